@@ -0,0 +1,44 @@
+// Command fakeidp is a throwaway OpenID Connect provider for trying single
+// sign-on locally. It signs in whoever submits its login form, so never
+// expose it beyond a development machine.
+//
+//	go run ./cmd/fakeidp -addr :9000
+//
+// and configure the server with
+//
+//	OIDC_PROVIDERS=dev
+//	OIDC_DEV_ISSUER=http://localhost:9000
+//	OIDC_DEV_CLIENT_ID=likemind
+//	OIDC_DEV_CLIENT_SECRET=secret
+//	OIDC_DEV_ROLE_CLAIM=groups
+//	OIDC_DEV_ROLE_MAP=admins=admin
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"likemind-backend/internal/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL clients use to reach this server")
+	clientID := flag.String("client-id", "likemind", "accepted client ID")
+	clientSecret := flag.String("client-secret", "secret", "accepted client secret; empty accepts public clients")
+	email := flag.String("email", "dev@example.com", "default email on the login form")
+	name := flag.String("name", "Dev User", "default name on the login form")
+	groups := flag.String("groups", "", "default groups on the login form")
+	flag.Parse()
+
+	s, err := oidctest.New(*issuer, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatal("Failed to start fake IdP:", err)
+	}
+	s.Defaults = oidctest.User{Email: *email, Name: *name, Groups: strings.Fields(*groups)}
+
+	log.Printf("Fake IdP %s listening on %s", s.Issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
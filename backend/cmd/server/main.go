@@ -1,14 +1,26 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"likemind-backend/internal/api"
+	"likemind-backend/internal/chunking"
 	"likemind-backend/internal/config"
+	"likemind-backend/internal/crawl"
 	"likemind-backend/internal/database"
+	"likemind-backend/internal/embedding"
+	"likemind-backend/internal/guardrails"
+	"likemind-backend/internal/jobs"
+	"likemind-backend/internal/mail"
 	"likemind-backend/internal/middleware"
+	"likemind-backend/internal/oidc"
+	"likemind-backend/internal/pii"
 	"likemind-backend/internal/services"
+	"likemind-backend/internal/vectordb"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -35,11 +47,182 @@ func main() {
 	}
 
 	// Initialize services
-	userService := services.NewUserService(db)
+	passwordPolicy, err := services.NewPasswordPolicy(cfg.PasswordMinLength, cfg.PasswordMinClasses, cfg.PasswordBreachedFile)
+	if err != nil {
+		log.Fatal("Invalid password policy:", err)
+	}
+	userService := services.NewUserService(db, passwordPolicy)
+	loginGuard := services.NewLoginGuard(redisClient, services.LoginGuardOptions{
+		MaxAccountFailures: cfg.LoginMaxAccountFailures,
+		MaxIPFailures:      cfg.LoginMaxIPFailures,
+		Window:             time.Duration(cfg.LoginFailureWindow) * time.Second,
+		Lockout:            time.Duration(cfg.LoginLockoutDuration) * time.Second,
+	})
+	twoFactorService, err := services.NewTwoFactorService(db, redisClient, loginGuard, cfg.JWTSecret, services.TwoFactorOptions{
+		Issuer:        cfg.TwoFactorIssuer,
+		RequiredRoles: cfg.TwoFactorRequiredRoles,
+		ChallengeTTL:  time.Duration(cfg.TwoFactorChallengeTTL) * time.Second,
+	})
+	if err != nil {
+		log.Fatal("Failed to initialize two-factor authentication:", err)
+	}
 	authService := services.NewAuthService(db, cfg.JWTSecret)
-	aiService := services.NewAIService(cfg.OpenAIAPIKey)
-	searchService := services.NewSearchService(cfg.VectorDBURL)
-	chatService := services.NewChatService(aiService, redisClient)
+	apiKeyService := services.NewAPIKeyService(db, time.Duration(cfg.APIKeyMaxTTLDays)*24*time.Hour)
+
+	// Embeddings come from an OpenAI-compatible API, or are computed locally
+	// when no API key is configured
+	var embedder embedding.Embedder
+	provider := cfg.EmbeddingProvider
+	if provider == "" {
+		provider = "local"
+		if cfg.OpenAIAPIKey != "" {
+			provider = "openai"
+		}
+	}
+	switch provider {
+	case "openai":
+		embedder = embedding.NewOpenAIEmbedder(embedding.OpenAIOptions{
+			BaseURL:   cfg.EmbeddingBaseURL,
+			APIKey:    cfg.OpenAIAPIKey,
+			Model:     cfg.EmbeddingModel,
+			Dimension: cfg.EmbeddingDimensions,
+			BatchSize: cfg.EmbeddingBatchSize,
+		})
+	case "local":
+		embedder = embedding.NewLocalEmbedder(cfg.EmbeddingDimensions)
+	default:
+		log.Fatal("Unknown EMBEDDING_PROVIDER:", provider)
+	}
+	if cfg.EmbeddingCacheTTL > 0 {
+		embedder = embedding.NewCachedEmbedder(embedder, redisClient, time.Duration(cfg.EmbeddingCacheTTL)*time.Hour)
+	}
+	cachePolicies, err := services.ParseCachePolicies(cfg.LLMCacheRoutes, time.Duration(cfg.LLMCacheTTL)*time.Second)
+	if err != nil {
+		log.Fatal("Invalid LLM_CACHE_ROUTES:", err)
+	}
+	responseCache := services.NewResponseCache(redisClient, embedder, services.ResponseCacheOptions{
+		Policies:   cachePolicies,
+		Threshold:  cfg.LLMCacheThreshold,
+		MaxEntries: cfg.LLMCacheMaxEntries,
+	})
+	guardrailPipeline, err := newGuardrailPipeline(cfg)
+	if err != nil {
+		log.Fatal("Invalid guardrail configuration:", err)
+	}
+	guardrailService := services.NewGuardrailService(db, guardrailPipeline)
+	var piiRedactor *pii.Redactor
+	if cfg.PIIRedaction {
+		piiTypes, err := pii.ParseTypes(cfg.PIITypes)
+		if err != nil {
+			log.Fatal("Invalid PII_TYPES:", err)
+		}
+		restoreTypes, err := pii.ParseTypes(cfg.PIIRestoreTypes)
+		if err != nil {
+			log.Fatal("Invalid PII_RESTORE_TYPES:", err)
+		}
+		piiRedactor = pii.NewRedactor(piiTypes, restoreTypes)
+	}
+	aiService := services.NewAIService(cfg.OpenAIAPIKey, embedder, services.LLMOptions{
+		Models:           cfg.LLMModels,
+		MaxRetries:       cfg.LLMMaxRetries,
+		Timeout:          time.Duration(cfg.LLMTimeout) * time.Second,
+		BreakerThreshold: cfg.LLMBreakerThreshold,
+		BreakerCooldown:  time.Duration(cfg.LLMBreakerCooldown) * time.Second,
+		Cache:            responseCache,
+		Guardrails:       guardrailService,
+		PII:              piiRedactor,
+	})
+	chunkStrategies, err := chunking.ParseStrategies(cfg.ChunkStrategies)
+	if err != nil {
+		log.Fatal("Invalid CHUNK_STRATEGIES:", err)
+	}
+	chunkConfig := chunking.Config{Size: cfg.ChunkSize, Overlap: cfg.ChunkOverlap, Strategies: chunkStrategies}
+
+	// Real-time event hub shared across replicas via Redis pub/sub
+	hub := api.NewHub(redisClient)
+	go hub.Run(context.Background())
+
+	// Versioned prompt templates referenced by chats, agents and generation
+	promptService := services.NewPromptService(db)
+
+	// Organizations and workspaces every tenant-owned record is scoped to
+	workspaceService := services.NewWorkspaceService(db)
+
+	// Single sign-on through OpenID Connect providers
+	oidcService := services.NewOIDCService(db, redisClient, services.OIDCOptions{
+		AutoProvision: cfg.OIDCAutoProvision,
+		LinkByEmail:   cfg.OIDCLinkByEmail,
+	})
+	for _, p := range cfg.OIDCProviders {
+		provider := oidc.NewProvider(oidc.Config{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  cfg.OIDCBaseURL + "/api/v1/auth/oidc/" + p.Name + "/callback",
+			Scopes:       p.Scopes,
+		}, nil)
+		if err := oidcService.AddProvider(provider, p.DisplayName, p.RoleClaim, p.RoleMap); err != nil {
+			log.Fatal("Invalid OIDC provider "+p.Name+":", err)
+		}
+	}
+
+	chatService := services.NewChatService(db, aiService, redisClient, hub, promptService)
+
+	// Background job queue backed by Redis
+	jobConfig := jobs.DefaultConfig()
+	jobConfig.MaxAttempts = cfg.JobMaxAttempts
+	jobPools, err := jobs.ParsePools(cfg.JobPools, cfg.JobWorkers)
+	if err != nil {
+		log.Fatal("Invalid JOB_POOLS:", err)
+	}
+	if jobConfig.Routes, err = jobs.ParseRoutes(cfg.JobRoutes, jobPools); err != nil {
+		log.Fatal("Invalid JOB_ROUTES:", err)
+	}
+	// Leases outlast an attempt so only jobs of stopped workers are reclaimed
+	jobQueue := jobs.NewQueue(jobs.NewRedisBackend(redisClient, 2*jobConfig.JobTimeout), jobConfig)
+
+	knowledgeService := services.NewKnowledgeService(db, jobQueue, cfg.MaxUploadSize, chunkConfig)
+
+	// Hybrid keyword and vector search over the knowledge base
+	searchService := services.NewSearchService(db, aiService, vectordb.NewClient(cfg.VectorDBURL), jobQueue, chunkConfig)
+
+	// Scheduled agent runs; every replica checks, Redis locks pick one to fire
+	agentService := services.NewAgentService(db, aiService, redisClient, jobQueue, promptService)
+	go agentService.RunScheduler(context.Background(), time.Duration(cfg.AgentSchedulerInterval)*time.Second)
+
+	// Web page ingestion with periodic conditional re-crawls
+	fetcher := crawl.NewFetcher(crawl.Options{
+		UserAgent:    cfg.CrawlUserAgent,
+		MaxBytes:     cfg.CrawlMaxSize,
+		AllowPrivate: cfg.CrawlAllowPrivate,
+	})
+	crawlService := services.NewCrawlService(db, redisClient, jobQueue, fetcher, services.CrawlOptions{
+		RecrawlInterval: time.Duration(cfg.CrawlRecrawlInterval) * time.Second,
+		MaxSitemapURLs:  cfg.CrawlMaxSitemapURLs,
+		Chunking:        chunkConfig,
+	})
+	go crawlService.RunRecrawler(context.Background(), time.Minute)
+
+	// Email verification and password reset mails, sent by the job queue
+	mailer, err := newMailer(cfg)
+	if err != nil {
+		log.Fatal("Invalid mailer configuration:", err)
+	}
+	mailTemplates, err := mail.LoadTemplates(cfg.MailTemplateDir)
+	if err != nil {
+		log.Fatal("Invalid mail templates:", err)
+	}
+	accountService := services.NewAccountService(db, redisClient, jobQueue, mailer, mailTemplates, cfg.JWTSecret, services.AccountOptions{
+		AppURL:              cfg.AppURL,
+		VerifyTTL:           time.Duration(cfg.EmailVerificationTTL) * time.Hour,
+		ResetTTL:            time.Duration(cfg.PasswordResetTTL) * time.Minute,
+		RequireVerification: cfg.EmailVerificationRequired,
+		Passwords:           passwordPolicy,
+	})
+
+	// Start workers once every service has registered its job handlers
+	jobQueue.Start(context.Background(), jobPools...)
 
 	// Initialize Gin router
 	if cfg.Environment == "production" {
@@ -47,7 +230,12 @@ func main() {
 	}
 
 	router := gin.New()
-	router.Use(gin.Logger())
+	// Client IPs key login limits, so forwarded headers are only believed
+	// from configured proxies
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+	router.Use(middleware.Logger())
 	router.Use(gin.Recovery())
 	router.Use(middleware.CORS())
 
@@ -56,30 +244,59 @@ func main() {
 	{
 		// Auth routes
 		auth := apiV1.Group("/auth")
-		api.RegisterAuthRoutes(auth, authService, userService)
+		api.RegisterAuthRoutes(auth, authService, userService, workspaceService, accountService, loginGuard, twoFactorService, cfg.PasswordLogin)
+		api.RegisterOIDCRoutes(auth.Group("/oidc"), oidcService, authService, workspaceService, accountService, twoFactorService, cfg.OIDCFrontendURL)
 
 		// Protected routes
 		protected := apiV1.Group("/")
-		protected.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+		protected.Use(middleware.AuthMiddleware(cfg.JWTSecret, apiKeyService, userService))
+		workspaceScope := middleware.WorkspaceScope(workspaceService)
 		{
 			// User routes
-			api.RegisterUserRoutes(protected.Group("/users"), userService)
+			api.RegisterUserRoutes(protected.Group("/users", middleware.RequireScope("users")), userService, loginGuard, twoFactorService)
+
+			// API key routes; keys cannot manage keys
+			api.RegisterAPIKeyRoutes(protected.Group("/users/me/api-keys", middleware.RequireSession()), apiKeyService)
+
+			// Two-factor settings, also session only
+			api.RegisterTwoFactorRoutes(protected.Group("/users/me/2fa", middleware.RequireSession()), twoFactorService, userService)
 
 			// AI routes
-			api.RegisterAIRoutes(protected.Group("/ai"), aiService)
+			api.RegisterAIRoutes(protected.Group("/ai", middleware.RequireScope("ai"), workspaceScope), aiService, promptService, cfg.AnalyzeMaxBatch, cfg.StructuredOutputRetries)
+
+			// Prompt template routes
+			api.RegisterPromptRoutes(protected.Group("/prompts", middleware.RequireScope("prompts")), promptService)
+
+			// Organization and workspace routes
+			api.RegisterOrganizationRoutes(protected.Group("/organizations", middleware.RequireScope("workspaces")), workspaceService)
+			api.RegisterWorkspaceRoutes(protected.Group("/workspaces", middleware.RequireScope("workspaces")), workspaceService, authService, userService)
 
 			// Chat routes
-			api.RegisterChatRoutes(protected.Group("/chat"), chatService)
+			api.RegisterChatRoutes(protected.Group("/chat", middleware.RequireScope("chat"), workspaceScope), chatService)
 
 			// Search routes
-			api.RegisterSearchRoutes(protected.Group("/search"), searchService)
+			api.RegisterSearchRoutes(protected.Group("/search", middleware.RequireScope("search"), workspaceScope), searchService)
 
 			// Knowledge routes
-			api.RegisterKnowledgeRoutes(protected.Group("/knowledge"), searchService)
+			api.RegisterKnowledgeRoutes(protected.Group("/knowledge", middleware.RequireScope("knowledge"), workspaceScope), knowledgeService, crawlService)
+
+			// Agent routes
+			api.RegisterAgentRoutes(protected.Group("/agents", middleware.RequireScope("agents"), workspaceScope), agentService)
+
+			// Guardrail review routes
+			api.RegisterGuardrailRoutes(protected.Group("/guardrails", middleware.RequireScope("guardrails")), guardrailService)
+
+			// Background job routes
+			api.RegisterJobRoutes(protected.Group("/jobs", middleware.RequireScope("jobs")), jobQueue)
 		}
 
+		// Public read-only shared sessions
+		api.RegisterSharedRoutes(apiV1.Group("/shared"), chatService)
+
 		// WebSocket routes
-		api.RegisterWebSocketRoutes(apiV1.Group("/ws"), chatService)
+		ws := apiV1.Group("/ws")
+		ws.Use(middleware.WebSocketAuth(cfg.JWTSecret, apiKeyService, userService), middleware.RequireScope("chat"))
+		api.RegisterWebSocketRoutes(ws, chatService, hub)
 	}
 
 	// Health check
@@ -98,3 +315,55 @@ func main() {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+// newMailer picks the configured Mailer
+func newMailer(cfg *config.Config) (mail.Mailer, error) {
+	switch cfg.Mailer {
+	case "log":
+		return mail.LogMailer{}, nil
+	case "file":
+		return mail.FileMailer{Dir: cfg.MailDir, From: cfg.MailFrom}, nil
+	case "smtp":
+		return mail.NewSMTPMailer(mail.SMTPOptions{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+			Security: cfg.SMTPSecurity,
+		})
+	}
+	return nil, fmt.Errorf("unknown MAILER %q", cfg.Mailer)
+}
+
+// newGuardrailPipeline assembles the configured input and output checks
+func newGuardrailPipeline(cfg *config.Config) (*guardrails.Pipeline, error) {
+	actions, err := guardrails.ParseActions(cfg.GuardrailActions)
+	if err != nil {
+		return nil, err
+	}
+
+	var checks []guardrails.Check
+	entries := cfg.GuardrailBlocklist
+	if cfg.GuardrailBlocklistFile != "" {
+		fileEntries, err := guardrails.LoadBlocklist(cfg.GuardrailBlocklistFile)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fileEntries...)
+	}
+	blocklist, err := guardrails.NewBlocklist(entries)
+	if err != nil {
+		return nil, err
+	}
+	if blocklist.Len() > 0 {
+		checks = append(checks, blocklist)
+	}
+	if cfg.GuardrailMaxInputLength > 0 || cfg.GuardrailMaxOutputLength > 0 {
+		checks = append(checks, guardrails.MaxLength{Input: cfg.GuardrailMaxInputLength, Output: cfg.GuardrailMaxOutputLength})
+	}
+	if cfg.GuardrailModeration {
+		checks = append(checks, guardrails.NewModeration(cfg.GuardrailModerationURL, cfg.OpenAIAPIKey, cfg.GuardrailModerationModel))
+	}
+	return guardrails.New(actions, checks...), nil
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"likemind-backend/internal/services"
+)
+
+// RegisterAgentRoutes exposes agents and their schedules
+func RegisterAgentRoutes(rg *gin.RouterGroup, agents *services.AgentService) {
+	rg.GET("", func(c *gin.Context) {
+		list, err := agents.ListAgents(c.Request.Context(), c.GetUint("workspace_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	})
+
+	rg.POST("", func(c *gin.Context) {
+		if !requireWorkspaceEditor(c) {
+			return
+		}
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		var payload struct {
+			Name        string               `json:"name" binding:"required"`
+			Description string               `json:"description"`
+			Config      services.AgentConfig `json:"config"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		agent, err := agents.CreateAgent(c.Request.Context(), c.GetUint("workspace_id"), userID, payload.Name, payload.Description, payload.Config)
+		if err != nil {
+			respondAgentError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, agent)
+	})
+
+	rg.POST("/:id/schedules", func(c *gin.Context) {
+		if !requireWorkspaceEditor(c) {
+			return
+		}
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		agentID, _ := strconv.Atoi(c.Param("id"))
+		var req services.ScheduleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		schedule, err := agents.CreateSchedule(c.Request.Context(), c.GetUint("workspace_id"), uint(agentID), userID, req)
+		if err != nil {
+			respondAgentError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, schedule)
+	})
+
+	rg.GET("/schedules", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		schedules, err := agents.ListSchedules(c.Request.Context(), c.GetUint("workspace_id"), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, schedules)
+	})
+
+	rg.POST("/schedules/:scheduleId/pause", func(c *gin.Context) {
+		setSchedulePaused(c, agents, true)
+	})
+
+	rg.POST("/schedules/:scheduleId/resume", func(c *gin.Context) {
+		setSchedulePaused(c, agents, false)
+	})
+
+	rg.POST("/schedules/:scheduleId/trigger", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		scheduleID, _ := strconv.Atoi(c.Param("scheduleId"))
+		run, err := agents.TriggerSchedule(c.Request.Context(), c.GetUint("workspace_id"), uint(scheduleID), userID)
+		if err != nil {
+			respondAgentError(c, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, run)
+	})
+
+	rg.GET("/schedules/:scheduleId/runs", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		scheduleID, _ := strconv.Atoi(c.Param("scheduleId"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if limit <= 0 || limit > 200 {
+			limit = 50
+		}
+		runs, err := agents.ListRuns(c.Request.Context(), c.GetUint("workspace_id"), uint(scheduleID), userID, limit)
+		if err != nil {
+			respondAgentError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, runs)
+	})
+
+	rg.DELETE("/schedules/:scheduleId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		scheduleID, _ := strconv.Atoi(c.Param("scheduleId"))
+		if err := agents.DeleteSchedule(c.Request.Context(), c.GetUint("workspace_id"), uint(scheduleID), userID); err != nil {
+			respondAgentError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
+
+func setSchedulePaused(c *gin.Context, agents *services.AgentService, paused bool) {
+	uid, _ := c.Get("user_id")
+	userID := uint(uid.(float64))
+	scheduleID, _ := strconv.Atoi(c.Param("scheduleId"))
+	schedule, err := agents.SetPaused(c.Request.Context(), c.GetUint("workspace_id"), uint(scheduleID), userID, paused)
+	if err != nil {
+		respondAgentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+// respondAgentError maps agent service errors to HTTP status codes
+func respondAgentError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrAgentNotFound), errors.Is(err, services.ErrScheduleNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidSchedule):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrPromptNotFound), errors.Is(err, services.ErrInvalidPrompt):
+		respondPromptError(c, err)
+		return
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
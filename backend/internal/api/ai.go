@@ -1,30 +1,192 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 
+	"likemind-backend/internal/jsonschema"
 	"likemind-backend/internal/models"
 	"likemind-backend/internal/services"
 )
 
-// RegisterAIRoutes exposes a simple AI generation endpoint
-func RegisterAIRoutes(rg *gin.RouterGroup, ai *services.AIService) {
+// RegisterAIRoutes exposes generation and text analysis endpoints
+func RegisterAIRoutes(rg *gin.RouterGroup, ai *services.AIService, prompts *services.PromptService, maxAnalyzeBatch, maxStructuredRetries int) {
+	// With a "schema" the reply is a JSON object validated against it; a
+	// "prompt" template reference becomes the system message
 	rg.POST("/generate", func(c *gin.Context) {
 		var payload struct {
-			Message string `json:"message"`
+			Message    string              `json:"message"`
+			Schema     json.RawMessage     `json:"schema"`
+			MaxRetries *int                `json:"max_retries"`
+			Prompt     *services.PromptRef `json:"prompt"`
 		}
 		if err := c.ShouldBindJSON(&payload); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 		msg := []models.ChatMessage{{Role: "user", Content: payload.Message}}
-		resp, err := ai.GenerateResponse(c.Request.Context(), msg)
+		system, err := prompts.SystemMessage(c.Request.Context(), payload.Prompt)
+		if err != nil {
+			respondPromptError(c, err)
+			return
+		}
+		if system != nil {
+			msg = append([]models.ChatMessage{*system}, msg...)
+		}
+
+		uid, _ := c.Get("user_id")
+		ctx := services.WithGuardrailSubject(c.Request.Context(), uint(uid.(float64)), 0)
+		if len(payload.Schema) == 0 {
+			scope := services.CacheScope{WorkspaceID: c.GetUint("workspace_id")}
+			resp, err := ai.GenerateResponse(services.WithCacheRoute(ctx, services.CacheRouteGenerate, scope), msg)
+			if err != nil {
+				respondLLMError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, resp)
+			return
+		}
+
+		schema, err := jsonschema.Compile(payload.Schema)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		retries := maxStructuredRetries
+		if payload.MaxRetries != nil {
+			if *payload.MaxRetries < 0 || *payload.MaxRetries > maxStructuredRetries {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("max_retries must be between 0 and %d", maxStructuredRetries)})
+				return
+			}
+			retries = *payload.MaxRetries
+		}
+
+		result, err := ai.GenerateStructured(ctx, msg, schema, string(payload.Schema), retries)
+		if err != nil {
+			var structErr *services.StructuredOutputError
+			if errors.As(err, &structErr) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{
+					"error":    structErr.Error(),
+					"attempts": structErr.Attempts,
+					"errors":   structErr.Errors,
+					"content":  structErr.Content,
+				})
+				return
+			}
+			respondLLMError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
+	// Drops cached responses for one "route", or all of them
+	rg.DELETE("/cache", func(c *gin.Context) {
+		if role, _ := c.Get("role"); role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			return
+		}
+		deleted, err := ai.InvalidateCache(c.Request.Context(), c.Query("route"))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, resp)
+		c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+	})
+
+	// Accepts a single "text" or a batch of "texts"
+	rg.POST("/analyze", func(c *gin.Context) {
+		var payload struct {
+			Text  string   `json:"text"`
+			Texts []string `json:"texts"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		uid, _ := c.Get("user_id")
+		ctx := services.WithGuardrailSubject(c.Request.Context(), uint(uid.(float64)), 0)
+		if len(payload.Texts) == 0 {
+			analysis, err := ai.AnalyzeText(ctx, payload.Text)
+			if err != nil {
+				respondAnalysisError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, analysis)
+			return
+		}
+
+		if payload.Text != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "send either text or texts, not both"})
+			return
+		}
+		if len(payload.Texts) > maxAnalyzeBatch {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d texts per request", maxAnalyzeBatch)})
+			return
+		}
+		results, err := ai.AnalyzeBatch(ctx, payload.Texts)
+		if err != nil {
+			respondAnalysisError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"results": results})
 	})
 }
+
+// respondLLMError maps model failures and guardrail blocks to statuses,
+// passing on how long a rate-limited client should wait
+func respondLLMError(c *gin.Context, err error) {
+	status, ok := llmErrorStatus(err)
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	var guardErr *services.GuardrailError
+	if errors.As(err, &guardErr) {
+		c.JSON(status, gin.H{"error": err.Error(), "stage": guardErr.Stage, "violations": guardErr.Violations})
+		return
+	}
+	var llmErr *services.LLMError
+	if errors.As(err, &llmErr) && llmErr.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(llmErr.RetryAfter.Seconds()))))
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+func llmErrorStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, services.ErrInputBlocked):
+		return http.StatusBadRequest, true
+	case errors.Is(err, services.ErrOutputBlocked):
+		return http.StatusUnprocessableEntity, true
+	case errors.Is(err, services.ErrLLMRateLimited):
+		return http.StatusTooManyRequests, true
+	case errors.Is(err, services.ErrLLMContextLength):
+		return http.StatusRequestEntityTooLarge, true
+	case errors.Is(err, services.ErrLLMOverloaded), errors.Is(err, services.ErrLLMUnavailable):
+		return http.StatusServiceUnavailable, true
+	case errors.Is(err, services.ErrLLMTimeout):
+		return http.StatusGatewayTimeout, true
+	case errors.Is(err, services.ErrLLMAuth):
+		return http.StatusBadGateway, true
+	}
+	return 0, false
+}
+
+func respondAnalysisError(c *gin.Context, err error) {
+	var guardErr *services.GuardrailError
+	if errors.As(err, &guardErr) {
+		respondLLMError(c, err)
+		return
+	}
+	status := http.StatusInternalServerError
+	if errors.Is(err, services.ErrEmptyText) {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
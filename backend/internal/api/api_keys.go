@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"likemind-backend/internal/services"
+)
+
+// RegisterAPIKeyRoutes exposes the current user's API keys
+func RegisterAPIKeyRoutes(rg *gin.RouterGroup, apiKeys *services.APIKeyService) {
+	rg.GET("", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		keys, err := apiKeys.ListAPIKeys(c.Request.Context(), userID)
+		if err != nil {
+			respondAPIKeyError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+	})
+
+	// The key is only ever shown in this response
+	rg.POST("", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		var req services.APIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		key, secret, err := apiKeys.CreateAPIKey(c.Request.Context(), userID, req)
+		if err != nil {
+			respondAPIKeyError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"api_key": key, "key": secret})
+	})
+
+	rg.DELETE("/:id", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		if err := apiKeys.RevokeAPIKey(c.Request.Context(), userID, uint(id)); err != nil {
+			respondAPIKeyError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
+
+// respondAPIKeyError maps API key errors to HTTP status codes
+func respondAPIKeyError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrAPIKeyNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidScope), errors.Is(err, services.ErrInvalidExpiry),
+		errors.Is(err, services.ErrNameRequired):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrWorkspaceNotFound):
+		status = http.StatusForbidden
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
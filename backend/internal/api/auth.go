@@ -1,10 +1,16 @@
 package api
 
 import (
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"likemind-backend/internal/models"
 	"likemind-backend/internal/services"
 )
 
@@ -19,8 +25,73 @@ type loginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// RegisterAuthRoutes registers authentication endpoints
-func RegisterAuthRoutes(rg *gin.RouterGroup, auth *services.AuthService, users *services.UserService) {
+type emailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type twoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// RegisterAuthRoutes registers authentication endpoints. passwordLogin
+// false leaves sign-in to single sign-on.
+func RegisterAuthRoutes(rg *gin.RouterGroup, auth *services.AuthService, users *services.UserService, workspaces *services.WorkspaceService, accounts *services.AccountService, guard *services.LoginGuard, twoFactor *services.TwoFactorService, passwordLogin bool) {
+	// The second step of password and single sign-on logins alike.
+	// Setup enrolls a user whose role requires 2FA during their first login.
+	rg.POST("/2fa/setup", func(c *gin.Context) {
+		var req struct {
+			ChallengeToken string `json:"challenge_token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		enrollment, err := twoFactor.SetupChallenge(c.Request.Context(), req.ChallengeToken)
+		if err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, enrollment)
+	})
+
+	// Accepts an authenticator code or a recovery code
+	rg.POST("/2fa/verify", func(c *gin.Context) {
+		var req twoFactorLoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, codes, err := twoFactor.CompleteLogin(c.Request.Context(), req.ChallengeToken, req.Code, c.ClientIP())
+		if err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+		if err := guard.Succeed(c.Request.Context(), user.Email); err != nil {
+			log.Printf("auth: %v", err)
+		}
+		token, workspaceID, err := sessionToken(c, auth, workspaces, user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		resp := gin.H{"token": token, "workspace_id": workspaceID}
+		// Set when setup finished during this login; shown only once
+		if codes != nil {
+			resp["recovery_codes"] = codes
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	if !passwordLogin {
+		return
+	}
+
 	rg.POST("/register", func(c *gin.Context) {
 		var req registerRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -32,12 +103,15 @@ func RegisterAuthRoutes(rg *gin.RouterGroup, auth *services.AuthService, users *
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		token, err := auth.GenerateToken(user)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// The account exists either way; the user can ask for a new email
+		if err := accounts.SendVerification(c.Request.Context(), user); err != nil {
+			log.Printf("account: failed to send verification to user %d: %v", user.ID, err)
+		}
+		if accounts.RequiresVerification() {
+			c.JSON(http.StatusCreated, gin.H{"user": user, "verification_required": true})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"token": token})
+		issueToken(c, auth, workspaces, user)
 	})
 
 	rg.POST("/login", func(c *gin.Context) {
@@ -46,16 +120,175 @@ func RegisterAuthRoutes(rg *gin.RouterGroup, auth *services.AuthService, users *
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		user, err := users.ValidateCredentials(req.Email, req.Password)
+		ctx := c.Request.Context()
+		// Limits fail open: a Redis outage should not stop everyone signing in
+		wait, err := guard.Reserve(ctx, req.Email, c.ClientIP())
 		if err != nil {
+			log.Printf("auth: %v", err)
+		} else if wait > 0 {
+			respondTooManyAttempts(c, wait)
+			return
+		}
+
+		user, err := users.ValidateCredentials(req.Email, req.Password)
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			wait, guardErr := guard.Fail(ctx, req.Email, c.ClientIP())
+			if guardErr != nil {
+				log.Printf("auth: %v", guardErr)
+			}
+			if wait > 0 {
+				c.Header("Retry-After", retryAfterSeconds(wait))
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 			return
 		}
-		token, err := auth.GenerateToken(user)
+		// The password was right, or could not be checked; either way the
+		// attempt does not count against the account
+		if guardErr := guard.Refund(ctx, req.Email, c.ClientIP()); guardErr != nil {
+			log.Printf("auth: %v", guardErr)
+		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondAccountError(c, err)
+			return
+		}
+		if err := accounts.CheckSignIn(user); err != nil {
+			respondAccountError(c, err)
+			return
+		}
+		challenge, err := twoFactor.BeginLogin(ctx, user)
+		if err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+		// Failures are only cleared once the second factor is in too, so
+		// knowing the password cannot reset wrong codes
+		if challenge != nil {
+			c.JSON(http.StatusOK, challengeResponse(challenge))
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"token": token})
+		if err := guard.Succeed(ctx, user.Email); err != nil {
+			log.Printf("auth: %v", err)
+		}
+		issueToken(c, auth, workspaces, user)
 	})
+
+	rg.POST("/verify", func(c *gin.Context) {
+		var req struct {
+			Token string `json:"token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, err := accounts.VerifyEmail(c.Request.Context(), req.Token)
+		if err != nil {
+			respondAccountError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, user)
+	})
+
+	// Accepted whether or not the email belongs to an account
+	rg.POST("/verify/resend", func(c *gin.Context) {
+		var req emailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := accounts.ResendVerification(c.Request.Context(), req.Email); err != nil {
+			respondAccountError(c, err)
+			return
+		}
+		c.Status(http.StatusAccepted)
+	})
+
+	// Accepted whether or not the email belongs to an account
+	rg.POST("/forgot-password", func(c *gin.Context) {
+		var req emailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := accounts.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+			respondAccountError(c, err)
+			return
+		}
+		c.Status(http.StatusAccepted)
+	})
+
+	rg.POST("/reset-password", func(c *gin.Context) {
+		var req resetPasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, err := accounts.ResetPassword(c.Request.Context(), req.Token, req.Password)
+		if err != nil {
+			respondAccountError(c, err)
+			return
+		}
+		// The reset revoked the user's sessions
+		users.Forget(user.ID)
+		// Whoever reset the password can read the account's email, so any
+		// lockout from guessing is lifted
+		if err := guard.Unlock(c.Request.Context(), user.Email); err != nil {
+			log.Printf("auth: %v", err)
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
+
+func respondAccountError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrInvalidToken), errors.Is(err, services.ErrWeakPassword):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrEmailNotVerified), errors.Is(err, services.ErrAccountDisabled):
+		status = http.StatusForbidden
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+func respondTooManyAttempts(c *gin.Context, wait time.Duration) {
+	seconds := retryAfterSeconds(wait)
+	c.Header("Retry-After", seconds)
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed login attempts, try again in " + seconds + " seconds"})
+}
+
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+// challengeResponse describes the second login step. The client finishes
+// with /2fa/verify, after /2fa/setup when setup_required is set.
+func challengeResponse(challenge *services.LoginChallenge) gin.H {
+	return gin.H{
+		"two_factor_required": true,
+		"challenge_token":     challenge.Token,
+		"setup_required":      challenge.SetupRequired,
+		"expires_at":          challenge.ExpiresAt,
+	}
+}
+
+// issueToken responds with a token whose active workspace is the user's
+// first, creating a personal workspace on first login
+func issueToken(c *gin.Context, auth *services.AuthService, workspaces *services.WorkspaceService, user *models.User) {
+	token, workspaceID, err := sessionToken(c, auth, workspaces, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": token, "workspace_id": workspaceID})
+}
+
+func sessionToken(c *gin.Context, auth *services.AuthService, workspaces *services.WorkspaceService, user *models.User) (string, uint, error) {
+	workspaceID, _, err := workspaces.ResolveWorkspace(c.Request.Context(), user.ID, 0)
+	if err != nil {
+		return "", 0, err
+	}
+	token, err := auth.GenerateToken(user, workspaceID)
+	if err != nil {
+		return "", 0, err
+	}
+	return token, workspaceID, nil
 }
@@ -1,8 +1,11 @@
 package api
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -14,7 +17,7 @@ func RegisterChatRoutes(rg *gin.RouterGroup, chat *services.ChatService) {
 	rg.GET("/sessions", func(c *gin.Context) {
 		uid, _ := c.Get("user_id")
 		userID := uint(uid.(float64))
-		sessions, err := chat.GetUserSessions(c.Request.Context(), userID)
+		sessions, err := chat.GetUserSessions(c.Request.Context(), c.GetUint("workspace_id"), userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -26,22 +29,29 @@ func RegisterChatRoutes(rg *gin.RouterGroup, chat *services.ChatService) {
 		uid, _ := c.Get("user_id")
 		userID := uint(uid.(float64))
 		var payload struct {
-			Title string `json:"title"`
+			Title  string              `json:"title"`
+			Prompt *services.PromptRef `json:"prompt"`
 		}
 		if err := c.ShouldBindJSON(&payload); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		session, err := chat.CreateSession(c.Request.Context(), userID, payload.Title)
+		session, err := chat.CreateSession(c.Request.Context(), c.GetUint("workspace_id"), userID, payload.Title, payload.Prompt)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondChatError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, session)
 	})
 
 	rg.GET("/sessions/:id/messages", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
 		sid, _ := strconv.Atoi(c.Param("id"))
+		if _, err := chat.SessionRole(c.Request.Context(), uint(sid), userID); err != nil {
+			respondChatError(c, err)
+			return
+		}
 		msgs, err := chat.GetSessionMessages(c.Request.Context(), uint(sid))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -51,6 +61,8 @@ func RegisterChatRoutes(rg *gin.RouterGroup, chat *services.ChatService) {
 	})
 
 	rg.POST("/sessions/:id/messages", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
 		sid, _ := strconv.Atoi(c.Param("id"))
 		var payload struct {
 			Message string `json:"message"`
@@ -59,11 +71,122 @@ func RegisterChatRoutes(rg *gin.RouterGroup, chat *services.ChatService) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		msg, err := chat.SendMessage(c.Request.Context(), uint(sid), payload.Message)
+		msg, err := chat.SendMessage(c.Request.Context(), uint(sid), userID, payload.Message)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondChatError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, msg)
 	})
+
+	rg.POST("/sessions/:id/share", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		sid, _ := strconv.Atoi(c.Param("id"))
+		var payload struct {
+			ExpiresInHours int `json:"expires_in_hours" binding:"min=0"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ttl := time.Duration(payload.ExpiresInHours) * time.Hour
+		link, token, err := chat.CreateShareLink(c.Request.Context(), uint(sid), userID, ttl)
+		if err != nil {
+			respondChatError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"share": link, "token": token, "path": "/api/v1/shared/" + token})
+	})
+
+	rg.GET("/sessions/:id/shares", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		sid, _ := strconv.Atoi(c.Param("id"))
+		links, err := chat.GetShareLinks(c.Request.Context(), uint(sid), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, links)
+	})
+
+	rg.DELETE("/sessions/:id/shares/:shareId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		sid, _ := strconv.Atoi(c.Param("id"))
+		linkID, _ := strconv.Atoi(c.Param("shareId"))
+		if err := chat.RevokeShareLink(c.Request.Context(), uint(sid), uint(linkID), userID); err != nil {
+			respondChatError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	rg.GET("/sessions/:id/participants", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		sid, _ := strconv.Atoi(c.Param("id"))
+		participants, err := chat.GetParticipants(c.Request.Context(), uint(sid), userID)
+		if err != nil {
+			respondChatError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, participants)
+	})
+
+	rg.PUT("/sessions/:id/participants/:userId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		sid, _ := strconv.Atoi(c.Param("id"))
+		targetID, _ := strconv.Atoi(c.Param("userId"))
+		var payload struct {
+			Role string `json:"role" binding:"required,oneof=editor viewer"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		participant, err := chat.SetParticipant(c.Request.Context(), uint(sid), userID, uint(targetID), payload.Role)
+		if err != nil {
+			respondChatError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, participant)
+	})
+
+	rg.DELETE("/sessions/:id/participants/:userId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		sid, _ := strconv.Atoi(c.Param("id"))
+		targetID, _ := strconv.Atoi(c.Param("userId"))
+		if err := chat.RemoveParticipant(c.Request.Context(), uint(sid), userID, uint(targetID)); err != nil {
+			respondChatError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
+
+// respondChatError maps chat service errors to HTTP status codes
+func respondChatError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound), errors.Is(err, services.ErrShareLinkNotFound),
+		errors.Is(err, services.ErrParticipantNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrPermissionDenied):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrInvalidRole):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrPromptNotFound), errors.Is(err, services.ErrInvalidPrompt):
+		respondPromptError(c, err)
+		return
+	default:
+		if _, ok := llmErrorStatus(err); ok {
+			respondLLMError(c, err)
+			return
+		}
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
 }
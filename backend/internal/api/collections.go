@@ -0,0 +1,128 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"likemind-backend/internal/services"
+)
+
+// registerCollectionRoutes exposes knowledge collections and their grants
+func registerCollectionRoutes(rg *gin.RouterGroup, knowledge *services.KnowledgeService) {
+	rg.GET("", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		collections, err := knowledge.ListCollections(c.Request.Context(), c.GetUint("workspace_id"), userID)
+		if err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"collections": collections})
+	})
+
+	rg.POST("", func(c *gin.Context) {
+		if !requireWorkspaceEditor(c) {
+			return
+		}
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		var req services.CollectionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		collection, err := knowledge.CreateCollection(c.Request.Context(), c.GetUint("workspace_id"), userID, req)
+		if err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, collection)
+	})
+
+	rg.GET("/:id", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		collection, err := knowledge.GetCollection(c.Request.Context(), userID, uint(id))
+		if err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, collection)
+	})
+
+	rg.PUT("/:id", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		var req services.CollectionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		collection, err := knowledge.UpdateCollection(c.Request.Context(), userID, uint(id), req)
+		if err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, collection)
+	})
+
+	rg.DELETE("/:id", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		if err := knowledge.DeleteCollection(c.Request.Context(), userID, uint(id)); err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	rg.GET("/:id/grants", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		grants, err := knowledge.ListGrants(c.Request.Context(), userID, uint(id))
+		if err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"grants": grants})
+	})
+
+	// :type is user or group
+	rg.PUT("/:id/grants/:type/:principalId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		principalID, _ := strconv.Atoi(c.Param("principalId"))
+		var payload struct {
+			Permission string `json:"permission" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		grant, err := knowledge.SetGrant(c.Request.Context(), userID, uint(id), c.Param("type"), uint(principalID), payload.Permission)
+		if err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, grant)
+	})
+
+	rg.DELETE("/:id/grants/:type/:principalId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		principalID, _ := strconv.Atoi(c.Param("principalId"))
+		if err := knowledge.RemoveGrant(c.Request.Context(), userID, uint(id), c.Param("type"), uint(principalID)); err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
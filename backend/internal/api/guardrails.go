@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"likemind-backend/internal/services"
+)
+
+// RegisterGuardrailRoutes exposes guardrail violations for admin review
+func RegisterGuardrailRoutes(rg *gin.RouterGroup, guard *services.GuardrailService) {
+	rg.Use(func(c *gin.Context) {
+		if role, _ := c.Get("role"); role != "admin" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			return
+		}
+		c.Next()
+	})
+
+	// Filters: status, stage, check, user_id; paginated with limit and offset
+	rg.GET("/violations", func(c *gin.Context) {
+		userID, _ := strconv.Atoi(c.Query("user_id"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		violations, total, err := guard.ListViolations(c.Request.Context(), services.ViolationFilter{
+			Status: c.Query("status"),
+			Stage:  c.Query("stage"),
+			Check:  c.Query("check"),
+			UserID: uint(userID),
+			Limit:  limit,
+			Offset: offset,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"violations": violations, "total": total})
+	})
+
+	rg.POST("/violations/:id/review", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		reviewerID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		var payload struct {
+			Status string `json:"status" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		violation, err := guard.ReviewViolation(c.Request.Context(), uint(id), reviewerID, payload.Status)
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, services.ErrViolationNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, services.ErrInvalidReviewStatus):
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, violation)
+	})
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"likemind-backend/internal/services"
+)
+
+const (
+	// hubChannel is the Redis pub/sub channel shared by every backend replica
+	hubChannel = "likemind:ws:events"
+	// presenceTTL bounds how long a connection counts as present without a heartbeat
+	presenceTTL = 2 * wsPongWait
+)
+
+// Hub tracks WebSocket connections per user and per session on this instance
+// and bridges events between replicas over Redis pub/sub. Every event is
+// published to Redis and delivered locally only when it comes back from the
+// subscription, so all replicas observe the same stream.
+type Hub struct {
+	redisClient *redis.Client
+
+	mu        sync.RWMutex
+	clients   map[*wsClient]struct{}
+	byUser    map[uint]map[*wsClient]struct{}
+	bySession map[uint]map[*wsClient]struct{}
+}
+
+// NewHub creates a hub; with a nil Redis client events are only delivered in-process
+func NewHub(redisClient *redis.Client) *Hub {
+	return &Hub{
+		redisClient: redisClient,
+		clients:     make(map[*wsClient]struct{}),
+		byUser:      make(map[uint]map[*wsClient]struct{}),
+		bySession:   make(map[uint]map[*wsClient]struct{}),
+	}
+}
+
+// Run consumes the Redis channel until ctx is cancelled
+func (h *Hub) Run(ctx context.Context) {
+	if h.redisClient == nil {
+		return
+	}
+
+	sub := h.redisClient.Subscribe(ctx, hubChannel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			h.dispatch([]byte(msg.Payload))
+		}
+	}
+}
+
+// Publish implements services.EventPublisher
+func (h *Hub) Publish(ctx context.Context, event services.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if h.redisClient == nil {
+		h.dispatch(payload)
+		return nil
+	}
+
+	if err := h.redisClient.Publish(ctx, hubChannel, payload).Err(); err != nil {
+		// Keep local subscribers working while Redis is unavailable
+		h.dispatch(payload)
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+
+	return nil
+}
+
+func (h *Hub) dispatch(payload []byte) {
+	var route struct {
+		Type      string `json:"type"`
+		UserID    uint   `json:"user_id"`
+		SessionID uint   `json:"session_id"`
+	}
+	if err := json.Unmarshal(payload, &route); err != nil {
+		log.Printf("hub: dropping malformed event: %v", err)
+		return
+	}
+
+	h.mu.RLock()
+	targets := make(map[*wsClient]struct{})
+	for c := range h.byUser[route.UserID] {
+		targets[c] = struct{}{}
+	}
+	for c := range h.bySession[route.SessionID] {
+		targets[c] = struct{}{}
+	}
+
+	var slow []*wsClient
+	for c := range targets {
+		select {
+		case c.send <- payload:
+		default:
+			slow = append(slow, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range slow {
+		h.unregister(c)
+	}
+
+	// A removed participant must stop receiving the session's events on every replica
+	if route.Type == services.EventParticipantRemoved {
+		h.mu.RLock()
+		var removed []*wsClient
+		for c := range h.byUser[route.UserID] {
+			if _, ok := c.sessions[route.SessionID]; ok {
+				removed = append(removed, c)
+			}
+		}
+		h.mu.RUnlock()
+
+		for _, c := range removed {
+			h.unsubscribe(c, route.SessionID)
+			h.leavePresence(context.Background(), c, route.SessionID)
+		}
+	}
+}
+
+func (h *Hub) register(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.clients[c] = struct{}{}
+	addClient(h.byUser, c.userID, c)
+}
+
+func (h *Hub) unregister(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	delete(h.clients, c)
+	removeClient(h.byUser, c.userID, c)
+	for sessionID := range c.sessions {
+		removeClient(h.bySession, sessionID, c)
+	}
+	close(c.send)
+}
+
+func (h *Hub) subscribe(c *wsClient, sessionID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	c.sessions[sessionID] = struct{}{}
+	addClient(h.bySession, sessionID, c)
+}
+
+func (h *Hub) unsubscribe(c *wsClient, sessionID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(c.sessions, sessionID)
+	removeClient(h.bySession, sessionID, c)
+}
+
+func addClient(index map[uint]map[*wsClient]struct{}, key uint, c *wsClient) {
+	set, ok := index[key]
+	if !ok {
+		set = make(map[*wsClient]struct{})
+		index[key] = set
+	}
+	set[c] = struct{}{}
+}
+
+func removeClient(index map[uint]map[*wsClient]struct{}, key uint, c *wsClient) {
+	set, ok := index[key]
+	if !ok {
+		return
+	}
+	delete(set, c)
+	if len(set) == 0 {
+		delete(index, key)
+	}
+}
+
+// sessionsOf returns the sessions a client is currently subscribed to
+func (h *Hub) sessionsOf(c *wsClient) []uint {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	sessions := make([]uint, 0, len(c.sessions))
+	for sessionID := range c.sessions {
+		sessions = append(sessions, sessionID)
+	}
+	return sessions
+}
+
+func presenceKey(sessionID uint) string {
+	return fmt.Sprintf("chat:presence:%d", sessionID)
+}
+
+// joinPresence records the connection as present in a session and announces it
+func (h *Hub) joinPresence(ctx context.Context, c *wsClient, sessionID uint) {
+	if h.redisClient != nil {
+		key := presenceKey(sessionID)
+		h.redisClient.ZAdd(ctx, key, redis.Z{Score: float64(time.Now().Unix()), Member: c.presenceMember()})
+		h.redisClient.Expire(ctx, key, presenceTTL)
+	}
+	h.announcePresence(ctx, sessionID, c.userID, "online")
+}
+
+// leavePresence removes the connection from a session's presence set and announces it
+func (h *Hub) leavePresence(ctx context.Context, c *wsClient, sessionID uint) {
+	if h.redisClient != nil {
+		h.redisClient.ZRem(ctx, presenceKey(sessionID), c.presenceMember())
+	}
+	h.announcePresence(ctx, sessionID, c.userID, "offline")
+}
+
+// refreshPresence extends the heartbeat of every session the client is in
+func (h *Hub) refreshPresence(ctx context.Context, c *wsClient) {
+	if h.redisClient == nil {
+		return
+	}
+	now := float64(time.Now().Unix())
+	for _, sessionID := range h.sessionsOf(c) {
+		key := presenceKey(sessionID)
+		h.redisClient.ZAdd(ctx, key, redis.Z{Score: now, Member: c.presenceMember()})
+		h.redisClient.Expire(ctx, key, presenceTTL)
+	}
+}
+
+// onlineUsers lists the distinct users connected to a session across all replicas
+func (h *Hub) onlineUsers(ctx context.Context, sessionID uint) []uint {
+	seen := make(map[uint]struct{})
+
+	if h.redisClient != nil {
+		key := presenceKey(sessionID)
+		cutoff := strconv.FormatInt(time.Now().Add(-presenceTTL).Unix(), 10)
+		h.redisClient.ZRemRangeByScore(ctx, key, "-inf", "("+cutoff)
+		members, err := h.redisClient.ZRange(ctx, key, 0, -1).Result()
+		if err == nil {
+			for _, member := range members {
+				userPart, _, _ := strings.Cut(member, ":")
+				if id, err := strconv.ParseUint(userPart, 10, 64); err == nil {
+					seen[uint(id)] = struct{}{}
+				}
+			}
+		}
+	} else {
+		h.mu.RLock()
+		for c := range h.bySession[sessionID] {
+			seen[c.userID] = struct{}{}
+		}
+		h.mu.RUnlock()
+	}
+
+	users := make([]uint, 0, len(seen))
+	for id := range seen {
+		users = append(users, id)
+	}
+	return users
+}
+
+func (h *Hub) announcePresence(ctx context.Context, sessionID, userID uint, status string) {
+	h.Publish(ctx, services.Event{
+		Type:      services.EventPresence,
+		SessionID: sessionID,
+		Data: map[string]interface{}{
+			"user_id": userID,
+			"status":  status,
+			"online":  h.onlineUsers(ctx, sessionID),
+		},
+	})
+}
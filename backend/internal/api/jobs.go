@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"likemind-backend/internal/jobs"
+)
+
+// RegisterJobRoutes exposes background job status
+func RegisterJobRoutes(rg *gin.RouterGroup, queue *jobs.Queue) {
+	rg.GET("/dead", func(c *gin.Context) {
+		if role, _ := c.Get("role"); role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			return
+		}
+		dead, err := queue.DeadLetters(c.Request.Context(), 100)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, dead)
+	})
+
+	rg.GET("/:id", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		role, _ := c.Get("role")
+
+		job, err := queue.Get(c.Request.Context(), c.Param("id"))
+		if errors.Is(err, jobs.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// Jobs are only visible to the user who created them
+		if job.UserID != userID && role != "admin" {
+			c.JSON(http.StatusNotFound, gin.H{"error": jobs.ErrJobNotFound.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	})
+}
@@ -1,11 +1,331 @@
 package api
 
-import "github.com/gin-gonic/gin"
-import "likemind-backend/internal/services"
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"likemind-backend/internal/chunking"
+	"likemind-backend/internal/crawl"
+	"likemind-backend/internal/extract"
+	"likemind-backend/internal/models"
+	"likemind-backend/internal/services"
+)
+
+// maxUploadFiles bounds the files of one multipart upload; each may be up
+// to the upload size limit
+const maxUploadFiles = 20
+
+// RegisterKnowledgeRoutes exposes knowledge base documents, file uploads and
+// web page ingestion
+func RegisterKnowledgeRoutes(rg *gin.RouterGroup, knowledge *services.KnowledgeService, crawler *services.CrawlService) {
+	registerCollectionRoutes(rg.Group("/collections"), knowledge)
 
-// RegisterKnowledgeRoutes is a placeholder
-func RegisterKnowledgeRoutes(rg *gin.RouterGroup, _ *services.SearchService) {
 	rg.GET("/documents", func(c *gin.Context) {
-		c.JSON(200, gin.H{"message": "list documents"})
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		collectionID, _ := strconv.Atoi(c.Query("collection_id"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if limit <= 0 || limit > 100 {
+			limit = 20
+		}
+		if offset < 0 {
+			offset = 0
+		}
+		docs, total, err := knowledge.ListDocuments(c.Request.Context(), c.GetUint("workspace_id"), userID, uint(collectionID), limit, offset)
+		if err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"documents": docs, "total": total, "limit": limit, "offset": offset})
+	})
+
+	rg.GET("/documents/:id", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		doc, err := knowledge.GetDocument(c.Request.Context(), userID, uint(id))
+		if err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, doc)
+	})
+
+	rg.GET("/documents/:id/chunks", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		chunks, err := knowledge.GetChunks(c.Request.Context(), userID, uint(id))
+		if err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"chunks": chunks})
+	})
+
+	// Shows how a multipart "file" or a JSON "text" would be chunked;
+	// strategy, size and overlap override the per-type defaults
+	rg.POST("/chunks/preview", func(c *gin.Context) {
+		var override services.ChunkOverride
+
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, knowledge.MaxUploadSize()+1<<20)
+			fh, err := c.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "no file provided"})
+				return
+			}
+			override.Strategy = chunking.Strategy(c.PostForm("strategy"))
+			if override.Size, err = formInt(c, "size"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if override.Overlap, err = formInt(c, "overlap"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			data, err := readUpload(fh, knowledge.MaxUploadSize())
+			if err != nil {
+				respondKnowledgeError(c, err)
+				return
+			}
+			preview, err := knowledge.PreviewFile(fh.Filename, data, override)
+			if err != nil {
+				respondKnowledgeError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, preview)
+			return
+		}
+
+		var req struct {
+			Text         string `json:"text" binding:"required"`
+			DocumentType string `json:"document_type"`
+			services.ChunkOverride
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.DocumentType == "" {
+			req.DocumentType = extract.TypeText
+		}
+		preview, err := knowledge.PreviewText(req.Text, req.DocumentType, req.ChunkOverride)
+		if err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, preview)
+	})
+
+	rg.DELETE("/documents/:id", func(c *gin.Context) {
+		if !requireWorkspaceEditor(c) {
+			return
+		}
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		if err := knowledge.DeleteDocument(c.Request.Context(), c.GetUint("workspace_id"), userID, uint(id)); err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
 	})
+
+	// Accepts one or more multipart files under "file" or "files", stored in
+	// the "collection_id" form field's collection or the workspace default
+	rg.POST("/upload", func(c *gin.Context) {
+		if !requireWorkspaceEditor(c) {
+			return
+		}
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadFiles*knowledge.MaxUploadSize()+1<<20)
+		form, err := c.MultipartForm()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid multipart upload: " + err.Error()})
+			return
+		}
+		collectionID, _ := strconv.Atoi(c.PostForm("collection_id"))
+		files := append(form.File["file"], form.File["files"]...)
+		if len(files) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "no file provided"})
+			return
+		}
+		if len(files) > maxUploadFiles {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "at most " + strconv.Itoa(maxUploadFiles) + " files per upload"})
+			return
+		}
+
+		// A single file reports its own error; batches report per-file errors
+		if len(files) == 1 {
+			doc, err := ingestUpload(c, knowledge, userID, uint(collectionID), files[0])
+			if err != nil {
+				respondKnowledgeError(c, err)
+				return
+			}
+			c.JSON(http.StatusCreated, gin.H{"documents": []interface{}{doc}, "errors": []gin.H{}})
+			return
+		}
+
+		created := make([]interface{}, 0, len(files))
+		failed := make([]gin.H, 0)
+		for _, fh := range files {
+			doc, err := ingestUpload(c, knowledge, userID, uint(collectionID), fh)
+			if err != nil {
+				failed = append(failed, gin.H{"filename": fh.Filename, "error": err.Error()})
+				continue
+			}
+			created = append(created, doc)
+		}
+
+		status := http.StatusCreated
+		if len(created) == 0 {
+			status = http.StatusUnprocessableEntity
+		}
+		c.JSON(status, gin.H{"documents": created, "errors": failed})
+	})
+
+	// Ingests a page immediately, or queues every page listed by a sitemap
+	rg.POST("/urls", func(c *gin.Context) {
+		if !requireWorkspaceEditor(c) {
+			return
+		}
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+
+		var req struct {
+			URL          string `json:"url" binding:"required"`
+			CollectionID uint   `json:"collection_id"`
+			// RecrawlInterval is in seconds; 0 disables re-crawling
+			RecrawlInterval *int `json:"recrawl_interval"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var interval *time.Duration
+		if req.RecrawlInterval != nil {
+			if *req.RecrawlInterval < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "recrawl_interval must not be negative"})
+				return
+			}
+			d := time.Duration(*req.RecrawlInterval) * time.Second
+			interval = &d
+		}
+
+		result, err := crawler.AddURL(c.Request.Context(), c.GetUint("workspace_id"), userID, req.CollectionID, req.URL, interval)
+		if err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		if result.Document == nil {
+			c.JSON(http.StatusAccepted, result)
+			return
+		}
+		c.JSON(http.StatusCreated, result)
+	})
+
+	rg.GET("/urls", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		sources, err := crawler.ListSources(c.Request.Context(), c.GetUint("workspace_id"), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"sources": sources})
+	})
+
+	rg.DELETE("/urls/:id", func(c *gin.Context) {
+		if !requireWorkspaceEditor(c) {
+			return
+		}
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		if err := crawler.DeleteSource(c.Request.Context(), c.GetUint("workspace_id"), userID, uint(id)); err != nil {
+			respondKnowledgeError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
+
+func ingestUpload(c *gin.Context, knowledge *services.KnowledgeService, userID, collectionID uint, fh *multipart.FileHeader) (*models.KnowledgeDocument, error) {
+	data, err := readUpload(fh, knowledge.MaxUploadSize())
+	if err != nil {
+		return nil, err
+	}
+	return knowledge.IngestFile(c.Request.Context(), c.GetUint("workspace_id"), userID, collectionID, fh.Filename, data)
+}
+
+func readUpload(fh *multipart.FileHeader, maxSize int64) ([]byte, error) {
+	if fh.Size > maxSize {
+		return nil, services.ErrFileTooLarge
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(io.LimitReader(f, maxSize+1))
+}
+
+// formInt parses an optional integer form field; nil means it was not sent
+func formInt(c *gin.Context, name string) (*int, error) {
+	raw := c.PostForm(name)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, errors.New(name + " must be an integer")
+	}
+	return &v, nil
+}
+
+// respondKnowledgeError maps knowledge service errors to HTTP status codes
+func respondKnowledgeError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrDocumentNotFound), errors.Is(err, services.ErrSourceNotFound),
+		errors.Is(err, services.ErrCollectionNotFound), errors.Is(err, services.ErrGrantNotFound),
+		errors.Is(err, services.ErrGroupNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrPermissionDenied):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrSourceInOtherCollection):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrNameRequired), errors.Is(err, services.ErrInvalidVisibility),
+		errors.Is(err, services.ErrInvalidGrant), errors.Is(err, services.ErrNotOrganizationMember):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrFileTooLarge), errors.Is(err, crawl.ErrTooLarge),
+		errors.Is(err, extract.ErrTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, crawl.ErrInvalidURL), errors.Is(err, crawl.ErrPrivateAddress),
+		errors.Is(err, chunking.ErrInvalidOptions):
+		status = http.StatusBadRequest
+	case errors.Is(err, crawl.ErrDisallowed):
+		status = http.StatusForbidden
+	case errors.Is(err, crawl.ErrFetchFailed):
+		status = http.StatusBadGateway
+	case errors.Is(err, extract.ErrUnsupportedType):
+		status = http.StatusUnsupportedMediaType
+	case errors.Is(err, extract.ErrNoText):
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
 }
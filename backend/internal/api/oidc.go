@@ -0,0 +1,149 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"likemind-backend/internal/oidc"
+	"likemind-backend/internal/services"
+)
+
+// errSSORefused wraps errors the provider reports back to the callback
+var errSSORefused = errors.New("sign-in refused by identity provider")
+
+// oidcStateCookie ties a callback to the browser that started the login
+const oidcStateCookie = "oidc_state"
+
+// RegisterOIDCRoutes registers single sign-on endpoints. After a
+// successful callback the browser is redirected to frontendURL with the
+// token in the URL fragment, or the token is returned as JSON when
+// frontendURL is empty. Logins go through the same verification and 2FA
+// checks as password logins; a 2FA challenge takes the token's place.
+func RegisterOIDCRoutes(rg *gin.RouterGroup, sso *services.OIDCService, auth *services.AuthService, workspaces *services.WorkspaceService, accounts *services.AccountService, twoFactor *services.TwoFactorService, frontendURL string) {
+	rg.GET("/providers", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"providers": sso.Providers()})
+	})
+
+	rg.GET("/:provider/login", func(c *gin.Context) {
+		authURL, state, err := sso.Begin(c.Request.Context(), c.Param("provider"))
+		if err != nil {
+			respondOIDCError(c, err, "")
+			return
+		}
+		// Lax, since the provider redirects back with a cross-site GET
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(oidcStateCookie, state, int(services.OIDCStateTTL.Seconds()), oidcCookiePath(c), "", secureRequest(c), true)
+		c.Redirect(http.StatusFound, authURL)
+	})
+
+	rg.GET("/:provider/callback", func(c *gin.Context) {
+		// The provider reports cancelled or refused logins as parameters
+		if errCode := c.Query("error"); errCode != "" {
+			message := errCode
+			if description := c.Query("error_description"); description != "" {
+				message += ": " + description
+			}
+			respondOIDCError(c, fmt.Errorf("%w: %s", errSSORefused, message), frontendURL)
+			return
+		}
+		// Without this a callback URL started by someone else could sign the
+		// browser into their account
+		cookie, _ := c.Cookie(oidcStateCookie)
+		c.SetCookie(oidcStateCookie, "", -1, oidcCookiePath(c), "", secureRequest(c), true)
+		state := c.Query("state")
+		if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+			respondOIDCError(c, services.ErrInvalidOIDCState, frontendURL)
+			return
+		}
+		ctx := c.Request.Context()
+		user, err := sso.Complete(ctx, c.Param("provider"), state, c.Query("code"))
+		if err != nil {
+			respondOIDCError(c, err, frontendURL)
+			return
+		}
+		if err := accounts.CheckSignIn(user); err != nil {
+			respondOIDCError(c, err, frontendURL)
+			return
+		}
+		challenge, err := twoFactor.BeginLogin(ctx, user)
+		if err != nil {
+			respondOIDCError(c, err, frontendURL)
+			return
+		}
+		if challenge != nil {
+			if frontendURL == "" {
+				c.JSON(http.StatusOK, challengeResponse(challenge))
+				return
+			}
+			fragment := url.Values{
+				"two_factor_required": {"true"},
+				"challenge_token":     {challenge.Token},
+				"setup_required":      {strconv.FormatBool(challenge.SetupRequired)},
+				"expires_at":          {challenge.ExpiresAt.Format(time.RFC3339)},
+			}
+			c.Redirect(http.StatusFound, frontendURL+"#"+fragment.Encode())
+			return
+		}
+		token, workspaceID, err := sessionToken(c, auth, workspaces, user)
+		if err != nil {
+			respondOIDCError(c, err, frontendURL)
+			return
+		}
+		if frontendURL == "" {
+			c.JSON(http.StatusOK, gin.H{"token": token, "workspace_id": workspaceID})
+			return
+		}
+		// A fragment is never sent to servers, keeping the token out of logs
+		fragment := url.Values{"token": {token}, "workspace_id": {strconv.FormatUint(uint64(workspaceID), 10)}}
+		c.Redirect(http.StatusFound, frontendURL+"#"+fragment.Encode())
+	})
+}
+
+// oidcCookiePath scopes the state cookie to the provider's login and
+// callback routes
+func oidcCookiePath(c *gin.Context) string {
+	path := c.Request.URL.Path
+	return path[:strings.LastIndexByte(path, '/')]
+}
+
+// secureRequest reports whether the client connected over HTTPS, directly
+// or through a proxy
+func secureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+func respondOIDCError(c *gin.Context, err error, frontendURL string) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrInvalidOIDCState):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrUnknownProvider):
+		status = http.StatusNotFound
+	case errors.Is(err, oidc.ErrInvalidIDToken):
+		status = http.StatusUnauthorized
+	case errors.Is(err, services.ErrSSOAccountExists):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrSSOEmailRequired), errors.Is(err, services.ErrSSOSignupDisabled),
+		errors.Is(err, errSSORefused), errors.Is(err, services.ErrAccountDisabled), errors.Is(err, services.ErrEmailNotVerified):
+		status = http.StatusForbidden
+	case errors.Is(err, oidc.ErrDiscovery), errors.Is(err, oidc.ErrExchange):
+		status = http.StatusBadGateway
+	}
+	if status >= http.StatusInternalServerError {
+		log.Printf("oidc: %s login failed: %v", c.Param("provider"), err)
+	}
+	if frontendURL != "" {
+		c.Redirect(http.StatusFound, frontendURL+"#"+url.Values{"error": {err.Error()}}.Encode())
+		return
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
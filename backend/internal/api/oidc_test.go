@@ -0,0 +1,128 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"likemind-backend/internal/oidc"
+	"likemind-backend/internal/oidc/oidctest"
+	"likemind-backend/internal/services"
+)
+
+// newTestOIDCRouter serves the SSO routes for the provider "dev" backed by
+// a fake IdP. Only the services the tested paths reach are set up.
+func newTestOIDCRouter(t *testing.T) (*gin.Engine, *oidctest.Server) {
+	t.Helper()
+	idp, err := oidctest.New("", "likemind", "secret")
+	if err != nil {
+		t.Fatalf("oidctest.New: %v", err)
+	}
+	ts := httptest.NewServer(idp)
+	t.Cleanup(ts.Close)
+	idp.Issuer = ts.URL
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	sso := services.NewOIDCService(nil, client, services.OIDCOptions{})
+	provider := oidc.NewProvider(oidc.Config{
+		Name:         "dev",
+		Issuer:       ts.URL,
+		ClientID:     "likemind",
+		ClientSecret: "secret",
+		RedirectURL:  "http://app.test/auth/oidc/dev/callback",
+	}, ts.Client())
+	if err := sso.AddProvider(provider, "Dev", "", ""); err != nil {
+		t.Fatalf("AddProvider: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterOIDCRoutes(r.Group("/auth/oidc"), sso, nil, nil, nil, nil, "")
+	return r, idp
+}
+
+func serve(r *gin.Engine, target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func stateCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			return cookie
+		}
+	}
+	t.Fatalf("response sets no %s cookie", oidcStateCookie)
+	return nil
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	r, idp := newTestOIDCRouter(t)
+
+	w := serve(r, "/auth/oidc/dev/login")
+	if w.Code != http.StatusFound {
+		t.Fatalf("login = %d, want a redirect", w.Code)
+	}
+	cookie := stateCookie(t, w)
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/auth/oidc/dev" {
+		t.Fatalf("state cookie = %+v, want HttpOnly, SameSite=Lax and scoped to the provider", cookie)
+	}
+	callback, err := idp.Login(w.Header().Get("Location"), oidctest.User{Email: "jane@example.com"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if callback.Query().Get("state") != cookie.Value {
+		t.Fatalf("callback state %q does not match the cookie %q", callback.Query().Get("state"), cookie.Value)
+	}
+	target := "/auth/oidc/dev/callback?" + callback.RawQuery
+
+	// Someone else's callback URL opened in a browser that did not start
+	// the login is refused, and the cookie is cleared either way
+	for _, tc := range []struct {
+		name    string
+		cookies []*http.Cookie
+	}{
+		{"no cookie", nil},
+		{"another login's cookie", []*http.Cookie{{Name: oidcStateCookie, Value: "another-state"}}},
+	} {
+		w := serve(r, target, tc.cookies...)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: callback = %d %s, want 400", tc.name, w.Code, w.Body)
+		}
+		if cleared := stateCookie(t, w); cleared.MaxAge >= 0 {
+			t.Errorf("%s: state cookie not cleared: %+v", tc.name, cleared)
+		}
+	}
+
+	// With the cookie the callback goes on to redeem the code, which the
+	// provider refuses once it has been tampered with
+	tampered := url.Values{"state": {cookie.Value}, "code": {"tampered"}}
+	w = serve(r, "/auth/oidc/dev/callback?"+tampered.Encode(), cookie)
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("callback with the state cookie = %d %s, want 502 from the code exchange", w.Code, w.Body)
+	}
+}
+
+func TestOIDCCallbackReportsProviderErrors(t *testing.T) {
+	r, _ := newTestOIDCRouter(t)
+	w := serve(r, "/auth/oidc/dev/callback?error=access_denied&error_description=no")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("callback with an error = %d, want 403", w.Code)
+	}
+	if w = serve(r, "/auth/oidc/missing/login"); w.Code != http.StatusNotFound {
+		t.Fatalf("login with an unknown provider = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"likemind-backend/internal/services"
+)
+
+// RegisterPromptRoutes exposes the versioned prompt template library
+func RegisterPromptRoutes(rg *gin.RouterGroup, prompts *services.PromptService) {
+	rg.GET("", func(c *gin.Context) {
+		list, err := prompts.List(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	})
+
+	rg.POST("", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		var payload struct {
+			Name string `json:"name" binding:"required"`
+			services.PromptRequest
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		prompt, err := prompts.Create(c.Request.Context(), userID, payload.Name, payload.PromptRequest)
+		if err != nil {
+			respondPromptError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, prompt)
+	})
+
+	// Renders an unsaved template with the given variables
+	rg.POST("/preview", func(c *gin.Context) {
+		var payload struct {
+			Template  string                 `json:"template" binding:"required"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rendered, err := prompts.Preview(payload.Template, payload.Variables)
+		if err != nil {
+			respondPromptError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, rendered)
+	})
+
+	// Latest version, or ?version=
+	rg.GET("/:name", func(c *gin.Context) {
+		prompt, err := prompts.Get(c.Request.Context(), c.Param("name"), promptVersion(c))
+		if err != nil {
+			respondPromptError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, prompt)
+	})
+
+	rg.GET("/:name/versions", func(c *gin.Context) {
+		versions, err := prompts.Versions(c.Request.Context(), c.Param("name"))
+		if err != nil {
+			respondPromptError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, versions)
+	})
+
+	// Saves a new version; existing versions never change
+	rg.PUT("/:name", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		role, _ := c.Get("role")
+		var req services.PromptRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		prompt, err := prompts.AddVersion(c.Request.Context(), userID, role == "admin", c.Param("name"), req)
+		if err != nil {
+			respondPromptError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, prompt)
+	})
+
+	// Deletes one ?version=, or every version
+	rg.DELETE("/:name", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		role, _ := c.Get("role")
+		if err := prompts.Delete(c.Request.Context(), userID, role == "admin", c.Param("name"), promptVersion(c)); err != nil {
+			respondPromptError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	rg.POST("/:name/render", func(c *gin.Context) {
+		var payload struct {
+			Version   int                    `json:"version"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rendered, err := prompts.Render(c.Request.Context(), services.PromptRef{
+			Name:      c.Param("name"),
+			Version:   payload.Version,
+			Variables: payload.Variables,
+		})
+		if err != nil {
+			respondPromptError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, rendered)
+	})
+}
+
+func promptVersion(c *gin.Context) int {
+	version, _ := strconv.Atoi(c.Query("version"))
+	return version
+}
+
+func respondPromptError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrPromptNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrPromptExists):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrInvalidPrompt):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrPermissionDenied):
+		status = http.StatusForbidden
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
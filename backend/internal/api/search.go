@@ -1,11 +1,140 @@
 package api
 
-import "github.com/gin-gonic/gin"
-import "likemind-backend/internal/services"
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"likemind-backend/internal/services"
+)
+
+// RegisterSearchRoutes exposes hybrid knowledge search and indexing
+func RegisterSearchRoutes(rg *gin.RouterGroup, search *services.SearchService) {
+	rg.POST("/semantic", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+
+		var req services.SearchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if (req.KeywordWeight != nil && *req.KeywordWeight < 0) || (req.VectorWeight != nil && *req.VectorWeight < 0) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "weights must not be negative"})
+			return
+		}
+
+		resp, err := search.Search(c.Request.Context(), c.GetUint("workspace_id"), userID, req)
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, services.ErrEmptyQuery):
+				status = http.StatusBadRequest
+			case errors.Is(err, services.ErrCollectionNotFound):
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// Queues the given documents, or every unindexed one, for embedding
+	rg.POST("/index", func(c *gin.Context) {
+		if !requireWorkspaceEditor(c) {
+			return
+		}
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+
+		var req struct {
+			DocumentIDs []uint `json:"document_ids"`
+			Limit       int    `json:"limit"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Limit <= 0 || req.Limit > 500 {
+			req.Limit = 100
+		}
+
+		job, ids, err := search.QueueIndex(c.Request.Context(), c.GetUint("workspace_id"), userID, req.DocumentIDs, req.Limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if job == nil {
+			c.JSON(http.StatusOK, gin.H{"document_ids": ids})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"job_id": job.ID, "document_ids": ids})
+	})
 
-// RegisterSearchRoutes provides placeholder search endpoints
-func RegisterSearchRoutes(rg *gin.RouterGroup, _ *services.SearchService) {
 	rg.GET("/history", func(c *gin.Context) {
-		c.JSON(200, gin.H{"message": "search history"})
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if limit <= 0 || limit > 100 {
+			limit = 20
+		}
+		if offset < 0 {
+			offset = 0
+		}
+		queries, total, err := search.GetHistory(c.Request.Context(), c.GetUint("workspace_id"), userID, limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"queries": queries, "total": total, "limit": limit, "offset": offset})
+	})
+
+	rg.DELETE("/history", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+
+		deleted, err := search.ClearHistory(c.Request.Context(), c.GetUint("workspace_id"), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+	})
+
+	rg.DELETE("/history/:id", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+
+		id, _ := strconv.Atoi(c.Param("id"))
+		if err := search.DeleteHistoryEntry(c.Request.Context(), userID, uint(id)); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, services.ErrSearchQueryNotFound) {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	rg.GET("/suggest", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "8"))
+		if limit <= 0 || limit > 20 {
+			limit = 8
+		}
+		suggestions, err := search.Suggest(c.Request.Context(), c.GetUint("workspace_id"), userID, c.Query("prefix"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
 	})
 }
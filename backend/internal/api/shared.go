@@ -0,0 +1,27 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"likemind-backend/internal/services"
+)
+
+// RegisterSharedRoutes exposes unauthenticated read-only access to shared sessions
+func RegisterSharedRoutes(rg *gin.RouterGroup, chat *services.ChatService) {
+	rg.GET("/:token", func(c *gin.Context) {
+		shared, err := chat.GetSharedSession(c.Request.Context(), c.Param("token"))
+		if errors.Is(err, services.ErrShareLinkNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, shared)
+	})
+}
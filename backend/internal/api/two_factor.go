@@ -0,0 +1,126 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"likemind-backend/internal/models"
+	"likemind-backend/internal/services"
+)
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// RegisterTwoFactorRoutes exposes the current user's two-factor settings
+func RegisterTwoFactorRoutes(rg *gin.RouterGroup, twoFactor *services.TwoFactorService, users *services.UserService) {
+	rg.GET("", func(c *gin.Context) {
+		user, ok := currentUser(c, users)
+		if !ok {
+			return
+		}
+		status, err := twoFactor.Status(c.Request.Context(), user)
+		if err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	})
+
+	// Returns a new secret; 2FA is not enabled until it is confirmed
+	rg.POST("/enroll", func(c *gin.Context) {
+		user, ok := currentUser(c, users)
+		if !ok {
+			return
+		}
+		enrollment, err := twoFactor.Enroll(c.Request.Context(), user)
+		if err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, enrollment)
+	})
+
+	// The recovery codes are only ever shown in this response
+	rg.POST("/confirm", func(c *gin.Context) {
+		var req twoFactorCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, ok := currentUser(c, users)
+		if !ok {
+			return
+		}
+		codes, err := twoFactor.Confirm(c.Request.Context(), user, req.Code)
+		if err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	})
+
+	rg.POST("/disable", func(c *gin.Context) {
+		var req twoFactorCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, ok := currentUser(c, users)
+		if !ok {
+			return
+		}
+		if err := twoFactor.Disable(c.Request.Context(), user, req.Code); err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	// Replaces all recovery codes, used or not
+	rg.POST("/recovery-codes", func(c *gin.Context) {
+		var req twoFactorCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, ok := currentUser(c, users)
+		if !ok {
+			return
+		}
+		codes, err := twoFactor.RegenerateRecoveryCodes(c.Request.Context(), user, req.Code)
+		if err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	})
+}
+
+func currentUser(c *gin.Context, users *services.UserService) (*models.User, bool) {
+	uid, _ := c.Get("user_id")
+	user, err := users.GetByID(uint(uid.(float64)))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// respondTwoFactorError maps two-factor errors to HTTP status codes
+func respondTwoFactorError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrInvalidTwoFactorCode), errors.Is(err, services.ErrTwoFactorNotEnrolled):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrInvalidChallenge):
+		status = http.StatusUnauthorized
+	case errors.Is(err, services.ErrTwoFactorRequired), errors.Is(err, services.ErrAccountDisabled):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrTwoFactorEnabled):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 
@@ -9,7 +11,7 @@ import (
 )
 
 // RegisterUserRoutes exposes user related endpoints
-func RegisterUserRoutes(rg *gin.RouterGroup, users *services.UserService) {
+func RegisterUserRoutes(rg *gin.RouterGroup, users *services.UserService, guard *services.LoginGuard, twoFactor *services.TwoFactorService) {
 	rg.GET("/me", func(c *gin.Context) {
 		idVal, exists := c.Get("user_id")
 		if !exists {
@@ -28,4 +30,69 @@ func RegisterUserRoutes(rg *gin.RouterGroup, users *services.UserService) {
 		}
 		c.JSON(http.StatusOK, user)
 	})
+
+	// Admins enable and disable accounts; disabled users cannot sign in and
+	// their tokens and API keys stop working
+	rg.PUT("/:id/active", func(c *gin.Context) {
+		if role, _ := c.Get("role"); role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			return
+		}
+		id, _ := strconv.Atoi(c.Param("id"))
+		var req struct {
+			IsActive *bool `json:"is_active" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, err := users.SetActive(c.Request.Context(), uint(id), *req.IsActive)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, services.ErrUserNotFound) {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, user)
+	})
+
+	// Admins lift a lockout from failed logins before it expires
+	rg.DELETE("/:id/lockout", func(c *gin.Context) {
+		if role, _ := c.Get("role"); role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			return
+		}
+		id, _ := strconv.Atoi(c.Param("id"))
+		user, err := users.GetByID(uint(id))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if err := guard.Unlock(c.Request.Context(), user.Email); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	// Admins remove a user's 2FA after a lost device; users whose role
+	// requires it set it up again at their next login
+	rg.DELETE("/:id/2fa", func(c *gin.Context) {
+		if role, _ := c.Get("role"); role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			return
+		}
+		id, _ := strconv.Atoi(c.Param("id"))
+		if _, err := users.GetByID(uint(id)); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if err := twoFactor.Reset(c.Request.Context(), uint(id)); err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
 }
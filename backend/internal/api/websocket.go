@@ -1,7 +1,13 @@
 package api
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -9,23 +15,216 @@ import (
 	"likemind-backend/internal/services"
 )
 
+const (
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = (wsPongWait * 9) / 10
+	wsMaxMessageSize = 64 * 1024
+	wsSendBuffer     = 256
+)
+
+// errChatReadOnly is sent to API key connections that try to write
+const errChatReadOnly = "API key lacks the chat:write scope"
+
 var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
 
-// RegisterWebSocketRoutes registers basic websocket chat endpoint
-func RegisterWebSocketRoutes(rg *gin.RouterGroup, chat *services.ChatService) {
+// wsClient is a single WebSocket connection registered with the hub
+type wsClient struct {
+	id       string
+	hub      *Hub
+	conn     *websocket.Conn
+	ctx      context.Context // cancelled when the connection closes
+	cancel   context.CancelFunc
+	userID   uint
+	readOnly bool                            // API key without the chat:write scope
+	check    func(ctx context.Context) error // re-validates the credential the connection opened with
+	send     chan []byte
+	sessions map[uint]struct{} // guarded by hub.mu
+}
+
+// wsCommand is a frame sent by the client
+type wsCommand struct {
+	Type      string `json:"type"` // subscribe, unsubscribe, message, typing
+	SessionID uint   `json:"session_id"`
+	Content   string `json:"content,omitempty"`
+	Typing    bool   `json:"typing,omitempty"`
+}
+
+// RegisterWebSocketRoutes registers the real-time chat endpoint. Clients
+// subscribe to sessions they participate in and receive events, presence and
+// typing indicators published by any replica.
+func RegisterWebSocketRoutes(rg *gin.RouterGroup, chat *services.ChatService, hub *Hub) {
 	rg.GET("/chat", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		readOnly := false
+		if scopes, ok := c.Get("scopes"); ok {
+			readOnly = !services.ScopeAllows(scopes.([]string), "chat", true)
+		}
+		check, _ := c.Get("credential_check")
+
 		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
 			return
 		}
-		defer conn.Close()
-		for {
-			_, msg, err := conn.ReadMessage()
-			if err != nil {
-				break
-			}
-			chat.SendMessage(c.Request.Context(), 0, string(msg))
-			conn.WriteMessage(websocket.TextMessage, msg)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		client := &wsClient{
+			id:       newClientID(),
+			hub:      hub,
+			conn:     conn,
+			ctx:      ctx,
+			cancel:   cancel,
+			userID:   userID,
+			readOnly: readOnly,
+			check:    check.(func(ctx context.Context) error),
+			send:     make(chan []byte, wsSendBuffer),
+			sessions: make(map[uint]struct{}),
 		}
+		hub.register(client)
+
+		go client.writePump()
+		client.readPump(chat)
 	})
 }
+
+func (c *wsClient) readPump(chat *services.ChatService) {
+	defer func() {
+		// Stops replies still being generated for this connection
+		c.cancel()
+		sessions := c.hub.sessionsOf(c)
+		c.hub.unregister(c)
+		c.conn.Close()
+		for _, sessionID := range sessions {
+			c.hub.leavePresence(context.Background(), c, sessionID)
+		}
+	}()
+
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var cmd wsCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			c.sendError("invalid command")
+			continue
+		}
+		c.handleCommand(chat, cmd)
+	}
+}
+
+func (c *wsClient) handleCommand(chat *services.ChatService, cmd wsCommand) {
+	ctx := c.ctx
+
+	switch cmd.Type {
+	case "subscribe":
+		if _, err := chat.SessionRole(ctx, cmd.SessionID, c.userID); err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		c.hub.subscribe(c, cmd.SessionID)
+		c.hub.joinPresence(ctx, c, cmd.SessionID)
+	case "unsubscribe":
+		c.hub.unsubscribe(c, cmd.SessionID)
+		c.hub.leavePresence(ctx, c, cmd.SessionID)
+	case "typing":
+		if c.readOnly {
+			c.sendError(errChatReadOnly)
+			return
+		}
+		role, err := chat.SessionRole(ctx, cmd.SessionID, c.userID)
+		if err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		if !services.CanPrompt(role) {
+			c.sendError(services.ErrPermissionDenied.Error())
+			return
+		}
+		c.hub.Publish(ctx, services.Event{
+			Type:      services.EventTyping,
+			SessionID: cmd.SessionID,
+			Data:      map[string]interface{}{"user_id": c.userID, "typing": cmd.Typing},
+		})
+	case "message":
+		if c.readOnly {
+			c.sendError(errChatReadOnly)
+			return
+		}
+		// Replies arrive as events, so generation must not block reads
+		go func() {
+			if _, err := chat.SendMessage(ctx, cmd.SessionID, c.userID, cmd.Content); err != nil {
+				c.sendError(err.Error())
+			}
+		}()
+	default:
+		c.sendError("unknown command type")
+	}
+}
+
+func (c *wsClient) sendError(message string) {
+	payload, _ := json.Marshal(gin.H{"type": "error", "error": message})
+
+	c.hub.mu.RLock()
+	defer c.hub.mu.RUnlock()
+	if _, ok := c.hub.clients[c]; !ok {
+		return
+	}
+	select {
+	case c.send <- payload:
+	default:
+	}
+}
+
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case payload, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				return
+			}
+		case <-ticker.C:
+			// The connection outlives its token or key, so it closes once
+			// that is revoked, expires or its account is deactivated
+			if err := c.check(c.ctx); err != nil {
+				c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()))
+				return
+			}
+			c.hub.refreshPresence(c.ctx, c)
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *wsClient) presenceMember() string {
+	return fmt.Sprintf("%d:%s", c.userID, c.id)
+}
+
+func newClientID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
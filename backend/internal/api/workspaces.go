@@ -0,0 +1,514 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"likemind-backend/internal/models"
+	"likemind-backend/internal/services"
+)
+
+type memberRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// RegisterOrganizationRoutes exposes organizations and their members
+func RegisterOrganizationRoutes(rg *gin.RouterGroup, workspaces *services.WorkspaceService) {
+	rg.GET("", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgs, err := workspaces.ListOrganizations(c.Request.Context(), userID)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, orgs)
+	})
+
+	// Creates an organization owned by the caller with a first workspace
+	rg.POST("", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		var payload struct {
+			Name          string `json:"name" binding:"required"`
+			WorkspaceName string `json:"workspace_name"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		org, workspace, err := workspaces.CreateOrganization(c.Request.Context(), userID, payload.Name, payload.WorkspaceName)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"organization": org, "workspace": workspace})
+	})
+
+	rg.GET("/:id/members", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		members, err := workspaces.ListOrganizationMembers(c.Request.Context(), uint(orgID), userID)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, members)
+	})
+
+	rg.PUT("/:id/members/:userId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		targetID, _ := strconv.Atoi(c.Param("userId"))
+		var payload memberRequest
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		member, err := workspaces.SetOrganizationMember(c.Request.Context(), uint(orgID), userID, uint(targetID), payload.Role)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, member)
+	})
+
+	// Users join organizations by accepting an invitation
+	rg.POST("/:id/invitations", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		var payload struct {
+			UserID uint   `json:"user_id" binding:"required"`
+			Role   string `json:"role" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		invitation, err := workspaces.InviteOrganizationMember(c.Request.Context(), uint(orgID), userID, payload.UserID, payload.Role)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, invitation)
+	})
+
+	rg.GET("/:id/invitations", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		invitations, err := workspaces.ListOrganizationInvitations(c.Request.Context(), uint(orgID), userID)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, invitations)
+	})
+
+	rg.DELETE("/:id/invitations/:invitationId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		invitationID, _ := strconv.Atoi(c.Param("invitationId"))
+		if err := workspaces.RevokeOrganizationInvitation(c.Request.Context(), uint(orgID), userID, uint(invitationID)); err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	// Invitations addressed to the caller
+	rg.GET("/invitations", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		invitations, err := workspaces.ListInvitations(c.Request.Context(), userID)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, invitations)
+	})
+
+	rg.POST("/invitations/:invitationId/accept", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		invitationID, _ := strconv.Atoi(c.Param("invitationId"))
+		member, err := workspaces.AcceptInvitation(c.Request.Context(), userID, uint(invitationID))
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, member)
+	})
+
+	rg.DELETE("/invitations/:invitationId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		invitationID, _ := strconv.Atoi(c.Param("invitationId"))
+		if err := workspaces.DeclineInvitation(c.Request.Context(), userID, uint(invitationID)); err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	rg.DELETE("/:id/members/:userId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		targetID, _ := strconv.Atoi(c.Param("userId"))
+		if err := workspaces.RemoveOrganizationMember(c.Request.Context(), uint(orgID), userID, uint(targetID)); err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	rg.POST("/:id/workspaces", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		var payload struct {
+			Name string `json:"name" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		workspace, err := workspaces.CreateWorkspace(c.Request.Context(), uint(orgID), userID, payload.Name)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, workspace)
+	})
+
+	rg.GET("/:id/groups", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		groups, err := workspaces.ListGroups(c.Request.Context(), uint(orgID), userID)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, groups)
+	})
+
+	rg.POST("/:id/groups", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		var payload struct {
+			Name string `json:"name" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		group, err := workspaces.CreateGroup(c.Request.Context(), uint(orgID), userID, payload.Name)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, group)
+	})
+
+	rg.DELETE("/:id/groups/:groupId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		groupID, _ := strconv.Atoi(c.Param("groupId"))
+		if err := workspaces.DeleteGroup(c.Request.Context(), uint(orgID), uint(groupID), userID); err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	rg.GET("/:id/groups/:groupId/members", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		groupID, _ := strconv.Atoi(c.Param("groupId"))
+		members, err := workspaces.ListGroupMembers(c.Request.Context(), uint(orgID), uint(groupID), userID)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, members)
+	})
+
+	rg.PUT("/:id/groups/:groupId/members/:userId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		groupID, _ := strconv.Atoi(c.Param("groupId"))
+		targetID, _ := strconv.Atoi(c.Param("userId"))
+		member, err := workspaces.AddGroupMember(c.Request.Context(), uint(orgID), uint(groupID), userID, uint(targetID))
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, member)
+	})
+
+	rg.DELETE("/:id/groups/:groupId/members/:userId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		groupID, _ := strconv.Atoi(c.Param("groupId"))
+		targetID, _ := strconv.Atoi(c.Param("userId"))
+		if err := workspaces.RemoveGroupMember(c.Request.Context(), uint(orgID), uint(groupID), userID, uint(targetID)); err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
+
+// RegisterWorkspaceRoutes exposes workspaces, their members and switching
+// the token's active workspace
+func RegisterWorkspaceRoutes(rg *gin.RouterGroup, workspaces *services.WorkspaceService, auth *services.AuthService, users *services.UserService) {
+	rg.GET("", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		list, err := workspaces.ListWorkspaces(c.Request.Context(), userID)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		if list == nil {
+			list = []models.Workspace{}
+		}
+		c.JSON(http.StatusOK, list)
+	})
+
+	rg.GET("/:id", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		workspace, err := workspaces.GetWorkspace(c.Request.Context(), uint(id), userID)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, workspace)
+	})
+
+	rg.PUT("/:id", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		var payload struct {
+			Name string `json:"name" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		workspace, err := workspaces.RenameWorkspace(c.Request.Context(), uint(id), userID, payload.Name)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, workspace)
+	})
+
+	rg.DELETE("/:id", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		if err := workspaces.DeleteWorkspace(c.Request.Context(), uint(id), userID); err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	// Returns a token whose active workspace is :id. API keys cannot switch,
+	// as the token would not be limited to the key's scopes; they send
+	// X-Workspace-ID instead.
+	rg.POST("/:id/switch", func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys select a workspace with the X-Workspace-ID header"})
+			return
+		}
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		workspace, err := workspaces.GetWorkspace(c.Request.Context(), uint(id), userID)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		user, err := users.GetByID(userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		token, err := auth.GenerateToken(user, workspace.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"token": token, "workspace": workspace})
+	})
+
+	rg.GET("/:id/members", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		members, err := workspaces.ListWorkspaceMembers(c.Request.Context(), uint(id), userID)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, members)
+	})
+
+	rg.PUT("/:id/members/:userId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		targetID, _ := strconv.Atoi(c.Param("userId"))
+		var payload memberRequest
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		member, err := workspaces.SetWorkspaceMember(c.Request.Context(), uint(id), userID, uint(targetID), payload.Role)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, member)
+	})
+
+	// Users join organizations by accepting an invitation
+	rg.POST("/:id/invitations", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		var payload struct {
+			UserID uint   `json:"user_id" binding:"required"`
+			Role   string `json:"role" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		invitation, err := workspaces.InviteOrganizationMember(c.Request.Context(), uint(orgID), userID, payload.UserID, payload.Role)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, invitation)
+	})
+
+	rg.GET("/:id/invitations", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		invitations, err := workspaces.ListOrganizationInvitations(c.Request.Context(), uint(orgID), userID)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, invitations)
+	})
+
+	rg.DELETE("/:id/invitations/:invitationId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		orgID, _ := strconv.Atoi(c.Param("id"))
+		invitationID, _ := strconv.Atoi(c.Param("invitationId"))
+		if err := workspaces.RevokeOrganizationInvitation(c.Request.Context(), uint(orgID), userID, uint(invitationID)); err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	// Invitations addressed to the caller
+	rg.GET("/invitations", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		invitations, err := workspaces.ListInvitations(c.Request.Context(), userID)
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, invitations)
+	})
+
+	rg.POST("/invitations/:invitationId/accept", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		invitationID, _ := strconv.Atoi(c.Param("invitationId"))
+		member, err := workspaces.AcceptInvitation(c.Request.Context(), userID, uint(invitationID))
+		if err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, member)
+	})
+
+	rg.DELETE("/invitations/:invitationId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		invitationID, _ := strconv.Atoi(c.Param("invitationId"))
+		if err := workspaces.DeclineInvitation(c.Request.Context(), userID, uint(invitationID)); err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	rg.DELETE("/:id/members/:userId", func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+		id, _ := strconv.Atoi(c.Param("id"))
+		targetID, _ := strconv.Atoi(c.Param("userId"))
+		if err := workspaces.RemoveWorkspaceMember(c.Request.Context(), uint(id), userID, uint(targetID)); err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
+
+// requireWorkspaceEditor rejects viewers of the active workspace set by
+// middleware.WorkspaceScope
+func requireWorkspaceEditor(c *gin.Context) bool {
+	if !services.CanEditWorkspace(c.GetString("workspace_role")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "editor role required in this workspace"})
+		return false
+	}
+	return true
+}
+
+// respondWorkspaceError maps organization and workspace errors to HTTP status codes
+func respondWorkspaceError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrOrganizationNotFound), errors.Is(err, services.ErrWorkspaceNotFound),
+		errors.Is(err, services.ErrMemberNotFound), errors.Is(err, services.ErrGroupNotFound),
+		errors.Is(err, services.ErrInvitationNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrPermissionDenied):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrNameRequired),
+		errors.Is(err, services.ErrNotOrganizationMember):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrLastOwner), errors.Is(err, services.ErrAlreadyMember):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
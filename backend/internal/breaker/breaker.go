@@ -0,0 +1,123 @@
+// Package breaker implements a consecutive-failure circuit breaker.
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State of a circuit
+type State string
+
+const (
+	Closed   State = "closed"
+	Open     State = "open"
+	HalfOpen State = "half_open"
+)
+
+// Breaker opens after threshold consecutive failures and rejects calls until
+// cooldown has passed. It then lets a single probe call through: success
+// closes the circuit again, failure re-opens it for another cooldown.
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     State
+	failures  int
+	openedAt  time.Time
+	probeAt   time.Time
+}
+
+// New creates a closed breaker. A threshold of zero or less disables it.
+func New(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown, state: Closed}
+}
+
+// Allow reports whether a call may proceed
+func (b *Breaker) Allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case Open:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = HalfOpen
+		b.probeAt = now
+		return true
+	case HalfOpen:
+		// A probe whose outcome was never recorded must not block the
+		// circuit forever
+		if now.Sub(b.probeAt) < b.cooldown {
+			return false
+		}
+		b.probeAt = now
+		return true
+	}
+	return true
+}
+
+// Success records a successful call and closes the circuit
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = Closed
+	b.failures = 0
+}
+
+// Failure records a failed call, opening the circuit once the threshold is
+// reached or when a probe fails
+func (b *Breaker) Failure() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.state = Open
+		b.openedAt = time.Now()
+	}
+}
+
+// State returns the current state, reporting an open circuit whose cooldown
+// has passed as half-open
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && time.Since(b.openedAt) >= b.cooldown {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Set holds one breaker per key, created on first use
+type Set struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	breakers  map[string]*Breaker
+}
+
+// NewSet creates breakers sharing threshold and cooldown
+func NewSet(threshold int, cooldown time.Duration) *Set {
+	return &Set{threshold: threshold, cooldown: cooldown, breakers: make(map[string]*Breaker)}
+}
+
+// Get returns the breaker for key
+func (s *Set) Get(key string) *Breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.breakers[key]
+	if !ok {
+		b = New(s.threshold, s.cooldown)
+		s.breakers[key] = b
+	}
+	return b
+}
@@ -0,0 +1,242 @@
+// Package chunking splits document text into overlapping chunks sized for
+// embedding and retrieval. Sizes are measured in approximate tokens: words
+// and individual punctuation marks.
+package chunking
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Strategy names a splitting algorithm
+type Strategy string
+
+const (
+	// StrategyFixed cuts every Size tokens regardless of structure
+	StrategyFixed Strategy = "fixed"
+	// StrategySentence packs whole sentences up to Size tokens
+	StrategySentence Strategy = "sentence"
+	// StrategyRecursive splits on paragraphs, then lines, sentences and words
+	StrategyRecursive Strategy = "recursive"
+	// StrategyMarkdown splits per heading section and records the heading path
+	StrategyMarkdown Strategy = "markdown"
+)
+
+const (
+	DefaultSize    = 512
+	DefaultOverlap = 64
+)
+
+// ErrInvalidOptions wraps validation failures of Options
+var ErrInvalidOptions = errors.New("invalid chunking options")
+
+// Options configures a split
+type Options struct {
+	Strategy Strategy `json:"strategy"`
+	Size     int      `json:"size"`
+	Overlap  int      `json:"overlap"`
+}
+
+// Chunk is a contiguous span of the source text
+type Chunk struct {
+	Index       int      `json:"index"`
+	Text        string   `json:"text"`
+	Start       int      `json:"start"` // byte offset in the source text
+	End         int      `json:"end"`
+	Tokens      int      `json:"tokens"`
+	HeadingPath []string `json:"heading_path,omitempty"`
+}
+
+// Validate fills defaults and checks that overlap is smaller than size
+func (o *Options) Validate() error {
+	if o.Strategy == "" {
+		o.Strategy = StrategyRecursive
+	}
+	switch o.Strategy {
+	case StrategyFixed, StrategySentence, StrategyRecursive, StrategyMarkdown:
+	default:
+		return fmt.Errorf("%w: unknown strategy %q", ErrInvalidOptions, o.Strategy)
+	}
+	if o.Size <= 0 {
+		o.Size = DefaultSize
+	}
+	if o.Overlap < 0 {
+		return fmt.Errorf("%w: overlap must not be negative", ErrInvalidOptions)
+	}
+	if o.Overlap >= o.Size {
+		return fmt.Errorf("%w: overlap must be smaller than size", ErrInvalidOptions)
+	}
+	return nil
+}
+
+// Split chunks text with the given options
+func Split(text string, opts Options) ([]Chunk, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	var chunks []Chunk
+	switch opts.Strategy {
+	case StrategyFixed:
+		chunks = splitFixed(text, span{0, len(text)}, opts.Size, opts.Overlap)
+	case StrategySentence:
+		chunks = pack(text, sentenceUnits(text, span{0, len(text)}, opts.Size), opts.Size, opts.Overlap)
+	case StrategyRecursive:
+		chunks = pack(text, recursiveUnits(text, span{0, len(text)}, opts.Size, defaultSeparators), opts.Size, opts.Overlap)
+	case StrategyMarkdown:
+		chunks = splitMarkdown(text, opts.Size, opts.Overlap)
+	}
+
+	for i := range chunks {
+		chunks[i].Index = i
+	}
+	return chunks, nil
+}
+
+// Config selects options per document type
+type Config struct {
+	Size       int
+	Overlap    int
+	Strategies map[string]Strategy // document type to strategy, overriding the defaults
+}
+
+// defaultStrategies suit the text produced by the extract package: HTML is
+// converted to Markdown-style headings, CSV rows are one per line
+var defaultStrategies = map[string]Strategy{
+	"markdown": StrategyMarkdown,
+	"html":     StrategyMarkdown,
+	"pdf":      StrategySentence,
+	"text":     StrategyRecursive,
+	"csv":      StrategyRecursive,
+}
+
+// For returns the options to use for a document type
+func (c Config) For(documentType string) Options {
+	opts := Options{Size: c.Size, Overlap: c.Overlap, Strategy: StrategyRecursive}
+	if s, ok := defaultStrategies[documentType]; ok {
+		opts.Strategy = s
+	}
+	if s, ok := c.Strategies[documentType]; ok {
+		opts.Strategy = s
+	}
+	return opts
+}
+
+// ParseStrategies parses "pdf=sentence,csv=fixed" into a strategy map
+func ParseStrategies(value string) (map[string]Strategy, error) {
+	strategies := make(map[string]Strategy)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		docType, strategy, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: expected type=strategy, got %q", ErrInvalidOptions, pair)
+		}
+		opts := Options{Strategy: Strategy(strings.TrimSpace(strategy)), Size: 2}
+		if err := opts.Validate(); err != nil {
+			return nil, err
+		}
+		strategies[strings.TrimSpace(docType)] = opts.Strategy
+	}
+	return strategies, nil
+}
+
+// span is a half-open byte range of the source text
+type span struct {
+	start, end int
+}
+
+var tokenPattern = regexp.MustCompile(`[\p{L}\p{N}_]+|[^\p{L}\p{N}_\s]`)
+
+// CountTokens approximates the number of tokens in text
+func CountTokens(text string) int {
+	return len(tokenPattern.FindAllStringIndex(text, -1))
+}
+
+// tokenSpans returns the tokens of text[s.start:s.end] as absolute spans
+func tokenSpans(text string, s span) []span {
+	locs := tokenPattern.FindAllStringIndex(text[s.start:s.end], -1)
+	spans := make([]span, len(locs))
+	for i, loc := range locs {
+		spans[i] = span{s.start + loc[0], s.start + loc[1]}
+	}
+	return spans
+}
+
+// splitFixed cuts s into windows of size tokens advancing by size-overlap
+func splitFixed(text string, s span, size, overlap int) []Chunk {
+	tokens := tokenSpans(text, s)
+	var chunks []Chunk
+	for i := 0; i < len(tokens); i += size - overlap {
+		j := i + size
+		if j > len(tokens) {
+			j = len(tokens)
+		}
+		chunks = append(chunks, newChunk(text, span{tokens[i].start, tokens[j-1].end}, j-i))
+		if j == len(tokens) {
+			break
+		}
+	}
+	return chunks
+}
+
+// pack merges consecutive units into chunks of at most size tokens,
+// repeating trailing units worth up to overlap tokens at the start of the
+// next chunk. Units must each fit in size.
+func pack(text string, units []span, size, overlap int) []Chunk {
+	var chunks []Chunk
+	var current []span
+	var counts []int
+	total := 0
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		chunks = append(chunks, newChunk(text, span{current[0].start, current[len(current)-1].end}, total))
+	}
+
+	for _, unit := range units {
+		n := CountTokens(text[unit.start:unit.end])
+		if n == 0 {
+			continue
+		}
+		if total+n > size && len(current) > 0 {
+			flush()
+
+			// Keep the longest tail that fits in overlap and leaves room for unit
+			keep := len(current)
+			kept := 0
+			for keep > 0 && kept+counts[keep-1] <= overlap && kept+counts[keep-1]+n <= size {
+				keep--
+				kept += counts[keep]
+			}
+			current = append([]span(nil), current[keep:]...)
+			counts = append([]int(nil), counts[keep:]...)
+			total = kept
+		}
+		current = append(current, unit)
+		counts = append(counts, n)
+		total += n
+	}
+	flush()
+	return chunks
+}
+
+// newChunk trims surrounding whitespace and records the adjusted offsets
+func newChunk(text string, s span, tokens int) Chunk {
+	raw := text[s.start:s.end]
+	trimmedLeft := strings.TrimLeft(raw, " \t\r\n")
+	start := s.start + len(raw) - len(trimmedLeft)
+	trimmed := strings.TrimRight(trimmedLeft, " \t\r\n")
+	return Chunk{
+		Text:   trimmed,
+		Start:  start,
+		End:    start + len(trimmed),
+		Tokens: tokens,
+	}
+}
@@ -0,0 +1,99 @@
+package chunking
+
+import (
+	"strings"
+	"testing"
+)
+
+var strategies = []Strategy{StrategyFixed, StrategySentence, StrategyRecursive, StrategyMarkdown}
+
+// checkChunks asserts the invariants every strategy must keep
+func checkChunks(t *testing.T, text string, opts Options, chunks []Chunk) {
+	t.Helper()
+	prevStart := 0
+	for i, c := range chunks {
+		if c.Index != i {
+			t.Fatalf("chunk %d has index %d", i, c.Index)
+		}
+		if c.Start < 0 || c.End > len(text) || c.Start > c.End {
+			t.Fatalf("chunk %d span [%d,%d) outside text of %d bytes", i, c.Start, c.End, len(text))
+		}
+		if text[c.Start:c.End] != c.Text {
+			t.Fatalf("chunk %d text does not match its span", i)
+		}
+		if c.Start < prevStart {
+			t.Fatalf("chunk %d starts at %d before chunk %d at %d", i, c.Start, i-1, prevStart)
+		}
+		if c.Tokens > opts.Size {
+			t.Fatalf("chunk %d has %d tokens, size is %d", i, c.Tokens, opts.Size)
+		}
+		prevStart = c.Start
+	}
+}
+
+func TestSplitWithoutOverlap(t *testing.T) {
+	text := strings.Repeat("One two three four five. Six seven eight nine ten.\n\n", 20)
+	for _, strategy := range strategies {
+		opts := Options{Strategy: strategy, Size: 8, Overlap: 0}
+		chunks, err := Split(text, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", strategy, err)
+		}
+		checkChunks(t, text, opts, chunks)
+		for i := 1; i < len(chunks); i++ {
+			if chunks[i].Start < chunks[i-1].End {
+				t.Fatalf("%s: chunk %d overlaps the previous chunk", strategy, i)
+			}
+		}
+	}
+}
+
+func TestSplitWithOverlap(t *testing.T) {
+	text := strings.Repeat("word ", 100)
+	opts := Options{Strategy: StrategyFixed, Size: 10, Overlap: 4}
+	chunks, err := Split(text, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChunks(t, text, opts, chunks)
+	if len(chunks) != 16 {
+		t.Fatalf("got %d chunks, want 16", len(chunks))
+	}
+	if chunks[1].Start >= chunks[0].End {
+		t.Fatal("consecutive chunks do not overlap")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, opts := range []Options{
+		{Strategy: "bogus"},
+		{Size: 10, Overlap: -1},
+		{Size: 10, Overlap: 10},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded", opts)
+		}
+	}
+}
+
+func FuzzSplit(f *testing.F) {
+	f.Add("# Title\n\nFirst paragraph. Second sentence!\n\n## Sub\n\n- item one\n- item two\n", 8, 2)
+	f.Add("a,b,c\n1,2,3\n4,5,6\n", 3, 0)
+	f.Add(strings.Repeat("longwordwithoutanyseparator", 10), 2, 1)
+	f.Add("“Quoted.” Next… (bracketed.) Done?\n\n\n", 1, 0)
+	f.Add("\xff\xfe broken utf-8 \xc3", 4, 3)
+
+	f.Fuzz(func(t *testing.T, text string, size, overlap int) {
+		if size < 1 || size > 64 || overlap < 0 || overlap >= size {
+			return
+		}
+		for _, strategy := range strategies {
+			opts := Options{Strategy: strategy, Size: size, Overlap: overlap}
+			chunks, err := Split(text, opts)
+			if err != nil {
+				t.Fatalf("%s: %v", strategy, err)
+			}
+			checkChunks(t, text, opts, chunks)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package chunking
+
+import "strings"
+
+// section is the text under one heading
+type section struct {
+	span
+	path []string
+}
+
+// splitMarkdown chunks each heading section on its own so no chunk mixes
+// sections, and tags chunks with the path of enclosing headings
+func splitMarkdown(text string, size, overlap int) []Chunk {
+	var chunks []Chunk
+	for _, sec := range markdownSections(text) {
+		units := recursiveUnits(text, sec.span, size, defaultSeparators)
+		for _, c := range pack(text, units, size, overlap) {
+			if c.Text == "" {
+				continue
+			}
+			c.HeadingPath = sec.path
+			chunks = append(chunks, c)
+		}
+	}
+	return chunks
+}
+
+// markdownSections splits text at ATX headings outside fenced code blocks.
+// Each section starts with its heading line.
+func markdownSections(text string) []section {
+	var sections []section
+	var path []string
+	var levels []int
+	current := section{span: span{0, 0}}
+	inFence := false
+
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		lineStart := offset
+		offset += len(line)
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		level, heading := headingLevel(trimmed)
+		if level == 0 {
+			continue
+		}
+
+		current.end = lineStart
+		if strings.TrimSpace(text[current.start:current.end]) != "" {
+			sections = append(sections, current)
+		}
+
+		for len(levels) > 0 && levels[len(levels)-1] >= level {
+			levels = levels[:len(levels)-1]
+			path = path[:len(path)-1]
+		}
+		levels = append(levels, level)
+		path = append(path, heading)
+
+		current = section{span: span{lineStart, lineStart}, path: append([]string(nil), path...)}
+	}
+
+	current.end = len(text)
+	if strings.TrimSpace(text[current.start:current.end]) != "" {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+// headingLevel parses an ATX heading such as "## Setup"
+func headingLevel(line string) (int, string) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(line) && line[level] != ' ' && line[level] != '\t') {
+		return 0, ""
+	}
+	heading := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#"))
+	if heading == "" {
+		return 0, ""
+	}
+	return level, heading
+}
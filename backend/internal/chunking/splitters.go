@@ -0,0 +1,73 @@
+package chunking
+
+import (
+	"regexp"
+	"strings"
+)
+
+// defaultSeparators are tried in order by the recursive splitter
+var defaultSeparators = []string{"\n\n", "\n", ". ", "; ", ", ", " "}
+
+// recursiveUnits splits s on the first separator it contains, recursing
+// into pieces that are still larger than size with the remaining separators
+func recursiveUnits(text string, s span, size int, separators []string) []span {
+	if CountTokens(text[s.start:s.end]) <= size {
+		return []span{s}
+	}
+
+	for i, sep := range separators {
+		if !strings.Contains(text[s.start:s.end], sep) {
+			continue
+		}
+		var units []span
+		for _, piece := range splitKeepSeparator(text, s, sep) {
+			units = append(units, recursiveUnits(text, piece, size, separators[i+1:])...)
+		}
+		return units
+	}
+
+	// No separator left: fall back to fixed windows without overlap
+	var units []span
+	for _, c := range splitFixed(text, s, size, 0) {
+		units = append(units, span{c.Start, c.End})
+	}
+	return units
+}
+
+// splitKeepSeparator splits s after each occurrence of sep so that the
+// pieces cover s without gaps
+func splitKeepSeparator(text string, s span, sep string) []span {
+	var pieces []span
+	start := s.start
+	for start < s.end {
+		idx := strings.Index(text[start:s.end], sep)
+		if idx < 0 {
+			pieces = append(pieces, span{start, s.end})
+			break
+		}
+		end := start + idx + len(sep)
+		pieces = append(pieces, span{start, end})
+		start = end
+	}
+	return pieces
+}
+
+// sentenceEnd matches terminal punctuation with closing quotes or brackets
+// followed by whitespace, and paragraph breaks
+var sentenceEnd = regexp.MustCompile(`[.!?…]+["'”’)\]]*\s+|\n\s*\n`)
+
+// sentenceUnits splits s into sentences; sentences longer than size are
+// split further with the recursive splitter
+func sentenceUnits(text string, s span, size int) []span {
+	var units []span
+	start := s.start
+	for _, loc := range sentenceEnd.FindAllStringIndex(text[s.start:s.end], -1) {
+		end := s.start + loc[1]
+		units = append(units, recursiveUnits(text, span{start, end}, size, []string{"; ", ", ", " "})...)
+		start = end
+	}
+	if start < s.end {
+		units = append(units, recursiveUnits(text, span{start, s.end}, size, []string{"; ", ", ", " "})...)
+	}
+	return units
+}
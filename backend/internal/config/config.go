@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -14,6 +15,112 @@ type Config struct {
 	OpenAIAPIKey  string
 	VectorDBURL   string
 	CORSOrigins   []string
+
+	TrustedProxies []string // addresses or CIDRs whose X-Forwarded-For is believed for client IPs
+
+	JobWorkers     int
+	JobMaxAttempts int
+	JobPools       string // extra worker pools as queue=concurrency, e.g. "crawl=2"
+	JobRoutes      string // job types to queues as type=queue, e.g. "knowledge.crawl=crawl"
+
+	AgentSchedulerInterval int // seconds between schedule checks
+
+	MaxUploadSize int64
+
+	CrawlUserAgent       string
+	CrawlMaxSize         int64
+	CrawlAllowPrivate    bool
+	CrawlRecrawlInterval int // default seconds between re-crawls of a web source
+	CrawlMaxSitemapURLs  int
+
+	ChunkSize       int
+	ChunkOverlap    int
+	ChunkStrategies string // per document type overrides, e.g. "pdf=sentence,csv=fixed"
+
+	EmbeddingProvider   string // "openai" or "local"; defaults to openai when an API key is set
+	EmbeddingBaseURL    string
+	EmbeddingModel      string
+	EmbeddingDimensions int
+	EmbeddingBatchSize  int
+	EmbeddingCacheTTL   int // hours; 0 disables the Redis cache
+
+	AnalyzeMaxBatch         int
+	StructuredOutputRetries int
+
+	LLMModels           []string // fallback chain, primary model first
+	LLMMaxRetries       int
+	LLMTimeout          int // seconds to wait for a model to start responding
+	LLMBreakerThreshold int // consecutive failures that open a model's circuit; 0 disables
+	LLMBreakerCooldown  int // seconds before an open circuit is probed again
+
+	LLMCacheRoutes     string // per-route opt-in, e.g. "generate=semantic,chat=exact:600"
+	LLMCacheTTL        int    // default seconds a cached response is reused
+	LLMCacheThreshold  float64
+	LLMCacheMaxEntries int
+
+	GuardrailBlocklist       []string // keywords, or "re:" regular expressions
+	GuardrailBlocklistFile   string   // one blocklist entry per line
+	GuardrailMaxInputLength  int      // characters; 0 disables
+	GuardrailMaxOutputLength int
+	GuardrailModeration      bool
+	GuardrailModerationURL   string
+	GuardrailModerationModel string
+	GuardrailActions         string // per check, e.g. "blocklist=redact,moderation=warn"
+
+	PIIRedaction    bool
+	PIITypes        string // detected before prompts leave the server
+	PIIRestoreTypes string // put back into responses
+
+	APIKeyMaxTTLDays int // longest allowed API key lifetime; 0 allows keys that never expire
+
+	PasswordLogin bool // local email and password sign-in and registration
+
+	PasswordMinLength    int
+	PasswordMinClasses   int    // of lower case, upper case, digits and symbols
+	PasswordBreachedFile string // known-breached passwords or their SHA-1 hashes, one per line
+
+	LoginMaxAccountFailures int // failed logins before an account is locked; 0 disables
+	LoginMaxIPFailures      int // failed logins before a client address is locked; 0 disables
+	LoginFailureWindow      int // seconds failures are counted
+	LoginLockoutDuration    int // seconds
+
+	TwoFactorIssuer        string   // name authenticator apps show
+	TwoFactorRequiredRoles []string // roles that must use 2FA with password logins
+	TwoFactorChallengeTTL  int      // seconds to enter the code after the password
+
+	AppURL                    string // frontend base URL for links in emails
+	EmailVerificationRequired bool
+	EmailVerificationTTL      int // hours a verification link is valid
+	PasswordResetTTL          int // minutes a reset link is valid
+
+	Mailer          string // "log", "file" or "smtp"
+	MailFrom        string
+	MailDir         string // where the file mailer writes .eml files
+	MailTemplateDir string // overrides for the built-in templates
+	SMTPHost        string
+	SMTPPort        int
+	SMTPUsername    string
+	SMTPPassword    string
+	SMTPSecurity    string // "starttls", "tls" or "none"
+
+	OIDCProviders     []OIDCProvider
+	OIDCBaseURL       string // public URL of this server, used for callback URLs
+	OIDCFrontendURL   string // where the browser is sent with the token after SSO; empty responds with JSON
+	OIDCAutoProvision bool   // create accounts for unknown users on first SSO login
+	OIDCLinkByEmail   bool   // attach SSO logins to existing accounts with the same verified email
+}
+
+// OIDCProvider configures one single sign-on identity provider, read from
+// OIDC_<NAME>_* variables for each name in OIDC_PROVIDERS
+type OIDCProvider struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RoleClaim    string // claim holding the user's IdP groups or roles, e.g. "groups"
+	RoleMap      string // claim values to local roles, e.g. "platform-admins=admin"
 }
 
 func Load() *Config {
@@ -26,9 +133,127 @@ func Load() *Config {
 		OpenAIAPIKey: getEnv("OPENAI_API_KEY", ""),
 		VectorDBURL:  getEnv("VECTOR_DB_URL", "http://localhost:6333"),
 		CORSOrigins:  []string{getEnv("CORS_ORIGINS", "http://localhost:3000")},
+
+		TrustedProxies: getEnvAsList("TRUSTED_PROXIES", nil),
+
+		JobWorkers:     getEnvAsInt("JOB_WORKERS", 4),
+		JobMaxAttempts: getEnvAsInt("JOB_MAX_ATTEMPTS", 5),
+		JobPools:       getEnv("JOB_POOLS", ""),
+		JobRoutes:      getEnv("JOB_ROUTES", ""),
+
+		AgentSchedulerInterval: getEnvAsInt("AGENT_SCHEDULER_INTERVAL", 30),
+
+		MaxUploadSize: getEnvAsBytes("MAX_UPLOAD_SIZE", 10<<20),
+
+		CrawlUserAgent:       getEnv("CRAWL_USER_AGENT", "LikeMindBot/1.0"),
+		CrawlMaxSize:         getEnvAsBytes("CRAWL_MAX_SIZE", 5<<20),
+		CrawlAllowPrivate:    getEnvAsBool("CRAWL_ALLOW_PRIVATE", false),
+		CrawlRecrawlInterval: getEnvAsInt("CRAWL_RECRAWL_INTERVAL", 86400),
+		CrawlMaxSitemapURLs:  getEnvAsInt("CRAWL_MAX_SITEMAP_URLS", 200),
+
+		ChunkSize:       getEnvAsInt("CHUNK_SIZE", 512),
+		ChunkOverlap:    getEnvAsInt("CHUNK_OVERLAP", 64),
+		ChunkStrategies: getEnv("CHUNK_STRATEGIES", ""),
+
+		EmbeddingProvider:   getEnv("EMBEDDING_PROVIDER", ""),
+		EmbeddingBaseURL:    getEnv("EMBEDDING_BASE_URL", "https://api.openai.com/v1"),
+		EmbeddingModel:      getEnv("EMBEDDING_MODEL", "text-embedding-3-small"),
+		EmbeddingDimensions: getEnvAsInt("EMBEDDING_DIMENSIONS", 0),
+		EmbeddingBatchSize:  getEnvAsInt("EMBEDDING_BATCH_SIZE", 64),
+		EmbeddingCacheTTL:   getEnvAsInt("EMBEDDING_CACHE_TTL", 720),
+
+		AnalyzeMaxBatch:         getEnvAsInt("ANALYZE_MAX_BATCH", 20),
+		StructuredOutputRetries: getEnvAsInt("STRUCTURED_OUTPUT_RETRIES", 2),
+
+		LLMModels:           getEnvAsList("LLM_MODELS", []string{"gpt-3.5-turbo"}),
+		LLMMaxRetries:       getEnvAsInt("LLM_MAX_RETRIES", 2),
+		LLMTimeout:          getEnvAsInt("LLM_TIMEOUT", 60),
+		LLMBreakerThreshold: getEnvAsInt("LLM_BREAKER_THRESHOLD", 5),
+		LLMBreakerCooldown:  getEnvAsInt("LLM_BREAKER_COOLDOWN", 30),
+
+		LLMCacheRoutes:     getEnv("LLM_CACHE_ROUTES", ""),
+		LLMCacheTTL:        getEnvAsInt("LLM_CACHE_TTL", 3600),
+		LLMCacheThreshold:  getEnvAsFloat("LLM_CACHE_THRESHOLD", 0.95),
+		LLMCacheMaxEntries: getEnvAsInt("LLM_CACHE_MAX_ENTRIES", 500),
+
+		GuardrailBlocklist:       getEnvAsList("GUARDRAIL_BLOCKLIST", nil),
+		GuardrailBlocklistFile:   getEnv("GUARDRAIL_BLOCKLIST_FILE", ""),
+		GuardrailMaxInputLength:  getEnvAsInt("GUARDRAIL_MAX_INPUT_LENGTH", 0),
+		GuardrailMaxOutputLength: getEnvAsInt("GUARDRAIL_MAX_OUTPUT_LENGTH", 0),
+		GuardrailModeration:      getEnvAsBool("GUARDRAIL_MODERATION", false),
+		GuardrailModerationURL:   getEnv("GUARDRAIL_MODERATION_URL", "https://api.openai.com/v1"),
+		GuardrailModerationModel: getEnv("GUARDRAIL_MODERATION_MODEL", "omni-moderation-latest"),
+		GuardrailActions:         getEnv("GUARDRAIL_ACTIONS", ""),
+
+		PIIRedaction:    getEnvAsBool("PII_REDACTION", true),
+		PIITypes:        getEnv("PII_TYPES", "email,phone,credit_card,iban,secret"),
+		PIIRestoreTypes: getEnv("PII_RESTORE_TYPES", "email,phone,iban"),
+
+		APIKeyMaxTTLDays: getEnvAsInt("API_KEY_MAX_TTL_DAYS", 365),
+
+		PasswordLogin: getEnvAsBool("PASSWORD_LOGIN", true),
+
+		PasswordMinLength:    getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMinClasses:   getEnvAsInt("PASSWORD_MIN_CLASSES", 0),
+		PasswordBreachedFile: getEnv("PASSWORD_BREACHED_FILE", ""),
+
+		LoginMaxAccountFailures: getEnvAsInt("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+		LoginMaxIPFailures:      getEnvAsInt("LOGIN_MAX_IP_FAILURES", 50),
+		LoginFailureWindow:      getEnvAsInt("LOGIN_FAILURE_WINDOW", 900),
+		LoginLockoutDuration:    getEnvAsInt("LOGIN_LOCKOUT_DURATION", 900),
+
+		TwoFactorIssuer:        getEnv("TWO_FACTOR_ISSUER", "LikeMind"),
+		TwoFactorRequiredRoles: getEnvAsList("TWO_FACTOR_REQUIRED_ROLES", nil),
+		TwoFactorChallengeTTL:  getEnvAsInt("TWO_FACTOR_CHALLENGE_TTL", 300),
+
+		AppURL:                    getEnv("APP_URL", "http://localhost:3000"),
+		EmailVerificationRequired: getEnvAsBool("EMAIL_VERIFICATION_REQUIRED", false),
+		EmailVerificationTTL:      getEnvAsInt("EMAIL_VERIFICATION_TTL", 48),
+		PasswordResetTTL:          getEnvAsInt("PASSWORD_RESET_TTL", 60),
+
+		Mailer:          getEnv("MAILER", "log"),
+		MailFrom:        getEnv("MAIL_FROM", "LikeMind <no-reply@localhost>"),
+		MailDir:         getEnv("MAIL_DIR", "./mail"),
+		MailTemplateDir: getEnv("MAIL_TEMPLATE_DIR", ""),
+		SMTPHost:        getEnv("SMTP_HOST", ""),
+		SMTPPort:        getEnvAsInt("SMTP_PORT", 0),
+		SMTPUsername:    getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:    getEnv("SMTP_PASSWORD", ""),
+		SMTPSecurity:    getEnv("SMTP_SECURITY", "starttls"),
+
+		OIDCProviders:     loadOIDCProviders(),
+		OIDCBaseURL:       strings.TrimSuffix(getEnv("OIDC_BASE_URL", "http://localhost:8080"), "/"),
+		OIDCFrontendURL:   getEnv("OIDC_FRONTEND_URL", ""),
+		OIDCAutoProvision: getEnvAsBool("OIDC_AUTO_PROVISION", true),
+		OIDCLinkByEmail:   getEnvAsBool("OIDC_LINK_BY_EMAIL", true),
 	}
 }
 
+// loadOIDCProviders reads the providers named in OIDC_PROVIDERS, skipping
+// any without an issuer or client ID
+func loadOIDCProviders() []OIDCProvider {
+	var providers []OIDCProvider
+	for _, name := range getEnvAsList("OIDC_PROVIDERS", nil) {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		provider := OIDCProvider{
+			Name:         name,
+			DisplayName:  getEnv(prefix+"DISPLAY_NAME", name),
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+			RoleClaim:    getEnv(prefix+"ROLE_CLAIM", ""),
+			RoleMap:      getEnv(prefix+"ROLE_MAP", ""),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -45,6 +270,15 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -53,3 +287,42 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+// getEnvAsList splits a comma-separated value, dropping empty entries
+func getEnvAsList(key string, defaultValue []string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return defaultValue
+	}
+	return values
+}
+
+// getEnvAsBytes parses sizes such as "10MB", "512KB" or a plain byte count
+func getEnvAsBytes(key string, defaultValue int64) int64 {
+	value := strings.ToUpper(strings.TrimSpace(os.Getenv(key)))
+	if value == "" {
+		return defaultValue
+	}
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			multiplier = unit.size
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			break
+		}
+	}
+
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil && n > 0 {
+		return n * multiplier
+	}
+	return defaultValue
+}
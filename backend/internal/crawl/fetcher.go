@@ -0,0 +1,351 @@
+// Package crawl fetches web pages and sitemaps politely: it honours
+// robots.txt, bounds response sizes, supports conditional requests and
+// refuses private network addresses unless explicitly allowed.
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrDisallowed is returned when robots.txt forbids fetching a URL
+	ErrDisallowed = errors.New("disallowed by robots.txt")
+	// ErrTooLarge is returned when a response exceeds Options.MaxBytes
+	ErrTooLarge = errors.New("response too large")
+	// ErrInvalidURL is returned for malformed or non-HTTP URLs
+	ErrInvalidURL = errors.New("invalid url")
+	// ErrPrivateAddress is returned when a host resolves to a private network
+	ErrPrivateAddress = errors.New("private network addresses are not allowed")
+	// ErrFetchFailed wraps network and HTTP failures of the remote site
+	ErrFetchFailed = errors.New("failed to fetch")
+)
+
+const (
+	robotsCacheTTL = time.Hour
+	maxRobotsBytes = 512 << 10
+	maxRedirects   = 5
+)
+
+// Options configures a Fetcher
+type Options struct {
+	UserAgent string
+	MaxBytes  int64
+	Timeout   time.Duration
+	// AllowPrivate permits loopback and private addresses, e.g. for tests
+	// against an httptest server
+	AllowPrivate bool
+}
+
+// Result is the outcome of a fetch
+type Result struct {
+	URL          string // final URL after redirects
+	StatusCode   int
+	NotModified  bool
+	Body         []byte
+	ContentType  string
+	ETag         string
+	LastModified string
+}
+
+// HTTPError is returned for non-success responses
+type HTTPError struct {
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("unexpected status %d", e.StatusCode)
+}
+
+func (e *HTTPError) Unwrap() error {
+	return ErrFetchFailed
+}
+
+// Fetcher retrieves pages on behalf of the knowledge base
+type Fetcher struct {
+	client *http.Client
+	opts   Options
+
+	mu     sync.Mutex
+	robots map[string]robotsEntry
+}
+
+type robotsEntry struct {
+	rules   *robotsRules
+	expires time.Time
+}
+
+func NewFetcher(opts Options) *Fetcher {
+	if opts.UserAgent == "" {
+		opts.UserAgent = "LikeMindBot/1.0"
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 5 << 20
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+
+	f := &Fetcher{opts: opts, robots: make(map[string]robotsEntry)}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !opts.AllowPrivate {
+		// Checked after DNS resolution so rebinding cannot bypass it
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	f.client = &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Path == "/robots.txt" {
+				return nil
+			}
+			return f.checkRobots(req.Context(), req.URL)
+		},
+	}
+	return f
+}
+
+// NormalizeURL validates an http(s) URL and returns it with a lower-case
+// scheme and host and without a fragment
+func NormalizeURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%w: only absolute http and https URLs are supported", ErrInvalidURL)
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String(), nil
+}
+
+// MaxBytes is the largest response body Fetch accepts
+func (f *Fetcher) MaxBytes() int64 {
+	return f.opts.MaxBytes
+}
+
+// Fetch retrieves rawURL. When etag or lastModified are set the request is
+// conditional and an unchanged page yields Result.NotModified.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL, etag, lastModified string) (*Result, error) {
+	normalized, err := NormalizeURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(normalized)
+	if err := f.checkRobots(ctx, u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, normalized, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	req.Header.Set("User-Agent", f.opts.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,text/plain;q=0.8,*/*;q=0.5")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrDisallowed) {
+			return nil, ErrDisallowed
+		}
+		if errors.Is(err, ErrPrivateAddress) {
+			return nil, ErrPrivateAddress
+		}
+		return nil, fmt.Errorf("%w %s: %w", ErrFetchFailed, normalized, err)
+	}
+	defer resp.Body.Close()
+
+	result := &Result{
+		URL:          resp.Request.URL.String(),
+		StatusCode:   resp.StatusCode,
+		ContentType:  resp.Header.Get("Content-Type"),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		result.NotModified = true
+		return result, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &HTTPError{StatusCode: resp.StatusCode}
+	}
+
+	body, err := readLimited(resp, f.opts.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	result.Body = body
+	return result, nil
+}
+
+// PageURLs returns the URLs listed by an already fetched sitemap body
+func (f *Fetcher) PageURLs(ctx context.Context, body []byte, limit int) ([]string, error) {
+	return f.collectSitemap(ctx, body, limit, 1)
+}
+
+func (f *Fetcher) collectSitemap(ctx context.Context, body []byte, limit, depth int) ([]string, error) {
+	sitemap, err := ParseSitemap(body)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var urls []string
+	add := func(list []string) {
+		for _, u := range list {
+			if len(urls) >= limit {
+				return
+			}
+			normalized, err := NormalizeURL(u)
+			if err != nil || seen[normalized] {
+				continue
+			}
+			seen[normalized] = true
+			urls = append(urls, normalized)
+		}
+	}
+	add(sitemap.URLs)
+
+	if depth > 0 {
+		for _, child := range sitemap.Sitemaps {
+			if len(urls) >= limit {
+				break
+			}
+			result, err := f.Fetch(ctx, child, "", "")
+			if err != nil {
+				continue
+			}
+			// add stops at the limit; asking the child for less would let
+			// duplicates of pages already seen crowd out new ones
+			nested, err := f.collectSitemap(ctx, result.Body, limit, depth-1)
+			if err != nil {
+				continue
+			}
+			add(nested)
+		}
+	}
+	return urls, nil
+}
+
+// checkRobots consults the cached robots.txt of u's host
+func (f *Fetcher) checkRobots(ctx context.Context, u *url.URL) error {
+	key := u.Scheme + "://" + u.Host
+
+	f.mu.Lock()
+	entry, ok := f.robots[key]
+	f.mu.Unlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		rules, err := f.fetchRobots(ctx, key)
+		if err != nil {
+			return err
+		}
+		entry = robotsEntry{rules: rules, expires: time.Now().Add(robotsCacheTTL)}
+		f.mu.Lock()
+		f.robots[key] = entry
+		f.mu.Unlock()
+	}
+
+	if !entry.rules.allowed(u.EscapedPath()) {
+		return ErrDisallowed
+	}
+	return nil
+}
+
+// fetchRobots downloads robots.txt. A missing file allows everything; an
+// unreachable one or a server error disallows everything (RFC 9309 §2.3.1).
+// Private addresses are reported as an error rather than cached.
+func (f *Fetcher) fetchRobots(ctx context.Context, origin string) (*robotsRules, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	req.Header.Set("User-Agent", f.opts.UserAgent)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrPrivateAddress) {
+			return nil, ErrPrivateAddress
+		}
+		return disallowAll, nil
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return disallowAll, nil
+	case resp.StatusCode >= 300:
+		return allowAll, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsBytes))
+	if err != nil {
+		return disallowAll, nil
+	}
+	return parseRobots(data, productToken(f.opts.UserAgent)), nil
+}
+
+func readLimited(resp *http.Response, maxBytes int64) ([]byte, error) {
+	if resp.ContentLength > maxBytes {
+		return nil, ErrTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+// productToken is the robots.txt name of a user agent, e.g. "likemindbot"
+// for "LikeMindBot/1.0 (+https://example.com)"
+func productToken(userAgent string) string {
+	token, _, _ := strings.Cut(userAgent, "/")
+	token, _, _ = strings.Cut(token, " ")
+	return strings.ToLower(token)
+}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast()
+}
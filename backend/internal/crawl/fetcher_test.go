@@ -0,0 +1,289 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestSite serves robots.txt and the given pages from an httptest server
+func newTestSite(t *testing.T, robots string, pages map[string]http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		if robots == "" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, robots)
+	})
+	for path, handler := range pages {
+		mux.HandleFunc(path, handler)
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func servePage(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, body)
+	}
+}
+
+func newTestFetcher(opts Options) *Fetcher {
+	opts.AllowPrivate = true
+	return NewFetcher(opts)
+}
+
+func TestFetchRespectsRobots(t *testing.T) {
+	robots := "User-agent: *\nDisallow: /\n\n" +
+		"User-agent: LikeMindBot\nDisallow: /private\nAllow: /private/open\n"
+	page := servePage("<p>hello</p>")
+	srv := newTestSite(t, robots, map[string]http.HandlerFunc{
+		"/":                page,
+		"/private/":        page,
+		"/private/open":    page,
+		"/to-private":      func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/private/secret", http.StatusFound) },
+		"/private/secret/": page,
+	})
+	f := newTestFetcher(Options{})
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		path string
+		want error
+	}{
+		{"/", nil},
+		{"/private/secret", ErrDisallowed},
+		{"/private/open", nil},
+		{"/to-private", ErrDisallowed},
+	} {
+		_, err := f.Fetch(ctx, srv.URL+tc.path, "", "")
+		if !errors.Is(err, tc.want) {
+			t.Errorf("Fetch(%s) = %v, want %v", tc.path, err, tc.want)
+		}
+	}
+
+	// Another agent falls back to the * group
+	other := newTestFetcher(Options{UserAgent: "OtherBot/2.0"})
+	if _, err := other.Fetch(ctx, srv.URL+"/", "", ""); !errors.Is(err, ErrDisallowed) {
+		t.Errorf("Fetch as OtherBot = %v, want %v", err, ErrDisallowed)
+	}
+}
+
+func TestFetchRobotsStatus(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		status int
+		want   error
+	}{
+		{http.StatusNotFound, nil},
+		{http.StatusForbidden, nil},
+		{http.StatusServiceUnavailable, ErrDisallowed},
+	} {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+		})
+		mux.HandleFunc("/", servePage("<p>hello</p>"))
+		srv := httptest.NewServer(mux)
+
+		_, err := newTestFetcher(Options{}).Fetch(ctx, srv.URL+"/", "", "")
+		if !errors.Is(err, tc.want) {
+			t.Errorf("Fetch with robots.txt status %d = %v, want %v", tc.status, err, tc.want)
+		}
+		srv.Close()
+	}
+}
+
+func TestFetchCachesRobots(t *testing.T) {
+	var robotsHits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		robotsHits.Add(1)
+		fmt.Fprint(w, "User-agent: *\nAllow: /\n")
+	})
+	mux.HandleFunc("/", servePage("<p>hello</p>"))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	f := newTestFetcher(Options{})
+	for i := 0; i < 3; i++ {
+		if _, err := f.Fetch(context.Background(), srv.URL+"/", "", ""); err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+	}
+	if n := robotsHits.Load(); n != 1 {
+		t.Fatalf("robots.txt fetched %d times, want 1", n)
+	}
+}
+
+func TestFetchSizeLimit(t *testing.T) {
+	body := strings.Repeat("a", 2048)
+	srv := newTestSite(t, "", map[string]http.HandlerFunc{
+		"/small": servePage(body[:1024]),
+		"/declared": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+			fmt.Fprint(w, body)
+		},
+		// Flushing first sends the body chunked, without a length
+		"/chunked": func(w http.ResponseWriter, r *http.Request) {
+			w.(http.Flusher).Flush()
+			fmt.Fprint(w, body)
+		},
+	})
+	f := newTestFetcher(Options{MaxBytes: 1024})
+	ctx := context.Background()
+
+	result, err := f.Fetch(ctx, srv.URL+"/small", "", "")
+	if err != nil || len(result.Body) != 1024 {
+		t.Fatalf("Fetch(/small) = %v, %v; want the whole body", result, err)
+	}
+	for _, path := range []string{"/declared", "/chunked"} {
+		if _, err := f.Fetch(ctx, srv.URL+path, "", ""); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("Fetch(%s) = %v, want %v", path, err, ErrTooLarge)
+		}
+	}
+}
+
+func TestFetchConditional(t *testing.T) {
+	const etag = `"v1"`
+	const lastModified = "Mon, 02 Sep 2024 10:00:00 GMT"
+	srv := newTestSite(t, "", map[string]http.HandlerFunc{
+		"/etag": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			fmt.Fprint(w, "<p>hello</p>")
+		},
+		"/modified": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Last-Modified", lastModified)
+			if r.Header.Get("If-Modified-Since") == lastModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			fmt.Fprint(w, "<p>hello</p>")
+		},
+	})
+	f := newTestFetcher(Options{})
+	ctx := context.Background()
+
+	first, err := f.Fetch(ctx, srv.URL+"/etag", "", "")
+	if err != nil || first.NotModified || first.ETag != etag {
+		t.Fatalf("first Fetch(/etag) = %+v, %v; want the page with its ETag", first, err)
+	}
+	again, err := f.Fetch(ctx, srv.URL+"/etag", first.ETag, "")
+	if err != nil || !again.NotModified || again.Body != nil {
+		t.Fatalf("conditional Fetch(/etag) = %+v, %v; want NotModified", again, err)
+	}
+
+	first, err = f.Fetch(ctx, srv.URL+"/modified", "", "")
+	if err != nil || first.NotModified || first.LastModified != lastModified {
+		t.Fatalf("first Fetch(/modified) = %+v, %v; want the page with Last-Modified", first, err)
+	}
+	again, err = f.Fetch(ctx, srv.URL+"/modified", "", first.LastModified)
+	if err != nil || !again.NotModified {
+		t.Fatalf("conditional Fetch(/modified) = %+v, %v; want NotModified", again, err)
+	}
+	// A stale validator gets the page again
+	again, err = f.Fetch(ctx, srv.URL+"/etag", `"v0"`, "")
+	if err != nil || again.NotModified {
+		t.Fatalf("Fetch(/etag) with a stale ETag = %+v, %v; want the page", again, err)
+	}
+}
+
+func TestFetchHTTPError(t *testing.T) {
+	srv := newTestSite(t, "", nil)
+	_, err := newTestFetcher(Options{}).Fetch(context.Background(), srv.URL+"/missing", "", "")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound || !errors.Is(err, ErrFetchFailed) {
+		t.Fatalf("Fetch(/missing) = %v, want a 404 HTTPError", err)
+	}
+}
+
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	srv := newTestSite(t, "", map[string]http.HandlerFunc{"/": servePage("<p>hello</p>")})
+	_, err := NewFetcher(Options{}).Fetch(context.Background(), srv.URL+"/", "", "")
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("Fetch(%s) = %v, want %v", srv.URL, err, ErrPrivateAddress)
+	}
+}
+
+func TestPageURLsExpandsSitemapIndex(t *testing.T) {
+	var srv *httptest.Server
+	urlset := func(paths ...string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `<?xml version="1.0"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+			for _, p := range paths {
+				fmt.Fprintf(w, "<url><loc>%s%s</loc></url>", srv.URL, p)
+			}
+			fmt.Fprint(w, "</urlset>")
+		}
+	}
+	srv = newTestSite(t, "User-agent: *\nDisallow: /hidden\n", map[string]http.HandlerFunc{
+		"/a.xml":      urlset("/a", "/b", "/a#top"),
+		"/b.xml":      urlset("/b", "/c", "/d"),
+		"/hidden.xml": urlset("/secret"),
+		"/nested.xml": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/a.xml</loc></sitemap></sitemapindex>`, srv.URL)
+		},
+	})
+	index := fmt.Sprintf(`<?xml version="1.0"?><sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`+
+		`<sitemap><loc>%[1]s/a.xml</loc></sitemap><sitemap><loc>%[1]s/hidden.xml</loc></sitemap>`+
+		`<sitemap><loc>%[1]s/nested.xml</loc></sitemap><sitemap><loc>%[1]s/b.xml</loc></sitemap></sitemapindex>`, srv.URL)
+	if !IsSitemap([]byte(index)) {
+		t.Fatal("IsSitemap(index) = false")
+	}
+	f := newTestFetcher(Options{})
+	ctx := context.Background()
+
+	urls, err := f.PageURLs(ctx, []byte(index), 10)
+	if err != nil {
+		t.Fatalf("PageURLs: %v", err)
+	}
+	// Duplicates and fragments collapse, disallowed child sitemaps and
+	// indexes nested deeper than one level are skipped
+	want := []string{srv.URL + "/a", srv.URL + "/b", srv.URL + "/c", srv.URL + "/d"}
+	if strings.Join(urls, " ") != strings.Join(want, " ") {
+		t.Fatalf("PageURLs = %v, want %v", urls, want)
+	}
+
+	urls, err = f.PageURLs(ctx, []byte(index), 3)
+	if err != nil || len(urls) != 3 {
+		t.Fatalf("PageURLs with limit 3 = %v, %v; want 3 URLs", urls, err)
+	}
+
+	if _, err := f.PageURLs(ctx, []byte("<urlset><url>"), 10); err == nil {
+		t.Fatal("PageURLs accepted a malformed sitemap")
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	for _, tc := range []struct{ raw, want string }{
+		{" HTTPS://Example.COM ", "https://example.com/"},
+		{"http://example.com/a?b=1#frag", "http://example.com/a?b=1"},
+		{"ftp://example.com/", ""},
+		{"/relative", ""},
+		{"http://", ""},
+	} {
+		got, err := NormalizeURL(tc.raw)
+		if tc.want == "" {
+			if !errors.Is(err, ErrInvalidURL) {
+				t.Errorf("NormalizeURL(%q) = %q, %v; want %v", tc.raw, got, err, ErrInvalidURL)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("NormalizeURL(%q) = %q, %v; want %q", tc.raw, got, err, tc.want)
+		}
+	}
+}
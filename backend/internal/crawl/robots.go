@@ -0,0 +1,145 @@
+package crawl
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// robotsRules is the rule group of a robots.txt file that applies to our user agent
+type robotsRules struct {
+	rules []robotsRule
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// allowAll and disallowAll are used when robots.txt is missing or unreachable
+var (
+	allowAll    = &robotsRules{}
+	disallowAll = &robotsRules{rules: []robotsRule{{allow: false, pattern: "/"}}}
+)
+
+// parseRobots selects the group whose user-agent token best matches agent,
+// falling back to the "*" group, as described in RFC 9309
+func parseRobots(data []byte, agent string) *robotsRules {
+	agent = strings.ToLower(agent)
+
+	type group struct {
+		agents []string
+		rules  []robotsRule
+	}
+	var groups []*group
+	var current *group
+	lastWasAgent := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !lastWasAgent || current == nil {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			lastWasAgent = true
+		case "allow", "disallow":
+			lastWasAgent = false
+			if current == nil {
+				continue
+			}
+			// An empty Disallow allows everything and adds no rule
+			if value == "" {
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{allow: key == "allow", pattern: value})
+		default:
+			lastWasAgent = false
+		}
+	}
+
+	var best, wildcard *group
+	bestLen := 0
+	for _, g := range groups {
+		for _, a := range g.agents {
+			if a == "*" {
+				if wildcard == nil {
+					wildcard = g
+				}
+				continue
+			}
+			if strings.Contains(agent, a) && len(a) > bestLen {
+				best, bestLen = g, len(a)
+			}
+		}
+	}
+	if best == nil {
+		best = wildcard
+	}
+	if best == nil {
+		return allowAll
+	}
+	return &robotsRules{rules: best.rules}
+}
+
+// allowed applies the longest matching rule; on a tie Allow wins
+func (r *robotsRules) allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+
+	allowed, matchLen := true, -1
+	for _, rule := range r.rules {
+		if !matchRobotsPattern(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > matchLen || (len(rule.pattern) == matchLen && rule.allow) {
+			allowed, matchLen = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// matchRobotsPattern matches a path prefix pattern supporting "*" wildcards
+// and a trailing "$" end anchor
+func matchRobotsPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return strings.HasSuffix(rest, part)
+		}
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(part):]
+	}
+	if anchored {
+		return rest == ""
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package crawl
+
+import "testing"
+
+func TestParseRobots(t *testing.T) {
+	const robots = `# comments are ignored
+User-agent: *
+Disallow: /
+
+User-agent: googlebot
+User-agent: likemindbot
+Disallow: /private
+Allow: /private/open
+Disallow: /*.pdf$
+Disallow:
+
+User-agent: likemindbot-news
+Allow: /
+`
+	for _, tc := range []struct {
+		agent, path string
+		want        bool
+	}{
+		{"likemindbot", "/", true},
+		{"likemindbot", "/robots.txt", true},
+		{"likemindbot", "/private", false},
+		{"likemindbot", "/private/page", false},
+		{"likemindbot", "/private/open/page", true},
+		{"likemindbot", "/files/report.pdf", false},
+		{"likemindbot", "/files/report.pdf?download=1", true},
+		// The longest matching agent token wins
+		{"likemindbot-news", "/private", true},
+		{"otherbot", "/", false},
+		{"otherbot", "/robots.txt", true},
+	} {
+		if got := parseRobots([]byte(robots), tc.agent).allowed(tc.path); got != tc.want {
+			t.Errorf("%s: allowed(%q) = %v, want %v", tc.agent, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestParseRobotsWithoutGroups(t *testing.T) {
+	for _, data := range []string{"", "Disallow: /\n", "User-agent: otherbot\nDisallow: /\n"} {
+		if !parseRobots([]byte(data), "likemindbot").allowed("/page") {
+			t.Errorf("parseRobots(%q) disallows /page, want everything allowed", data)
+		}
+	}
+}
+
+func TestMatchRobotsPattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/a", "/a/b", true},
+		{"/a", "/b", false},
+		{"/a$", "/a", true},
+		{"/a$", "/a/b", false},
+		{"/*/b", "/x/y/b", true},
+		{"/*/b$", "/x/b/c", false},
+		{"/*.php", "/index.php?x=1", true},
+		{"/*.php$", "/index.php?x=1", false},
+	} {
+		if got := matchRobotsPattern(tc.pattern, tc.path); got != tc.want {
+			t.Errorf("matchRobotsPattern(%q, %q) = %v, want %v", tc.pattern, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestProductToken(t *testing.T) {
+	for ua, want := range map[string]string{
+		"LikeMindBot/1.0":                        "likemindbot",
+		"LikeMindBot/1.0 (+https://example.com)": "likemindbot",
+		"Crawler (+https://example.com)":         "crawler",
+	} {
+		if got := productToken(ua); got != want {
+			t.Errorf("productToken(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+// Package cron parses standard five-field cron expressions and computes
+// their next activation time in a given time zone.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression. Each field is a bit set of allowed values.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// domStar and dowStar record day fields starting with "*" or "?"; when
+	// both day fields are restricted a time matches if either of them does,
+	// as in Vixie cron, so "*/2" still counts as unrestricted
+	domStar, dowStar bool
+}
+
+// allHours is the hour set of expressions that run every hour
+const allHours = 1<<24 - 1
+
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minutes = bounds{0, 59, nil}
+	hours   = bounds{0, 23, nil}
+	doms    = bounds{1, 31, nil}
+	months  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dows = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a five-field expression (minute hour day-of-month month
+// day-of-week) or one of the @yearly, @monthly, @weekly, @daily and @hourly
+// descriptors.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if d, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = d
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron: expected 5 fields, got %d in %q", len(fields), expr)
+	}
+
+	s := &Schedule{}
+	var err error
+	if s.minute, err = parseField(fields[0], minutes); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[1], hours); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(fields[2], doms); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[3], months); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(fields[4], dows); err != nil {
+		return nil, err
+	}
+	// 7 is an alias for Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*") || strings.HasPrefix(fields[2], "?")
+	s.dowStar = strings.HasPrefix(fields[4], "*") || strings.HasPrefix(fields[4], "?")
+
+	return s, nil
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := uint(1)
+		if rangePart, stepPart, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.ParseUint(stepPart, 10, 8)
+			if err != nil || n == 0 {
+				return 0, fmt.Errorf("cron: invalid step in %q", part)
+			}
+			step = uint(n)
+			part = rangePart
+		}
+
+		var lo, hi uint
+		switch {
+		case part == "*" || part == "?":
+			lo, hi = b.min, b.max
+		case strings.Contains(part, "-"):
+			loPart, hiPart, _ := strings.Cut(part, "-")
+			var err error
+			if lo, err = parseValue(loPart, b); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(hiPart, b); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := parseValue(part, b)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			if step > 1 {
+				hi = b.max
+			}
+		}
+
+		if lo > hi {
+			return 0, fmt.Errorf("cron: invalid range %q", part)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("cron: invalid value %q", s)
+	}
+	if uint(n) < b.min || uint(n) > b.max {
+		return 0, fmt.Errorf("cron: value %d out of range [%d, %d]", n, b.min, b.max)
+	}
+	return uint(n), nil
+}
+
+// Next returns the first activation strictly after t, evaluated in t's
+// location. It returns the zero time if no activation exists within five years.
+//
+// Around DST changes it behaves like Vixie cron: activations that fall in a
+// skipped hour run at the first minute after it, and expressions restricted
+// to certain hours run only once in a repeated hour, while those running
+// every hour run in both.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.skippedActivation(t) {
+			return t
+		}
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = advance(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = advance(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			// Step in absolute time so DST gaps are skipped rather than revisited
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 || (s.hour != allHours && repeated(t)) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// skippedActivation reports whether t directly follows a DST gap that
+// skipped one of the schedule's activations
+func (s *Schedule) skippedActivation(t time.Time) bool {
+	for wall := civil(t.Add(-time.Minute)).Add(time.Minute); wall.Before(civil(t)); wall = wall.Add(time.Minute) {
+		if s.matches(wall) {
+			return true
+		}
+	}
+	return false
+}
+
+// repeated reports whether the wall clock already showed t's time, during
+// the hour a DST change repeats
+func repeated(t time.Time) bool {
+	_, before := t.Add(-3 * time.Hour).Zone()
+	_, now := t.Zone()
+	if before <= now {
+		return false
+	}
+	earlier := t.Add(-time.Duration(before-now) * time.Second)
+	return civil(earlier).Equal(civil(t))
+}
+
+// civil returns t's wall clock time as a UTC time, which has no DST
+func civil(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+func (s *Schedule) matches(t time.Time) bool {
+	return s.month&(1<<uint(t.Month())) != 0 && s.dayMatches(t) &&
+		s.hour&(1<<uint(t.Hour())) != 0 && s.minute&(1<<uint(t.Minute())) != 0
+}
+
+// advance returns next unless DST normalization moved it backwards, in which
+// case it steps an hour forward from t so the search always makes progress.
+func advance(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(time.Duration(60-t.Minute()) * time.Minute)
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
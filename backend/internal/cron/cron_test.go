@@ -0,0 +1,143 @@
+package cron
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+	return loc
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"* * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"* * * foo *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", expr)
+		}
+	}
+	for _, expr := range []string{"@daily", "@Weekly", "0 0 * jan-mar mon-fri", "*/5 * ? * ?"} {
+		if _, err := Parse(expr); err != nil {
+			t.Errorf("Parse(%q): %v", expr, err)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	utc := time.UTC
+	for _, tc := range []struct {
+		name, expr string
+		from, want time.Time
+	}{
+		{"step and range", "5-20/5 9-17 * * mon-fri",
+			time.Date(2024, 9, 6, 17, 20, 0, 0, utc), time.Date(2024, 9, 9, 9, 5, 0, 0, utc)},
+		{"next step in range", "5-20/5 9-17 * * mon-fri",
+			time.Date(2024, 9, 9, 9, 5, 0, 0, utc), time.Date(2024, 9, 9, 9, 10, 0, 0, utc)},
+		{"step from a value", "10/20 * * * *",
+			time.Date(2024, 9, 9, 9, 31, 0, 0, utc), time.Date(2024, 9, 9, 9, 50, 0, 0, utc)},
+		{"month names", "0 0 1 jan,jul *",
+			time.Date(2024, 2, 1, 0, 0, 0, 0, utc), time.Date(2024, 7, 1, 0, 0, 0, 0, utc)},
+		{"7 is Sunday", "0 12 * * 7",
+			time.Date(2024, 9, 7, 0, 0, 0, 0, utc), time.Date(2024, 9, 8, 12, 0, 0, 0, utc)},
+		{"strictly after", "@hourly",
+			time.Date(2024, 9, 7, 10, 0, 0, 0, utc), time.Date(2024, 9, 7, 11, 0, 0, 0, utc)},
+		{"seconds are ignored", "@hourly",
+			time.Date(2024, 9, 7, 10, 59, 30, 0, utc), time.Date(2024, 9, 7, 11, 0, 0, 0, utc)},
+		// Both day fields restricted: the 13th or any Friday
+		{"day OR weekday, weekday first", "0 0 13 * fri",
+			time.Date(2024, 9, 1, 0, 0, 0, 0, utc), time.Date(2024, 9, 6, 0, 0, 0, 0, utc)},
+		{"day OR weekday, day first", "0 0 13 * fri",
+			time.Date(2024, 10, 11, 0, 0, 0, 0, utc), time.Date(2024, 10, 13, 0, 0, 0, 0, utc)},
+		// A day field starting with * counts as unrestricted: odd days AND Mondays
+		{"star step is AND", "0 0 */2 * mon",
+			time.Date(2024, 9, 1, 0, 0, 0, 0, utc), time.Date(2024, 9, 9, 0, 0, 0, 0, utc)},
+		{"star step weekday is AND", "0 0 13 * */2",
+			time.Date(2024, 9, 1, 0, 0, 0, 0, utc), time.Date(2024, 10, 13, 0, 0, 0, 0, utc)},
+		{"leap day", "0 0 29 2 *",
+			time.Date(2024, 3, 1, 0, 0, 0, 0, utc), time.Date(2028, 2, 29, 0, 0, 0, 0, utc)},
+		{"never", "0 0 30 2 *",
+			time.Date(2024, 1, 1, 0, 0, 0, 0, utc), time.Time{}},
+	} {
+		s, err := Parse(tc.expr)
+		if err != nil {
+			t.Fatalf("%s: Parse(%q): %v", tc.name, tc.expr, err)
+		}
+		if got := s.Next(tc.from); !got.Equal(tc.want) {
+			t.Errorf("%s: Next(%q, %v) = %v, want %v", tc.name, tc.expr, tc.from, got, tc.want)
+		}
+	}
+}
+
+func TestNextAcrossDST(t *testing.T) {
+	ny := mustLocation(t, "America/New_York")
+	edt := time.FixedZone("EDT", -4*3600)
+	est := time.FixedZone("EST", -5*3600)
+	for _, tc := range []struct {
+		name, expr string
+		from, want time.Time
+	}{
+		// 2024-03-10: 02:00 EST jumps to 03:00 EDT
+		{"gap runs after it", "30 2 * * *",
+			time.Date(2024, 3, 10, 0, 0, 0, 0, est), time.Date(2024, 3, 10, 3, 0, 0, 0, edt)},
+		{"gap on the hour", "0 2 * * *",
+			time.Date(2024, 3, 10, 0, 0, 0, 0, est), time.Date(2024, 3, 10, 3, 0, 0, 0, edt)},
+		{"after the gap run", "30 2 * * *",
+			time.Date(2024, 3, 10, 3, 0, 0, 0, edt), time.Date(2024, 3, 11, 2, 30, 0, 0, edt)},
+		{"hourly through the gap", "*/15 * * * *",
+			time.Date(2024, 3, 10, 1, 50, 0, 0, est), time.Date(2024, 3, 10, 3, 0, 0, 0, edt)},
+		{"gap outside the schedule", "0 4 * * *",
+			time.Date(2024, 3, 10, 0, 0, 0, 0, est), time.Date(2024, 3, 10, 4, 0, 0, 0, edt)},
+		// 2024-11-03: 02:00 EDT falls back to 01:00 EST
+		{"overlap runs first", "30 1 * * *",
+			time.Date(2024, 11, 3, 0, 0, 0, 0, edt), time.Date(2024, 11, 3, 1, 30, 0, 0, edt)},
+		{"overlap runs once", "30 1 * * *",
+			time.Date(2024, 11, 3, 1, 30, 0, 0, edt), time.Date(2024, 11, 4, 1, 30, 0, 0, est)},
+		{"hourly runs in both", "*/30 * * * *",
+			time.Date(2024, 11, 3, 1, 30, 0, 0, edt), time.Date(2024, 11, 3, 1, 0, 0, 0, est)},
+		{"after the overlap", "0 3 * * *",
+			time.Date(2024, 11, 3, 0, 0, 0, 0, edt), time.Date(2024, 11, 3, 3, 0, 0, 0, est)},
+	} {
+		s, err := Parse(tc.expr)
+		if err != nil {
+			t.Fatalf("%s: Parse(%q): %v", tc.name, tc.expr, err)
+		}
+		got := s.Next(tc.from.In(ny))
+		if !got.Equal(tc.want) {
+			t.Errorf("%s: Next(%q, %v) = %v, want %v", tc.name, tc.expr, tc.from.In(ny), got, tc.want.In(ny))
+		}
+		if got.Location() != ny {
+			t.Errorf("%s: Next returned %v, want it in %v", tc.name, got.Location(), ny)
+		}
+	}
+}
+
+func TestNextGapAtMidnight(t *testing.T) {
+	// 2018-11-04 in Sao Paulo: midnight jumped to 01:00
+	sp := mustLocation(t, "America/Sao_Paulo")
+	s, err := Parse("@daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2018, 11, 3, 12, 0, 0, 0, sp)
+	want := time.Date(2018, 11, 4, 1, 0, 0, 0, sp)
+	if got := s.Next(from); !got.Equal(want) {
+		t.Fatalf("Next(@daily, %v) = %v, want %v", from, got, want)
+	}
+}
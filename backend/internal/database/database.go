@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -32,6 +33,14 @@ func InitPostgreSQL(databaseURL string) (*gorm.DB, error) {
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
+	// Rows created before workspaces existed are moved into a default
+	// organization, once, when the workspace tables are first created
+	migrateToWorkspaces := !db.Migrator().HasTable(&models.Workspace{})
+
+	// Users created before email verification existed count as verified
+	backfillVerification := db.Migrator().HasTable(&models.User{}) &&
+		!db.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+
 	// Auto migrate models
 	if err := db.AutoMigrate(
 		&models.User{},
@@ -40,10 +49,44 @@ func InitPostgreSQL(databaseURL string) (*gorm.DB, error) {
 		&models.KnowledgeDocument{},
 		&models.SearchQuery{},
 		&models.Agent{},
+		&models.ChatShareLink{},
+		&models.ChatParticipant{},
+		&models.AgentSchedule{},
+		&models.AgentRun{},
+		&models.WebSource{},
+		&models.DocumentChunk{},
+		&models.PromptTemplate{},
+		&models.GuardrailViolation{},
+		&models.Organization{},
+		&models.OrganizationMember{},
+		&models.OrganizationInvitation{},
+		&models.Workspace{},
+		&models.WorkspaceMember{},
+		&models.UserGroup{},
+		&models.UserGroupMember{},
+		&models.KnowledgeCollection{},
+		&models.CollectionGrant{},
+		&models.APIKey{},
+		&models.UserIdentity{},
+		&models.TwoFactor{},
+		&models.RecoveryCode{},
 	); err != nil {
 		return nil, fmt.Errorf("failed to auto migrate: %w", err)
 	}
 
+	if err := backfillWorkspaces(db, migrateToWorkspaces); err != nil {
+		return nil, fmt.Errorf("failed to backfill workspaces: %w", err)
+	}
+	if err := backfillCollections(db); err != nil {
+		return nil, fmt.Errorf("failed to backfill collections: %w", err)
+	}
+	if backfillVerification {
+		if err := db.Model(&models.User{}).Where("email_verified_at IS NULL").
+			UpdateColumn("email_verified_at", gorm.Expr("created_at")).Error; err != nil {
+			return nil, fmt.Errorf("failed to backfill email verification: %w", err)
+		}
+	}
+
 	return db, nil
 }
 
@@ -65,3 +108,144 @@ func InitRedis(redisURL string) (*redis.Client, error) {
 
 	return client, nil
 }
+
+// workspaceScopedTables hold rows that belong to exactly one workspace
+var workspaceScopedTables = []string{"chat_sessions", "knowledge_documents", "search_queries", "agents", "web_sources"}
+
+// backfillWorkspaces moves rows created before workspaces existed into a
+// "Default" organization that every existing user joins. Documents are
+// marked for re-indexing so their vectors carry the workspace payload. It
+// only moves rows on the first migration to workspaces; later rows without
+// a workspace are left alone rather than shared with every user.
+func backfillWorkspaces(db *gorm.DB, firstMigration bool) error {
+	// URLs are unique per user and workspace now, not globally or per
+	// workspace
+	for _, index := range []string{"idx_web_sources_url", "idx_web_source_url"} {
+		if db.Migrator().HasIndex(&models.WebSource{}, index) {
+			if err := db.Migrator().DropIndex(&models.WebSource{}, index); err != nil {
+				return err
+			}
+		}
+	}
+	if !firstMigration {
+		return nil
+	}
+
+	var orphans int64
+	for _, table := range workspaceScopedTables {
+		var count int64
+		if err := db.Table(table).Where("workspace_id IS NULL OR workspace_id = 0").Count(&count).Error; err != nil {
+			return err
+		}
+		orphans += count
+	}
+	if orphans == 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var users []models.User
+		if err := tx.Order("id").Find(&users).Error; err != nil {
+			return err
+		}
+		var owner uint
+		for _, user := range users {
+			if user.Role == "admin" {
+				owner = user.ID
+				break
+			}
+		}
+		if owner == 0 && len(users) > 0 {
+			owner = users[0].ID
+		}
+
+		org := models.Organization{Name: "Default", CreatedBy: owner}
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		workspace := models.Workspace{OrganizationID: org.ID, Name: "General", CreatedBy: owner}
+		if err := tx.Create(&workspace).Error; err != nil {
+			return err
+		}
+		for _, user := range users {
+			role := "member"
+			if user.ID == owner {
+				role = "owner"
+			}
+			if err := tx.Create(&models.OrganizationMember{OrganizationID: org.ID, UserID: user.ID, Role: role}).Error; err != nil {
+				return err
+			}
+			if role == "member" {
+				if err := tx.Create(&models.WorkspaceMember{WorkspaceID: workspace.ID, UserID: user.ID, Role: "editor"}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, table := range workspaceScopedTables {
+			updates := map[string]interface{}{"workspace_id": workspace.ID}
+			if table == "knowledge_documents" {
+				updates["embedding_id"] = ""
+			}
+			if err := tx.Table(table).Where("workspace_id IS NULL OR workspace_id = 0").Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		log.Printf("workspaces: moved %d existing rows into workspace %d", orphans, workspace.ID)
+		return nil
+	})
+}
+
+// backfillCollections moves documents and web sources created before
+// collections existed into their workspace's default collection, which every
+// workspace member can read. Moved documents are marked for re-indexing so
+// their vectors carry the collection payload search filters on.
+func backfillCollections(db *gorm.DB) error {
+	var workspaceIDs []uint
+	if err := db.Unscoped().Model(&models.KnowledgeDocument{}).
+		Where("collection_id IS NULL OR collection_id = 0").
+		Distinct().
+		Pluck("workspace_id", &workspaceIDs).Error; err != nil {
+		return err
+	}
+	var sourceWorkspaceIDs []uint
+	if err := db.Unscoped().Model(&models.WebSource{}).
+		Where("collection_id IS NULL OR collection_id = 0").
+		Distinct().
+		Pluck("workspace_id", &sourceWorkspaceIDs).Error; err != nil {
+		return err
+	}
+	seen := make(map[uint]bool)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, workspaceID := range append(workspaceIDs, sourceWorkspaceIDs...) {
+			if seen[workspaceID] {
+				continue
+			}
+			seen[workspaceID] = true
+			var workspace models.Workspace
+			if err := tx.Unscoped().First(&workspace, workspaceID).Error; err != nil {
+				return err
+			}
+			collection := models.KnowledgeCollection{WorkspaceID: workspaceID, IsDefault: true}
+			if err := tx.Where(&collection).
+				Attrs(models.KnowledgeCollection{Name: "General", Visibility: "workspace", CreatedBy: workspace.CreatedBy}).
+				FirstOrCreate(&collection).Error; err != nil {
+				return err
+			}
+			documents := tx.Unscoped().Model(&models.KnowledgeDocument{}).
+				Where("workspace_id = ? AND (collection_id IS NULL OR collection_id = 0)", workspaceID).
+				Updates(map[string]interface{}{"collection_id": collection.ID, "embedding_id": ""})
+			if documents.Error != nil {
+				return documents.Error
+			}
+			if err := tx.Unscoped().Model(&models.WebSource{}).
+				Where("workspace_id = ? AND (collection_id IS NULL OR collection_id = 0)", workspaceID).
+				Update("collection_id", collection.ID).Error; err != nil {
+				return err
+			}
+			log.Printf("collections: moved %d documents of workspace %d into collection %d", documents.RowsAffected, workspaceID, collection.ID)
+		}
+		return nil
+	})
+}
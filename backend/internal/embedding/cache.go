@@ -0,0 +1,105 @@
+package embedding
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"log"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CachedEmbedder stores vectors in Redis keyed by model and content hash so
+// unchanged text is never embedded twice
+type CachedEmbedder struct {
+	next   Embedder
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewCachedEmbedder(next Embedder, client *redis.Client, ttl time.Duration) *CachedEmbedder {
+	return &CachedEmbedder{next: next, client: client, ttl: ttl}
+}
+
+func (c *CachedEmbedder) Model() string {
+	return c.next.Model()
+}
+
+func (c *CachedEmbedder) Dimension() int {
+	return c.next.Dimension()
+}
+
+// Embed serves hits from Redis and embeds only the misses, in one batch.
+// Cache failures fall through to the wrapped embedder.
+func (c *CachedEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	keys := make([]string, len(texts))
+	for i, text := range texts {
+		keys[i] = c.key(text)
+	}
+
+	vectors := make([][]float32, len(texts))
+	cached, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		log.Printf("embedding: cache lookup failed: %v", err)
+		cached = make([]interface{}, len(texts))
+	}
+
+	var missTexts []string
+	var missIdx []int
+	for i, value := range cached {
+		if s, ok := value.(string); ok {
+			if v := decodeVector(s, c.next.Dimension()); v != nil {
+				vectors[i] = v
+				continue
+			}
+		}
+		missTexts = append(missTexts, texts[i])
+		missIdx = append(missIdx, i)
+	}
+	if len(missTexts) == 0 {
+		return vectors, nil
+	}
+
+	embedded, err := c.next.Embed(ctx, missTexts)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := c.client.Pipeline()
+	for j, i := range missIdx {
+		vectors[i] = embedded[j]
+		pipe.Set(ctx, keys[i], encodeVector(embedded[j]), c.ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("embedding: cache store failed: %v", err)
+	}
+	return vectors, nil
+}
+
+func (c *CachedEmbedder) key(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return "embeddings:" + c.next.Model() + ":" + hex.EncodeToString(sum[:])
+}
+
+// encodeVector packs float32s little-endian, 4 bytes each
+func encodeVector(v []float32) string {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return string(buf)
+}
+
+func decodeVector(s string, dimension int) []float32 {
+	if len(s) != 4*dimension {
+		return nil
+	}
+	v := make([]float32, dimension)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32([]byte(s[4*i : 4*i+4])))
+	}
+	return v
+}
@@ -0,0 +1,120 @@
+package embedding
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// recordingEmbedder wraps LocalEmbedder and records which texts it embedded
+type recordingEmbedder struct {
+	*LocalEmbedder
+	calls [][]string
+}
+
+func (e *recordingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.calls = append(e.calls, append([]string(nil), texts...))
+	return e.LocalEmbedder.Embed(ctx, texts)
+}
+
+func newTestCachedEmbedder(t *testing.T) (*CachedEmbedder, *recordingEmbedder, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	next := &recordingEmbedder{LocalEmbedder: NewLocalEmbedder(16)}
+	return NewCachedEmbedder(next, client, time.Hour), next, mr
+}
+
+func sameVector(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCachedEmbedderMergesHitsAndMisses(t *testing.T) {
+	ctx := context.Background()
+	c, next, _ := newTestCachedEmbedder(t)
+
+	if _, err := c.Embed(ctx, []string{"alpha", "gamma"}); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	texts := []string{"alpha", "beta", "gamma", "delta"}
+	vectors, err := c.Embed(ctx, texts)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+
+	// Only the misses reach the wrapped embedder, in one batch
+	if len(next.calls) != 2 || strings.Join(next.calls[1], ",") != "beta,delta" {
+		t.Fatalf("wrapped embedder calls = %v, want [alpha gamma] then [beta delta]", next.calls)
+	}
+	for i, text := range texts {
+		if want := next.embed(text); !sameVector(vectors[i], want) {
+			t.Errorf("vector %d (%s) = %v, want %v", i, text, vectors[i], want)
+		}
+	}
+
+	if _, err := c.Embed(ctx, texts); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(next.calls) != 2 {
+		t.Fatalf("fully cached Embed called the wrapped embedder: %v", next.calls[2:])
+	}
+}
+
+func TestCachedEmbedderIgnoresMalformedEntries(t *testing.T) {
+	ctx := context.Background()
+	c, next, mr := newTestCachedEmbedder(t)
+
+	// A vector of another dimension, e.g. from before a config change
+	mr.Set(c.key("alpha"), encodeVector([]float32{1, 2, 3}))
+	vectors, err := c.Embed(ctx, []string{"alpha"})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(next.calls) != 1 || len(vectors[0]) != 16 {
+		t.Fatalf("Embed with a malformed entry = %d dimensions after %d calls, want a fresh vector", len(vectors[0]), len(next.calls))
+	}
+	if got, _ := mr.Get(c.key("alpha")); got != encodeVector(vectors[0]) {
+		t.Fatal("malformed entry was not replaced")
+	}
+}
+
+func TestCachedEmbedderFallsThroughWithoutRedis(t *testing.T) {
+	c, next, mr := newTestCachedEmbedder(t)
+	mr.Close()
+
+	vectors, err := c.Embed(context.Background(), []string{"alpha", "beta"})
+	if err != nil || len(vectors) != 2 || len(next.calls) != 1 {
+		t.Fatalf("Embed without Redis = %d vectors, %v after %d calls; want both embedded", len(vectors), err, len(next.calls))
+	}
+}
+
+func TestCachedEmbedderKeysByModel(t *testing.T) {
+	c, _, _ := newTestCachedEmbedder(t)
+	other := NewCachedEmbedder(NewLocalEmbedder(32), c.client, time.Hour)
+	if c.key("alpha") == other.key("alpha") {
+		t.Fatal("different models share a cache key")
+	}
+}
+
+func TestVectorEncodingRoundTrip(t *testing.T) {
+	v := []float32{0, -1.5, 3.25, 1e-8}
+	if got := decodeVector(encodeVector(v), len(v)); !sameVector(got, v) {
+		t.Fatalf("decodeVector(encodeVector(%v)) = %v", v, got)
+	}
+	if got := decodeVector(encodeVector(v), len(v)+1); got != nil {
+		t.Fatalf("decodeVector with the wrong dimension = %v, want nil", got)
+	}
+}
@@ -0,0 +1,48 @@
+// Package embedding turns text into vectors. It provides an
+// OpenAI-compatible HTTP embedder, a deterministic offline embedder and a
+// Redis cache that wraps either.
+package embedding
+
+import (
+	"context"
+	"errors"
+	"math"
+)
+
+// ErrDimensionMismatch is returned when a provider returns vectors of an
+// unexpected size
+var ErrDimensionMismatch = errors.New("embedding dimension mismatch")
+
+// Embedder converts texts into vectors of a fixed dimension
+type Embedder interface {
+	// Model identifies the embedding model; vectors from different models
+	// must not be compared
+	Model() string
+	Dimension() int
+	// Embed returns one vector per text, in order
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbedOne embeds a single text
+func EmbedOne(ctx context.Context, e Embedder, text string) ([]float32, error) {
+	vectors, err := e.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// normalize scales v to unit length in place
+func normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= norm
+	}
+}
@@ -0,0 +1,79 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// LocalEmbedder is a deterministic, network-free embedder based on the
+// hashing trick: word unigrams, word bigrams and character trigrams are
+// hashed into a fixed number of signed buckets and the result is
+// L2-normalized. It captures lexical overlap rather than meaning, which is
+// enough for development and offline deployments.
+type LocalEmbedder struct {
+	dimension int
+}
+
+// LocalModel is the model name recorded for LocalEmbedder vectors
+const LocalModel = "local-hashed-ngrams-v1"
+
+func NewLocalEmbedder(dimension int) *LocalEmbedder {
+	if dimension <= 0 {
+		dimension = 384
+	}
+	return &LocalEmbedder{dimension: dimension}
+}
+
+func (e *LocalEmbedder) Model() string {
+	return fmt.Sprintf("%s-%d", LocalModel, e.dimension)
+}
+
+func (e *LocalEmbedder) Dimension() int {
+	return e.dimension
+}
+
+func (e *LocalEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *LocalEmbedder) embed(text string) []float32 {
+	counts := make(map[string]float64)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for i, w := range words {
+		counts["w:"+w] += 1
+		if i > 0 {
+			counts["b:"+words[i-1]+" "+w] += 0.5
+		}
+		// Character trigrams make morphological variants land close together
+		padded := []rune("^" + w + "$")
+		for j := 0; j+3 <= len(padded); j++ {
+			counts["c:"+string(padded[j:j+3])] += 0.25
+		}
+	}
+
+	v := make([]float32, e.dimension)
+	for feature, count := range counts {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		idx := int(sum % uint64(e.dimension))
+		sign := float32(1)
+		if sum>>63 == 1 {
+			sign = -1
+		}
+		// Sublinear term frequency keeps repeated words from dominating
+		v[idx] += sign * float32(1+math.Log(1+count))
+	}
+	normalize(v)
+	return v
+}
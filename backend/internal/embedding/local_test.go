@@ -0,0 +1,51 @@
+package embedding
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func cosine(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func TestLocalEmbedder(t *testing.T) {
+	e := NewLocalEmbedder(0)
+	if e.Dimension() != 384 || e.Model() != LocalModel+"-384" {
+		t.Fatalf("default embedder = %s with %d dimensions", e.Model(), e.Dimension())
+	}
+
+	texts := []string{"Deploying the backend service", "deploy backend services", "Chocolate cake recipe", ""}
+	vectors, err := e.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	for i, v := range vectors[:3] {
+		if len(v) != 384 {
+			t.Fatalf("vector %d has %d dimensions", i, len(v))
+		}
+		if norm := math.Sqrt(cosine(v, v)); math.Abs(norm-1) > 1e-5 {
+			t.Errorf("vector %d has length %v, want 1", i, norm)
+		}
+	}
+	for _, x := range vectors[3] {
+		if x != 0 {
+			t.Fatalf("empty text embedded as %v, want the zero vector", vectors[3])
+		}
+	}
+
+	// Lexical overlap, including word variants, brings texts closer
+	if related, unrelated := cosine(vectors[0], vectors[1]), cosine(vectors[0], vectors[2]); related <= unrelated {
+		t.Errorf("similarity of related texts %v <= unrelated %v", related, unrelated)
+	}
+
+	again, _ := EmbedOne(context.Background(), e, texts[0])
+	if !sameVector(again, vectors[0]) {
+		t.Error("Embed is not deterministic")
+	}
+}
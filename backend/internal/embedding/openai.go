@@ -0,0 +1,148 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenAIEmbedder calls an OpenAI-compatible /embeddings endpoint
+type OpenAIEmbedder struct {
+	baseURL   string
+	apiKey    string
+	model     string
+	dimension int
+	batchSize int
+	client    *http.Client
+}
+
+// OpenAIOptions configures an OpenAIEmbedder
+type OpenAIOptions struct {
+	BaseURL   string
+	APIKey    string
+	Model     string
+	Dimension int // requested via the "dimensions" parameter when the model supports it
+	BatchSize int
+}
+
+func NewOpenAIEmbedder(opts OpenAIOptions) *OpenAIEmbedder {
+	if opts.BaseURL == "" {
+		opts.BaseURL = "https://api.openai.com/v1"
+	}
+	if opts.Model == "" {
+		opts.Model = "text-embedding-3-small"
+	}
+	if opts.Dimension <= 0 {
+		opts.Dimension = 1536
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 64
+	}
+	return &OpenAIEmbedder{
+		baseURL:   strings.TrimRight(opts.BaseURL, "/"),
+		apiKey:    opts.APIKey,
+		model:     opts.Model,
+		dimension: opts.Dimension,
+		batchSize: opts.BatchSize,
+		client:    &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (e *OpenAIEmbedder) Model() string {
+	return e.model
+}
+
+func (e *OpenAIEmbedder) Dimension() int {
+	return e.dimension
+}
+
+// Embed sends texts in batches of at most batchSize inputs
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += e.batchSize {
+		end := start + e.batchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := e.embedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+type embeddingRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *OpenAIEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	reqBody := embeddingRequest{Model: e.model, Input: texts}
+	// Only the text-embedding-3 family accepts a custom dimension
+	if strings.HasPrefix(e.model, "text-embedding-3") {
+		reqBody.Dimensions = e.dimension
+	}
+	data, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("embedding API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var embResp embeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(embResp.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding API returned %d vectors for %d inputs", len(embResp.Data), len(texts))
+	}
+
+	sort.Slice(embResp.Data, func(i, j int) bool { return embResp.Data[i].Index < embResp.Data[j].Index })
+	vectors := make([][]float32, len(texts))
+	for i, d := range embResp.Data {
+		// A repeated or missing index would silently pair vectors with the
+		// wrong texts
+		if d.Index != i {
+			return nil, fmt.Errorf("embedding API returned index %d at position %d", d.Index, i)
+		}
+		if len(d.Embedding) != e.dimension {
+			return nil, fmt.Errorf("%w: got %d, want %d", ErrDimensionMismatch, len(d.Embedding), e.dimension)
+		}
+		vectors[i] = d.Embedding
+	}
+	return vectors, nil
+}
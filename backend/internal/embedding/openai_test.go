@@ -0,0 +1,140 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type embeddingData struct {
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// newTestEndpoint serves /embeddings with respond and records the requests
+func newTestEndpoint(t *testing.T, respond func(req embeddingRequest) []embeddingData) (*httptest.Server, *[]embeddingRequest) {
+	t.Helper()
+	var (
+		mu       sync.Mutex
+		requests []embeddingRequest
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/embeddings" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		var req embeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": respond(req)})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+// lengthVectors embeds each text as [len(text), 0, 0] and lists the results
+// in reverse, as providers may
+func lengthVectors(req embeddingRequest) []embeddingData {
+	data := make([]embeddingData, len(req.Input))
+	for i, text := range req.Input {
+		data[len(data)-1-i] = embeddingData{Index: i, Embedding: []float32{float32(len(text)), 0, 0}}
+	}
+	return data
+}
+
+func TestOpenAIEmbedderBatchesInOrder(t *testing.T) {
+	srv, requests := newTestEndpoint(t, lengthVectors)
+	e := NewOpenAIEmbedder(OpenAIOptions{BaseURL: srv.URL + "/v1/", APIKey: "test-key", Dimension: 3, BatchSize: 2})
+
+	texts := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+	vectors, err := e.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vectors) != len(texts) {
+		t.Fatalf("Embed returned %d vectors for %d texts", len(vectors), len(texts))
+	}
+	for i, v := range vectors {
+		if v[0] != float32(len(texts[i])) {
+			t.Errorf("vector %d belongs to a text of length %v, want %d", i, v[0], len(texts[i]))
+		}
+	}
+
+	if len(*requests) != 3 {
+		t.Fatalf("sent %d requests, want 3 batches", len(*requests))
+	}
+	var sent []string
+	for _, req := range *requests {
+		if req.Model != "text-embedding-3-small" || req.Dimensions != 3 {
+			t.Errorf("request model %q, dimensions %d; want text-embedding-3-small, 3", req.Model, req.Dimensions)
+		}
+		sent = append(sent, strings.Join(req.Input, ","))
+	}
+	if got := strings.Join(sent, "|"); got != "a,bb|ccc,dddd|eeeee" {
+		t.Errorf("batches = %s, want a,bb|ccc,dddd|eeeee", got)
+	}
+}
+
+func TestOpenAIEmbedderOmitsDimensionsForOtherModels(t *testing.T) {
+	srv, requests := newTestEndpoint(t, lengthVectors)
+	e := NewOpenAIEmbedder(OpenAIOptions{BaseURL: srv.URL + "/v1", APIKey: "test-key", Model: "nomic-embed-text", Dimension: 3})
+	if _, err := EmbedOne(context.Background(), e, "hello"); err != nil {
+		t.Fatalf("EmbedOne: %v", err)
+	}
+	if (*requests)[0].Dimensions != 0 {
+		t.Fatalf("sent dimensions %d to nomic-embed-text, want none", (*requests)[0].Dimensions)
+	}
+}
+
+func TestOpenAIEmbedderRejectsBadResponses(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		texts   []string
+		respond func(req embeddingRequest) []embeddingData
+		want    error
+	}{
+		{"dimension mismatch", []string{"a"}, func(req embeddingRequest) []embeddingData {
+			return []embeddingData{{Index: 0, Embedding: []float32{1, 2}}}
+		}, ErrDimensionMismatch},
+		{"missing vectors", []string{"a"}, func(req embeddingRequest) []embeddingData {
+			return nil
+		}, nil},
+		{"repeated index", []string{"a", "b"}, func(req embeddingRequest) []embeddingData {
+			return []embeddingData{{Index: 0, Embedding: []float32{1, 0, 0}}, {Index: 0, Embedding: []float32{2, 0, 0}}}
+		}, nil},
+	} {
+		srv, _ := newTestEndpoint(t, tc.respond)
+		e := NewOpenAIEmbedder(OpenAIOptions{BaseURL: srv.URL + "/v1", APIKey: "test-key", Dimension: 3})
+		vectors, err := e.Embed(context.Background(), tc.texts)
+		if err == nil {
+			t.Errorf("%s: Embed = %v, want an error", tc.name, vectors)
+			continue
+		}
+		if tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("%s: Embed error = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestOpenAIEmbedderReportsAPIErrors(t *testing.T) {
+	srv, _ := newTestEndpoint(t, lengthVectors)
+	e := NewOpenAIEmbedder(OpenAIOptions{BaseURL: srv.URL + "/v1", APIKey: "wrong-key", Dimension: 3})
+	_, err := e.Embed(context.Background(), []string{"a"})
+	if err == nil || !strings.Contains(err.Error(), "status 401") || !strings.Contains(err.Error(), "unauthorized") {
+		t.Fatalf("Embed with a wrong key = %v, want the 401 and its body", err)
+	}
+}
@@ -0,0 +1,92 @@
+package extract
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// csvRowsPerSection groups rows so each section stays a reasonable size
+const csvRowsPerSection = 50
+
+// extractCSV renders each row as "column: value" pairs so the text keeps the
+// header context, with one section per block of rows
+func extractCSV(data []byte) (*Document, error) {
+	text := cleanText(data)
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = sniffDelimiter(text)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return extractText(""), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV header: %w", err)
+	}
+
+	doc := &Document{}
+	var b strings.Builder
+	b.WriteString(strings.Join(header, " | "))
+	b.WriteString("\n")
+
+	section := Section{Start: 0}
+	firstRow, row := 1, 0
+	closeSection := func() {
+		section.End = b.Len()
+		section.Heading = fmt.Sprintf("Rows %d-%d", firstRow, row)
+		section.HeadingPath = []string{section.Heading}
+		doc.Sections = append(doc.Sections, section)
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV row %d: %w", row+2, err)
+		}
+
+		if row > 0 && row%csvRowsPerSection == 0 {
+			closeSection()
+			section = Section{Start: b.Len()}
+			firstRow = row + 1
+		}
+		row++
+
+		pairs := make([]string, 0, len(record))
+		for i, value := range record {
+			if strings.TrimSpace(value) == "" {
+				continue
+			}
+			column := fmt.Sprintf("column %d", i+1)
+			if i < len(header) && strings.TrimSpace(header[i]) != "" {
+				column = strings.TrimSpace(header[i])
+			}
+			pairs = append(pairs, column+": "+strings.TrimSpace(value))
+		}
+		b.WriteString(strings.Join(pairs, "; "))
+		b.WriteString("\n")
+	}
+
+	if row > 0 {
+		closeSection()
+	}
+	doc.Text = b.String()
+	return doc, nil
+}
+
+// sniffDelimiter picks the most frequent of comma, semicolon and tab in the header line
+func sniffDelimiter(text string) rune {
+	firstLine, _, _ := strings.Cut(text, "\n")
+	best, bestCount := ',', 0
+	for _, candidate := range []rune{',', ';', '\t'} {
+		if n := strings.Count(firstLine, string(candidate)); n > bestCount {
+			best, bestCount = candidate, n
+		}
+	}
+	return best
+}
@@ -0,0 +1,134 @@
+// Package extract turns uploaded files into plain text with structural
+// metadata (headings, pages, row ranges) using pure-Go parsers.
+package extract
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// Document types produced by Extract
+const (
+	TypeMarkdown = "markdown"
+	TypeHTML     = "html"
+	TypeText     = "text"
+	TypeCSV      = "csv"
+	TypePDF      = "pdf"
+)
+
+var (
+	// ErrUnsupportedType is returned for files no extractor understands
+	ErrUnsupportedType = errors.New("unsupported file type")
+	// ErrNoText is returned when a file contains no extractable text, e.g. a scanned PDF
+	ErrNoText = errors.New("no extractable text")
+	// ErrTooLarge is returned when a file decompresses to far more than its
+	// size limit
+	ErrTooLarge = errors.New("decompressed content too large")
+)
+
+// Document is the extracted text of a file
+type Document struct {
+	Title    string    `json:"title"`
+	Type     string    `json:"type"`
+	MIME     string    `json:"mime"`
+	Text     string    `json:"-"`
+	Sections []Section `json:"sections"`
+}
+
+// Section is a structural region of Document.Text. Start and End are byte
+// offsets into the text; Page is 1-based and only set for paged formats.
+type Section struct {
+	Heading     string   `json:"heading,omitempty"`
+	HeadingPath []string `json:"heading_path,omitempty"`
+	Page        int      `json:"page,omitempty"`
+	Start       int      `json:"start"`
+	End         int      `json:"end"`
+}
+
+// DetectType resolves the document type from content, falling back to the
+// file extension for text formats that cannot be sniffed reliably
+func DetectType(filename string, data []byte) (string, string, error) {
+	mime := mimetype.Detect(data)
+	ext := strings.ToLower(filepath.Ext(filename))
+
+	switch {
+	case mime.Is("application/pdf"):
+		return TypePDF, mime.String(), nil
+	case mime.Is("text/html"):
+		return TypeHTML, mime.String(), nil
+	case mime.Is("text/csv"), mime.Is("text/tab-separated-values"):
+		return TypeCSV, mime.String(), nil
+	case strings.HasPrefix(mime.String(), "text/"):
+		switch ext {
+		case ".md", ".markdown", ".mdown":
+			return TypeMarkdown, "text/markdown", nil
+		case ".csv", ".tsv":
+			return TypeCSV, "text/csv", nil
+		case ".html", ".htm":
+			return TypeHTML, "text/html", nil
+		}
+		return TypeText, mime.String(), nil
+	}
+	return "", mime.String(), ErrUnsupportedType
+}
+
+// Extract detects the file type and extracts its text and sections.
+// maxSize is the size limit the file was accepted under; compressed content
+// may only expand to a multiple of it.
+func Extract(filename string, data []byte, maxSize int64) (*Document, error) {
+	docType, mime, err := DetectType(filename, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc *Document
+	switch docType {
+	case TypePDF:
+		doc, err = extractPDF(data, maxSize)
+	case TypeHTML:
+		doc, err = ExtractHTML(data)
+	case TypeCSV:
+		doc, err = extractCSV(data)
+	case TypeMarkdown:
+		doc = extractMarkdown(cleanText(data))
+	default:
+		doc = extractText(cleanText(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(doc.Text) == "" {
+		return nil, ErrNoText
+	}
+
+	doc.Type = docType
+	doc.MIME = mime
+	if doc.Title == "" {
+		doc.Title = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	return doc, nil
+}
+
+func extractText(text string) *Document {
+	return &Document{
+		Text:     text,
+		Sections: []Section{{Start: 0, End: len(text)}},
+	}
+}
+
+// cleanText converts data to valid UTF-8 without NUL bytes, which Postgres
+// text columns reject, and normalizes line endings
+func cleanText(data []byte) string {
+	text := string(data)
+	text = strings.TrimPrefix(text, "\ufeff")
+	if !utf8.ValidString(text) {
+		text = strings.ToValidUTF8(text, "\ufffd")
+	}
+	text = strings.ReplaceAll(text, "\x00", "")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n")
+}
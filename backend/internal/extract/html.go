@@ -0,0 +1,239 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// skippedElements never contain readable content
+var skippedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Svg: true, atom.Iframe: true, atom.Form: true, atom.Button: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+}
+
+// blockElements start a new line in the extracted text
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Table: true, atom.Tr: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Br: true, atom.Hr: true,
+	atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Figure: true, atom.Figcaption: true,
+}
+
+var headingLevels = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+}
+
+// ExtractHTML extracts the readable main content of an HTML page. It prefers
+// the <main> or largest <article> element and drops navigation, headers,
+// footers and scripts; headings become sections.
+func ExtractHTML(data []byte) (*Document, error) {
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	w := &htmlWriter{doc: &Document{}}
+	w.doc.Title = strings.TrimSpace(textContent(findFirst(root, atom.Title)))
+
+	content := mainContent(root)
+	w.current = Section{Start: 0}
+	w.walk(content)
+	w.closeSection()
+	if len(w.doc.Sections) == 0 {
+		w.doc.Sections = append(w.doc.Sections, w.current)
+	}
+
+	w.doc.Text = strings.TrimRight(w.b.String(), "\n ") + "\n"
+	if n := len(w.doc.Sections); n > 0 && w.doc.Sections[n-1].End > len(w.doc.Text) {
+		w.doc.Sections[n-1].End = len(w.doc.Text)
+	}
+	if w.doc.Title == "" && len(w.doc.Sections) > 0 {
+		w.doc.Title = w.doc.Sections[0].Heading
+	}
+	return w.doc, nil
+}
+
+// mainContent picks <main>, then the <article> with the most text, then <body>
+func mainContent(root *html.Node) *html.Node {
+	if main := findFirst(root, atom.Main); main != nil {
+		return main
+	}
+
+	var best *html.Node
+	bestLen := 0
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Article {
+			if l := len(strings.TrimSpace(textContent(n))); l > bestLen {
+				best, bestLen = n, l
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(root)
+	if best != nil {
+		return best
+	}
+
+	if body := findFirst(root, atom.Body); body != nil {
+		return body
+	}
+	return root
+}
+
+type htmlWriter struct {
+	doc     *Document
+	b       bytes.Buffer
+	path    []string
+	levels  []int
+	current Section
+}
+
+func (w *htmlWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.writeText(n.Data)
+		return
+	case html.ElementNode:
+		if skippedElements[n.DataAtom] {
+			return
+		}
+		if level, ok := headingLevels[n.DataAtom]; ok {
+			w.heading(level, strings.Join(strings.Fields(textContent(n)), " "))
+			return
+		}
+		if n.DataAtom == atom.Pre {
+			w.newline()
+			w.b.WriteString(textContent(n))
+			w.newline()
+			return
+		}
+	}
+
+	block := n.Type == html.ElementNode && blockElements[n.DataAtom]
+	if block {
+		w.newline()
+		if n.DataAtom == atom.Li {
+			w.b.WriteString("- ")
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+	if block {
+		w.newline()
+	}
+}
+
+func (w *htmlWriter) heading(level int, text string) {
+	if text == "" {
+		return
+	}
+	w.newline()
+	if w.b.Len() > 0 {
+		w.b.WriteString("\n")
+	}
+	w.closeSection()
+
+	for len(w.levels) > 0 && w.levels[len(w.levels)-1] >= level {
+		w.levels = w.levels[:len(w.levels)-1]
+		w.path = w.path[:len(w.path)-1]
+	}
+	w.levels = append(w.levels, level)
+	w.path = append(w.path, text)
+
+	w.current = Section{
+		Heading:     text,
+		HeadingPath: append([]string(nil), w.path...),
+		Start:       w.b.Len(),
+	}
+	w.b.WriteString(strings.Repeat("#", level) + " " + text + "\n\n")
+}
+
+func (w *htmlWriter) closeSection() {
+	w.current.End = w.b.Len()
+	if w.current.End > w.current.Start {
+		w.doc.Sections = append(w.doc.Sections, w.current)
+	}
+}
+
+// writeText appends text with collapsed whitespace
+func (w *htmlWriter) writeText(text string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		if text != "" && w.b.Len() > 0 && !w.endsWith(' ') && !w.endsWith('\n') {
+			w.b.WriteByte(' ')
+		}
+		return
+	}
+	if startsWithSpace(text) && w.b.Len() > 0 && !w.endsWith(' ') && !w.endsWith('\n') {
+		w.b.WriteByte(' ')
+	}
+	w.b.WriteString(strings.Join(fields, " "))
+	if endsWithSpace(text) {
+		w.b.WriteByte(' ')
+	}
+}
+
+func (w *htmlWriter) newline() {
+	if w.b.Len() == 0 || w.endsWith('\n') {
+		return
+	}
+	// Drop a trailing space left by inline text
+	w.b.Truncate(len(bytes.TrimRight(w.b.Bytes(), " ")))
+	w.b.WriteByte('\n')
+}
+
+func (w *htmlWriter) endsWith(c byte) bool {
+	s := w.b.Bytes()
+	return len(s) > 0 && s[len(s)-1] == c
+}
+
+func startsWithSpace(s string) bool {
+	return len(s) > 0 && strings.ContainsRune(" \t\n\r\f", rune(s[0]))
+}
+
+func endsWithSpace(s string) bool {
+	return len(s) > 0 && strings.ContainsRune(" \t\n\r\f", rune(s[len(s)-1]))
+}
+
+func findFirst(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findFirst(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func textContent(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	var b strings.Builder
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		if n.Type == html.ElementNode && (n.DataAtom == atom.Script || n.DataAtom == atom.Style) {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(n)
+	return b.String()
+}
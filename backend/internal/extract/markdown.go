@@ -0,0 +1,91 @@
+package extract
+
+import "strings"
+
+// extractMarkdown keeps the Markdown source as text and records a section per
+// ATX or setext heading, with the path of enclosing headings
+func extractMarkdown(text string) *Document {
+	doc := &Document{Text: text}
+
+	var path []string
+	var levels []int
+	current := Section{Start: 0}
+	inFence := false
+
+	lines := strings.SplitAfter(text, "\n")
+	offset := 0
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		lineStart := offset
+		offset += len(line)
+
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+
+		level, heading := atxHeading(trimmed)
+		headingStart := lineStart
+		if level == 0 && i+1 < len(lines) && trimmed != "" {
+			// Setext headings underline the previous line with === or ---
+			next := strings.TrimSpace(lines[i+1])
+			if len(next) >= 3 && strings.Trim(next, "=") == "" {
+				level, heading = 1, trimmed
+			} else if len(next) >= 3 && strings.Trim(next, "-") == "" && !strings.HasPrefix(trimmed, "-") {
+				level, heading = 2, trimmed
+			}
+		}
+		if level == 0 {
+			continue
+		}
+
+		current.End = headingStart
+		if current.End > current.Start {
+			doc.Sections = append(doc.Sections, current)
+		}
+
+		for len(levels) > 0 && levels[len(levels)-1] >= level {
+			levels = levels[:len(levels)-1]
+			path = path[:len(path)-1]
+		}
+		levels = append(levels, level)
+		path = append(path, heading)
+
+		if doc.Title == "" && level == 1 {
+			doc.Title = heading
+		}
+		current = Section{
+			Heading:     heading,
+			HeadingPath: append([]string(nil), path...),
+			Start:       headingStart,
+		}
+	}
+
+	current.End = len(text)
+	if current.End > current.Start || len(doc.Sections) == 0 {
+		doc.Sections = append(doc.Sections, current)
+	}
+	return doc
+}
+
+// atxHeading parses "## Heading ##" lines, returning level 0 for other lines
+func atxHeading(line string) (int, string) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 {
+		return 0, ""
+	}
+	if level < len(line) && line[level] != ' ' && line[level] != '\t' {
+		return 0, ""
+	}
+	heading := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#"))
+	if heading == "" {
+		return 0, ""
+	}
+	return level, heading
+}
@@ -0,0 +1,687 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// maxPDFPageDepth guards against cycles in malformed page trees
+	maxPDFPageDepth = 32
+	// pdfMaxExpansion bounds how much larger than the input size limit all
+	// of a PDF's decompressed streams together may get
+	pdfMaxExpansion = 10
+)
+
+var pdfObjectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// pdfFile indexes the objects of a PDF by object number
+type pdfFile struct {
+	objects map[int]interface{}
+	decoded map[*pdfStream][]byte
+	budget  int64 // decompressed bytes left
+	err     error // set once the budget is exceeded
+}
+
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// extractPDF extracts text page by page from uncompressed or Flate-compressed
+// content streams. Fonts with a ToUnicode CMap are decoded through it; simple
+// fonts are decoded as WinAnsi. Scanned PDFs yield no text.
+func extractPDF(data []byte, maxSize int64) (*Document, error) {
+	f := parsePDF(data, maxSize*pdfMaxExpansion)
+	if f.err != nil {
+		return nil, f.err
+	}
+	if len(f.objects) == 0 {
+		return nil, fmt.Errorf("pdf: no objects found")
+	}
+
+	trailer := f.trailer(data)
+	if _, encrypted := trailer["Encrypt"]; encrypted {
+		return nil, fmt.Errorf("pdf: encrypted documents are not supported")
+	}
+
+	doc := &Document{}
+	if info, ok := f.resolve(trailer["Info"]).(pdfDict); ok {
+		if title, ok := f.resolve(info["Title"]).(string); ok {
+			doc.Title = strings.TrimSpace(decodePDFTextString(title))
+		}
+	}
+
+	var b strings.Builder
+	for i, page := range f.pages(trailer) {
+		text := strings.TrimSpace(f.pageText(page))
+		if text == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		start := b.Len()
+		b.WriteString(text)
+		doc.Sections = append(doc.Sections, Section{Page: i + 1, Start: start, End: b.Len()})
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	doc.Text = cleanText([]byte(b.String()))
+	return doc, nil
+}
+
+func parsePDF(data []byte, maxDecoded int64) *pdfFile {
+	f := &pdfFile{
+		objects: make(map[int]interface{}),
+		decoded: make(map[*pdfStream][]byte),
+		budget:  maxDecoded,
+	}
+
+	pos := 0
+	for pos < len(data) {
+		loc := pdfObjectHeader.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		start := pos + loc[0]
+		if start > 0 && data[start-1] >= '0' && data[start-1] <= '9' {
+			pos = start + 1
+			continue
+		}
+		var num int
+		fmt.Sscanf(string(data[pos+loc[2]:pos+loc[3]]), "%d", &num)
+
+		l := &pdfLexer{data: data, pos: pos + loc[1]}
+		obj, err := l.next()
+		if err != nil {
+			pos = start + 1
+			continue
+		}
+		if dict, ok := obj.(pdfDict); ok {
+			if stream, end, ok := readStream(data, l.pos, dict); ok {
+				obj = stream
+				l.pos = end
+			}
+		}
+		// Later definitions win, matching incremental updates
+		f.objects[num] = obj
+		pos = l.pos
+	}
+
+	f.expandObjectStreams()
+	return f
+}
+
+// readStream reads the stream body following a dictionary, if any
+func readStream(data []byte, pos int, dict pdfDict) (*pdfStream, int, bool) {
+	l := &pdfLexer{data: data, pos: pos}
+	l.skipSpace()
+	if !bytes.HasPrefix(data[l.pos:], []byte("stream")) {
+		return nil, pos, false
+	}
+	start := l.pos + len("stream")
+	if start < len(data) && data[start] == '\r' {
+		start++
+	}
+	if start < len(data) && data[start] == '\n' {
+		start++
+	}
+
+	if length, ok := dict["Length"].(float64); ok && length >= 0 && length <= float64(len(data)) {
+		end := start + int(length)
+		if end <= len(data) {
+			rest := bytes.TrimLeft(data[end:], " \r\n\t")
+			if bytes.HasPrefix(rest, []byte("endstream")) {
+				return &pdfStream{dict: dict, data: data[start:end]}, end, true
+			}
+		}
+	}
+
+	idx := bytes.Index(data[start:], []byte("endstream"))
+	if idx < 0 {
+		return nil, pos, false
+	}
+	end := start + idx
+	body := bytes.TrimRight(data[start:end], "\r\n")
+	return &pdfStream{dict: dict, data: body}, end + len("endstream"), true
+}
+
+// expandObjectStreams adds objects stored inside /Type /ObjStm streams
+func (f *pdfFile) expandObjectStreams() {
+	var streams []*pdfStream
+	for _, obj := range f.objects {
+		if s, ok := obj.(*pdfStream); ok && s.dict["Type"] == pdfName("ObjStm") {
+			streams = append(streams, s)
+		}
+	}
+
+	for _, s := range streams {
+		data, err := f.decodeStream(s)
+		if err != nil {
+			continue
+		}
+		n, _ := f.resolve(s.dict["N"]).(float64)
+		first, _ := f.resolve(s.dict["First"]).(float64)
+		if first < 0 || first > float64(len(data)) {
+			continue
+		}
+
+		header := &pdfLexer{data: data[:int(first)]}
+		for i := 0; i < int(n); i++ {
+			numTok, err1 := header.next()
+			offTok, err2 := header.next()
+			num, ok1 := numTok.(float64)
+			off, ok2 := offTok.(float64)
+			if err1 != nil || err2 != nil || !ok1 || !ok2 {
+				break
+			}
+			if off < 0 || first+off >= float64(len(data)) {
+				continue
+			}
+			if _, exists := f.objects[int(num)]; exists {
+				continue
+			}
+			l := &pdfLexer{data: data, pos: int(first) + int(off)}
+			if obj, err := l.next(); err == nil {
+				f.objects[int(num)] = obj
+			}
+		}
+	}
+}
+
+// trailer returns the trailer dictionary, or the dictionary of the last
+// cross-reference stream for PDFs that have no classic trailer
+func (f *pdfFile) trailer(data []byte) pdfDict {
+	if idx := bytes.LastIndex(data, []byte("trailer")); idx >= 0 {
+		l := &pdfLexer{data: data, pos: idx + len("trailer")}
+		if obj, err := l.next(); err == nil {
+			if dict, ok := obj.(pdfDict); ok {
+				return dict
+			}
+		}
+	}
+
+	nums := make([]int, 0, len(f.objects))
+	for num := range f.objects {
+		nums = append(nums, num)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(nums)))
+	for _, num := range nums {
+		if s, ok := f.objects[num].(*pdfStream); ok && s.dict["Type"] == pdfName("XRef") {
+			return s.dict
+		}
+	}
+	return pdfDict{}
+}
+
+func (f *pdfFile) resolve(v interface{}) interface{} {
+	for i := 0; i < 8; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = f.objects[ref.num]
+	}
+	return nil
+}
+
+func (f *pdfFile) resolveDict(v interface{}) pdfDict {
+	switch obj := f.resolve(v).(type) {
+	case pdfDict:
+		return obj
+	case *pdfStream:
+		return obj.dict
+	}
+	return nil
+}
+
+// pages walks the page tree from the catalog, falling back to every page
+// object in object-number order when the tree cannot be followed
+func (f *pdfFile) pages(trailer pdfDict) []pdfPage {
+	var pages []pdfPage
+	if catalog := f.resolveDict(trailer["Root"]); catalog != nil {
+		f.walkPages(f.resolveDict(catalog["Pages"]), nil, 0, &pages)
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	nums := make([]int, 0, len(f.objects))
+	for num := range f.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		if dict, ok := f.objects[num].(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			pages = append(pages, pdfPage{dict: dict, resources: f.resolveDict(dict["Resources"])})
+		}
+	}
+	return pages
+}
+
+func (f *pdfFile) walkPages(node pdfDict, inherited pdfDict, depth int, pages *[]pdfPage) {
+	if node == nil || depth > maxPDFPageDepth {
+		return
+	}
+	resources := inherited
+	if r := f.resolveDict(node["Resources"]); r != nil {
+		resources = r
+	}
+
+	if node["Type"] == pdfName("Page") {
+		*pages = append(*pages, pdfPage{dict: node, resources: resources})
+		return
+	}
+	kids, _ := f.resolve(node["Kids"]).(pdfArray)
+	for _, kid := range kids {
+		f.walkPages(f.resolveDict(kid), resources, depth+1, pages)
+	}
+}
+
+func (f *pdfFile) pageText(page pdfPage) string {
+	var content []byte
+	switch c := f.resolve(page.dict["Contents"]).(type) {
+	case *pdfStream:
+		content, _ = f.decodeStream(c)
+	case pdfArray:
+		for _, part := range c {
+			if s, ok := f.resolve(part).(*pdfStream); ok {
+				data, err := f.decodeStream(s)
+				if err == nil {
+					content = append(content, data...)
+					content = append(content, '\n')
+				}
+			}
+		}
+	}
+	if len(content) == 0 {
+		return ""
+	}
+
+	fonts := make(map[string]*pdfFont)
+	if fontDict := f.resolveDict(page.resources["Font"]); fontDict != nil {
+		for name, ref := range fontDict {
+			fonts[name] = f.loadFont(f.resolveDict(ref))
+		}
+	}
+
+	w := &pdfTextWriter{fonts: fonts}
+	w.run(content)
+	return w.b.String()
+}
+
+// decodeStream applies a stream's filters. Results are cached, since fonts
+// are shared between pages, and count against the decompression budget.
+func (f *pdfFile) decodeStream(s *pdfStream) ([]byte, error) {
+	if data, ok := f.decoded[s]; ok {
+		return data, nil
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	var filters []pdfName
+	switch v := f.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []pdfName{v}
+	case pdfArray:
+		for _, item := range v {
+			if name, ok := f.resolve(item).(pdfName); ok {
+				filters = append(filters, name)
+			}
+		}
+	}
+
+	data := s.data
+	for _, filter := range filters {
+		var err error
+		switch filter {
+		case "FlateDecode", "Fl":
+			data, err = inflate(data, f.budget)
+			if errors.Is(err, ErrTooLarge) {
+				f.err = err
+			} else {
+				f.budget -= int64(len(data))
+			}
+		case "ASCIIHexDecode", "AHx":
+			data, err = asciiHexDecode(data)
+		case "ASCII85Decode", "A85":
+			data, err = ascii85Decode(data)
+		default:
+			err = fmt.Errorf("pdf: unsupported filter %s", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	f.decoded[s] = data
+	return data, nil
+}
+
+// inflate decompresses data, failing with ErrTooLarge past limit bytes
+func inflate(data []byte, limit int64) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if int64(len(out)) > limit {
+		return nil, ErrTooLarge
+	}
+	// Many writers produce truncated streams; keep whatever was decoded
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	_, err := hex.Decode(out, digits)
+	return out, err
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if idx := bytes.Index(data, []byte("~>")); idx >= 0 {
+		data = data[:idx]
+	}
+	out := make([]byte, 4*len(data)/5+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+// pdfFont decodes shown strings to Unicode
+type pdfFont struct {
+	width   int // code width in bytes
+	unicode map[uint32]string
+}
+
+func (f *pdfFile) loadFont(dict pdfDict) *pdfFont {
+	font := &pdfFont{width: 1}
+	if dict == nil {
+		return font
+	}
+	if dict["Subtype"] == pdfName("Type0") {
+		font.width = 2
+	}
+	if s, ok := f.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := f.decodeStream(s); err == nil {
+			parseToUnicode(data, font)
+		}
+	}
+	return font
+}
+
+// parseToUnicode reads codespace ranges and bfchar/bfrange mappings of a CMap
+func parseToUnicode(data []byte, font *pdfFont) {
+	font.unicode = make(map[uint32]string)
+	l := &pdfLexer{data: data}
+
+	var operands []interface{}
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return
+		}
+		kw, ok := tok.(pdfKeyword)
+		if !ok {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch kw {
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if lo, ok := operands[0].(string); ok && len(lo) > 0 {
+					font.width = len(lo)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(string)
+				dst, ok2 := operands[i+1].(string)
+				if ok1 && ok2 {
+					font.unicode[codeOf(src)] = decodeUTF16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(string)
+				hi, ok2 := operands[i+1].(string)
+				if !ok1 || !ok2 {
+					continue
+				}
+				start, end := codeOf(lo), codeOf(hi)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case string:
+					base := []rune(decodeUTF16BE(dst))
+					if len(base) == 0 {
+						continue
+					}
+					for code := start; code <= end; code++ {
+						r := append([]rune(nil), base...)
+						r[len(r)-1] += rune(code - start)
+						font.unicode[code] = string(r)
+					}
+				case pdfArray:
+					for j, item := range dst {
+						if s, ok := item.(string); ok && start+uint32(j) <= end {
+							font.unicode[start+uint32(j)] = decodeUTF16BE(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func codeOf(s string) uint32 {
+	var code uint32
+	for i := 0; i < len(s); i++ {
+		code = code<<8 | uint32(s[i])
+	}
+	return code
+}
+
+func (font *pdfFont) decode(s string) string {
+	if font == nil || font.unicode == nil {
+		if font != nil && font.width == 2 {
+			// CID fonts without a ToUnicode map cannot be decoded
+			return ""
+		}
+		return decodeWinAnsi(s)
+	}
+
+	var b strings.Builder
+	for i := 0; i+font.width <= len(s); i += font.width {
+		code := codeOf(s[i : i+font.width])
+		if text, ok := font.unicode[code]; ok {
+			b.WriteString(text)
+		} else if font.width == 1 {
+			b.WriteString(decodeWinAnsi(s[i : i+1]))
+		}
+	}
+	return b.String()
+}
+
+// winAnsiHigh maps the 0x80-0x9F range where WinAnsi differs from Latin-1
+var winAnsiHigh = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž',
+	0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+	0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›', 0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+func decodeWinAnsi(s string) string {
+	runes := make([]rune, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if r, ok := winAnsiHigh[c]; ok {
+			runes = append(runes, r)
+		} else if c >= 0x20 || c == '\n' || c == '\t' {
+			runes = append(runes, rune(c))
+		}
+	}
+	return string(runes)
+}
+
+func decodeUTF16BE(s string) string {
+	if len(s)%2 == 1 {
+		s += "\x00"
+	}
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// decodePDFTextString decodes document-level strings such as /Title, which
+// are UTF-16BE with a byte order mark or PDFDocEncoding
+func decodePDFTextString(s string) string {
+	if strings.HasPrefix(s, "\xfe\xff") {
+		return decodeUTF16BE(s[2:])
+	}
+	return decodeWinAnsi(s)
+}
+
+// pdfTextWriter interprets the text operators of a content stream
+type pdfTextWriter struct {
+	fonts map[string]*pdfFont
+	font  *pdfFont
+	lastY float64
+	b     strings.Builder
+}
+
+func (w *pdfTextWriter) run(content []byte) {
+	l := &pdfLexer{data: content}
+	var operands []interface{}
+
+	for {
+		tok, err := l.next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		kw, ok := tok.(pdfKeyword)
+		if !ok {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch kw {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[0].(pdfName); ok {
+					w.font = w.fonts[string(name)]
+				}
+			}
+		case "Tj":
+			w.showLast(operands)
+		case "'", "\"":
+			w.newline()
+			w.showLast(operands)
+		case "TJ":
+			if len(operands) > 0 {
+				if items, ok := operands[len(operands)-1].(pdfArray); ok {
+					for _, item := range items {
+						switch v := item.(type) {
+						case string:
+							w.show(v)
+						case float64:
+							// Large negative adjustments separate words
+							if v < -250 {
+								w.space()
+							}
+						}
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				tx, _ := operands[0].(float64)
+				ty, _ := operands[1].(float64)
+				if ty != 0 {
+					w.newline()
+				} else if tx != 0 {
+					w.space()
+				}
+			}
+		case "T*":
+			w.newline()
+		case "Tm":
+			if len(operands) >= 6 {
+				if y, ok := operands[5].(float64); ok {
+					if y != w.lastY {
+						w.newline()
+					}
+					w.lastY = y
+				}
+			}
+		case "ET":
+			w.space()
+		case "ID":
+			l.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+func (w *pdfTextWriter) showLast(operands []interface{}) {
+	if len(operands) == 0 {
+		return
+	}
+	if s, ok := operands[len(operands)-1].(string); ok {
+		w.show(s)
+	}
+}
+
+func (w *pdfTextWriter) show(s string) {
+	w.b.WriteString(w.font.decode(s))
+}
+
+func (w *pdfTextWriter) space() {
+	s := w.b.String()
+	if len(s) > 0 && s[len(s)-1] != ' ' && s[len(s)-1] != '\n' {
+		w.b.WriteByte(' ')
+	}
+}
+
+func (w *pdfTextWriter) newline() {
+	s := w.b.String()
+	if len(s) > 0 && s[len(s)-1] != '\n' {
+		w.b.WriteByte('\n')
+	}
+}
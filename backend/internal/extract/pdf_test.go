@@ -0,0 +1,100 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testMaxSize = 1 << 20
+
+// buildPDF assembles a one-page PDF showing text through a Flate-compressed
+// content stream
+func buildPDF(text string) []byte {
+	var content bytes.Buffer
+	zw := zlib.NewWriter(&content)
+	fmt.Fprintf(zw, "BT /F1 12 Tf 72 712 Td (%s) Tj ET", text)
+	zw.Close()
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	b.WriteString("1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n")
+	b.WriteString("2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n")
+	b.WriteString("3 0 obj << /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >> endobj\n")
+	fmt.Fprintf(&b, "4 0 obj << /Length %d /Filter /FlateDecode >>\nstream\n", content.Len())
+	b.Write(content.Bytes())
+	b.WriteString("\nendstream endobj\n")
+	b.WriteString("5 0 obj << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> endobj\n")
+	b.WriteString("trailer << /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func TestExtractPDF(t *testing.T) {
+	doc, err := Extract("hello.pdf", buildPDF("Hello PDF"), testMaxSize)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if doc.Type != TypePDF || doc.Text != "Hello PDF" {
+		t.Fatalf("got %s %q, want pdf %q", doc.Type, doc.Text, "Hello PDF")
+	}
+	if len(doc.Sections) != 1 || doc.Sections[0].Page != 1 {
+		t.Fatalf("sections = %+v, want one for page 1", doc.Sections)
+	}
+}
+
+func TestExtractPDFMalformedObjectStream(t *testing.T) {
+	for _, header := range []string{
+		"/N 1 /First -5",
+		"/N 1 /First 1e30",
+		"/N 2 /First 4",
+	} {
+		data := []byte("%PDF-1.4\n1 0 obj << /Type /ObjStm " + header + " >> stream\n7 -9 abc\nendstream endobj")
+		// Must not panic
+		parsePDF(data, testMaxSize)
+	}
+}
+
+func TestExtractPDFNegativeLength(t *testing.T) {
+	data := []byte("%PDF-1.4\n1 0 obj << /Length -20 >> stream\nabc\nendstream endobj")
+	parsePDF(data, testMaxSize)
+}
+
+func TestExtractPDFDecompressionLimit(t *testing.T) {
+	// Compresses to a few KB but expands past the budget
+	pdf := buildPDF(strings.Repeat("A", 64<<10))
+	_, err := Extract("bomb.pdf", pdf, 4<<10)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Extract = %v, want ErrTooLarge", err)
+	}
+}
+
+func FuzzExtractPDF(f *testing.F) {
+	f.Add(buildPDF("Hello PDF"))
+	f.Add([]byte("1 0 obj << /Type /ObjStm /N 1 /First -5 >> stream\nabc\nendstream endobj"))
+	f.Add([]byte("%PDF-1.4\n1 0 obj << /Type /ObjStm /N 1 /First 2 >> stream\n2 99 << /Type /Page >>\nendstream endobj"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		extractPDF(data, testMaxSize)
+	})
+}
+
+func FuzzExtract(f *testing.F) {
+	f.Add("doc.md", []byte("# Title\n\nSome *text*.\n\n## Section\n\nMore."))
+	f.Add("page.html", []byte("<html><head><title>T</title></head><body><h1>H</h1><p>x</p></body></html>"))
+	f.Add("rows.csv", []byte("a,b\n1,2\n\"3\",\"4,5\"\n"))
+	f.Add("notes.txt", []byte("plain\r\ntext\x00"))
+	f.Add("doc.pdf", buildPDF("fuzz"))
+	f.Fuzz(func(t *testing.T, filename string, data []byte) {
+		doc, err := Extract(filename, data, testMaxSize)
+		if err != nil {
+			return
+		}
+		for _, s := range doc.Sections {
+			if s.Start < 0 || s.End < s.Start {
+				t.Fatalf("invalid section %+v", s)
+			}
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package guardrails
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Blocklist flags keywords, matched case-insensitively on word boundaries,
+// and regular expressions
+type Blocklist struct {
+	rules []blockRule
+}
+
+type blockRule struct {
+	name    string
+	message string
+	pattern *regexp.Regexp
+}
+
+// NewBlocklist compiles entries. An entry prefixed with "re:" is a regular
+// expression; anything else is a keyword or phrase.
+func NewBlocklist(entries []string) (*Blocklist, error) {
+	b := &Blocklist{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		if expr, ok := strings.CutPrefix(entry, "re:"); ok {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid blocklist pattern %q: %w", expr, err)
+			}
+			b.rules = append(b.rules, blockRule{name: entry, message: "matches a blocked pattern", pattern: re})
+			continue
+		}
+		re := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(entry) + `\b`)
+		b.rules = append(b.rules, blockRule{name: entry, message: fmt.Sprintf("contains blocked term %q", entry), pattern: re})
+	}
+	return b, nil
+}
+
+// LoadBlocklist reads one entry per line from path; blank lines and lines
+// starting with # are ignored
+func LoadBlocklist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entries = append(entries, scanner.Text())
+	}
+	return entries, scanner.Err()
+}
+
+// Len returns the number of rules
+func (b *Blocklist) Len() int {
+	return len(b.rules)
+}
+
+func (b *Blocklist) Name() string {
+	return "blocklist"
+}
+
+func (b *Blocklist) Check(ctx context.Context, stage Stage, text string) ([]Violation, error) {
+	var violations []Violation
+	for _, rule := range b.rules {
+		for _, loc := range rule.pattern.FindAllStringIndex(text, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			violations = append(violations, Violation{
+				Rule:    rule.name,
+				Message: rule.message,
+				Start:   loc[0],
+				End:     loc[1],
+			})
+		}
+	}
+	return violations, nil
+}
+
+// MaxLength flags texts longer than a number of characters. A limit of
+// zero leaves that stage unchecked.
+type MaxLength struct {
+	Input  int
+	Output int
+}
+
+func (m MaxLength) Name() string {
+	return "max_length"
+}
+
+func (m MaxLength) Check(ctx context.Context, stage Stage, text string) ([]Violation, error) {
+	limit := m.Input
+	if stage == Output {
+		limit = m.Output
+	}
+	length := utf8.RuneCountInString(text)
+	if limit <= 0 || length <= limit {
+		return nil, nil
+	}
+
+	// Redaction keeps the first limit characters
+	cut := len(text)
+	for i := range text {
+		if limit == 0 {
+			cut = i
+			break
+		}
+		limit--
+	}
+	return []Violation{{
+		Rule:    "max_length",
+		Message: fmt.Sprintf("%d characters exceeds the limit of %d", length, utf8.RuneCountInString(text[:cut])),
+		Start:   cut,
+		End:     len(text),
+	}}, nil
+}
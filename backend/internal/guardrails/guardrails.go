@@ -0,0 +1,182 @@
+// Package guardrails screens model input and output with pluggable checks.
+// Each check reports violations; the pipeline applies the action configured
+// for the check: block the text, let it through with a warning, or redact
+// the offending parts.
+package guardrails
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Stage is the side of a model call being screened
+type Stage string
+
+const (
+	Input  Stage = "input"
+	Output Stage = "output"
+)
+
+// Action is what happens to text that violates a check
+type Action string
+
+const (
+	Block  Action = "block"
+	Warn   Action = "warn"
+	Redact Action = "redact"
+)
+
+// RedactedText replaces redacted spans
+const RedactedText = "[redacted]"
+
+// Violation is one problem a check found in a text
+type Violation struct {
+	Check   string `json:"check"`
+	Rule    string `json:"rule,omitempty"` // matched keyword, pattern or moderation category
+	Message string `json:"message"`
+	Action  Action `json:"action"`
+	// Start and End delimit the offending bytes; a zero End covers the
+	// whole text
+	Start int `json:"-"`
+	End   int `json:"-"`
+}
+
+// Check inspects text for one kind of problem
+type Check interface {
+	Name() string
+	Check(ctx context.Context, stage Stage, text string) ([]Violation, error)
+}
+
+// Result is the outcome of screening a text
+type Result struct {
+	Text       string      // the text after redactions
+	Violations []Violation // every violation, with the action taken
+	Blocked    bool
+}
+
+// Warnings returns the violations that were let through
+func (r *Result) Warnings() []Violation {
+	var warnings []Violation
+	for _, v := range r.Violations {
+		if v.Action == Warn {
+			warnings = append(warnings, v)
+		}
+	}
+	return warnings
+}
+
+// Pipeline runs checks in order and applies their actions
+type Pipeline struct {
+	checks  []Check
+	actions map[string]Action
+}
+
+// New creates a pipeline. Checks without an entry in actions block.
+func New(actions map[string]Action, checks ...Check) *Pipeline {
+	return &Pipeline{checks: checks, actions: actions}
+}
+
+// Enabled reports whether the pipeline has any checks
+func (p *Pipeline) Enabled() bool {
+	return p != nil && len(p.checks) > 0
+}
+
+// Run screens text. A check that fails, such as an unreachable moderation
+// endpoint, is logged and skipped so an outage does not stop every request.
+func (p *Pipeline) Run(ctx context.Context, stage Stage, text string) *Result {
+	result := &Result{Text: text}
+	if !p.Enabled() {
+		return result
+	}
+
+	var redactions []Violation
+	for _, check := range p.checks {
+		violations, err := check.Check(ctx, stage, text)
+		if err != nil {
+			log.Printf("guardrails: %s check failed: %v", check.Name(), err)
+			continue
+		}
+		action, ok := p.actions[check.Name()]
+		if !ok {
+			action = Block
+		}
+		for _, v := range violations {
+			v.Check = check.Name()
+			v.Action = action
+			result.Violations = append(result.Violations, v)
+			switch action {
+			case Block:
+				result.Blocked = true
+			case Redact:
+				redactions = append(redactions, v)
+			}
+		}
+	}
+	if !result.Blocked && len(redactions) > 0 {
+		result.Text = redact(text, redactions)
+	}
+	return result
+}
+
+// redact replaces the union of the violations' spans
+func redact(text string, violations []Violation) string {
+	type span struct{ start, end int }
+	spans := make([]span, 0, len(violations))
+	for _, v := range violations {
+		if v.End == 0 {
+			return RedactedText
+		}
+		spans = append(spans, span{v.Start, v.End})
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	merged := spans[:0]
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s.start <= merged[n-1].end {
+			if s.end > merged[n-1].end {
+				merged[n-1].end = s.end
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+
+	var b strings.Builder
+	pos := 0
+	for _, s := range merged {
+		b.WriteString(text[pos:s.start])
+		b.WriteString(RedactedText)
+		pos = s.end
+	}
+	b.WriteString(text[pos:])
+	return b.String()
+}
+
+// ParseActions reads actions for the built-in checks, such as
+// "blocklist=redact,moderation=warn"
+func ParseActions(value string) (map[string]Action, error) {
+	actions := make(map[string]Action)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		check, action, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected check=action, got %q", pair)
+		}
+		check = strings.TrimSpace(check)
+		if check != "blocklist" && check != "max_length" && check != "moderation" {
+			return nil, fmt.Errorf("unknown guardrail check %q", check)
+		}
+		a := Action(strings.TrimSpace(action))
+		if a != Block && a != Warn && a != Redact {
+			return nil, fmt.Errorf("unknown guardrail action %q", action)
+		}
+		actions[check] = a
+	}
+	return actions, nil
+}
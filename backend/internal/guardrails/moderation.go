@@ -0,0 +1,101 @@
+package guardrails
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Moderation asks an OpenAI-compatible /moderations endpoint whether a text
+// is harmful and reports each flagged category
+type Moderation struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+func NewModeration(baseURL, apiKey, model string) *Moderation {
+	return &Moderation{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (m *Moderation) Name() string {
+	return "moderation"
+}
+
+func (m *Moderation) Check(ctx context.Context, stage Stage, text string) ([]Violation, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	body := map[string]string{"input": text}
+	if m.model != "" {
+		body["model"] = m.model
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal moderation request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", m.baseURL+"/moderations", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create moderation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call moderation endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation request failed with status: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Results []struct {
+			Flagged        bool               `json:"flagged"`
+			Categories     map[string]bool    `json:"categories"`
+			CategoryScores map[string]float64 `json:"category_scores"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode moderation response: %w", err)
+	}
+
+	var violations []Violation
+	for _, r := range result.Results {
+		if !r.Flagged {
+			continue
+		}
+		var categories []string
+		for category, flagged := range r.Categories {
+			if flagged {
+				categories = append(categories, category)
+			}
+		}
+		sort.Strings(categories)
+		if len(categories) == 0 {
+			categories = []string{"flagged"}
+		}
+		for _, category := range categories {
+			violations = append(violations, Violation{
+				Rule:    category,
+				Message: fmt.Sprintf("flagged by moderation as %s (score %.2f)", category, r.CategoryScores[category]),
+			})
+		}
+	}
+	return violations, nil
+}
@@ -0,0 +1,25 @@
+package jobs
+
+import (
+	"context"
+	"time"
+)
+
+// Backend persists jobs and hands them to workers
+type Backend interface {
+	// Push saves the job and makes it available once job.RunAt has passed
+	Push(ctx context.Context, job *Job) error
+	// Pop blocks up to timeout for a due job on queue; it returns nil, nil when none arrived
+	Pop(ctx context.Context, queue string, timeout time.Duration) (*Job, error)
+	// Ack marks a popped job as handled, after it was saved, rescheduled or
+	// buried; jobs never acknowledged may be handed out again
+	Ack(ctx context.Context, job *Job) error
+	// Save persists the job's current state
+	Save(ctx context.Context, job *Job) error
+	// Get loads a job by ID
+	Get(ctx context.Context, id string) (*Job, error)
+	// Bury saves a failed job and appends it to the dead letter list
+	Bury(ctx context.Context, job *Job) error
+	// DeadLetters returns the most recently buried jobs
+	DeadLetters(ctx context.Context, limit int) ([]*Job, error)
+}
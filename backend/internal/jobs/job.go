@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Job statuses
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusRetrying  = "retrying"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+// DefaultQueue is used when a job does not name a queue
+const DefaultQueue = "default"
+
+// ErrJobNotFound is returned when a job ID is unknown or has expired
+var ErrJobNotFound = errors.New("job not found")
+
+// Job is a unit of background work and its execution state
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Queue       string          `json:"queue"`
+	UserID      uint            `json:"user_id,omitempty"`
+	Payload     json.RawMessage `json:"payload"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	RunAt       time.Time       `json:"run_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// SetResult stores a JSON-encodable value that status queries can return
+func (j *Job) SetResult(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job result: %w", err)
+	}
+	j.Result = data
+	return nil
+}
+
+// Terminal reports whether the job will not run again
+func (j *Job) Terminal() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusDead
+}
+
+// Handler executes a job. Returning an error schedules a retry until the
+// job's attempts are exhausted, after which it moves to the dead letter list.
+type Handler func(ctx context.Context, job *Job) error
+
+// Handle adapts a function taking a decoded payload into a Handler
+func Handle[T any](fn func(ctx context.Context, payload T) error) Handler {
+	return func(ctx context.Context, job *Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return Permanent(fmt.Errorf("failed to decode %s payload: %w", job.Type, err))
+		}
+		return fn(ctx, payload)
+	}
+}
+
+// permanentError marks a failure that retrying cannot fix
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job is dead-lettered without further retries
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Option customizes a job at enqueue time
+type Option func(*Job)
+
+// WithQueue routes the job to a named worker pool
+func WithQueue(queue string) Option {
+	return func(j *Job) { j.Queue = queue }
+}
+
+// WithUserID records the user the job runs on behalf of
+func WithUserID(userID uint) Option {
+	return func(j *Job) { j.UserID = userID }
+}
+
+// WithMaxAttempts overrides the queue's default attempt limit
+func WithMaxAttempts(n int) Option {
+	return func(j *Job) { j.MaxAttempts = n }
+}
+
+// WithDelay postpones the first run of the job
+func WithDelay(d time.Duration) Option {
+	return func(j *Job) { j.RunAt = j.RunAt.Add(d) }
+}
+
+func newJobID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
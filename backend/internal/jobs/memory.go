@@ -0,0 +1,149 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// MemoryBackend keeps jobs in process memory. It is intended for tests and
+// single-instance development where Redis is not available.
+type MemoryBackend struct {
+	mu     sync.Mutex
+	jobs   map[string][]byte
+	queues map[string][]string
+	dead   []string
+	notify chan struct{}
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		jobs:   make(map[string][]byte),
+		queues: make(map[string][]string),
+		notify: make(chan struct{}, 1),
+	}
+}
+
+func (b *MemoryBackend) Push(ctx context.Context, job *Job) error {
+	if err := b.Save(ctx, job); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.queues[job.Queue] = append(b.queues[job.Queue], job.ID)
+	b.mu.Unlock()
+
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (b *MemoryBackend) Pop(ctx context.Context, queue string, timeout time.Duration) (*Job, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		if job := b.popDue(queue); job != nil {
+			return job, nil
+		}
+
+		// Delayed jobs become due without a push, so poll at a short interval too
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			return nil, nil
+		case <-b.notify:
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// popDue removes and returns the first job on queue whose RunAt has passed
+func (b *MemoryBackend) popDue(queue string) *Job {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	ids := b.queues[queue]
+	for i, id := range ids {
+		var job Job
+		if err := json.Unmarshal(b.jobs[id], &job); err != nil {
+			continue
+		}
+		if job.RunAt.After(now) {
+			continue
+		}
+		b.queues[queue] = append(ids[:i:i], ids[i+1:]...)
+		return &job
+	}
+	return nil
+}
+
+// Ack is a no-op; jobs in memory do not outlive the worker's process
+func (b *MemoryBackend) Ack(ctx context.Context, job *Job) error {
+	return nil
+}
+
+func (b *MemoryBackend) Save(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.jobs[job.ID] = data
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *MemoryBackend) Get(ctx context.Context, id string) (*Job, error) {
+	b.mu.Lock()
+	data, ok := b.jobs[id]
+	b.mu.Unlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (b *MemoryBackend) Bury(ctx context.Context, job *Job) error {
+	if err := b.Save(ctx, job); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.dead = append([]string{job.ID}, b.dead...)
+	if len(b.dead) > maxDeadLetters {
+		b.dead = b.dead[:maxDeadLetters]
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *MemoryBackend) DeadLetters(ctx context.Context, limit int) ([]*Job, error) {
+	b.mu.Lock()
+	ids := append([]string(nil), b.dead...)
+	b.mu.Unlock()
+
+	if limit < len(ids) {
+		ids = ids[:limit]
+	}
+	jobs := make([]*Job, 0, len(ids))
+	for _, id := range ids {
+		job, err := b.Get(ctx, id)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
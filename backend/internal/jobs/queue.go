@@ -0,0 +1,304 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config controls retry behaviour and job execution limits
+type Config struct {
+	MaxAttempts int           // attempts before a job is dead-lettered
+	BaseBackoff time.Duration // delay before the first retry, doubled on each attempt
+	MaxBackoff  time.Duration // upper bound for the retry delay
+	JobTimeout  time.Duration // deadline for a single attempt
+	PollTimeout time.Duration // how long a worker blocks waiting for work
+
+	// Routes sends job types to named queues; others go to DefaultQueue.
+	// WithQueue overrides the route of a single job.
+	Routes map[string]string
+}
+
+// DefaultConfig returns conservative defaults for production use
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts: 5,
+		BaseBackoff: 2 * time.Second,
+		MaxBackoff:  10 * time.Minute,
+		JobTimeout:  5 * time.Minute,
+		PollTimeout: 2 * time.Second,
+	}
+}
+
+// Pool is a set of workers consuming one queue
+type Pool struct {
+	Queue       string
+	Concurrency int
+}
+
+// ParsePools parses comma-separated queue=concurrency pairs, e.g.
+// "crawl=2,agents=1". The default queue gets defaultConcurrency workers
+// unless the spec lists it.
+func ParsePools(spec string, defaultConcurrency int) ([]Pool, error) {
+	pools := []Pool{{Queue: DefaultQueue, Concurrency: defaultConcurrency}}
+	pairs, err := parsePairs(spec)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		n, err := strconv.Atoi(pair[1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid concurrency %q for queue %q", pair[1], pair[0])
+		}
+		if pair[0] == DefaultQueue {
+			pools[0].Concurrency = n
+			continue
+		}
+		pools = append(pools, Pool{Queue: pair[0], Concurrency: n})
+	}
+	return pools, nil
+}
+
+// ParseRoutes parses comma-separated type=queue pairs, e.g.
+// "knowledge.crawl=crawl". Every queue must have a pool, or its jobs would
+// never run.
+func ParseRoutes(spec string, pools []Pool) (map[string]string, error) {
+	pairs, err := parsePairs(spec)
+	if err != nil {
+		return nil, err
+	}
+	routes := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		served := false
+		for _, pool := range pools {
+			served = served || (pool.Queue == pair[1] && pool.Concurrency > 0)
+		}
+		if !served {
+			return nil, fmt.Errorf("job type %q is routed to queue %q, which has no workers", pair[0], pair[1])
+		}
+		routes[pair[0]] = pair[1]
+	}
+	return routes, nil
+}
+
+func parsePairs(spec string) ([][2]string, error) {
+	var pairs [][2]string
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid entry %q, want name=value", item)
+		}
+		pairs = append(pairs, [2]string{key, value})
+	}
+	return pairs, nil
+}
+
+// Queue enqueues jobs and dispatches them to registered handlers
+type Queue struct {
+	backend Backend
+	cfg     Config
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+
+	wg sync.WaitGroup
+}
+
+func NewQueue(backend Backend, cfg Config) *Queue {
+	return &Queue{
+		backend:  backend,
+		cfg:      cfg,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Register binds a handler to a job type
+func (q *Queue) Register(jobType string, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = handler
+}
+
+// Enqueue schedules a job of jobType with a JSON-encodable payload
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}, opts ...Option) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job payload: %w", err)
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:          newJobID(),
+		Type:        jobType,
+		Queue:       q.queueFor(jobType),
+		Payload:     data,
+		Status:      StatusPending,
+		MaxAttempts: q.cfg.MaxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+
+	if err := q.backend.Push(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (q *Queue) queueFor(jobType string) string {
+	if queue, ok := q.cfg.Routes[jobType]; ok {
+		return queue
+	}
+	return DefaultQueue
+}
+
+// Get returns the current state of a job
+func (q *Queue) Get(ctx context.Context, id string) (*Job, error) {
+	return q.backend.Get(ctx, id)
+}
+
+// DeadLetters returns the most recently dead-lettered jobs
+func (q *Queue) DeadLetters(ctx context.Context, limit int) ([]*Job, error) {
+	return q.backend.DeadLetters(ctx, limit)
+}
+
+// Start launches the worker pools; they stop when ctx is cancelled
+func (q *Queue) Start(ctx context.Context, pools ...Pool) {
+	for _, pool := range pools {
+		for i := 0; i < pool.Concurrency; i++ {
+			q.wg.Add(1)
+			go q.work(ctx, pool.Queue)
+		}
+	}
+}
+
+// Wait blocks until all workers have exited
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context, queue string) {
+	defer q.wg.Done()
+
+	for ctx.Err() == nil {
+		job, err := q.backend.Pop(ctx, queue, q.cfg.PollTimeout)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("jobs: failed to pop from %s: %v", queue, err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if job == nil {
+			continue
+		}
+		q.process(ctx, job)
+	}
+}
+
+func (q *Queue) process(ctx context.Context, job *Job) {
+	defer func() {
+		if err := q.backend.Ack(ctx, job); err != nil {
+			log.Printf("jobs: %s: %v", job.ID, err)
+		}
+	}()
+
+	q.mu.RLock()
+	handler, ok := q.handlers[job.Type]
+	q.mu.RUnlock()
+
+	// A job still marked running was reclaimed from a worker that stopped
+	// mid-attempt. That attempt counts, so jobs that crash workers end up
+	// dead-lettered.
+	if job.Status == StatusRunning && job.Attempts >= job.MaxAttempts {
+		job.Status = StatusDead
+		job.LastError = "worker stopped during the last attempt"
+		job.UpdatedAt = time.Now()
+		if err := q.backend.Bury(ctx, job); err != nil {
+			log.Printf("jobs: failed to dead-letter %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	job.Attempts++
+	job.Status = StatusRunning
+	job.UpdatedAt = time.Now()
+	if err := q.backend.Save(ctx, job); err != nil {
+		log.Printf("jobs: failed to mark %s running: %v", job.ID, err)
+	}
+
+	var err error
+	if !ok {
+		err = Permanent(fmt.Errorf("no handler registered for job type %q", job.Type))
+	} else {
+		err = q.run(ctx, handler, job)
+	}
+
+	job.UpdatedAt = time.Now()
+	if err == nil {
+		job.Status = StatusSucceeded
+		job.LastError = ""
+		if err := q.backend.Save(ctx, job); err != nil {
+			log.Printf("jobs: failed to mark %s succeeded: %v", job.ID, err)
+		}
+		return
+	}
+
+	job.LastError = err.Error()
+	var permanent *permanentError
+	if errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts {
+		job.Status = StatusDead
+		if err := q.backend.Bury(ctx, job); err != nil {
+			log.Printf("jobs: failed to dead-letter %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	job.Status = StatusRetrying
+	job.RunAt = time.Now().Add(q.backoff(job.Attempts))
+	if err := q.backend.Push(ctx, job); err != nil {
+		log.Printf("jobs: failed to reschedule %s: %v", job.ID, err)
+	}
+}
+
+// run executes a single attempt, converting panics into errors
+func (q *Queue) run(ctx context.Context, handler Handler, job *Job) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, q.cfg.JobTimeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+// backoff returns an exponential delay with jitter for the given attempt
+func (q *Queue) backoff(attempt int) time.Duration {
+	delay := q.cfg.BaseBackoff
+	for i := 1; i < attempt && delay < q.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.cfg.MaxBackoff {
+		delay = q.cfg.MaxBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,217 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	return Config{
+		MaxAttempts: 3,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+		JobTimeout:  time.Second,
+		PollTimeout: 20 * time.Millisecond,
+	}
+}
+
+// startQueue runs one worker until the test ends
+func startQueue(t *testing.T, backend Backend) *Queue {
+	t.Helper()
+	q := NewQueue(backend, testConfig())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		q.Wait()
+	})
+	q.Start(ctx, Pool{Queue: DefaultQueue, Concurrency: 1})
+	return q
+}
+
+// waitFor polls the job until it reaches a terminal state
+func waitFor(t *testing.T, q *Queue, id string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := q.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if job.Terminal() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
+
+func TestQueueRunsJob(t *testing.T) {
+	q := startQueue(t, NewMemoryBackend())
+	q.Register("echo", Handle(func(ctx context.Context, payload string) error {
+		if payload != "hello" {
+			return Permanent(errors.New("unexpected payload " + payload))
+		}
+		return nil
+	}))
+
+	job, err := q.Enqueue(context.Background(), "echo", "hello")
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	done := waitFor(t, q, job.ID)
+	if done.Status != StatusSucceeded || done.Attempts != 1 {
+		t.Fatalf("got status %s after %d attempts, want succeeded after 1", done.Status, done.Attempts)
+	}
+}
+
+func TestQueueRetriesThenSucceeds(t *testing.T) {
+	q := startQueue(t, NewMemoryBackend())
+	var calls int32
+	q.Register("flaky", func(ctx context.Context, job *Job) error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errors.New("try again")
+		}
+		return nil
+	})
+
+	job, _ := q.Enqueue(context.Background(), "flaky", nil)
+	done := waitFor(t, q, job.ID)
+	if done.Status != StatusSucceeded || done.Attempts != 3 {
+		t.Fatalf("got status %s after %d attempts, want succeeded after 3", done.Status, done.Attempts)
+	}
+}
+
+func TestQueueDeadLettersExhaustedJob(t *testing.T) {
+	q := startQueue(t, NewMemoryBackend())
+	q.Register("broken", func(ctx context.Context, job *Job) error {
+		return errors.New("always fails")
+	})
+
+	job, _ := q.Enqueue(context.Background(), "broken", nil)
+	done := waitFor(t, q, job.ID)
+	if done.Status != StatusDead || done.Attempts != 3 || done.LastError != "always fails" {
+		t.Fatalf("got %s after %d attempts (%q), want dead after 3", done.Status, done.Attempts, done.LastError)
+	}
+	dead, err := q.DeadLetters(context.Background(), 10)
+	if err != nil || len(dead) != 1 || dead[0].ID != job.ID {
+		t.Fatalf("DeadLetters = %v, %v; want the job", dead, err)
+	}
+}
+
+func TestQueuePermanentAndPanic(t *testing.T) {
+	q := startQueue(t, NewMemoryBackend())
+	q.Register("permanent", func(ctx context.Context, job *Job) error {
+		return Permanent(errors.New("bad input"))
+	})
+	q.Register("panics", func(ctx context.Context, job *Job) error {
+		panic("boom")
+	})
+
+	permanent, _ := q.Enqueue(context.Background(), "permanent", nil)
+	if done := waitFor(t, q, permanent.ID); done.Status != StatusDead || done.Attempts != 1 {
+		t.Fatalf("permanent: got %s after %d attempts, want dead after 1", done.Status, done.Attempts)
+	}
+	panics, _ := q.Enqueue(context.Background(), "panics", nil, WithMaxAttempts(1))
+	if done := waitFor(t, q, panics.ID); done.Status != StatusDead || done.LastError != "job panicked: boom" {
+		t.Fatalf("panics: got %s (%q), want dead from the panic", done.Status, done.LastError)
+	}
+	unknown, _ := q.Enqueue(context.Background(), "unknown", nil)
+	if done := waitFor(t, q, unknown.ID); done.Status != StatusDead || done.Attempts != 1 {
+		t.Fatalf("unknown type: got %s after %d attempts, want dead after 1", done.Status, done.Attempts)
+	}
+}
+
+func TestQueueDelay(t *testing.T) {
+	q := startQueue(t, NewMemoryBackend())
+	ran := make(chan time.Time, 1)
+	q.Register("later", func(ctx context.Context, job *Job) error {
+		ran <- time.Now()
+		return nil
+	})
+
+	start := time.Now()
+	job, _ := q.Enqueue(context.Background(), "later", nil, WithDelay(100*time.Millisecond))
+	waitFor(t, q, job.ID)
+	if at := <-ran; at.Sub(start) < 100*time.Millisecond {
+		t.Fatalf("job ran after %v, before its delay", at.Sub(start))
+	}
+}
+
+func TestQueueDeadLettersJobReclaimedAfterLastAttempt(t *testing.T) {
+	backend := NewMemoryBackend()
+	q := startQueue(t, backend)
+	q.Register("crashes", func(ctx context.Context, job *Job) error {
+		t.Error("a job whose attempts ran out must not run again")
+		return nil
+	})
+
+	// As left behind by a worker that stopped during the last attempt
+	job := &Job{ID: newJobID(), Type: "crashes", Queue: DefaultQueue, Status: StatusRunning, Attempts: 3, MaxAttempts: 3, RunAt: time.Now()}
+	if err := backend.Push(context.Background(), job); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if done := waitFor(t, q, job.ID); done.Status != StatusDead || done.Attempts != 3 {
+		t.Fatalf("got %s after %d attempts, want dead after 3", done.Status, done.Attempts)
+	}
+}
+
+func TestQueueRoutesJobTypes(t *testing.T) {
+	pools, err := ParsePools("crawl=1", 0)
+	if err != nil {
+		t.Fatalf("ParsePools: %v", err)
+	}
+	cfg := testConfig()
+	if cfg.Routes, err = ParseRoutes("crawl.page=crawl", pools); err != nil {
+		t.Fatalf("ParseRoutes: %v", err)
+	}
+	q := NewQueue(NewMemoryBackend(), cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		q.Wait()
+	})
+	// The default pool has no workers, so only routed jobs run
+	q.Start(ctx, pools...)
+	q.Register("crawl.page", Handle(func(ctx context.Context, payload string) error { return nil }))
+
+	job, err := q.Enqueue(ctx, "crawl.page", "x")
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if job.Queue != "crawl" {
+		t.Fatalf("job went to %q, want crawl", job.Queue)
+	}
+	if done := waitFor(t, q, job.ID); done.Status != StatusSucceeded {
+		t.Fatalf("routed job finished as %s", done.Status)
+	}
+	if other, err := q.Enqueue(ctx, "crawl.page", "x", WithQueue(DefaultQueue)); err != nil || other.Queue != DefaultQueue {
+		t.Fatalf("WithQueue did not override the route: %v, %v", other, err)
+	}
+}
+
+func TestParsePoolsAndRoutes(t *testing.T) {
+	pools, err := ParsePools(" default=2, crawl=3 ,", 4)
+	if err != nil {
+		t.Fatalf("ParsePools: %v", err)
+	}
+	want := []Pool{{DefaultQueue, 2}, {"crawl", 3}}
+	if len(pools) != len(want) || pools[0] != want[0] || pools[1] != want[1] {
+		t.Fatalf("ParsePools = %v, want %v", pools, want)
+	}
+	for _, spec := range []string{"crawl", "crawl=", "crawl=-1", "crawl=x", "=2"} {
+		if _, err := ParsePools(spec, 4); err == nil {
+			t.Errorf("ParsePools(%q) succeeded, want an error", spec)
+		}
+	}
+	if _, err := ParseRoutes("mail.send=mail", pools); err == nil {
+		t.Error("ParseRoutes accepted a queue without workers")
+	}
+	routes, err := ParseRoutes("knowledge.crawl=crawl", pools)
+	if err != nil || routes["knowledge.crawl"] != "crawl" {
+		t.Fatalf("ParseRoutes = %v, %v", routes, err)
+	}
+}
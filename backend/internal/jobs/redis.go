@@ -0,0 +1,206 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// finishedRetention is how long succeeded and dead jobs remain queryable
+	finishedRetention = 7 * 24 * time.Hour
+	// maxDeadLetters caps the dead letter list
+	maxDeadLetters = 1000
+)
+
+// promoteScript atomically moves due jobs from the delayed set to the ready list
+var promoteScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('RPUSH', KEYS[2], id)
+end
+return #ids
+`)
+
+// reclaimScript returns jobs whose lease expired to the ready list. A job
+// popped but not yet leased gets a lease instead, since its worker may be
+// about to record one.
+var reclaimScript = redis.NewScript(`
+local ids = redis.call('LRANGE', KEYS[1], 0, -1)
+local reclaimed = 0
+for _, id in ipairs(ids) do
+	local lease = redis.call('ZSCORE', KEYS[2], id)
+	if not lease then
+		redis.call('ZADD', KEYS[2], ARGV[2], id)
+	elseif tonumber(lease) <= tonumber(ARGV[1]) then
+		redis.call('LREM', KEYS[1], 1, id)
+		redis.call('ZREM', KEYS[2], id)
+		redis.call('RPUSH', KEYS[3], id)
+		reclaimed = reclaimed + 1
+	end
+end
+return reclaimed
+`)
+
+// RedisBackend stores jobs in Redis so any replica's workers can run them.
+// Popped jobs stay on a processing list under a lease until acknowledged,
+// so a job whose worker dies is run again once the lease expires.
+type RedisBackend struct {
+	client     *redis.Client
+	visibility time.Duration
+}
+
+// NewRedisBackend creates a backend whose leases last visibility, which
+// must exceed the longest a job attempt can run
+func NewRedisBackend(client *redis.Client, visibility time.Duration) *RedisBackend {
+	return &RedisBackend{client: client, visibility: visibility}
+}
+
+func jobKey(id string) string           { return "jobs:job:" + id }
+func readyKey(queue string) string      { return "jobs:ready:" + queue }
+func delayedKey(queue string) string    { return "jobs:delayed:" + queue }
+func processingKey(queue string) string { return "jobs:processing:" + queue }
+func leaseKey(queue string) string      { return "jobs:leases:" + queue }
+func deadLetterKey() string             { return "jobs:dead" }
+
+func (b *RedisBackend) Push(ctx context.Context, job *Job) error {
+	if err := b.Save(ctx, job); err != nil {
+		return err
+	}
+
+	if job.RunAt.After(time.Now()) {
+		member := redis.Z{Score: float64(job.RunAt.UnixMilli()), Member: job.ID}
+		if err := b.client.ZAdd(ctx, delayedKey(job.Queue), member).Err(); err != nil {
+			return fmt.Errorf("failed to schedule job: %w", err)
+		}
+		return nil
+	}
+
+	if err := b.client.RPush(ctx, readyKey(job.Queue), job.ID).Err(); err != nil {
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	return nil
+}
+
+func (b *RedisBackend) Pop(ctx context.Context, queue string, timeout time.Duration) (*Job, error) {
+	now := time.Now()
+	nowMillis := strconv.FormatInt(now.UnixMilli(), 10)
+	if err := promoteScript.Run(ctx, b.client, []string{delayedKey(queue), readyKey(queue)}, nowMillis).Err(); err != nil {
+		return nil, fmt.Errorf("failed to promote delayed jobs: %w", err)
+	}
+	expiry := strconv.FormatInt(now.Add(b.visibility).UnixMilli(), 10)
+	reclaimed, err := reclaimScript.Run(ctx, b.client,
+		[]string{processingKey(queue), leaseKey(queue), readyKey(queue)}, nowMillis, expiry).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reclaim expired jobs: %w", err)
+	}
+	if reclaimed > 0 {
+		log.Printf("jobs: reclaimed %d jobs from %s whose workers stopped", reclaimed, queue)
+	}
+
+	id, err := b.client.BLMove(ctx, readyKey(queue), processingKey(queue), "LEFT", "RIGHT", timeout).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to pop job: %w", err)
+	}
+	lease := redis.Z{Score: float64(time.Now().Add(b.visibility).UnixMilli()), Member: id}
+	if err := b.client.ZAdd(ctx, leaseKey(queue), lease).Err(); err != nil {
+		// The reclaim pass leases it instead
+		log.Printf("jobs: failed to lease %s: %v", id, err)
+	}
+
+	job, err := b.Get(ctx, id)
+	if errors.Is(err, ErrJobNotFound) {
+		// The job record expired while queued; nothing left to run
+		b.Ack(ctx, &Job{ID: id, Queue: queue})
+		return nil, nil
+	}
+	return job, err
+}
+
+// Ack removes a popped job from the processing list once its attempt is
+// recorded
+func (b *RedisBackend) Ack(ctx context.Context, job *Job) error {
+	pipe := b.client.TxPipeline()
+	pipe.LRem(ctx, processingKey(job.Queue), 1, job.ID)
+	pipe.ZRem(ctx, leaseKey(job.Queue), job.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to acknowledge job: %w", err)
+	}
+	return nil
+}
+
+func (b *RedisBackend) Save(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	var ttl time.Duration
+	if job.Terminal() {
+		ttl = finishedRetention
+	}
+	if err := b.client.Set(ctx, jobKey(job.ID), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	return nil
+}
+
+func (b *RedisBackend) Get(ctx context.Context, id string) (*Job, error) {
+	data, err := b.client.Get(ctx, jobKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load job: %w", err)
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job: %w", err)
+	}
+	return &job, nil
+}
+
+func (b *RedisBackend) Bury(ctx context.Context, job *Job) error {
+	if err := b.Save(ctx, job); err != nil {
+		return err
+	}
+
+	pipe := b.client.TxPipeline()
+	pipe.LPush(ctx, deadLetterKey(), job.ID)
+	pipe.LTrim(ctx, deadLetterKey(), 0, maxDeadLetters-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to dead-letter job: %w", err)
+	}
+	return nil
+}
+
+func (b *RedisBackend) DeadLetters(ctx context.Context, limit int) ([]*Job, error) {
+	ids, err := b.client.LRange(ctx, deadLetterKey(), 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+
+	jobs := make([]*Job, 0, len(ids))
+	for _, id := range ids {
+		job, err := b.Get(ctx, id)
+		if errors.Is(err, ErrJobNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
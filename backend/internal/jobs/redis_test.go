@@ -0,0 +1,101 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisBackend(t *testing.T, visibility time.Duration) (*RedisBackend, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisBackend(client, visibility), mr
+}
+
+func TestRedisBackendPopAck(t *testing.T) {
+	ctx := context.Background()
+	b, mr := newTestRedisBackend(t, time.Minute)
+
+	job := &Job{ID: "a", Type: "t", Queue: DefaultQueue, Status: StatusPending, RunAt: time.Now()}
+	if err := b.Push(ctx, job); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	popped, err := b.Pop(ctx, DefaultQueue, 10*time.Millisecond)
+	if err != nil || popped == nil || popped.ID != "a" {
+		t.Fatalf("Pop = %v, %v; want job a", popped, err)
+	}
+	if items, _ := mr.List(processingKey(DefaultQueue)); len(items) != 1 {
+		t.Fatalf("processing list = %v, want the popped job", items)
+	}
+	if err := b.Ack(ctx, popped); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if mr.Exists(processingKey(DefaultQueue)) || mr.Exists(leaseKey(DefaultQueue)) {
+		t.Fatal("acknowledged job is still tracked as processing")
+	}
+	if again, err := b.Pop(ctx, DefaultQueue, 10*time.Millisecond); err != nil || again != nil {
+		t.Fatalf("second Pop = %v, %v; want nothing", again, err)
+	}
+}
+
+func TestRedisBackendReclaimsExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	b, _ := newTestRedisBackend(t, 50*time.Millisecond)
+
+	job := &Job{ID: "a", Type: "t", Queue: DefaultQueue, Status: StatusPending, RunAt: time.Now()}
+	if err := b.Push(ctx, job); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	// The worker that pops it never acknowledges it
+	if popped, err := b.Pop(ctx, DefaultQueue, 10*time.Millisecond); err != nil || popped == nil {
+		t.Fatalf("Pop = %v, %v; want the job", popped, err)
+	}
+	if early, err := b.Pop(ctx, DefaultQueue, 10*time.Millisecond); err != nil || early != nil {
+		t.Fatalf("Pop during the lease = %v, %v; want nothing", early, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	reclaimed, err := b.Pop(ctx, DefaultQueue, 10*time.Millisecond)
+	if err != nil || reclaimed == nil || reclaimed.ID != "a" {
+		t.Fatalf("Pop after the lease = %v, %v; want job a again", reclaimed, err)
+	}
+}
+
+func TestRedisBackendDelayedJob(t *testing.T) {
+	ctx := context.Background()
+	b, _ := newTestRedisBackend(t, time.Minute)
+
+	job := &Job{ID: "a", Type: "t", Queue: DefaultQueue, Status: StatusPending, RunAt: time.Now().Add(50 * time.Millisecond)}
+	if err := b.Push(ctx, job); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if early, err := b.Pop(ctx, DefaultQueue, 10*time.Millisecond); err != nil || early != nil {
+		t.Fatalf("Pop before RunAt = %v, %v; want nothing", early, err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if due, err := b.Pop(ctx, DefaultQueue, 10*time.Millisecond); err != nil || due == nil {
+		t.Fatalf("Pop after RunAt = %v, %v; want the job", due, err)
+	}
+}
+
+func TestQueueOnRedisBackend(t *testing.T) {
+	b, mr := newTestRedisBackend(t, time.Minute)
+	q := startQueue(t, b)
+	q.Register("echo", func(ctx context.Context, job *Job) error { return nil })
+
+	job, err := q.Enqueue(context.Background(), "echo", nil)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if done := waitFor(t, q, job.ID); done.Status != StatusSucceeded {
+		t.Fatalf("got status %s, want succeeded", done.Status)
+	}
+	if mr.Exists(processingKey(DefaultQueue)) {
+		t.Fatal("finished job is still on the processing list")
+	}
+}
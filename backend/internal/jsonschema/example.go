@@ -0,0 +1,104 @@
+package jsonschema
+
+import (
+	"math"
+	"strings"
+)
+
+// Example builds a value that satisfies simple schemas, for offline mock
+// responses. Patterns and complex combinations are not guaranteed to match.
+func (s *Schema) Example() interface{} {
+	if s.hasConst {
+		return s.constValue
+	}
+	if len(s.enum) > 0 {
+		return s.enum[0]
+	}
+	for _, subs := range [][]*Schema{s.allOf, s.anyOf, s.oneOf} {
+		if len(subs) > 0 && len(s.types) == 0 {
+			return subs[0].Example()
+		}
+	}
+
+	typ := ""
+	for _, t := range s.types {
+		if t != "null" {
+			typ = t
+			break
+		}
+	}
+	if typ == "" && len(s.types) > 0 {
+		return nil
+	}
+	if typ == "" {
+		switch {
+		case s.properties != nil:
+			typ = "object"
+		case s.items != nil:
+			typ = "array"
+		default:
+			typ = "string"
+		}
+	}
+
+	switch typ {
+	case "object":
+		obj := make(map[string]interface{})
+		names := s.required
+		if len(names) == 0 {
+			for name := range s.properties {
+				names = append(names, name)
+			}
+		}
+		for _, name := range names {
+			if prop, ok := s.properties[name]; ok {
+				obj[name] = prop.Example()
+			} else if s.additionalProperties != nil {
+				obj[name] = s.additionalProperties.Example()
+			} else {
+				obj[name] = ""
+			}
+		}
+		return obj
+	case "array":
+		n := 0
+		if s.minItems != nil {
+			n = *s.minItems
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			if s.items != nil {
+				arr[i] = s.items.Example()
+			} else {
+				arr[i] = ""
+			}
+		}
+		return arr
+	case "number", "integer":
+		n := 0.0
+		if s.minimum != nil {
+			n = *s.minimum
+		}
+		if s.exclusiveMinimum != nil && n <= *s.exclusiveMinimum {
+			n = *s.exclusiveMinimum + 1
+		}
+		if s.maximum != nil && n > *s.maximum {
+			n = *s.maximum
+		}
+		if typ == "integer" {
+			n = math.Ceil(n)
+		}
+		return n
+	case "boolean":
+		return false
+	default:
+		str := "example"
+		if s.maxLength != nil && len(str) > *s.maxLength {
+			str = str[:*s.maxLength]
+		}
+		if s.minLength != nil && len(str) < *s.minLength {
+			str += strings.Repeat("x", *s.minLength-len(str))
+		}
+		return str
+	}
+}
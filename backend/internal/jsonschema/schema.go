@@ -0,0 +1,496 @@
+// Package jsonschema validates decoded JSON values against a practical
+// subset of JSON Schema: type, enum, const, properties, required,
+// additionalProperties, items, string/number/array bounds, pattern and the
+// allOf/anyOf/oneOf/not combinators. Annotations such as title and
+// description are accepted; any other keyword, such as format or $ref, is
+// rejected at compile time rather than silently not enforced.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidSchema is returned when a schema cannot be compiled
+var ErrInvalidSchema = errors.New("invalid JSON schema")
+
+// Schema is a compiled schema
+type Schema struct {
+	types                []string
+	enum                 []interface{}
+	constValue           interface{}
+	hasConst             bool
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *Schema // nil allows anything
+	noAdditional         bool
+	items                *Schema
+	minItems, maxItems   *int
+	minLength, maxLength *int
+	minimum, maximum     *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+	pattern              *regexp.Regexp
+	allOf, anyOf, oneOf  []*Schema
+	not                  *Schema
+}
+
+// ValidationError describes one violation at a JSON pointer-like path
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Errors is a list of violations
+type Errors []ValidationError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Compile parses a schema document
+func Compile(raw []byte) (*Schema, error) {
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	return compile(doc, "#")
+}
+
+// MustCompile is like Compile but panics, for schemas embedded in code
+func MustCompile(raw string) *Schema {
+	s, err := Compile([]byte(raw))
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+var knownTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// keywords lists everything compile understands; annotations are accepted
+// but have no effect on validation
+var keywords = map[string]bool{
+	"type": true, "enum": true, "const": true, "properties": true, "required": true,
+	"additionalProperties": true, "items": true, "minItems": true, "maxItems": true,
+	"minLength": true, "maxLength": true, "minimum": true, "maximum": true,
+	"exclusiveMinimum": true, "exclusiveMaximum": true, "pattern": true,
+	"allOf": true, "anyOf": true, "oneOf": true, "not": true,
+	// annotations
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+func compile(doc interface{}, path string) (*Schema, error) {
+	if b, ok := doc.(bool); ok {
+		// true accepts everything; false accepts nothing
+		if b {
+			return &Schema{}, nil
+		}
+		return &Schema{not: &Schema{}}, nil
+	}
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: %s must be an object", ErrInvalidSchema, path)
+	}
+
+	s := &Schema{}
+	var err error
+	fail := func(keyword, msg string) error {
+		return fmt.Errorf("%w: %s/%s %s", ErrInvalidSchema, path, keyword, msg)
+	}
+
+	var unknown []string
+	for keyword := range m {
+		if !keywords[keyword] {
+			unknown = append(unknown, keyword)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fail(unknown[0], "is not supported")
+	}
+
+	switch t := m["type"].(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, v := range t {
+			name, ok := v.(string)
+			if !ok {
+				return nil, fail("type", "must contain strings")
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		return nil, fail("type", "must be a string or array")
+	}
+	for _, t := range s.types {
+		if !knownTypes[t] {
+			return nil, fail("type", fmt.Sprintf("has unknown type %q", t))
+		}
+	}
+
+	if v, ok := m["enum"]; ok {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fail("enum", "must be an array")
+		}
+		s.enum = list
+	}
+	if v, ok := m["const"]; ok {
+		s.constValue, s.hasConst = v, true
+	}
+
+	if v, ok := m["properties"]; ok {
+		props, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fail("properties", "must be an object")
+		}
+		s.properties = make(map[string]*Schema, len(props))
+		for name, sub := range props {
+			if s.properties[name], err = compile(sub, path+"/properties/"+name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if v, ok := m["required"]; ok {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fail("required", "must be an array")
+		}
+		for _, r := range list {
+			name, ok := r.(string)
+			if !ok {
+				return nil, fail("required", "must contain strings")
+			}
+			s.required = append(s.required, name)
+		}
+	}
+	switch v := m["additionalProperties"].(type) {
+	case nil:
+	case bool:
+		s.noAdditional = !v
+	default:
+		if s.additionalProperties, err = compile(v, path+"/additionalProperties"); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := m["items"]; ok {
+		if s.items, err = compile(v, path+"/items"); err != nil {
+			return nil, err
+		}
+	}
+
+	ints := map[string]**int{"minItems": &s.minItems, "maxItems": &s.maxItems, "minLength": &s.minLength, "maxLength": &s.maxLength}
+	for keyword, dst := range ints {
+		if v, ok := m[keyword]; ok {
+			n, ok := toFloat(v)
+			if !ok || n < 0 || n != math.Trunc(n) {
+				return nil, fail(keyword, "must be a non-negative integer")
+			}
+			i := int(n)
+			*dst = &i
+		}
+	}
+	floats := map[string]**float64{"minimum": &s.minimum, "maximum": &s.maximum, "exclusiveMinimum": &s.exclusiveMinimum, "exclusiveMaximum": &s.exclusiveMaximum}
+	for keyword, dst := range floats {
+		if v, ok := m[keyword]; ok {
+			n, ok := toFloat(v)
+			if !ok {
+				return nil, fail(keyword, "must be a number")
+			}
+			*dst = &n
+		}
+	}
+
+	if v, ok := m["pattern"]; ok {
+		p, ok := v.(string)
+		if !ok {
+			return nil, fail("pattern", "must be a string")
+		}
+		if s.pattern, err = regexp.Compile(p); err != nil {
+			return nil, fail("pattern", err.Error())
+		}
+	}
+
+	combinators := map[string]*[]*Schema{"allOf": &s.allOf, "anyOf": &s.anyOf, "oneOf": &s.oneOf}
+	for keyword, dst := range combinators {
+		v, ok := m[keyword]
+		if !ok {
+			continue
+		}
+		list, ok := v.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, fail(keyword, "must be a non-empty array")
+		}
+		for i, sub := range list {
+			compiled, err := compile(sub, fmt.Sprintf("%s/%s/%d", path, keyword, i))
+			if err != nil {
+				return nil, err
+			}
+			*dst = append(*dst, compiled)
+		}
+	}
+	if v, ok := m["not"]; ok {
+		if s.not, err = compile(v, path+"/not"); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// ValidateJSON decodes data and validates it
+func (s *Schema) ValidateJSON(data []byte) (interface{}, error) {
+	var value interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return nil, Errors{{Path: "/", Message: "invalid JSON: " + err.Error()}}
+	}
+	if dec.More() {
+		return nil, Errors{{Path: "/", Message: "unexpected data after JSON value"}}
+	}
+	if errs := s.Validate(value); len(errs) > 0 {
+		return value, errs
+	}
+	return value, nil
+}
+
+// Validate checks a value decoded with encoding/json (numbers may be
+// float64 or json.Number) and returns every violation found
+func (s *Schema) Validate(value interface{}) Errors {
+	var errs Errors
+	s.validate(value, "", &errs)
+	return errs
+}
+
+func (s *Schema) validate(v interface{}, path string, errs *Errors) {
+	add := func(format string, args ...interface{}) {
+		p := path
+		if p == "" {
+			p = "/"
+		}
+		*errs = append(*errs, ValidationError{Path: p, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.types) > 0 && !s.matchesType(v) {
+		add("expected %s, got %s", strings.Join(s.types, " or "), typeName(v))
+		return
+	}
+	if len(s.enum) > 0 {
+		found := false
+		for _, e := range s.enum {
+			if equal(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("must be one of %s", formatValues(s.enum))
+		}
+	}
+	if s.hasConst && !equal(s.constValue, v) {
+		add("must equal %s", formatValues([]interface{}{s.constValue}))
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := val[name]; !ok {
+				add("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(val))
+		for name := range val {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := path + "/" + name
+			if prop, ok := s.properties[name]; ok {
+				prop.validate(val[name], child, errs)
+			} else if s.noAdditional {
+				*errs = append(*errs, ValidationError{Path: child, Message: "additional property is not allowed"})
+			} else if s.additionalProperties != nil {
+				s.additionalProperties.validate(val[name], child, errs)
+			}
+		}
+	case []interface{}:
+		if s.minItems != nil && len(val) < *s.minItems {
+			add("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(val) > *s.maxItems {
+			add("must have at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range val {
+				s.items.validate(item, fmt.Sprintf("%s/%d", path, i), errs)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.minLength != nil && n < *s.minLength {
+			add("must be at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			add("must be at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			add("must match pattern %q", s.pattern.String())
+		}
+	default:
+		if n, ok := toFloat(v); ok {
+			if s.minimum != nil && n < *s.minimum {
+				add("must be >= %v", *s.minimum)
+			}
+			if s.maximum != nil && n > *s.maximum {
+				add("must be <= %v", *s.maximum)
+			}
+			if s.exclusiveMinimum != nil && n <= *s.exclusiveMinimum {
+				add("must be > %v", *s.exclusiveMinimum)
+			}
+			if s.exclusiveMaximum != nil && n >= *s.exclusiveMaximum {
+				add("must be < %v", *s.exclusiveMaximum)
+			}
+		}
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, path, errs)
+	}
+	if len(s.anyOf) > 0 {
+		matched := false
+		for _, sub := range s.anyOf {
+			if len(sub.Validate(v)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			add("must match at least one schema in anyOf")
+		}
+	}
+	if len(s.oneOf) > 0 {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if len(sub.Validate(v)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			add("must match exactly one schema in oneOf, matched %d", matches)
+		}
+	}
+	if s.not != nil && len(s.not.Validate(v)) == 0 {
+		add("must not match the schema in not")
+	}
+}
+
+func (s *Schema) matchesType(v interface{}) bool {
+	actual := typeName(v)
+	for _, t := range s.types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func typeName(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		if n, ok := toFloat(val); ok {
+			if n == math.Trunc(n) && !math.IsInf(n, 0) {
+				return "integer"
+			}
+			return "number"
+		}
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// equal compares decoded JSON values, treating numbers by value
+func equal(a, b interface{}) bool {
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if okA && okB {
+		return fa == fb
+	}
+	return reflect.DeepEqual(normalizeNumbers(a), normalizeNumbers(b))
+}
+
+func normalizeNumbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = normalizeNumbers(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = normalizeNumbers(item)
+		}
+		return out
+	default:
+		if f, ok := toFloat(val); ok {
+			return f
+		}
+		return v
+	}
+}
+
+func formatValues(values []interface{}) string {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Sprint(values)
+	}
+	return string(data)
+}
@@ -0,0 +1,62 @@
+package jsonschema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompileRejectsUnsupportedKeywords(t *testing.T) {
+	for _, raw := range []string{
+		`{"type": "string", "format": "email"}`,
+		`{"$ref": "#/definitions/x"}`,
+		`{"type": "object", "properties": {"a": {"type": "string", "format": "date"}}}`,
+		`{"type": "array", "items": {"uniqueItems": true}}`,
+		`{"anyOf": [{"type": "string"}, {"if": {}}]}`,
+	} {
+		_, err := Compile([]byte(raw))
+		if !errors.Is(err, ErrInvalidSchema) {
+			t.Errorf("Compile(%s) = %v, want ErrInvalidSchema", raw, err)
+		}
+	}
+}
+
+func TestCompileAcceptsAnnotations(t *testing.T) {
+	raw := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title": "Person",
+		"description": "A person",
+		"type": "object",
+		"properties": {"name": {"type": "string", "default": "", "examples": ["Ada"]}}
+	}`
+	if _, err := Compile([]byte(raw)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompileErrorNamesKeyword(t *testing.T) {
+	_, err := Compile([]byte(`{"properties": {"a": {"format": "uri"}}}`))
+	if err == nil || !strings.Contains(err.Error(), "#/properties/a/format") {
+		t.Fatalf("got %v, want the path of the unsupported keyword", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := MustCompile(`{
+		"type": "object",
+		"required": ["name"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"age": {"type": "integer", "minimum": 0}
+		}
+	}`)
+	if _, err := s.ValidateJSON([]byte(`{"name": "Ada", "age": 36}`)); err != nil {
+		t.Fatalf("valid document rejected: %v", err)
+	}
+	_, err := s.ValidateJSON([]byte(`{"age": -1, "extra": true}`))
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 3 {
+		t.Fatalf("got %v, want three violations", err)
+	}
+}
@@ -0,0 +1,103 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Templates renders messages from template files that define "subject",
+// "text" and optionally "html". The HTML part is escaped for HTML; the
+// others are plain text.
+type Templates struct {
+	text map[string]*template.Template
+	html map[string]*htmltemplate.Template
+}
+
+// LoadTemplates parses the built-in templates, replacing any with a file of
+// the same name, e.g. verify_email.tmpl, in dir when dir is set
+func LoadTemplates(dir string) (*Templates, error) {
+	entries, err := defaultTemplates.ReadDir("templates")
+	if err != nil {
+		return nil, err
+	}
+	t := &Templates{
+		text: make(map[string]*template.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+	for _, entry := range entries {
+		source, err := defaultTemplates.ReadFile("templates/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if dir != "" {
+			override, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err == nil {
+				source = override
+			} else if !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		name := strings.TrimSuffix(entry.Name(), ".tmpl")
+		if err := t.parse(name, string(source)); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *Templates) parse(name, source string) error {
+	text, err := template.New(name).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return fmt.Errorf("invalid mail template %s: %w", name, err)
+	}
+	if text.Lookup("subject") == nil || text.Lookup("text") == nil {
+		return fmt.Errorf("mail template %s must define subject and text", name)
+	}
+	t.text[name] = text
+	if text.Lookup("html") != nil {
+		html, err := htmltemplate.New(name).Option("missingkey=error").Parse(source)
+		if err != nil {
+			return fmt.Errorf("invalid mail template %s: %w", name, err)
+		}
+		t.html[name] = html
+	}
+	return nil
+}
+
+// Render builds the message named name for recipient to
+func (t *Templates) Render(name, to string, data interface{}) (Message, error) {
+	text, ok := t.text[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown mail template %q", name)
+	}
+	msg := Message{To: to}
+	var buf bytes.Buffer
+	if err := text.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s subject: %w", name, err)
+	}
+	msg.Subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+	if err := text.ExecuteTemplate(&buf, "text", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s text: %w", name, err)
+	}
+	msg.Text = strings.TrimSpace(buf.String()) + "\n"
+
+	if html, ok := t.html[name]; ok {
+		buf.Reset()
+		if err := html.ExecuteTemplate(&buf, "html", data); err != nil {
+			return Message{}, fmt.Errorf("failed to render %s html: %w", name, err)
+		}
+		msg.HTML = strings.TrimSpace(buf.String()) + "\n"
+	}
+	return msg, nil
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redactedParams are query parameters that may carry credentials, such as
+// the WebSocket ?token= fallback
+var redactedParams = []string{"token"}
+
+// redactedSegments are path prefixes followed by a credential, such as
+// the token of a shared session link
+var redactedSegments = []string{"/api/v1/shared/"}
+
+// Logger is gin's request logger with credentials removed from the logged
+// path
+func Logger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		var statusColor, methodColor, resetColor string
+		if param.IsOutputColor() {
+			statusColor = param.StatusCodeColor()
+			methodColor = param.MethodColor()
+			resetColor = param.ResetColor()
+		}
+		if param.Latency > time.Minute {
+			param.Latency = param.Latency.Truncate(time.Second)
+		}
+		return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			statusColor, param.StatusCode, resetColor,
+			param.Latency,
+			param.ClientIP,
+			methodColor, param.Method, resetColor,
+			redactPath(param.Path),
+			param.ErrorMessage,
+		)
+	})
+}
+
+func redactPath(path string) string {
+	base, rawQuery, ok := strings.Cut(path, "?")
+	base = redactSegments(base)
+	if !ok {
+		return base
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// Unparseable queries could hide a credential anywhere
+		return base + "?REDACTED"
+	}
+	redacted := false
+	for _, name := range redactedParams {
+		if _, found := query[name]; found {
+			query.Set(name, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return base + "?" + rawQuery
+	}
+	return base + "?" + query.Encode()
+}
+
+func redactSegments(path string) string {
+	for _, prefix := range redactedSegments {
+		rest, found := strings.CutPrefix(path, prefix)
+		if !found || rest == "" {
+			continue
+		}
+		_, tail, hasTail := strings.Cut(rest, "/")
+		path = prefix + "REDACTED"
+		if hasTail {
+			path += "/" + tail
+		}
+	}
+	return path
+}
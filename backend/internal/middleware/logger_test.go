@@ -0,0 +1,18 @@
+package middleware
+
+import "testing"
+
+func TestRedactPath(t *testing.T) {
+	for _, tc := range []struct{ path, want string }{
+		{"/api/v1/chat/sessions", "/api/v1/chat/sessions"},
+		{"/api/v1/ws/chat?token=secret", "/api/v1/ws/chat?token=REDACTED"},
+		{"/api/v1/search?q=go&page=2", "/api/v1/search?q=go&page=2"},
+		{"/api/v1/shared/abc123", "/api/v1/shared/REDACTED"},
+		{"/api/v1/shared/abc123/messages?limit=10", "/api/v1/shared/REDACTED/messages?limit=10"},
+		{"/api/v1/shared/", "/api/v1/shared/"},
+	} {
+		if got := redactPath(tc.path); got != tc.want {
+			t.Errorf("redactPath(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
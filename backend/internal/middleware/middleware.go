@@ -1,11 +1,18 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+
+	"likemind-backend/internal/services"
 )
 
 // CORS middleware
@@ -13,7 +20,7 @@ func CORS() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Workspace-ID")
 		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -25,8 +32,15 @@ func CORS() gin.HandlerFunc {
 	})
 }
 
-// AuthMiddleware validates JWT tokens
-func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+// errTokenExpired is returned by a credential check once a JWT expires
+var errTokenExpired = errors.New("token expired")
+
+// AuthMiddleware validates JWT tokens and API keys. Requests made with an
+// API key also get "api_key_id" and the key's "scopes", which RequireScope
+// checks. Every request gets a "credential_check" func(context.Context)
+// error that returns an error once the credential is revoked, expires or its
+// account is deactivated, for connections that outlive the request.
+func AuthMiddleware(jwtSecret string, apiKeys *services.APIKeyService, users *services.UserService) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -42,6 +56,36 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
+		if strings.HasPrefix(tokenString, services.APIKeyPrefix) {
+			key, user, err := apiKeys.Authenticate(c.Request.Context(), tokenString, c.ClientIP())
+			if err != nil {
+				if errors.Is(err, services.ErrInvalidAPIKey) {
+					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+					return
+				}
+				if errors.Is(err, services.ErrAccountDisabled) {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+					return
+				}
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			// Same types as the JWT claims handlers read
+			c.Set("user_id", float64(user.ID))
+			c.Set("email", user.Email)
+			c.Set("role", user.Role)
+			if key.WorkspaceID != 0 {
+				c.Set("token_workspace_id", float64(key.WorkspaceID))
+			}
+			c.Set("api_key_id", key.ID)
+			c.Set("scopes", key.ScopeList)
+			c.Set("credential_check", func(ctx context.Context) error {
+				return revoked(apiKeys.CheckKey(ctx, key.ID))
+			})
+			c.Next()
+			return
+		}
+
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, jwt.ErrSignatureInvalid
@@ -55,16 +99,158 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			c.Set("user_id", claims["user_id"])
-			c.Set("email", claims["email"])
-			c.Set("role", claims["role"])
+		claims, ok := token.Claims.(jwt.MapClaims)
+		userID, hasUser := claims["user_id"].(float64)
+		if !ok || !hasUser {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		// Tokens outlive deactivation and password resets, so the account
+		// is checked each time. Tokens issued before token versions have none.
+		version, _ := claims["tv"].(float64)
+		if err := users.CheckToken(c.Request.Context(), uint(userID), int(version)); err != nil {
+			if errors.Is(err, services.ErrAccountDisabled) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+				return
+			}
+			if errors.Is(err, services.ErrTokenRevoked) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		expiresAt, _ := claims.GetExpirationTime()
+		c.Set("user_id", claims["user_id"])
+		c.Set("email", claims["email"])
+		c.Set("role", claims["role"])
+		c.Set("token_workspace_id", claims["workspace_id"])
+		c.Set("credential_check", func(ctx context.Context) error {
+			if expiresAt != nil && time.Now().After(expiresAt.Time) {
+				return errTokenExpired
+			}
+			return revoked(users.CheckToken(ctx, uint(userID), int(version)))
+		})
+
+		c.Next()
+	})
+}
+
+// revoked keeps the errors that mean a credential is no longer valid, so a
+// database hiccup does not drop long-lived connections
+func revoked(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, services.ErrInvalidAPIKey), errors.Is(err, services.ErrAccountDisabled), errors.Is(err, services.ErrTokenRevoked):
+		return err
+	}
+	log.Printf("auth: failed to re-check credential: %v", err)
+	return nil
+}
+
+// WorkspaceScope resolves the workspace a request acts in and sets
+// "workspace_id" and the user's "workspace_role" in it. The X-Workspace-ID
+// header takes precedence over the token's workspace; without either, or
+// when the token's workspace is no longer accessible, the user's first
+// workspace is used. Must run after AuthMiddleware.
+func WorkspaceScope(workspaces *services.WorkspaceService) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		uid, _ := c.Get("user_id")
+		userID := uint(uid.(float64))
+
+		ctx := c.Request.Context()
+		var (
+			workspaceID uint
+			role        string
+			err         error
+		)
+		if header := c.GetHeader("X-Workspace-ID"); header != "" {
+			id, parseErr := strconv.ParseUint(header, 10, 64)
+			if parseErr != nil || id == 0 {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid X-Workspace-ID header"})
+				return
+			}
+			workspaceID, role, err = workspaces.ResolveWorkspace(ctx, userID, uint(id))
+		} else {
+			claim, _ := c.Get("token_workspace_id")
+			id, _ := claim.(float64)
+			workspaceID, role, err = workspaces.ResolveWorkspace(ctx, userID, uint(id))
+			if errors.Is(err, services.ErrWorkspaceNotFound) {
+				workspaceID, role, err = workspaces.ResolveWorkspace(ctx, userID, 0)
+			}
+		}
+		if err != nil {
+			if errors.Is(err, services.ErrWorkspaceNotFound) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "no access to this workspace"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set("workspace_id", workspaceID)
+		c.Set("workspace_role", role)
+		c.Next()
+	})
+}
+
+// readOnlyPOSTs are POST routes that only read, so a ":read" scope covers them
+var readOnlyPOSTs = map[string]bool{
+	"/api/v1/search/semantic":          true,
+	"/api/v1/knowledge/chunks/preview": true,
+}
+
+// RequireScope limits API keys to the route groups their scopes cover:
+// GET requests need resource:read or resource:write, others resource:write.
+// JWT sessions are not limited. Must run after AuthMiddleware.
+func RequireScope(resource string) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		value, ok := c.Get("scopes")
+		if !ok {
+			c.Next()
+			return
 		}
+		write := c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead && !readOnlyPOSTs[c.FullPath()]
+		if !services.ScopeAllows(value.([]string), resource, write) {
+			scope := resource + ":read"
+			if write {
+				scope = resource + ":write"
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key lacks the " + scope + " scope"})
+			return
+		}
+		c.Next()
+	})
+}
 
+// RequireSession rejects requests made with an API key, for routes that
+// manage credentials. Must run after AuthMiddleware.
+func RequireSession() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "this endpoint cannot be used with an API key"})
+			return
+		}
 		c.Next()
 	})
 }
 
+// WebSocketAuth validates JWT tokens and API keys for WebSocket upgrades.
+// Browsers cannot set headers on WebSocket requests, so the token may be
+// passed as ?token=.
+func WebSocketAuth(jwtSecret string, apiKeys *services.APIKeyService, users *services.UserService) gin.HandlerFunc {
+	auth := AuthMiddleware(jwtSecret, apiKeys, users)
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			if token := c.Query("token"); token != "" {
+				c.Request.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		auth(c)
+	})
+}
+
 // RateLimiting middleware (basic implementation)
 func RateLimiting() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
@@ -8,15 +8,17 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID        uint           `json:"id" gorm:"primarykey"`
-	Email     string         `json:"email" gorm:"unique;not null"`
-	Username  string         `json:"username" gorm:"unique;not null"`
-	Password  string         `json:"-" gorm:"not null"`
-	Role      string         `json:"role" gorm:"default:user"`
-	IsActive  bool           `json:"is_active" gorm:"default:true"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID              uint           `json:"id" gorm:"primarykey"`
+	Email           string         `json:"email" gorm:"unique;not null"`
+	Username        string         `json:"username" gorm:"unique;not null"`
+	Password        string         `json:"-" gorm:"not null"`
+	Role            string         `json:"role" gorm:"default:user"`
+	IsActive        bool           `json:"is_active" gorm:"default:true"`
+	EmailVerifiedAt *time.Time     `json:"email_verified_at,omitempty"`
+	TokenVersion    int            `json:"-" gorm:"not null;default:0"` // bumped to invalidate issued JWTs
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 // ChatSession represents a chat session
@@ -30,6 +32,27 @@ type ChatSession struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 	Messages  []ChatMessage  `json:"messages,omitempty" gorm:"foreignKey:SessionID"`
+
+	WorkspaceID uint `json:"workspace_id" gorm:"index"`
+
+	Participants []ChatParticipant `json:"participants,omitempty" gorm:"foreignKey:SessionID"`
+
+	// Optional system prompt rendered from a prompt template
+	PromptName      string `json:"prompt_name,omitempty"`
+	PromptVersion   int    `json:"prompt_version,omitempty"` // 0 follows the latest version
+	PromptVariables string `json:"prompt_variables,omitempty" gorm:"type:jsonb"`
+}
+
+// ChatParticipant grants a user access to a chat session they do not own
+type ChatParticipant struct {
+	ID        uint           `json:"id" gorm:"primarykey"`
+	SessionID uint           `json:"session_id" gorm:"not null;uniqueIndex:idx_chat_participant"`
+	UserID    uint           `json:"user_id" gorm:"not null;uniqueIndex:idx_chat_participant"`
+	User      User           `json:"user" gorm:"foreignKey:UserID"`
+	Role      string         `json:"role" gorm:"not null"` // owner, editor, viewer
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 // ChatMessage represents a message in a chat session
@@ -37,9 +60,11 @@ type ChatMessage struct {
 	ID        uint           `json:"id" gorm:"primarykey"`
 	SessionID uint           `json:"session_id" gorm:"not null"`
 	Session   ChatSession    `json:"-" gorm:"foreignKey:SessionID"`
-	Role      string         `json:"role" gorm:"not null"` // user, assistant, system
+	UserID    *uint          `json:"user_id,omitempty" gorm:"index"` // author of user messages
+	Role      string         `json:"role" gorm:"not null"`           // user, assistant, system
 	Content   string         `json:"content" gorm:"type:text;not null"`
 	Metadata  string         `json:"metadata,omitempty" gorm:"type:jsonb"`
+	Model     string         `json:"model,omitempty"` // model that generated an assistant message
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
@@ -57,17 +82,42 @@ type KnowledgeDocument struct {
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	WorkspaceID  uint `json:"workspace_id" gorm:"index"`
+	CreatedBy    uint `json:"created_by,omitempty"`
+	CollectionID uint `json:"collection_id" gorm:"index"`
+}
+
+// DocumentChunk is a retrieval-sized span of a knowledge document. Chunks
+// are derived data and are replaced whenever the document content changes.
+type DocumentChunk struct {
+	ID                 uint      `json:"id" gorm:"primarykey"`
+	DocumentID         uint      `json:"document_id" gorm:"not null;uniqueIndex:idx_document_chunk"`
+	ChunkIndex         int       `json:"index" gorm:"not null;uniqueIndex:idx_document_chunk"`
+	Content            string    `json:"content" gorm:"type:text;not null"`
+	StartOffset        int       `json:"start_offset"`
+	EndOffset          int       `json:"end_offset"`
+	Tokens             int       `json:"tokens"`
+	HeadingPath        string    `json:"heading_path,omitempty"` // headings joined with " > "
+	Strategy           string    `json:"strategy"`
+	EmbeddingModel     string    `json:"embedding_model,omitempty"`
+	EmbeddingDimension int       `json:"embedding_dimension,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
 }
 
 // SearchQuery represents a search query log
 type SearchQuery struct {
-	ID        uint           `json:"id" gorm:"primarykey"`
-	UserID    uint           `json:"user_id" gorm:"not null"`
-	User      User           `json:"user" gorm:"foreignKey:UserID"`
-	Query     string         `json:"query" gorm:"not null"`
-	Results   string         `json:"results,omitempty" gorm:"type:jsonb"`
-	CreatedAt time.Time      `json:"created_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID          uint           `json:"id" gorm:"primarykey"`
+	UserID      uint           `json:"user_id" gorm:"not null"`
+	User        User           `json:"-" gorm:"foreignKey:UserID"`
+	Query       string         `json:"query" gorm:"not null"`
+	Normalized  string         `json:"-" gorm:"index"` // lower-cased, whitespace-collapsed query
+	Results     string         `json:"results,omitempty" gorm:"type:jsonb"`
+	ResultCount int            `json:"result_count"`
+	LatencyMs   int64          `json:"latency_ms"`
+	CreatedAt   time.Time      `json:"created_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	WorkspaceID uint           `json:"workspace_id" gorm:"index"`
 }
 
 // Agent represents an AI agent configuration
@@ -80,4 +130,280 @@ type Agent struct {
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	WorkspaceID uint           `json:"workspace_id" gorm:"index"`
+	CreatedBy   uint           `json:"created_by,omitempty"`
+}
+
+// ChatShareLink grants read-only public access to a snapshot of a chat session
+type ChatShareLink struct {
+	ID        uint           `json:"id" gorm:"primarykey"`
+	SessionID uint           `json:"session_id" gorm:"not null;index"`
+	Session   ChatSession    `json:"-" gorm:"foreignKey:SessionID"`
+	CreatedBy uint           `json:"created_by" gorm:"not null"`
+	TokenHash string         `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt *time.Time     `json:"expires_at,omitempty"`
+	RevokedAt *time.Time     `json:"revoked_at,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// AgentSchedule runs an agent on a cron schedule
+type AgentSchedule struct {
+	ID        uint           `json:"id" gorm:"primarykey"`
+	AgentID   uint           `json:"agent_id" gorm:"not null;index"`
+	Agent     Agent          `json:"agent,omitempty" gorm:"foreignKey:AgentID"`
+	CreatedBy uint           `json:"created_by" gorm:"not null;index"`
+	Name      string         `json:"name"`
+	CronExpr  string         `json:"cron_expr" gorm:"not null"`
+	Timezone  string         `json:"timezone" gorm:"not null;default:UTC"`
+	Input     string         `json:"input" gorm:"type:text"`
+	CatchUp   string         `json:"catch_up" gorm:"not null;default:skip"` // skip, latest, all
+	IsPaused  bool           `json:"is_paused" gorm:"default:false"`
+	NextRunAt *time.Time     `json:"next_run_at,omitempty" gorm:"index"`
+	LastRunAt *time.Time     `json:"last_run_at,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// AgentRun records a single execution of an agent
+type AgentRun struct {
+	ID           uint           `json:"id" gorm:"primarykey"`
+	AgentID      uint           `json:"agent_id" gorm:"not null;index"`
+	ScheduleID   *uint          `json:"schedule_id,omitempty" gorm:"index"`
+	Trigger      string         `json:"trigger" gorm:"not null"` // schedule, catch_up, manual
+	ScheduledFor time.Time      `json:"scheduled_for"`
+	Input        string         `json:"input" gorm:"type:text"`
+	Output       string         `json:"output" gorm:"type:text"`
+	Status       string         `json:"status" gorm:"not null;default:pending"` // pending, running, succeeded, failed
+	Error        string         `json:"error,omitempty" gorm:"type:text"`
+	JobID        string         `json:"job_id,omitempty"`
+	StartedAt    *time.Time     `json:"started_at,omitempty"`
+	FinishedAt   *time.Time     `json:"finished_at,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// WebSource is a web page tracked for periodic re-crawling into the knowledge base
+type WebSource struct {
+	ID              uint           `json:"id" gorm:"primarykey"`
+	URL             string         `json:"url" gorm:"not null;uniqueIndex:idx_web_source_owner_url"`
+	WorkspaceID     uint           `json:"workspace_id" gorm:"uniqueIndex:idx_web_source_owner_url"`
+	CollectionID    uint           `json:"collection_id" gorm:"index"`
+	DocumentID      *uint          `json:"document_id,omitempty" gorm:"index"`
+	CreatedBy       uint           `json:"created_by" gorm:"not null;index;uniqueIndex:idx_web_source_owner_url"`
+	SitemapURL      string         `json:"sitemap_url,omitempty"`
+	ETag            string         `json:"etag,omitempty"`
+	LastModified    string         `json:"last_modified,omitempty"`
+	ContentHash     string         `json:"content_hash,omitempty"`
+	RecrawlInterval int            `json:"recrawl_interval"` // seconds; 0 disables re-crawling
+	LastFetchedAt   *time.Time     `json:"last_fetched_at,omitempty"`
+	LastChangedAt   *time.Time     `json:"last_changed_at,omitempty"`
+	NextFetchAt     *time.Time     `json:"next_fetch_at,omitempty" gorm:"index"`
+	LastStatus      int            `json:"last_status,omitempty"`
+	LastError       string         `json:"last_error,omitempty" gorm:"type:text"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// PromptTemplate is one immutable version of a named Go text/template prompt
+type PromptTemplate struct {
+	ID          uint           `json:"id" gorm:"primarykey"`
+	Name        string         `json:"name" gorm:"not null;uniqueIndex:idx_prompt_name_version"`
+	Version     int            `json:"version" gorm:"not null;uniqueIndex:idx_prompt_name_version"`
+	Description string         `json:"description"`
+	Template    string         `json:"template" gorm:"type:text;not null"`
+	Defaults    string         `json:"defaults,omitempty" gorm:"type:jsonb"` // default variable values
+	CreatedBy   uint           `json:"created_by" gorm:"not null;index"`
+	CreatedAt   time.Time      `json:"created_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// GuardrailViolation records content a guardrail check flagged, for review
+type GuardrailViolation struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	UserID     *uint      `json:"user_id,omitempty" gorm:"index"`
+	SessionID  *uint      `json:"session_id,omitempty" gorm:"index"`
+	Route      string     `json:"route,omitempty"`
+	Stage      string     `json:"stage" gorm:"not null;index"` // input, output
+	CheckName  string     `json:"check" gorm:"not null;index"`
+	Rule       string     `json:"rule,omitempty"`
+	Message    string     `json:"message"`
+	Action     string     `json:"action" gorm:"not null"` // block, warn, redact
+	Excerpt    string     `json:"excerpt" gorm:"type:text"`
+	Status     string     `json:"status" gorm:"not null;default:pending;index"` // pending, confirmed, dismissed
+	ReviewedBy *uint      `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Organization is a tenant; its members are grouped into workspaces
+type Organization struct {
+	ID        uint           `json:"id" gorm:"primarykey"`
+	Name      string         `json:"name" gorm:"not null"`
+	CreatedBy uint           `json:"created_by" gorm:"not null"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Role of the requesting user, filled in by listings
+	Role string `json:"role,omitempty" gorm:"-"`
+}
+
+// OrganizationMember grants a user a role in an organization
+type OrganizationMember struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	OrganizationID uint      `json:"organization_id" gorm:"not null;uniqueIndex:idx_organization_member"`
+	UserID         uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_organization_member;index"`
+	User           User      `json:"user" gorm:"foreignKey:UserID"`
+	Role           string    `json:"role" gorm:"not null"` // owner, admin, member
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// OrganizationInvitation offers a user a role in an organization; the user
+// only becomes a member by accepting it
+type OrganizationInvitation struct {
+	ID             uint         `json:"id" gorm:"primarykey"`
+	OrganizationID uint         `json:"organization_id" gorm:"not null;uniqueIndex:idx_organization_invitation"`
+	Organization   Organization `json:"organization" gorm:"foreignKey:OrganizationID"`
+	UserID         uint         `json:"user_id" gorm:"not null;uniqueIndex:idx_organization_invitation;index"`
+	User           User         `json:"user" gorm:"foreignKey:UserID"`
+	Role           string       `json:"role" gorm:"not null"` // owner, admin, member
+	InvitedBy      uint         `json:"invited_by" gorm:"not null"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// Workspace scopes the documents, agents, chat sessions and searches of a
+// team within an organization
+type Workspace struct {
+	ID             uint           `json:"id" gorm:"primarykey"`
+	OrganizationID uint           `json:"organization_id" gorm:"not null;index"`
+	Name           string         `json:"name" gorm:"not null"`
+	CreatedBy      uint           `json:"created_by" gorm:"not null"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Role of the requesting user, filled in by listings
+	Role string `json:"role,omitempty" gorm:"-"`
+}
+
+// WorkspaceMember grants an organization member a role in one workspace.
+// Organization owners and admins administer every workspace without one.
+type WorkspaceMember struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	WorkspaceID uint      `json:"workspace_id" gorm:"not null;uniqueIndex:idx_workspace_member"`
+	UserID      uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_workspace_member;index"`
+	User        User      `json:"user" gorm:"foreignKey:UserID"`
+	Role        string    `json:"role" gorm:"not null"` // admin, editor, viewer
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// UserGroup is a named set of organization members that collections can be
+// shared with
+type UserGroup struct {
+	ID             uint           `json:"id" gorm:"primarykey"`
+	OrganizationID uint           `json:"organization_id" gorm:"not null;index"`
+	Name           string         `json:"name" gorm:"not null"`
+	CreatedBy      uint           `json:"created_by" gorm:"not null"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// UserGroupMember adds an organization member to a group
+type UserGroupMember struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	GroupID   uint      `json:"group_id" gorm:"not null;uniqueIndex:idx_user_group_member"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_user_group_member;index"`
+	User      User      `json:"user" gorm:"foreignKey:UserID"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// KnowledgeCollection groups documents of a workspace under one access policy
+type KnowledgeCollection struct {
+	ID          uint           `json:"id" gorm:"primarykey"`
+	WorkspaceID uint           `json:"workspace_id" gorm:"not null;index"`
+	Name        string         `json:"name" gorm:"not null"`
+	Description string         `json:"description"`
+	Visibility  string         `json:"visibility" gorm:"not null;default:workspace"` // private, shared, workspace, organization, public
+	IsDefault   bool           `json:"is_default" gorm:"default:false"`
+	CreatedBy   uint           `json:"created_by" gorm:"not null"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Whether the requesting user may add documents, filled in by lookups
+	CanWrite bool `json:"can_write" gorm:"-"`
+}
+
+// CollectionGrant shares a collection with a user or a user group
+type CollectionGrant struct {
+	ID            uint      `json:"id" gorm:"primarykey"`
+	CollectionID  uint      `json:"collection_id" gorm:"not null;uniqueIndex:idx_collection_grant"`
+	PrincipalType string    `json:"principal_type" gorm:"not null;uniqueIndex:idx_collection_grant"` // user, group
+	PrincipalID   uint      `json:"principal_id" gorm:"not null;uniqueIndex:idx_collection_grant"`
+	Permission    string    `json:"permission" gorm:"not null"` // read, write
+	CreatedBy     uint      `json:"created_by" gorm:"not null"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// APIKey is a long-lived personal access token limited to a set of scopes.
+// Only a hash of the key is stored.
+type APIKey struct {
+	ID          uint           `json:"id" gorm:"primarykey"`
+	UserID      uint           `json:"user_id" gorm:"not null;index"`
+	Name        string         `json:"name" gorm:"not null"`
+	Prefix      string         `json:"prefix" gorm:"not null"` // leading characters of the key, to recognize it
+	KeyHash     string         `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes      string         `json:"-" gorm:"not null"` // space-separated, e.g. "chat:write knowledge:read"
+	WorkspaceID uint           `json:"workspace_id,omitempty"`
+	ExpiresAt   *time.Time     `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time     `json:"last_used_at,omitempty"`
+	LastUsedIP  string         `json:"last_used_ip,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	ScopeList []string `json:"scopes" gorm:"-"`
+}
+
+// UserIdentity links a user to an account at a single sign-on provider
+type UserIdentity struct {
+	ID          uint       `json:"id" gorm:"primarykey"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	Provider    string     `json:"provider" gorm:"not null;uniqueIndex:idx_user_identity_subject"`
+	Subject     string     `json:"-" gorm:"not null;uniqueIndex:idx_user_identity_subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// TwoFactor holds a user's TOTP secret. EnabledAt stays nil until the
+// user confirms enrollment with a code.
+type TwoFactor struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	UserID    uint       `json:"user_id" gorm:"uniqueIndex;not null"`
+	Secret    string     `json:"-" gorm:"not null"` // encrypted
+	LastStep  int64      `json:"-"`                 // time step of the last accepted code, against replays
+	EnabledAt *time.Time `json:"enabled_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// RecoveryCode is a single-use code to sign in without the authenticator
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
 }
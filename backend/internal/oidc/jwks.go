@@ -0,0 +1,180 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keyRefreshInterval bounds how often an unknown key ID triggers a JWKS
+// fetch, so forged tokens cannot hammer the provider
+const keyRefreshInterval = time.Minute
+
+// jwk is one entry of a JSON Web Key Set
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type parsedKey struct {
+	alg string
+	key interface{}
+}
+
+// keySet caches a provider's signing keys by key ID and refetches them when
+// a token names a key it has not seen, which is how providers rotate keys
+type keySet struct {
+	client *http.Client
+	uri    func(context.Context) (string, error)
+
+	mu      sync.Mutex
+	keys    map[string]parsedKey
+	fetched time.Time
+}
+
+func newKeySet(client *http.Client, uri func(context.Context) (string, error)) *keySet {
+	return &keySet{client: client, uri: uri}
+}
+
+// key returns the verification key for kid; an empty kid matches the only
+// key of a single-key set
+func (s *keySet) key(ctx context.Context, kid, alg string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.lookup(kid)
+	if !ok && time.Since(s.fetched) >= keyRefreshInterval {
+		if err := s.refresh(ctx); err != nil {
+			return nil, err
+		}
+		k, ok = s.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if k.alg != "" && k.alg != alg {
+		return nil, fmt.Errorf("key %q is for %s, not %s", kid, k.alg, alg)
+	}
+	if !keyFitsAlg(k.key, alg) {
+		return nil, fmt.Errorf("key %q cannot verify %s", kid, alg)
+	}
+	return k.key, nil
+}
+
+func (s *keySet) lookup(kid string) (parsedKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, k := range s.keys {
+			return k, true
+		}
+	}
+	k, ok := s.keys[kid]
+	return k, ok
+}
+
+func (s *keySet) refresh(ctx context.Context) error {
+	uri, err := s.uri(ctx)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	s.fetched = time.Now()
+	if err := getJSON(ctx, s.client, uri, &set); err != nil {
+		return fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	keys := make(map[string]parsedKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// Skip key types we do not understand rather than failing the set
+			continue
+		}
+		keys[k.Kid] = parsedKey{alg: k.Alg, key: key}
+	}
+	s.keys = keys
+	return nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent out of range")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("ec point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func keyFitsAlg(key interface{}, alg string) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(alg, "ES")
+	}
+	return false
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing key parameter")
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
@@ -0,0 +1,361 @@
+// Package oidc is a minimal OpenID Connect relying party: it discovers a
+// provider's endpoints, builds authorization code requests with PKCE,
+// exchanges codes for tokens and verifies ID tokens against the provider's
+// published signing keys.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrDiscovery is returned when the provider's configuration cannot be
+	// fetched or does not describe the configured issuer
+	ErrDiscovery = errors.New("oidc discovery failed")
+	// ErrExchange is returned when the token endpoint rejects a code
+	ErrExchange = errors.New("oidc code exchange failed")
+	// ErrInvalidIDToken is returned for ID tokens that fail verification
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+const (
+	discoveryTTL  = time.Hour
+	clockLeeway   = time.Minute
+	maxBodyBytes  = 1 << 20
+	signingMethod = "RS256"
+)
+
+// Config describes one identity provider
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for public clients, which rely on PKCE alone
+	RedirectURL  string
+	Scopes       []string // "openid" is always requested
+}
+
+// Discovery is the subset of the provider metadata document the relying
+// party uses
+type Discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+	SigningAlgs           []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// Tokens is the token endpoint's response
+type Tokens struct {
+	IDToken     string `json:"id_token"`
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Claims are the verified claims of an ID token
+type Claims map[string]interface{}
+
+// Subject is the provider's stable identifier for the user
+func (c Claims) Subject() string { return c.String("sub") }
+
+// Email is the user's email address, lower-cased
+func (c Claims) Email() string { return strings.ToLower(strings.TrimSpace(c.String("email"))) }
+
+// EmailVerified reports whether the provider vouches for Email. Some
+// providers send the flag as a string.
+func (c Claims) EmailVerified() bool {
+	switch v := c["email_verified"].(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+// String returns a string claim, or "" when missing or of another type
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns a claim that may be a single string or a list of
+// strings. Dotted names address nested objects, e.g. "realm_access.roles".
+func (c Claims) Strings(name string) []string {
+	var value interface{} = map[string]interface{}(c)
+	for _, part := range strings.Split(name, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[part]
+	}
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Provider talks to one identity provider. Discovery and signing keys are
+// fetched lazily and cached, so an unreachable provider does not stop the
+// server from starting.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+	keys   *keySet
+
+	mu         sync.Mutex
+	discovery  *Discovery
+	discovered time.Time
+}
+
+// NewProvider creates a Provider; client defaults to one with a 10s timeout
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	p := &Provider{cfg: cfg, client: client}
+	p.keys = newKeySet(client, func(ctx context.Context) (string, error) {
+		d, err := p.Discover(ctx)
+		if err != nil {
+			return "", err
+		}
+		return d.JWKSURI, nil
+	})
+	return p
+}
+
+// Name is the provider's configured name
+func (p *Provider) Name() string { return p.cfg.Name }
+
+// Discover returns the provider's metadata, fetching it at most hourly
+func (p *Provider) Discover(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil && time.Since(p.discovered) < discoveryTTL {
+		return p.discovery, nil
+	}
+
+	var d Discovery
+	if err := getJSON(ctx, p.client, p.cfg.Issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("%w: metadata is for issuer %q", ErrDiscovery, d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: metadata is missing endpoints", ErrDiscovery)
+	}
+	p.discovery = &d
+	p.discovered = time.Now()
+	return p.discovery, nil
+}
+
+// AuthCodeURL builds the URL the user is sent to for signing in. The
+// challenge is derived from verifier with S256.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.scopes(), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+func (p *Provider) scopes() []string {
+	scopes := []string{"openid"}
+	for _, scope := range p.cfg.Scopes {
+		if scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// Exchange trades an authorization code and its PKCE verifier for tokens
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (*Tokens, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	// client_secret_basic is the default method; fall back to
+	// client_secret_post only when the provider does not support it
+	useBasic := p.cfg.ClientSecret != "" && (len(d.TokenAuthMethods) == 0 || contains(d.TokenAuthMethods, "client_secret_basic"))
+	if !useBasic {
+		form.Set("client_id", p.cfg.ClientID)
+		if p.cfg.ClientSecret != "" {
+			form.Set("client_secret", p.cfg.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasic {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("%w: %s %s", ErrExchange, e.Error, e.Description)
+		}
+		return nil, fmt.Errorf("%w: status %d", ErrExchange, resp.StatusCode)
+	}
+	var tokens Tokens
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: response has no id_token", ErrExchange)
+	}
+	return &tokens, nil
+}
+
+// VerifyIDToken checks an ID token's signature, issuer, audience, expiry
+// and nonce and returns its claims
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (Claims, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	algs := d.SigningAlgs
+	if len(algs) == 0 {
+		algs = []string{signingMethod}
+	}
+	if algs = supportedAlgs(algs); len(algs) == 0 {
+		return nil, fmt.Errorf("%w: provider uses no supported signing algorithm", ErrInvalidIDToken)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.key(ctx, kid, token.Method.Alg())
+	},
+		jwt.WithValidMethods(algs),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockLeeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	result := Claims(claims)
+	if nonce != "" && result.String("nonce") != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	// With several audiences the token must name this client as the party
+	// it was issued to
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp := result.String("azp"); azp != p.cfg.ClientID {
+			return nil, fmt.Errorf("%w: authorized party mismatch", ErrInvalidIDToken)
+		}
+	}
+	if result.Subject() == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	return result, nil
+}
+
+// Challenge derives the S256 PKCE code challenge for verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func supportedAlgs(algs []string) []string {
+	var supported []string
+	for _, alg := range algs {
+		switch alg {
+		case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512":
+			supported = append(supported, alg)
+		}
+	}
+	return supported
+}
+
+func getJSON(ctx context.Context, client *http.Client, rawURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxBodyBytes)).Decode(v)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"likemind-backend/internal/oidc/oidctest"
+)
+
+const testRedirectURL = "http://app.test/callback"
+
+func newTestProvider(t *testing.T, clientSecret string) (*Provider, *oidctest.Server) {
+	t.Helper()
+	idp, err := oidctest.New("", "likemind", clientSecret)
+	if err != nil {
+		t.Fatalf("oidctest.New: %v", err)
+	}
+	ts := httptest.NewServer(idp)
+	t.Cleanup(ts.Close)
+	idp.Issuer = ts.URL
+	p := NewProvider(Config{
+		Name:         "dev",
+		Issuer:       ts.URL + "/",
+		ClientID:     "likemind",
+		ClientSecret: clientSecret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"email", "openid", "profile"},
+	}, ts.Client())
+	return p, idp
+}
+
+// login signs user in at the fake provider and returns the code it issues
+func login(t *testing.T, p *Provider, idp *oidctest.Server, user oidctest.User, nonce, verifier string) string {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	callback, err := idp.Login(authURL, user)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if got := callback.Query().Get("state"); got != "state-1" {
+		t.Fatalf("callback state = %q, want state-1", got)
+	}
+	return callback.Query().Get("code")
+}
+
+func TestDiscover(t *testing.T) {
+	p, idp := newTestProvider(t, "secret")
+	d, err := p.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if d.TokenEndpoint != idp.Issuer+"/token" || d.JWKSURI != idp.Issuer+"/jwks" {
+		t.Fatalf("Discover = %+v", d)
+	}
+
+	// Metadata for another issuer must not be trusted
+	p, idp = newTestProvider(t, "secret")
+	idp.Issuer = "https://idp.example.com"
+	if _, err := p.Discover(context.Background()); !errors.Is(err, ErrDiscovery) {
+		t.Fatalf("Discover with an issuer mismatch = %v, want ErrDiscovery", err)
+	}
+
+	missing := NewProvider(Config{Issuer: idp.Issuer + "/missing"}, nil)
+	if _, err := missing.Discover(context.Background()); !errors.Is(err, ErrDiscovery) {
+		t.Fatalf("Discover of a missing document = %v, want ErrDiscovery", err)
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	p, idp := newTestProvider(t, "secret")
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	if got := u.Scheme + "://" + u.Host + u.Path; got != idp.Issuer+"/authorize" {
+		t.Fatalf("AuthCodeURL endpoint = %s", got)
+	}
+	for name, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             "likemind",
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        Challenge("verifier-1"),
+		"code_challenge_method": "S256",
+	} {
+		if got := u.Query().Get(name); got != want {
+			t.Errorf("AuthCodeURL %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestLoginFlow(t *testing.T) {
+	for _, tc := range []struct {
+		name, secret string
+	}{
+		{"confidential client", "s3cret&more"},
+		{"public client", ""},
+	} {
+		p, idp := newTestProvider(t, tc.secret)
+		user := oidctest.User{Email: "Jane@Example.com", EmailVerified: true, Groups: []string{"staff", "admins"}}
+		code := login(t, p, idp, user, "nonce-1", "verifier-1")
+
+		tokens, err := p.Exchange(context.Background(), code, "verifier-1")
+		if err != nil {
+			t.Fatalf("%s: Exchange: %v", tc.name, err)
+		}
+		claims, err := p.VerifyIDToken(context.Background(), tokens.IDToken, "nonce-1")
+		if err != nil {
+			t.Fatalf("%s: VerifyIDToken: %v", tc.name, err)
+		}
+		if claims.Subject() != oidctest.Subject(user.Email) || claims.Email() != "jane@example.com" || !claims.EmailVerified() {
+			t.Errorf("%s: claims = %v", tc.name, claims)
+		}
+		if got := strings.Join(claims.Strings("groups"), " "); got != "staff admins" {
+			t.Errorf("%s: groups = %q", tc.name, got)
+		}
+	}
+}
+
+func TestExchangeChecksVerifierAndCode(t *testing.T) {
+	p, idp := newTestProvider(t, "secret")
+	user := oidctest.User{Email: "jane@example.com"}
+
+	// The provider only redeems a code for the verifier its challenge came from
+	code := login(t, p, idp, user, "nonce-1", "verifier-1")
+	if _, err := p.Exchange(context.Background(), code, "verifier-2"); !errors.Is(err, ErrExchange) {
+		t.Fatalf("Exchange with the wrong verifier = %v, want ErrExchange", err)
+	}
+	// and only once
+	if _, err := p.Exchange(context.Background(), code, "verifier-1"); !errors.Is(err, ErrExchange) {
+		t.Fatalf("Exchange of a used code = %v, want ErrExchange", err)
+	}
+
+	wrongSecret := NewProvider(Config{Issuer: idp.Issuer, ClientID: "likemind", ClientSecret: "guess", RedirectURL: testRedirectURL}, nil)
+	code = login(t, p, idp, user, "nonce-1", "verifier-1")
+	if _, err := wrongSecret.Exchange(context.Background(), code, "verifier-1"); !errors.Is(err, ErrExchange) {
+		t.Fatalf("Exchange with the wrong secret = %v, want ErrExchange", err)
+	}
+}
+
+func TestVerifyIDTokenSignature(t *testing.T) {
+	p, idp := newTestProvider(t, "secret")
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{"iss": idp.Issuer, "aud": "likemind", "sub": "jane", "exp": time.Now().Add(time.Hour).Unix()}
+	}
+	raw, err := idp.SignIDToken(claims())
+	if err != nil {
+		t.Fatalf("SignIDToken: %v", err)
+	}
+	if _, err := p.VerifyIDToken(context.Background(), raw, ""); err != nil {
+		t.Fatalf("VerifyIDToken of a valid token: %v", err)
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, claims())
+	forged.Header["kid"] = oidctest.KeyID
+	unknownKid := jwt.NewWithClaims(jwt.SigningMethodRS256, claims())
+	unknownKid.Header["kid"] = "rotated-away"
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	hmac.Header["kid"] = oidctest.KeyID
+
+	for _, tc := range []struct {
+		name  string
+		token *jwt.Token
+		key   interface{}
+	}{
+		{"signed with another key", forged, otherKey},
+		{"unknown key ID", unknownKid, idp.Key},
+		{"HMAC with the public modulus", hmac, idp.Key.PublicKey.N.Bytes()},
+	} {
+		raw, err := tc.token.SignedString(tc.key)
+		if err != nil {
+			t.Fatalf("%s: SignedString: %v", tc.name, err)
+		}
+		if _, err := p.VerifyIDToken(context.Background(), raw, ""); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("%s: VerifyIDToken = %v, want ErrInvalidIDToken", tc.name, err)
+		}
+	}
+}
+
+func TestVerifyIDTokenClaims(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		edit  func(jwt.MapClaims)
+		valid bool
+	}{
+		{"unchanged", func(jwt.MapClaims) {}, true},
+		{"other nonce", func(c jwt.MapClaims) { c["nonce"] = "replayed" }, false},
+		{"no nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, false},
+		{"other audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }, false},
+		{"several audiences without azp", func(c jwt.MapClaims) { c["aud"] = []string{"likemind", "another-client"} }, false},
+		{"several audiences, azp is another client", func(c jwt.MapClaims) {
+			c["aud"], c["azp"] = []string{"likemind", "another-client"}, "another-client"
+		}, false},
+		{"several audiences, azp is this client", func(c jwt.MapClaims) {
+			c["aud"], c["azp"] = []string{"likemind", "another-client"}, "likemind"
+		}, true},
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "https://idp.example.com" }, false},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, false},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }, false},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }, false},
+	} {
+		p, idp := newTestProvider(t, "secret")
+		idp.EditClaims = tc.edit
+		code := login(t, p, idp, oidctest.User{Email: "jane@example.com"}, "nonce-1", "verifier-1")
+		tokens, err := p.Exchange(context.Background(), code, "verifier-1")
+		if err != nil {
+			t.Fatalf("%s: Exchange: %v", tc.name, err)
+		}
+		_, err = p.VerifyIDToken(context.Background(), tokens.IDToken, "nonce-1")
+		if tc.valid && err != nil {
+			t.Errorf("%s: VerifyIDToken: %v", tc.name, err)
+		}
+		if !tc.valid && !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("%s: VerifyIDToken = %v, want ErrInvalidIDToken", tc.name, err)
+		}
+	}
+}
+
+func TestClaims(t *testing.T) {
+	claims := Claims{
+		"email":          " Jane@Example.COM ",
+		"email_verified": "TRUE",
+		"scope":          "read write",
+		"realm_access":   map[string]interface{}{"roles": []interface{}{"admin", 7, "user"}},
+	}
+	if claims.Email() != "jane@example.com" || !claims.EmailVerified() {
+		t.Fatalf("Email, EmailVerified = %q, %v", claims.Email(), claims.EmailVerified())
+	}
+	if got := strings.Join(claims.Strings("realm_access.roles"), ","); got != "admin,user" {
+		t.Errorf("Strings(realm_access.roles) = %q", got)
+	}
+	if got := strings.Join(claims.Strings("scope"), ","); got != "read,write" {
+		t.Errorf("Strings(scope) = %q", got)
+	}
+	if got := claims.Strings("email.domain"); got != nil {
+		t.Errorf("Strings through a string = %q, want nil", got)
+	}
+	for _, verified := range []interface{}{false, "false", "yes", nil} {
+		if (Claims{"email_verified": verified}).EmailVerified() {
+			t.Errorf("EmailVerified(%v) = true", verified)
+		}
+	}
+}
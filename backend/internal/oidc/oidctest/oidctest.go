@@ -0,0 +1,350 @@
+// Package oidctest is a throwaway OpenID Connect provider for tests and
+// local development. It signs in whoever submits its login form, so never
+// expose it beyond a development machine.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyID names the provider's signing key in tokens and its key set
+const KeyID = "fakeidp-1"
+
+var loginPage = template.Must(template.New("login").Parse(`<!doctype html>
+<title>Fake IdP</title>
+<h1>Fake IdP sign-in</h1>
+<form method="post" action="/authorize">
+{{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">
+{{end}}<p><label>Email <input name="email" value="{{.Email}}"></label>
+<p><label><input type="checkbox" name="email_verified" value="true" checked> Email verified</label>
+<p><label>Name <input name="name" value="{{.Name}}"></label>
+<p><label>Groups <input name="groups" value="{{.Groups}}"></label> (space-separated)
+<p><button>Sign in</button> <button name="deny" value="1">Deny</button>
+</form>`))
+
+// User is who a login signs in
+type User struct {
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+type grant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	claims      jwt.MapClaims
+	expires     time.Time
+}
+
+// Server is the fake provider. Set Issuer to the URL clients reach it at
+// before serving requests.
+type Server struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty accepts public clients
+	Key          *rsa.PrivateKey
+	// Defaults pre-fill the login form
+	Defaults User
+	// EditClaims, when set, changes every ID token's claims before they are
+	// signed, e.g. to test how clients handle a bad audience
+	EditClaims func(jwt.MapClaims)
+
+	mux    *http.ServeMux
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+// New creates a provider with a fresh signing key
+func New(issuer, clientID, clientSecret string) (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	s := &Server{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Key:          key,
+		grants:       make(map[string]grant),
+	}
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	s.mux.HandleFunc("/jwks", s.jwks)
+	s.mux.HandleFunc("/authorize", s.authorize)
+	s.mux.HandleFunc("/token", s.token)
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Login submits the login form of the authorization request authURL as
+// user and returns the URL the browser is sent back to
+func (s *Server) Login(authURL string, user User) (*url.URL, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return nil, err
+	}
+	form := u.Query()
+	form.Set("email", user.Email)
+	if user.EmailVerified {
+		form.Set("email_verified", "true")
+	}
+	form.Set("name", user.Name)
+	form.Set("groups", strings.Join(user.Groups, " "))
+	u.RawQuery = ""
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.PostForm(u.String(), form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("login: status %d", resp.StatusCode)
+	}
+	return resp.Location()
+}
+
+// SignIDToken signs claims as an ID token with the provider's key
+func (s *Server) SignIDToken(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyID
+	return token.SignedString(s.Key)
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.Issuer,
+		"authorization_endpoint":                s.Issuer + "/authorize",
+		"token_endpoint":                        s.Issuer + "/token",
+		"jwks_uri":                              s.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": KeyID,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+func (s *Server) checkAuthorize(params url.Values) string {
+	switch {
+	case params.Get("client_id") != s.ClientID:
+		return "unknown client_id"
+	case params.Get("response_type") != "code":
+		return "only response_type=code is supported"
+	case params.Get("redirect_uri") == "":
+		return "redirect_uri is required"
+	case params.Get("code_challenge") == "" || params.Get("code_challenge_method") != "S256":
+		return "PKCE with S256 is required"
+	}
+	return ""
+}
+
+// authorize shows the login form and, once it is submitted, redirects back
+// with a code
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		params := r.URL.Query()
+		if err := s.checkAuthorize(params); err != "" {
+			http.Error(w, err, http.StatusBadRequest)
+			return
+		}
+		loginPage.Execute(w, map[string]interface{}{
+			"Params": params, "Email": s.Defaults.Email, "Name": s.Defaults.Name, "Groups": strings.Join(s.Defaults.Groups, " "),
+		})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.checkAuthorize(r.PostForm); err != "" {
+		http.Error(w, err, http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(r.PostForm.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := redirect.Query()
+	query.Set("state", r.PostForm.Get("state"))
+	if r.PostForm.Get("deny") != "" {
+		query.Set("error", "access_denied")
+		query.Set("error_description", "the user denied the request")
+		redirect.RawQuery = query.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+		return
+	}
+
+	email := strings.TrimSpace(r.PostForm.Get("email"))
+	claims := jwt.MapClaims{
+		// The subject is stable per email, like a real provider's user ID
+		"sub":                Subject(email),
+		"email":              email,
+		"email_verified":     r.PostForm.Get("email_verified") == "true",
+		"name":               r.PostForm.Get("name"),
+		"preferred_username": strings.SplitN(email, "@", 2)[0],
+		"groups":             strings.Fields(r.PostForm.Get("groups")),
+	}
+	code, err := randomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	s.grants[code] = grant{
+		clientID:    r.PostForm.Get("client_id"),
+		redirectURI: r.PostForm.Get("redirect_uri"),
+		challenge:   r.PostForm.Get("code_challenge"),
+		nonce:       r.PostForm.Get("nonce"),
+		claims:      claims,
+		expires:     time.Now().Add(time.Minute),
+	}
+	s.mu.Unlock()
+
+	query.Set("code", code)
+	redirect.RawQuery = query.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token redeems a code once, checking the client and PKCE verifier
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != s.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(s.ClientSecret)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Basic")
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	g, ok := s.grants[code]
+	delete(s.grants, code)
+	s.mu.Unlock()
+	switch {
+	case !ok || time.Now().After(g.expires) || g.clientID != clientID:
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	case g.redirectURI != r.PostForm.Get("redirect_uri"):
+		tokenError(w, "invalid_grant", "redirect_uri mismatch")
+		return
+	case challenge(r.PostForm.Get("code_verifier")) != g.challenge:
+		tokenError(w, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for k, v := range g.claims {
+		claims[k] = v
+	}
+	claims["iss"] = s.Issuer
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Hour).Unix()
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	if s.EditClaims != nil {
+		s.EditClaims(claims)
+	}
+	idToken, err := s.SignIDToken(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	accessToken, err := randomString()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// Subject is the stable user ID the provider issues for email
+func Subject(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
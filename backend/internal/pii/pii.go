@@ -0,0 +1,239 @@
+// Package pii finds personal data and secrets in text and swaps them for
+// placeholders such as [EMAIL_1] that can be mapped back after the text has
+// been through an external service.
+package pii
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Type is a kind of sensitive value
+type Type string
+
+const (
+	Email      Type = "email"
+	Phone      Type = "phone"
+	CreditCard Type = "credit_card"
+	IBAN       Type = "iban"
+	Secret     Type = "secret"
+)
+
+// AllTypes lists every detector, highest priority first. When matches
+// overlap, the higher priority one wins.
+var AllTypes = []Type{Secret, Email, IBAN, CreditCard, Phone}
+
+// Match is one sensitive value found in a text
+type Match struct {
+	Type  Type
+	Start int
+	End   int
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{1,4}\)[\s.-]?)?\d{2,4}(?:[\s.-]?\d{2,4}){2,5}`)
+	datePattern  = regexp.MustCompile(`^\d{4}[-./]\d{1,2}[-./]\d{1,2}$|^\d{1,2}[-./]\d{1,2}[-./]\d{4}$`)
+	cardPattern  = regexp.MustCompile(`\d(?:[ -]?\d){12,18}`)
+	ibanPattern  = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`)
+
+	secretPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+		regexp.MustCompile(`\bsk-(?:proj-|ant-)?[A-Za-z0-9_-]{20,}`),
+		regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+		regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{40,}\b`),
+		regexp.MustCompile(`\bxox[abpr]-[A-Za-z0-9-]{10,}`),
+		regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+		regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),
+	}
+	// Values assigned to names like api_key or password
+	assignmentPattern = regexp.MustCompile(`(?i)\b(?:api[_-]?key|secret|token|password|passwd)\b["']?\s*[:=]\s*["']?([^\s"',;]{8,})`)
+)
+
+// Detect finds values of the given types, sorted by position and without
+// overlaps
+func Detect(text string, types []Type) []Match {
+	enabled := make(map[Type]bool, len(types))
+	for _, t := range types {
+		enabled[t] = true
+	}
+
+	var matches []Match
+	overlaps := func(start, end int) bool {
+		for _, m := range matches {
+			if start < m.End && m.Start < end {
+				return true
+			}
+		}
+		return false
+	}
+	add := func(t Type, start, end int) {
+		if !overlaps(start, end) {
+			matches = append(matches, Match{Type: t, Start: start, End: end})
+		}
+	}
+
+	for _, t := range AllTypes {
+		if !enabled[t] {
+			continue
+		}
+		switch t {
+		case Secret:
+			for _, re := range secretPatterns {
+				for _, loc := range re.FindAllStringIndex(text, -1) {
+					add(Secret, loc[0], loc[1])
+				}
+			}
+			for _, loc := range assignmentPattern.FindAllStringSubmatchIndex(text, -1) {
+				add(Secret, loc[2], loc[3])
+			}
+		case Email:
+			for _, loc := range emailPattern.FindAllStringIndex(text, -1) {
+				add(Email, loc[0], loc[1])
+			}
+		case IBAN:
+			for _, loc := range ibanPattern.FindAllStringIndex(text, -1) {
+				if validIBAN(text[loc[0]:loc[1]]) {
+					add(IBAN, loc[0], loc[1])
+				}
+			}
+		case CreditCard:
+			for _, loc := range cardPattern.FindAllStringIndex(text, -1) {
+				if isolatedDigits(text, loc[0], loc[1]) && luhn(digitsOf(text[loc[0]:loc[1]])) {
+					add(CreditCard, loc[0], loc[1])
+				}
+			}
+		case Phone:
+			for _, loc := range phonePattern.FindAllStringIndex(text, -1) {
+				if isolatedDigits(text, loc[0], loc[1]) && plausiblePhone(text[loc[0]:loc[1]]) {
+					add(Phone, loc[0], loc[1])
+				}
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Start < matches[j].Start })
+	return matches
+}
+
+// Mask returns text[start:end] with every value of the given types that
+// overlaps it replaced by its type, e.g. [EMAIL]. Values cut off by the
+// range are masked too, so no part of them is returned.
+func Mask(text string, start, end int, types []Type) string {
+	var b strings.Builder
+	pos := start
+	for _, m := range Detect(text, types) {
+		if m.End <= start || m.Start >= end {
+			continue
+		}
+		if m.Start > pos {
+			b.WriteString(text[pos:m.Start])
+		}
+		b.WriteString("[" + strings.ToUpper(string(m.Type)) + "]")
+		pos = m.End
+	}
+	if pos < end {
+		b.WriteString(text[pos:end])
+	}
+	return b.String()
+}
+
+// ParseTypes reads a comma-separated list of types
+func ParseTypes(value string) ([]Type, error) {
+	var types []Type
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, t := range AllTypes {
+			if Type(name) == t {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown PII type %q", name)
+		}
+		types = append(types, Type(name))
+	}
+	return types, nil
+}
+
+// isolatedDigits rejects digit runs that continue past the match, such as
+// part of an order number
+func isolatedDigits(text string, start, end int) bool {
+	isWord := func(c byte) bool {
+		return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+	}
+	return (start == 0 || !isWord(text[start-1])) && (end == len(text) || !isWord(text[end]))
+}
+
+func digitsOf(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// plausiblePhone requires 10 to 15 digits, or 8 with an international
+// prefix, and rejects dates
+func plausiblePhone(s string) bool {
+	if datePattern.MatchString(s) {
+		return false
+	}
+	n := len(digitsOf(s))
+	if strings.HasPrefix(s, "+") {
+		return n >= 8 && n <= 15
+	}
+	return n >= 10 && n <= 15
+}
+
+// luhn validates a card number's check digit
+func luhn(digits string) bool {
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// validIBAN checks the ISO 13616 mod-97 checksum
+func validIBAN(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+	rearranged := s[4:] + s[:4]
+	remainder := 0
+	for _, c := range rearranged {
+		switch {
+		case c >= '0' && c <= '9':
+			remainder = (remainder*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			remainder = (remainder*100 + int(c-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
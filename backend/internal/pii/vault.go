@@ -0,0 +1,152 @@
+package pii
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Redactor holds which types are detected and which may be put back into
+// responses
+type Redactor struct {
+	types   []Type
+	restore map[Type]bool
+}
+
+// NewRedactor detects types and restores the subset in restore
+func NewRedactor(types, restore []Type) *Redactor {
+	r := &Redactor{types: types, restore: make(map[Type]bool, len(restore))}
+	for _, t := range restore {
+		r.restore[t] = true
+	}
+	return r
+}
+
+// NewVault starts a mapping for one request. Equal values share a
+// placeholder, so the same prompt always redacts to the same text.
+func (r *Redactor) NewVault() *Vault {
+	return &Vault{
+		redactor: r,
+		byValue:  make(map[string]string),
+		values:   make(map[string]entry),
+		next:     make(map[Type]int),
+		counts:   make(map[Type]int),
+	}
+}
+
+type entry struct {
+	typ   Type
+	value string
+}
+
+// Vault maps the placeholders of one request back to their values
+type Vault struct {
+	redactor *Redactor
+	byValue  map[string]string // value -> placeholder
+	values   map[string]entry  // placeholder -> value
+	next     map[Type]int
+	counts   map[Type]int
+}
+
+var placeholderPattern = regexp.MustCompile(`\[(?:EMAIL|PHONE|CREDIT_CARD|IBAN|SECRET)_\d+\]`)
+
+// maxPlaceholderLen bounds how much streamed text is held back waiting for a
+// placeholder to complete
+const maxPlaceholderLen = 24
+
+// Redact replaces sensitive values in text and returns the redacted text
+// with the number of values replaced per type
+func (v *Vault) Redact(text string) (string, map[Type]int) {
+	if v == nil {
+		return text, nil
+	}
+	matches := Detect(text, v.redactor.types)
+	if len(matches) == 0 {
+		return text, nil
+	}
+
+	counts := make(map[Type]int)
+	var b strings.Builder
+	pos := 0
+	for _, m := range matches {
+		value := text[m.Start:m.End]
+		placeholder, ok := v.byValue[value]
+		if !ok {
+			v.next[m.Type]++
+			placeholder = fmt.Sprintf("[%s_%d]", strings.ToUpper(string(m.Type)), v.next[m.Type])
+			v.byValue[value] = placeholder
+			v.values[placeholder] = entry{typ: m.Type, value: value}
+		}
+		b.WriteString(text[pos:m.Start])
+		b.WriteString(placeholder)
+		pos = m.End
+		counts[m.Type]++
+		v.counts[m.Type]++
+	}
+	b.WriteString(text[pos:])
+	return b.String(), counts
+}
+
+// Restore puts back the values of restorable types. Other placeholders stay
+// as they are.
+func (v *Vault) Restore(text string) string {
+	if v == nil || len(v.values) == 0 {
+		return text
+	}
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		e, ok := v.values[placeholder]
+		if !ok || !v.redactor.restore[e.typ] {
+			return placeholder
+		}
+		return e.value
+	})
+}
+
+// Counts returns how many values of each type the vault has redacted
+func (v *Vault) Counts() map[Type]int {
+	if v == nil {
+		return nil
+	}
+	return v.counts
+}
+
+// FormatCounts renders counts as "email=2, phone=1" for logs
+func FormatCounts(counts map[Type]int) string {
+	parts := make([]string, 0, len(counts))
+	for t, n := range counts {
+		parts = append(parts, fmt.Sprintf("%s=%d", t, n))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// StreamRestorer restores placeholders in streamed fragments, holding back
+// a trailing fragment that may be the start of a placeholder
+type StreamRestorer struct {
+	vault   *Vault
+	pending string
+}
+
+// NewStreamRestorer restores placeholders from v in a streamed response
+func (v *Vault) NewStreamRestorer() *StreamRestorer {
+	return &StreamRestorer{vault: v}
+}
+
+// Write takes the next fragment and returns the text that can be emitted
+func (r *StreamRestorer) Write(fragment string) string {
+	text := r.pending + fragment
+	r.pending = ""
+	if i := strings.LastIndexByte(text, '['); i >= 0 && !strings.Contains(text[i:], "]") && len(text)-i < maxPlaceholderLen {
+		r.pending = text[i:]
+		text = text[:i]
+	}
+	return r.vault.Restore(text)
+}
+
+// Flush returns whatever is still held back
+func (r *StreamRestorer) Flush() string {
+	text := r.pending
+	r.pending = ""
+	return r.vault.Restore(text)
+}
@@ -0,0 +1,106 @@
+package pii
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVaultRedactAndRestore(t *testing.T) {
+	v := NewRedactor(AllTypes, []Type{Email, Phone}).NewVault()
+
+	text := "From bob@example.org (+49 30 1234567), card 4111 1111 1111 1111, cc bob@example.org and amy@example.org"
+	redacted, counts := v.Redact(text)
+	want := "From [EMAIL_1] ([PHONE_1]), card [CREDIT_CARD_1], cc [EMAIL_1] and [EMAIL_2]"
+	if redacted != want {
+		t.Fatalf("Redact = %q, want %q", redacted, want)
+	}
+	if counts[Email] != 3 || counts[Phone] != 1 || counts[CreditCard] != 1 {
+		t.Fatalf("Redact counts = %v", counts)
+	}
+
+	// Placeholders keep their numbering across messages of a request
+	second, _ := v.Redact("and amy@example.org, carl@example.org")
+	if second != "and [EMAIL_2], [EMAIL_3]" {
+		t.Fatalf("second Redact = %q", second)
+	}
+	if got := FormatCounts(v.Counts()); got != "credit_card=1, email=5, phone=1" {
+		t.Fatalf("Counts = %s", got)
+	}
+
+	// Restorable types come back; card numbers and unknown placeholders stay
+	reply := "Sure [EMAIL_1], I'll call [PHONE_1]. Card [CREDIT_CARD_1], see [EMAIL_9] and [NAME_1]."
+	wantReply := "Sure bob@example.org, I'll call +49 30 1234567. Card [CREDIT_CARD_1], see [EMAIL_9] and [NAME_1]."
+	if got := v.Restore(reply); got != wantReply {
+		t.Fatalf("Restore = %q, want %q", got, wantReply)
+	}
+}
+
+func TestVaultWithoutMatches(t *testing.T) {
+	v := NewRedactor(AllTypes, AllTypes).NewVault()
+	if text, counts := v.Redact("nothing to see"); text != "nothing to see" || counts != nil {
+		t.Fatalf("Redact = %q, %v", text, counts)
+	}
+	if got := v.Restore("[EMAIL_1]"); got != "[EMAIL_1]" {
+		t.Fatalf("Restore with an empty vault = %q", got)
+	}
+
+	// A nil vault, as used when redaction is off, passes text through
+	var none *Vault
+	if text, _ := none.Redact("bob@example.org"); text != "bob@example.org" {
+		t.Fatalf("nil Redact = %q", text)
+	}
+	if got := none.Restore("[EMAIL_1]"); got != "[EMAIL_1]" || none.Counts() != nil {
+		t.Fatalf("nil Restore = %q", got)
+	}
+}
+
+func TestStreamRestorerJoinsSplitPlaceholders(t *testing.T) {
+	v := NewRedactor(AllTypes, []Type{Email}).NewVault()
+	v.Redact("bob@example.org and 4111 1111 1111 1111")
+
+	for _, tc := range []struct {
+		name      string
+		fragments []string
+	}{
+		{"whole", []string{"Hi [EMAIL_1], card [CREDIT_CARD_1]."}},
+		{"split inside", []string{"Hi [EM", "AIL_", "1], card [CREDIT_", "CARD_1]."}},
+		{"split at the bracket", []string{"Hi [", "EMAIL_1]", ", card [CREDIT_CARD_1", "]."}},
+		{"one byte at a time", strings.Split("Hi [EMAIL_1], card [CREDIT_CARD_1].", "")},
+	} {
+		r := v.NewStreamRestorer()
+		var out strings.Builder
+		for _, fragment := range tc.fragments {
+			text := r.Write(fragment)
+			if strings.Contains(text, "[EMAIL") && !strings.Contains(text, "[EMAIL_1]") {
+				t.Errorf("%s: emitted a partial placeholder %q", tc.name, text)
+			}
+			out.WriteString(text)
+		}
+		out.WriteString(r.Flush())
+		if got, want := out.String(), "Hi bob@example.org, card [CREDIT_CARD_1]."; got != want {
+			t.Errorf("%s: restored stream = %q, want %q", tc.name, got, want)
+		}
+	}
+}
+
+func TestStreamRestorerReleasesPlainBrackets(t *testing.T) {
+	v := NewRedactor(AllTypes, AllTypes).NewVault()
+	v.Redact("bob@example.org")
+	r := v.NewStreamRestorer()
+
+	// A bracket that cannot become a placeholder is held only until it is
+	// too long to be one
+	var out strings.Builder
+	out.WriteString(r.Write("see [note"))
+	out.WriteString(r.Write(" that is clearly not a placeholder"))
+	if got := out.String(); got != "see [note that is clearly not a placeholder" {
+		t.Fatalf("stream = %q", got)
+	}
+	// An unfinished bracket at the end comes out on Flush
+	if got := r.Write(" [EMA"); got != " " {
+		t.Fatalf("Write = %q, want the text before the bracket", got)
+	}
+	if got := r.Flush(); got != "[EMA" {
+		t.Fatalf("Flush = %q", got)
+	}
+}
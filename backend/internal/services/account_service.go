@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"likemind-backend/internal/jobs"
+	"likemind-backend/internal/mail"
+	"likemind-backend/internal/models"
+)
+
+// JobTypeSendEmail delivers one rendered message
+const JobTypeSendEmail = "mail.send"
+
+// Account token purposes; a token only works for the purpose it was made for
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// accountMailInterval bounds how often one account is sent the same kind
+// of email, so the endpoints cannot be used to flood an inbox
+const accountMailInterval = time.Minute
+
+var (
+	// ErrInvalidToken is returned for malformed, expired, used or
+	// superseded verification and reset tokens
+	ErrInvalidToken = errors.New("invalid or expired token")
+	// ErrEmailNotVerified is returned when signing in to an unverified
+	// account while verification is required
+	ErrEmailNotVerified = errors.New("email address not verified")
+)
+
+// AccountOptions configures email verification and password reset
+type AccountOptions struct {
+	AppURL              string // frontend base URL the emailed links point to
+	VerifyTTL           time.Duration
+	ResetTTL            time.Duration
+	RequireVerification bool // refuse password sign-in until the email is verified
+	Passwords           *PasswordPolicy
+}
+
+// accountToken is the signed body of a verification or reset token
+type accountToken struct {
+	Purpose   string `json:"p"`
+	UserID    uint   `json:"u"`
+	ExpiresAt int64  `json:"e"`
+	ID        string `json:"j"`
+	// Binding is derived from the state the token acts on, the email for
+	// verification and the password hash for resets, so a token stops
+	// working once that state changes
+	Binding string `json:"b"`
+}
+
+// AccountService verifies email addresses and resets forgotten passwords
+// using signed, single-use tokens sent by email
+type AccountService struct {
+	db          *gorm.DB
+	redisClient *redis.Client
+	jobs        *jobs.Queue
+	mailer      mail.Mailer
+	templates   *mail.Templates
+	key         []byte
+	opts        AccountOptions
+}
+
+func NewAccountService(db *gorm.DB, redisClient *redis.Client, queue *jobs.Queue, mailer mail.Mailer, templates *mail.Templates, secret string, opts AccountOptions) *AccountService {
+	// Derive a separate key so account tokens can never pass as JWTs
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("likemind account tokens"))
+	s := &AccountService{
+		db:          db,
+		redisClient: redisClient,
+		jobs:        queue,
+		mailer:      mailer,
+		templates:   templates,
+		key:         mac.Sum(nil),
+		opts:        opts,
+	}
+	queue.Register(JobTypeSendEmail, jobs.Handle(s.sendEmail))
+	return s
+}
+
+// CheckSignIn refuses unverified accounts when verification is required
+func (s *AccountService) CheckSignIn(user *models.User) error {
+	if s.opts.RequireVerification && user.EmailVerifiedAt == nil {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// RequiresVerification reports whether new accounts must verify their
+// email before signing in with a password
+func (s *AccountService) RequiresVerification() bool {
+	return s.opts.RequireVerification
+}
+
+// SendVerification emails user a link to confirm their address; already
+// verified users are skipped
+func (s *AccountService) SendVerification(ctx context.Context, user *models.User) error {
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	return s.sendTokenEmail(ctx, user, TokenVerifyEmail, s.opts.VerifyTTL, "/verify-email")
+}
+
+// ResendVerification sends a new verification email to the account with
+// email, if there is an unverified one. It reports nothing about whether
+// the account exists.
+func (s *AccountService) ResendVerification(ctx context.Context, email string) error {
+	user, err := s.userByEmail(ctx, email)
+	if err != nil || user == nil {
+		return err
+	}
+	return s.SendVerification(ctx, user)
+}
+
+// VerifyEmail confirms the address a verification token was sent to
+func (s *AccountService) VerifyEmail(ctx context.Context, token string) (*models.User, error) {
+	var user models.User
+	err := s.consumeToken(ctx, token, TokenVerifyEmail, &user, func(tx *gorm.DB) error {
+		if user.EmailVerifiedAt != nil {
+			return nil
+		}
+		return tx.Model(&user).Update("email_verified_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// RequestPasswordReset emails a reset link to the account with email. It
+// succeeds whether or not the account exists so callers cannot probe for
+// registered addresses.
+func (s *AccountService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userByEmail(ctx, email)
+	if err != nil || user == nil {
+		return err
+	}
+	return s.sendTokenEmail(ctx, user, TokenResetPassword, s.opts.ResetTTL, "/reset-password")
+}
+
+// ResetPassword sets a new password using a reset token and returns the
+// user. Receiving the email proves control of the address, so it also
+// counts as verification.
+func (s *AccountService) ResetPassword(ctx context.Context, token, password string) (*models.User, error) {
+	if err := s.opts.Passwords.Validate(password); err != nil {
+		return nil, err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	var user models.User
+	err = s.consumeToken(ctx, token, TokenResetPassword, &user, func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"password":      string(hashed),
+			"token_version": gorm.Expr("token_version + 1"),
+		}
+		if user.EmailVerifiedAt == nil {
+			updates["email_verified_at"] = time.Now()
+		}
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.APIKey{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *AccountService) userByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	return &user, nil
+}
+
+// sendTokenEmail issues a token for user and queues the email carrying it
+func (s *AccountService) sendTokenEmail(ctx context.Context, user *models.User, purpose string, ttl time.Duration, path string) error {
+	throttleKey := fmt.Sprintf("account:mail:%s:%d", purpose, user.ID)
+	sent, err := s.redisClient.SetNX(ctx, throttleKey, 1, accountMailInterval).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check mail throttle: %w", err)
+	}
+	if !sent {
+		log.Printf("account: skipped %s email to user %d, one was sent recently", purpose, user.ID)
+		return nil
+	}
+
+	token, err := s.issueToken(user, purpose, ttl)
+	if err != nil {
+		return err
+	}
+	link := strings.TrimSuffix(s.opts.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+	msg, err := s.templates.Render(purpose, user.Email, map[string]string{
+		"Username":  user.Username,
+		"Link":      link,
+		"ExpiresIn": humanDuration(ttl),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := s.jobs.Enqueue(ctx, JobTypeSendEmail, msg, jobs.WithUserID(user.ID)); err != nil {
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+	return nil
+}
+
+func (s *AccountService) sendEmail(ctx context.Context, msg mail.Message) error {
+	return s.mailer.Send(ctx, msg)
+}
+
+func (s *AccountService) issueToken(user *models.User, purpose string, ttl time.Duration) (string, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	payload, err := json.Marshal(accountToken{
+		Purpose:   purpose,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+		ID:        id,
+		Binding:   tokenBinding(user, purpose),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token: %w", err)
+	}
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + base64.RawURLEncoding.EncodeToString(s.sign(body)), nil
+}
+
+// consumeToken checks token, loads its user and runs apply in a
+// transaction. The token is marked used first so concurrent requests
+// cannot both apply it, and released again if apply fails.
+func (s *AccountService) consumeToken(ctx context.Context, token, purpose string, user *models.User, apply func(tx *gorm.DB) error) error {
+	body, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, s.sign(body)) {
+		return ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	var claims accountToken
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Purpose != purpose || claims.ID == "" {
+		return ErrInvalidToken
+	}
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if time.Now().After(expiresAt) {
+		return ErrInvalidToken
+	}
+
+	if err := s.db.WithContext(ctx).First(user, claims.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+	if !hmac.Equal([]byte(claims.Binding), []byte(tokenBinding(user, purpose))) {
+		return ErrInvalidToken
+	}
+
+	usedKey := "account:token:used:" + claims.ID
+	fresh, err := s.redisClient.SetNX(ctx, usedKey, 1, time.Until(expiresAt)+time.Minute).Result()
+	if err != nil {
+		return fmt.Errorf("failed to record token use: %w", err)
+	}
+	if !fresh {
+		return ErrInvalidToken
+	}
+	if err := s.db.WithContext(ctx).Transaction(apply); err != nil {
+		if delErr := s.redisClient.Del(ctx, usedKey).Err(); delErr != nil {
+			log.Printf("account: failed to release token %s: %v", claims.ID, delErr)
+		}
+		return fmt.Errorf("failed to apply %s token: %w", purpose, err)
+	}
+	return nil
+}
+
+func (s *AccountService) sign(body string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
+
+func tokenBinding(user *models.User, purpose string) string {
+	state := strings.ToLower(user.Email)
+	if purpose == TokenResetPassword {
+		state = user.Password
+	}
+	sum := sha256.Sum256([]byte(purpose + ":" + state))
+	return hex.EncodeToString(sum[:8])
+}
+
+// randomToken returns n random bytes, base64url encoded; used for account
+// tokens, login challenges and sign-in state
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// humanDuration renders TTLs for emails, e.g. "1 hour" or "2 days"
+func humanDuration(d time.Duration) string {
+	unit, size := "minute", time.Minute
+	switch {
+	case d >= 48*time.Hour && d%(24*time.Hour) == 0:
+		unit, size = "day", 24*time.Hour
+	case d >= time.Hour && d%time.Hour == 0:
+		unit, size = "hour", time.Hour
+	}
+	n := int(d / size)
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
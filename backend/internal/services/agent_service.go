@@ -0,0 +1,608 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"likemind-backend/internal/cron"
+	"likemind-backend/internal/jobs"
+	"likemind-backend/internal/models"
+)
+
+// Catch-up policies applied when a schedule missed runs, e.g. because no
+// replica was running at the scheduled time
+const (
+	CatchUpSkip   = "skip"   // resume at the next future slot
+	CatchUpLatest = "latest" // run once for the most recent missed slot
+	CatchUpAll    = "all"    // run every missed slot, up to maxCatchUpRuns
+)
+
+// Agent run triggers and statuses
+const (
+	RunTriggerSchedule = "schedule"
+	RunTriggerCatchUp  = "catch_up"
+	RunTriggerManual   = "manual"
+
+	RunStatusPending   = "pending"
+	RunStatusRunning   = "running"
+	RunStatusSucceeded = "succeeded"
+	RunStatusFailed    = "failed"
+)
+
+// JobTypeAgentRun executes a persisted AgentRun
+const JobTypeAgentRun = "agent.run"
+
+const (
+	// maxCatchUpRuns bounds how many missed slots a single tick replays
+	maxCatchUpRuns = 24
+	// scheduleGrace is how late a slot may fire and still count as on time
+	scheduleGrace = 2 * time.Minute
+	// scheduleLockTTL bounds how long a replica holds a schedule while firing it
+	scheduleLockTTL = time.Minute
+)
+
+var (
+	// ErrAgentNotFound is returned for unknown or inactive agents and agents
+	// of other workspaces
+	ErrAgentNotFound = errors.New("agent not found")
+	// ErrScheduleNotFound is returned when a schedule does not exist or belongs
+	// to another user or workspace
+	ErrScheduleNotFound = errors.New("schedule not found")
+	// ErrInvalidSchedule wraps cron, time zone and catch-up validation failures
+	ErrInvalidSchedule = errors.New("invalid schedule")
+)
+
+// AgentConfig is the JSON stored in models.Agent.Config
+type AgentConfig struct {
+	SystemPrompt string `json:"system_prompt"`
+	// Prompt renders a template as the system prompt, before SystemPrompt
+	Prompt *PromptRef `json:"prompt,omitempty"`
+	// IncludeNewDocuments appends knowledge documents created since the
+	// previous successful run, e.g. for a daily digest agent
+	IncludeNewDocuments bool `json:"include_new_documents"`
+	MaxDocuments        int  `json:"max_documents"`
+}
+
+// ScheduleRequest describes a schedule to create
+type ScheduleRequest struct {
+	Name     string `json:"name"`
+	CronExpr string `json:"cron_expr" binding:"required"`
+	Timezone string `json:"timezone"`
+	Input    string `json:"input"`
+	CatchUp  string `json:"catch_up"`
+}
+
+// AgentService manages agents, their schedules and runs
+type AgentService struct {
+	db          *gorm.DB
+	aiService   *AIService
+	redisClient *redis.Client
+	jobs        *jobs.Queue
+	prompts     *PromptService
+}
+
+func NewAgentService(db *gorm.DB, aiService *AIService, redisClient *redis.Client, queue *jobs.Queue, prompts *PromptService) *AgentService {
+	s := &AgentService{
+		db:          db,
+		aiService:   aiService,
+		redisClient: redisClient,
+		jobs:        queue,
+		prompts:     prompts,
+	}
+	queue.Register(JobTypeAgentRun, jobs.Handle(s.executeRun))
+	return s
+}
+
+// ListAgents returns the workspace's active agents
+func (s *AgentService) ListAgents(ctx context.Context, workspaceID uint) ([]models.Agent, error) {
+	var agents []models.Agent
+	if err := s.db.WithContext(ctx).Where("is_active = ? AND workspace_id = ?", true, workspaceID).Order("name ASC").Find(&agents).Error; err != nil {
+		return nil, fmt.Errorf("failed to list agents: %w", err)
+	}
+	return agents, nil
+}
+
+func (s *AgentService) CreateAgent(ctx context.Context, workspaceID, userID uint, name, description string, cfg AgentConfig) (*models.Agent, error) {
+	if _, err := s.prompts.SystemMessage(ctx, cfg.Prompt); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal agent config: %w", err)
+	}
+
+	agent := &models.Agent{
+		Name:        name,
+		Description: description,
+		Config:      string(data),
+		IsActive:    true,
+		WorkspaceID: workspaceID,
+		CreatedBy:   userID,
+	}
+	if err := s.db.WithContext(ctx).Create(agent).Error; err != nil {
+		return nil, fmt.Errorf("failed to create agent: %w", err)
+	}
+	return agent, nil
+}
+
+// getAgent loads an active agent. workspaceID scopes the lookup for
+// requests; job handlers, which act on stored IDs, pass nil.
+func (s *AgentService) getAgent(ctx context.Context, workspaceID *uint, agentID uint) (*models.Agent, error) {
+	query := s.db.WithContext(ctx).Where("id = ? AND is_active = ?", agentID, true)
+	if workspaceID != nil {
+		query = query.Where("workspace_id = ?", *workspaceID)
+	}
+	var agent models.Agent
+	if err := query.First(&agent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAgentNotFound
+		}
+		return nil, fmt.Errorf("failed to load agent: %w", err)
+	}
+	return &agent, nil
+}
+
+// CreateSchedule validates the cron expression, time zone and catch-up policy
+// and stores a schedule whose first run is the next matching slot
+func (s *AgentService) CreateSchedule(ctx context.Context, workspaceID, agentID, userID uint, req ScheduleRequest) (*models.AgentSchedule, error) {
+	if _, err := s.getAgent(ctx, &workspaceID, agentID); err != nil {
+		return nil, err
+	}
+
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if req.CatchUp == "" {
+		req.CatchUp = CatchUpSkip
+	}
+	if req.CatchUp != CatchUpSkip && req.CatchUp != CatchUpLatest && req.CatchUp != CatchUpAll {
+		return nil, fmt.Errorf("%w: unknown catch_up policy %q", ErrInvalidSchedule, req.CatchUp)
+	}
+
+	schedule := &models.AgentSchedule{
+		AgentID:   agentID,
+		CreatedBy: userID,
+		Name:      req.Name,
+		CronExpr:  req.CronExpr,
+		Timezone:  req.Timezone,
+		Input:     req.Input,
+		CatchUp:   req.CatchUp,
+	}
+	next, err := nextRun(schedule, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	schedule.NextRunAt = &next
+
+	if err := s.db.WithContext(ctx).Create(schedule).Error; err != nil {
+		return nil, fmt.Errorf("failed to create schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// ListSchedules returns the schedules userID created for the workspace's agents
+func (s *AgentService) ListSchedules(ctx context.Context, workspaceID, userID uint) ([]models.AgentSchedule, error) {
+	var schedules []models.AgentSchedule
+	if err := s.db.WithContext(ctx).
+		Preload("Agent").
+		Where("created_by = ? AND agent_id IN (?)", userID, s.workspaceAgentIDs(workspaceID)).
+		Order("next_run_at ASC").
+		Find(&schedules).Error; err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// workspaceAgentIDs is a subquery selecting the IDs of a workspace's agents
+func (s *AgentService) workspaceAgentIDs(workspaceID uint) *gorm.DB {
+	return s.db.Model(&models.Agent{}).Select("id").Where("workspace_id = ?", workspaceID)
+}
+
+func (s *AgentService) getSchedule(ctx context.Context, workspaceID, scheduleID, userID uint) (*models.AgentSchedule, error) {
+	var schedule models.AgentSchedule
+	if err := s.db.WithContext(ctx).
+		Where("id = ? AND created_by = ? AND agent_id IN (?)", scheduleID, userID, s.workspaceAgentIDs(workspaceID)).
+		First(&schedule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrScheduleNotFound
+		}
+		return nil, fmt.Errorf("failed to load schedule: %w", err)
+	}
+	return &schedule, nil
+}
+
+// SetPaused pauses or resumes a schedule. Resuming restarts from the next
+// future slot so a long pause does not trigger catch-up runs.
+func (s *AgentService) SetPaused(ctx context.Context, workspaceID, scheduleID, userID uint, paused bool) (*models.AgentSchedule, error) {
+	schedule, err := s.getSchedule(ctx, workspaceID, scheduleID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{"is_paused": paused}
+	if !paused {
+		next, err := nextRun(schedule, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		updates["next_run_at"] = next
+	}
+	if err := s.db.WithContext(ctx).Model(schedule).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+func (s *AgentService) DeleteSchedule(ctx context.Context, workspaceID, scheduleID, userID uint) error {
+	result := s.db.WithContext(ctx).
+		Where("id = ? AND created_by = ? AND agent_id IN (?)", scheduleID, userID, s.workspaceAgentIDs(workspaceID)).
+		Delete(&models.AgentSchedule{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete schedule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+// TriggerSchedule starts a manual run immediately, independent of the cron slots
+func (s *AgentService) TriggerSchedule(ctx context.Context, workspaceID, scheduleID, userID uint) (*models.AgentRun, error) {
+	schedule, err := s.getSchedule(ctx, workspaceID, scheduleID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.enqueueRun(ctx, schedule, RunTriggerManual, time.Now())
+}
+
+// ListRuns returns the most recent runs of a schedule
+func (s *AgentService) ListRuns(ctx context.Context, workspaceID, scheduleID, userID uint, limit int) ([]models.AgentRun, error) {
+	if _, err := s.getSchedule(ctx, workspaceID, scheduleID, userID); err != nil {
+		return nil, err
+	}
+
+	var runs []models.AgentRun
+	if err := s.db.WithContext(ctx).
+		Where("schedule_id = ?", scheduleID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&runs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	return runs, nil
+}
+
+// RunScheduler fires due schedules every interval until ctx is cancelled.
+// Every replica runs the loop; a Redis lock per schedule ensures only one of
+// them fires a given slot.
+func (s *AgentService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.fireDueSchedules(ctx); err != nil {
+				log.Printf("agents: scheduler tick failed: %v", err)
+			}
+		}
+	}
+}
+
+func (s *AgentService) fireDueSchedules(ctx context.Context) error {
+	var due []models.AgentSchedule
+	if err := s.db.WithContext(ctx).
+		Where("is_paused = ? AND next_run_at <= ?", false, time.Now()).
+		Find(&due).Error; err != nil {
+		return fmt.Errorf("failed to load due schedules: %w", err)
+	}
+
+	for _, schedule := range due {
+		if err := s.fireSchedule(ctx, schedule.ID); err != nil {
+			log.Printf("agents: failed to fire schedule %d: %v", schedule.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *AgentService) fireSchedule(ctx context.Context, scheduleID uint) error {
+	release, ok := acquireLock(ctx, s.redisClient, fmt.Sprintf("agents:schedule:%d:lock", scheduleID), scheduleLockTTL)
+	if !ok {
+		return nil
+	}
+	defer release()
+
+	// Reload under the lock; another replica may already have advanced it
+	var schedule models.AgentSchedule
+	if err := s.db.WithContext(ctx).First(&schedule, scheduleID).Error; err != nil {
+		return fmt.Errorf("failed to reload schedule: %w", err)
+	}
+	now := time.Now()
+	if schedule.IsPaused || schedule.NextRunAt == nil || schedule.NextRunAt.After(now) {
+		return nil
+	}
+
+	slots, next, err := dueSlots(&schedule, now)
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{"next_run_at": next, "last_run_at": now}
+	if next.IsZero() {
+		updates["next_run_at"] = nil
+	}
+	if err := s.db.WithContext(ctx).Model(&schedule).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to advance schedule: %w", err)
+	}
+
+	for _, slot := range selectSlots(schedule.CatchUp, slots, now) {
+		trigger := RunTriggerSchedule
+		if now.Sub(slot) > scheduleGrace {
+			trigger = RunTriggerCatchUp
+		}
+		if _, err := s.enqueueRun(ctx, &schedule, trigger, slot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dueSlots lists the slots from the schedule's NextRunAt up to now and the
+// first slot after now, which is zero if the expression never fires again
+func dueSlots(schedule *models.AgentSchedule, now time.Time) ([]time.Time, time.Time, error) {
+	expr, loc, err := parseSchedule(schedule)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var slots []time.Time
+	t := schedule.NextRunAt.In(loc)
+	for !t.After(now) {
+		slots = append(slots, t)
+		if len(slots) > maxCatchUpRuns {
+			slots = slots[1:]
+		}
+		t = expr.Next(t)
+		if t.IsZero() {
+			break
+		}
+	}
+	return slots, t, nil
+}
+
+// selectSlots applies the catch-up policy. A slot inside the grace period is
+// on time and always runs; older slots are missed runs.
+func selectSlots(policy string, slots []time.Time, now time.Time) []time.Time {
+	if len(slots) == 0 {
+		return nil
+	}
+	latest := slots[len(slots)-1]
+	onTime := now.Sub(latest) <= scheduleGrace
+
+	switch policy {
+	case CatchUpAll:
+		return slots
+	case CatchUpLatest:
+		return []time.Time{latest}
+	default:
+		if onTime {
+			return []time.Time{latest}
+		}
+		return nil
+	}
+}
+
+func (s *AgentService) enqueueRun(ctx context.Context, schedule *models.AgentSchedule, trigger string, scheduledFor time.Time) (*models.AgentRun, error) {
+	run := &models.AgentRun{
+		AgentID:      schedule.AgentID,
+		ScheduleID:   &schedule.ID,
+		Trigger:      trigger,
+		ScheduledFor: scheduledFor,
+		Input:        schedule.Input,
+		Status:       RunStatusPending,
+	}
+	if err := s.db.WithContext(ctx).Create(run).Error; err != nil {
+		return nil, fmt.Errorf("failed to create agent run: %w", err)
+	}
+
+	job, err := s.jobs.Enqueue(ctx, JobTypeAgentRun, agentRunPayload{RunID: run.ID}, jobs.WithUserID(schedule.CreatedBy))
+	if err != nil {
+		s.db.WithContext(ctx).Model(run).Updates(map[string]interface{}{"status": RunStatusFailed, "error": err.Error()})
+		return nil, fmt.Errorf("failed to enqueue agent run: %w", err)
+	}
+
+	run.JobID = job.ID
+	s.db.WithContext(ctx).Model(run).Update("job_id", job.ID)
+	return run, nil
+}
+
+type agentRunPayload struct {
+	RunID uint `json:"run_id"`
+}
+
+// executeRun is the job handler that runs an agent and persists its output
+func (s *AgentService) executeRun(ctx context.Context, payload agentRunPayload) error {
+	var run models.AgentRun
+	if err := s.db.WithContext(ctx).First(&run, payload.RunID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(fmt.Errorf("agent run %d not found", payload.RunID))
+		}
+		return err
+	}
+
+	agent, err := s.getAgent(ctx, nil, run.AgentID)
+	if err != nil {
+		s.finishRun(ctx, &run, "", err)
+		if errors.Is(err, ErrAgentNotFound) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+
+	startedAt := time.Now()
+	s.db.WithContext(ctx).Model(&run).Updates(map[string]interface{}{"status": RunStatusRunning, "started_at": startedAt})
+
+	messages, err := s.buildMessages(ctx, agent, &run)
+	if err != nil {
+		s.finishRun(ctx, &run, "", err)
+		return err
+	}
+
+	response, err := s.aiService.GenerateResponse(ctx, messages)
+	if err != nil {
+		s.finishRun(ctx, &run, "", err)
+		return err
+	}
+
+	s.finishRun(ctx, &run, response.Content, nil)
+	return nil
+}
+
+func (s *AgentService) finishRun(ctx context.Context, run *models.AgentRun, output string, runErr error) {
+	updates := map[string]interface{}{
+		"status":      RunStatusSucceeded,
+		"output":      output,
+		"error":       "",
+		"finished_at": time.Now(),
+	}
+	if runErr != nil {
+		updates["status"] = RunStatusFailed
+		updates["error"] = runErr.Error()
+	}
+	s.db.WithContext(ctx).Model(run).Updates(updates)
+}
+
+func (s *AgentService) buildMessages(ctx context.Context, agent *models.Agent, run *models.AgentRun) ([]models.ChatMessage, error) {
+	var cfg AgentConfig
+	if agent.Config != "" {
+		if err := json.Unmarshal([]byte(agent.Config), &cfg); err != nil {
+			return nil, jobs.Permanent(fmt.Errorf("invalid agent config: %w", err))
+		}
+	}
+
+	var messages []models.ChatMessage
+	system, err := s.prompts.SystemMessage(ctx, cfg.Prompt)
+	if err != nil {
+		if errors.Is(err, ErrPromptNotFound) || errors.Is(err, ErrInvalidPrompt) {
+			return nil, jobs.Permanent(err)
+		}
+		return nil, err
+	}
+	if system != nil {
+		messages = append(messages, *system)
+	}
+	if cfg.SystemPrompt != "" {
+		messages = append(messages, models.ChatMessage{Role: "system", Content: cfg.SystemPrompt})
+	}
+
+	input := run.Input
+	if cfg.IncludeNewDocuments {
+		digest, err := s.newDocumentsContext(ctx, agent, run, cfg.MaxDocuments)
+		if err != nil {
+			return nil, err
+		}
+		input = strings.TrimSpace(input + "\n\n" + digest)
+	}
+	if input == "" {
+		input = "Run your configured task."
+	}
+	messages = append(messages, models.ChatMessage{Role: "user", Content: input})
+
+	return messages, nil
+}
+
+// newDocumentsContext summarizes the agent's workspace documents created
+// since the schedule's previous successful run, or the last 24 hours for a
+// first run. Only collections readable by the schedule's owner, or the
+// agent's creator for unscheduled runs, are included.
+func (s *AgentService) newDocumentsContext(ctx context.Context, agent *models.Agent, run *models.AgentRun, limit int) (string, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	since := run.ScheduledFor.Add(-24 * time.Hour)
+	requester := agent.CreatedBy
+	if run.ScheduleID != nil {
+		var schedule models.AgentSchedule
+		if err := s.db.WithContext(ctx).Unscoped().First(&schedule, *run.ScheduleID).Error; err != nil {
+			return "", fmt.Errorf("failed to load schedule: %w", err)
+		}
+		requester = schedule.CreatedBy
+
+		var previous models.AgentRun
+		err := s.db.WithContext(ctx).
+			Where("schedule_id = ? AND status = ? AND id <> ?", *run.ScheduleID, RunStatusSucceeded, run.ID).
+			Order("scheduled_for DESC").
+			First(&previous).Error
+		if err == nil {
+			since = previous.ScheduledFor
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("failed to load previous run: %w", err)
+		}
+	}
+
+	var docs []models.KnowledgeDocument
+	if err := s.db.WithContext(ctx).
+		Where("workspace_id = ? AND created_at > ?", agent.WorkspaceID, since).
+		Where("collection_id IN (?)", readableCollections(s.db, requester)).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&docs).Error; err != nil {
+		return "", fmt.Errorf("failed to load new documents: %w", err)
+	}
+
+	if len(docs) == 0 {
+		return fmt.Sprintf("No new knowledge documents were added since %s.", since.Format(time.RFC1123)), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "New knowledge documents since %s:\n", since.Format(time.RFC1123))
+	for _, doc := range docs {
+		content := doc.Content
+		if len(content) > 1000 {
+			// Cut on a rune boundary so the text stays valid UTF-8
+			cut := 1000
+			for cut > 0 && !utf8.RuneStart(content[cut]) {
+				cut--
+			}
+			content = content[:cut] + "..."
+		}
+		fmt.Fprintf(&b, "\n## %s\n%s\n", doc.Title, content)
+	}
+	return b.String(), nil
+}
+
+func parseSchedule(schedule *models.AgentSchedule) (*cron.Schedule, *time.Location, error) {
+	expr, err := cron.Parse(schedule.CronExpr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidSchedule, schedule.Timezone)
+	}
+	return expr, loc, nil
+}
+
+func nextRun(schedule *models.AgentSchedule, after time.Time) (time.Time, error) {
+	expr, loc, err := parseSchedule(schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := expr.Next(after.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("%w: cron expression %q never fires", ErrInvalidSchedule, schedule.CronExpr)
+	}
+	return next, nil
+}
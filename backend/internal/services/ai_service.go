@@ -1,28 +1,74 @@
 package services
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	"likemind-backend/internal/breaker"
+	"likemind-backend/internal/embedding"
+	"likemind-backend/internal/guardrails"
 	"likemind-backend/internal/models"
+	"likemind-backend/internal/pii"
 )
 
 type AIService struct {
 	apiKey      string
 	httpClient  *http.Client
 	baseURL     string
+	embedder    embedding.Embedder
+
+	models     []string
+	maxRetries int
+	timeout    time.Duration
+	breakers   *breaker.Set
+	cache      *ResponseCache
+	guardrails *GuardrailService
+	pii        *pii.Redactor
+}
+
+// LLMOptions configures how chat completions are retried and which models
+// they fall back to
+type LLMOptions struct {
+	Models           []string      // tried in order; the first is the primary model
+	MaxRetries       int           // retries of transient failures per model
+	Timeout          time.Duration // time allowed for a model to start responding
+	BreakerThreshold int           // consecutive failures that open a model's circuit
+	BreakerCooldown  time.Duration
+	Cache            *ResponseCache    // optional; see WithCacheRoute
+	Guardrails       *GuardrailService // optional input and output screening
+	PII              *pii.Redactor     // optional redaction of prompts
 }
 
+const (
+	llmProvider    = "openai"
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 8 * time.Second
+	maxRetryAfter  = 30 * time.Second
+)
+
 type OpenAIRequest struct {
-	Model       string    `json:"model"`
-	Messages    []Message `json:"messages"`
-	Temperature float32   `json:"temperature,omitempty"`
-	MaxTokens   int       `json:"max_tokens,omitempty"`
-	Stream      bool      `json:"stream,omitempty"`
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	Temperature    float32         `json:"temperature,omitempty"`
+	MaxTokens      int             `json:"max_tokens,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// ResponseFormat selects JSON mode with {"type": "json_object"}
+type ResponseFormat struct {
+	Type string `json:"type"`
 }
 
 type Message struct {
@@ -51,20 +97,340 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
-func NewAIService(apiKey string) *AIService {
+func NewAIService(apiKey string, embedder embedding.Embedder, opts LLMOptions) *AIService {
+	if len(opts.Models) == 0 {
+		opts.Models = []string{"gpt-3.5-turbo"}
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 60 * time.Second
+	}
 	return &AIService{
-		apiKey:     apiKey,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+		apiKey: apiKey,
+		// Streams may run long, so there is no overall client timeout; send
+		// bounds the wait for headers and for each read of the body
+		httpClient: newLLMHTTPClient(opts.Timeout),
 		baseURL:    "https://api.openai.com/v1",
+		embedder:   embedder,
+		models:     opts.Models,
+		maxRetries: opts.MaxRetries,
+		timeout:    opts.Timeout,
+		breakers:   breaker.NewSet(opts.BreakerThreshold, opts.BreakerCooldown),
+		cache:      opts.Cache,
+		guardrails: opts.Guardrails,
+		pii:        opts.PII,
 	}
 }
 
+// newLLMHTTPClient returns a client whose transport bounds connecting and
+// the TLS handshake, and gives up on headers after timeout as a backstop to
+// the per-request deadline in send
+func newLLMHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.ResponseHeaderTimeout = timeout
+	return &http.Client{Transport: transport}
+}
+
+// GenerateResponse answers messages, serving repeated prompts from the
+// response cache when the route attached to ctx opts in. The last user
+// message and the reply pass through the guardrails.
 func (s *AIService) GenerateResponse(ctx context.Context, messages []models.ChatMessage) (*models.ChatMessage, error) {
+	vault, messages := s.redactPII(messages)
+	messages, input, err := s.screenInput(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := s.cache.lookup(ctx, s.newOpenAIRequest(messages), s.models)
+	if lookup.hit != nil {
+		return s.cachedResponse(lookup, input, vault), nil
+	}
+
+	response, err := s.generateResponse(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	return s.finishResponse(ctx, response, lookup, input, vault)
+}
+
+func (s *AIService) generateResponse(ctx context.Context, messages []models.ChatMessage) (*models.ChatMessage, error) {
 	if s.apiKey == "" {
 		return s.generateMockResponse(messages)
 	}
 
-	// Convert messages to OpenAI format
+	openAIResp, model, err := s.complete(ctx, s.newOpenAIRequest(messages))
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.ChatMessage{
+		Role:      "assistant",
+		Content:   openAIResp.Choices[0].Message.Content,
+		Model:     model,
+		CreatedAt: time.Now(),
+	}
+
+	return response, nil
+}
+
+// complete sends a non-streaming chat completion request through the model
+// chain and returns the response with the model that produced it
+func (s *AIService) complete(ctx context.Context, request OpenAIRequest) (*OpenAIResponse, string, error) {
+	var openAIResp OpenAIResponse
+	model, err := s.withFallback(ctx, func(model string) error {
+		request.Model = model
+		resp, err := s.send(ctx, request)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		openAIResp = OpenAIResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&openAIResp); err != nil {
+			return transportError(ctx, model, fmt.Errorf("failed to decode response: %w", err))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(openAIResp.Choices) == 0 {
+		return nil, "", fmt.Errorf("no choices returned from OpenAI")
+	}
+
+	return &openAIResp, model, nil
+}
+
+// GenerateResponseStream behaves like GenerateResponse but invokes onDelta with
+// each content fragment as it arrives from the model. With guardrails
+// configured the reply is screened first and then delivered word by word.
+func (s *AIService) GenerateResponseStream(ctx context.Context, messages []models.ChatMessage, onDelta func(string)) (*models.ChatMessage, error) {
+	vault, messages := s.redactPII(messages)
+	messages, input, err := s.screenInput(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := s.cache.lookup(ctx, s.newOpenAIRequest(messages), s.models)
+	if lookup.hit != nil {
+		response := s.cachedResponse(lookup, input, vault)
+		replayDeltas(response.Content, onDelta)
+		return response, nil
+	}
+
+	// Output guardrails need the whole reply, so with checks configured
+	// nothing is delivered until it has been screened
+	if s.guardrails.Enabled() {
+		response, err := s.generateResponseStream(ctx, messages, func(string) {})
+		if err != nil {
+			return nil, err
+		}
+		response, err = s.finishResponse(ctx, response, lookup, input, vault)
+		if err != nil {
+			return nil, err
+		}
+		replayDeltas(response.Content, onDelta)
+		return response, nil
+	}
+
+	restorer := vault.NewStreamRestorer()
+	response, err := s.generateResponseStream(ctx, messages, func(delta string) {
+		if text := restorer.Write(delta); text != "" {
+			onDelta(text)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if text := restorer.Flush(); text != "" {
+		onDelta(text)
+	}
+	return s.finishResponse(ctx, response, lookup, input, vault)
+}
+
+// replayDeltas delivers a reply that is already complete word by word
+func replayDeltas(text string, onDelta func(string)) {
+	for _, word := range strings.SplitAfter(text, " ") {
+		onDelta(word)
+	}
+}
+
+// redactPII replaces personal data and secrets in messages with
+// placeholders, returning the vault that maps them back. Counts are logged
+// per message; values never are.
+func (s *AIService) redactPII(messages []models.ChatMessage) (*pii.Vault, []models.ChatMessage) {
+	if s.pii == nil {
+		return nil, messages
+	}
+	vault := s.pii.NewVault()
+	redacted := make([]models.ChatMessage, len(messages))
+	for i, msg := range messages {
+		text, counts := vault.Redact(msg.Content)
+		msg.Content = text
+		redacted[i] = msg
+		if len(counts) > 0 {
+			ref := fmt.Sprintf("#%d", i)
+			if msg.ID != 0 {
+				ref = fmt.Sprintf("%d", msg.ID)
+			}
+			log.Printf("pii: redacted %s from %s message %s", pii.FormatCounts(counts), msg.Role, ref)
+		}
+	}
+	return vault, redacted
+}
+
+// cachedResponse turns a cache hit into a reply for this request
+func (s *AIService) cachedResponse(lookup *cacheLookup, input *guardrails.Result, vault *pii.Vault) *models.ChatMessage {
+	response := lookup.message()
+	response.Content = vault.Restore(response.Content)
+	response.Metadata = withPIIMetadata(withGuardrailMetadata(response.Metadata, input, nil), vault)
+	return response
+}
+
+type screenedInputKey struct{}
+
+// screenMessage applies the input guardrails to a single user message, such
+// as one about to be stored. Pass the result to withScreenedInput so that
+// generating the reply does not screen the message again.
+func (s *AIService) screenMessage(ctx context.Context, text string) (*guardrails.Result, error) {
+	return s.guardrails.Screen(ctx, guardrails.Input, text)
+}
+
+// withScreenedInput marks the last user message of generation requests made
+// with ctx as already screened with result
+func withScreenedInput(ctx context.Context, result *guardrails.Result) context.Context {
+	return context.WithValue(ctx, screenedInputKey{}, result)
+}
+
+// screenInput applies the input guardrails to the last user message,
+// returning messages with any redactions
+func (s *AIService) screenInput(ctx context.Context, messages []models.ChatMessage) ([]models.ChatMessage, *guardrails.Result, error) {
+	last := len(messages) - 1
+	if last < 0 || messages[last].Role != "user" {
+		return messages, nil, nil
+	}
+	if result, ok := ctx.Value(screenedInputKey{}).(*guardrails.Result); ok {
+		return messages, result, nil
+	}
+	result, err := s.guardrails.Screen(ctx, guardrails.Input, messages[last].Content)
+	if err != nil {
+		return nil, nil, err
+	}
+	if result.Text != messages[last].Content {
+		messages = append([]models.ChatMessage(nil), messages...)
+		messages[last].Content = result.Text
+	}
+	return messages, result, nil
+}
+
+// finishResponse screens a generated reply, caches it while it still holds
+// placeholders, then restores them and records the metadata
+func (s *AIService) finishResponse(ctx context.Context, response *models.ChatMessage, lookup *cacheLookup, input *guardrails.Result, vault *pii.Vault) (*models.ChatMessage, error) {
+	output, err := s.guardrails.Screen(ctx, guardrails.Output, response.Content)
+	if err != nil {
+		return nil, err
+	}
+	response.Content = output.Text
+	lookup.store(ctx, response)
+
+	response.Content = vault.Restore(response.Content)
+	response.Metadata = withPIIMetadata(withGuardrailMetadata(lookup.metadata(), input, output), vault)
+	return response, nil
+}
+
+// withPIIMetadata records how many values of each type were redacted from
+// the prompt under "pii" in a message's metadata
+func withPIIMetadata(metadata string, vault *pii.Vault) string {
+	counts := vault.Counts()
+	if len(counts) == 0 {
+		return metadata
+	}
+	return setMetadata(metadata, "pii", map[string]interface{}{"redacted": counts})
+}
+
+// setMetadata sets key in a message's JSON metadata
+func setMetadata(metadata, key string, value interface{}) string {
+	fields := make(map[string]interface{})
+	if metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &fields); err != nil {
+			return metadata
+		}
+	}
+	fields[key] = value
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return metadata
+	}
+	return string(data)
+}
+
+func (s *AIService) generateResponseStream(ctx context.Context, messages []models.ChatMessage, onDelta func(string)) (*models.ChatMessage, error) {
+	if s.apiKey == "" {
+		response, err := s.generateMockResponse(messages)
+		if err != nil {
+			return nil, err
+		}
+		replayDeltas(response.Content, onDelta)
+		return response, nil
+	}
+
+	// Retries and fallbacks happen before the first delta; once content
+	// is streaming a failure is returned as is
+	request := s.newOpenAIRequest(messages)
+	request.Stream = true
+	var resp *http.Response
+	model, err := s.withFallback(ctx, func(model string) error {
+		request.Model = model
+		r, err := s.send(ctx, request)
+		resp = r
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk OpenAIResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to decode stream chunk: %w", err)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		content.WriteString(chunk.Choices[0].Delta.Content)
+		onDelta(chunk.Choices[0].Delta.Content)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	response := &models.ChatMessage{
+		Role:      "assistant",
+		Content:   content.String(),
+		Model:     model,
+		CreatedAt: time.Now(),
+	}
+
+	return response, nil
+}
+
+// newOpenAIRequest converts messages to OpenAI format with the default
+// model and sampling settings
+func (s *AIService) newOpenAIRequest(messages []models.ChatMessage) OpenAIRequest {
 	openAIMessages := make([]Message, len(messages))
 	for i, msg := range messages {
 		openAIMessages[i] = Message{
@@ -73,13 +439,15 @@ func (s *AIService) GenerateResponse(ctx context.Context, messages []models.Chat
 		}
 	}
 
-	request := OpenAIRequest{
-		Model:       "gpt-3.5-turbo",
+	return OpenAIRequest{
+		Model:       s.models[0],
 		Messages:    openAIMessages,
 		Temperature: 0.7,
 		MaxTokens:   1000,
 	}
+}
 
+func (s *AIService) newChatCompletionRequest(ctx context.Context, request OpenAIRequest) (*http.Request, error) {
 	jsonData, err := json.Marshal(request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -93,32 +461,163 @@ func (s *AIService) GenerateResponse(ctx context.Context, messages []models.Chat
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+s.apiKey)
 
+	return req, nil
+}
+
+// withFallback runs call against each model of the chain in order. Transient
+// failures are retried with jittered exponential backoff, honoring the
+// provider's Retry-After; a model whose retries are exhausted, whose circuit
+// is open or that cannot serve the request hands over to the next one.
+// Errors that no other model would fix, such as rejected credentials, end
+// the chain. It returns the model that succeeded.
+func (s *AIService) withFallback(ctx context.Context, call func(model string) error) (string, error) {
+	var lastErr error
+	for i, model := range s.models {
+		if i > 0 {
+			log.Printf("ai: falling back to model %s: %v", model, lastErr)
+		}
+		err := s.callModel(ctx, model, call)
+		if err == nil {
+			return model, nil
+		}
+		var llmErr *LLMError
+		if !errors.As(err, &llmErr) || !llmErr.fallback {
+			return "", err
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+// callModel calls one model, retrying transient failures while its circuit
+// stays closed
+func (s *AIService) callModel(ctx context.Context, model string, call func(model string) error) error {
+	b := s.breakers.Get(llmProvider + "/" + model)
+	if !b.Allow() {
+		return &LLMError{Kind: ErrLLMUnavailable, Model: model, Message: "circuit breaker is open", fallback: true}
+	}
+	for attempt := 0; ; attempt++ {
+		err := call(model)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var llmErr *LLMError
+		if !errors.As(err, &llmErr) {
+			b.Success()
+			return err
+		}
+		if !llmErr.retryable {
+			// The provider answered, so the model itself is healthy
+			b.Success()
+			return err
+		}
+		b.Failure()
+
+		if attempt >= s.maxRetries || llmErr.RetryAfter > maxRetryAfter || !b.Allow() {
+			return err
+		}
+		timer := time.NewTimer(retryDelay(attempt, llmErr.RetryAfter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay is an exponential backoff with jitter, or the provider's
+// Retry-After when that is longer
+func retryDelay(attempt int, retryAfter time.Duration) time.Duration {
+	delay := retryBaseDelay << attempt
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	if retryAfter > delay {
+		return retryAfter
+	}
+	return delay
+}
+
+// send posts one chat completion request and returns the response if it
+// succeeded. The request is abandoned if no response headers arrive within
+// the timeout; after that the body may take as long as it needs, as long as
+// it never stalls for longer than the timeout.
+func (s *AIService) send(ctx context.Context, request OpenAIRequest) (*http.Response, error) {
+	// headerCtx only bounds the wait for headers; attemptCtx carries the
+	// request and lives on until the body is closed
+	headerCtx, stopHeaderTimeout := context.WithTimeout(ctx, s.timeout)
+	defer stopHeaderTimeout()
+	attemptCtx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(headerCtx, func() { cancel(context.DeadlineExceeded) })
+
+	req, err := s.newChatCompletionRequest(attemptCtx, request)
+	if err != nil {
+		stop()
+		cancel(nil)
+		return nil, err
+	}
+
 	resp, err := s.httpClient.Do(req)
+	if !stop() && err == nil {
+		// The deadline passed just as the headers arrived and the body is
+		// already cut off
+		resp.Body.Close()
+		err = context.Cause(attemptCtx)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
+		cancel(nil)
+		var netErr net.Error
+		timedOut := errors.Is(headerCtx.Err(), context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+		if timedOut && ctx.Err() == nil {
+			return nil, &LLMError{Kind: ErrLLMTimeout, Model: request.Model, Err: err, retryable: true, fallback: true}
+		}
+		return nil, transportError(ctx, request.Model, err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+		defer cancel(nil)
+		defer resp.Body.Close()
+		return nil, classifyResponse(request.Model, resp)
 	}
+	resp.Body = newIdleTimeoutBody(attemptCtx, resp.Body, s.timeout, cancel)
+	return resp, nil
+}
 
-	var openAIResp OpenAIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&openAIResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
+// errBodyStalled ends a response body that delivered nothing for too long
+var errBodyStalled = errors.New("response body stalled")
 
-	if len(openAIResp.Choices) == 0 {
-		return nil, fmt.Errorf("no choices returned from OpenAI")
-	}
+// idleTimeoutBody cancels its request once a read has waited longer than
+// idle, and releases the request's context when it is closed
+type idleTimeoutBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	idle   time.Duration
+	timer  *time.Timer
+	cancel context.CancelCauseFunc
+}
 
-	response := &models.ChatMessage{
-		Role:      "assistant",
-		Content:   openAIResp.Choices[0].Message.Content,
-		CreatedAt: time.Now(),
+func newIdleTimeoutBody(ctx context.Context, body io.ReadCloser, idle time.Duration, cancel context.CancelCauseFunc) *idleTimeoutBody {
+	b := &idleTimeoutBody{ReadCloser: body, ctx: ctx, idle: idle, cancel: cancel}
+	b.timer = time.AfterFunc(idle, func() { cancel(errBodyStalled) })
+	return b
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && errors.Is(context.Cause(b.ctx), errBodyStalled) {
+		return n, fmt.Errorf("%w: nothing received for %s", errBodyStalled, b.idle)
 	}
+	b.timer.Reset(b.idle)
+	return n, err
+}
 
-	return response, nil
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
 }
 
 func (s *AIService) generateMockResponse(messages []models.ChatMessage) (*models.ChatMessage, error) {
@@ -146,16 +645,24 @@ func (s *AIService) generateMockResponse(messages []models.ChatMessage) (*models
 }
 
 func (s *AIService) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
-	// This would integrate with OpenAI's embedding API
-	// For now, return a mock embedding
-	return make([]float32, 1536), nil
-}
-
-func (s *AIService) AnalyzeText(ctx context.Context, text string) (map[string]interface{}, error) {
-	// Text analysis functionality
-	return map[string]interface{}{
-		"sentiment": "positive",
-		"topics":    []string{"technology", "AI"},
-		"entities":  []string{"OpenAI", "GPT"},
-	}, nil
+	return embedding.EmbedOne(ctx, s.embedder, text)
+}
+
+// GenerateEmbeddings embeds texts in order, batching requests to the provider
+func (s *AIService) GenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	return s.embedder.Embed(ctx, texts)
+}
+
+// InvalidateCache drops cached responses for route, or for all routes when
+// route is empty
+func (s *AIService) InvalidateCache(ctx context.Context, route string) (int, error) {
+	return s.cache.Invalidate(ctx, route)
+}
+
+// EmbeddingModel returns the model and dimension of generated embeddings
+func (s *AIService) EmbeddingModel() (string, int) {
+	return s.embedder.Model(), s.embedder.Dimension()
 }
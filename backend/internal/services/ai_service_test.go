@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"likemind-backend/internal/models"
+)
+
+// newTestAIService points an AIService at handler with a short timeout and
+// no retries or fallbacks. The request body is drained first so that the
+// server notices when the client goes away.
+func newTestAIService(t *testing.T, handler http.HandlerFunc) *AIService {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	s := NewAIService("test-key", nil, LLMOptions{Models: []string{"test-model"}, Timeout: 200 * time.Millisecond})
+	s.baseURL = srv.URL
+	return s
+}
+
+var testPrompt = []models.ChatMessage{{Role: "user", Content: "hello"}}
+
+func TestSendTimesOutWaitingForHeaders(t *testing.T) {
+	s := newTestAIService(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	start := time.Now()
+	_, err := s.GenerateResponse(context.Background(), testPrompt)
+	if !errors.Is(err, ErrLLMTimeout) {
+		t.Fatalf("got %v, want ErrLLMTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("took %s to time out", elapsed)
+	}
+}
+
+func TestStreamOutlivesHeaderTimeout(t *testing.T) {
+	s := newTestAIService(t, func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		w.WriteHeader(http.StatusOK)
+		for _, word := range []string{"slow ", "but ", "steady"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", word)
+			flusher.Flush()
+			time.Sleep(150 * time.Millisecond)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	var deltas []string
+	resp, err := s.GenerateResponseStream(context.Background(), testPrompt, func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "slow but steady" || strings.Join(deltas, "") != resp.Content {
+		t.Fatalf("got %q from deltas %q", resp.Content, deltas)
+	}
+}
+
+func TestStalledStreamIsAbandoned(t *testing.T) {
+	s := newTestAIService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"partial\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	start := time.Now()
+	_, err := s.GenerateResponseStream(context.Background(), testPrompt, func(string) {})
+	if !errors.Is(err, errBodyStalled) {
+		t.Fatalf("got %v, want errBodyStalled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("took %s to abandon the stream", elapsed)
+	}
+}
+
+func TestCanceledContextIsNotATimeout(t *testing.T) {
+	s := newTestAIService(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := s.GenerateResponse(ctx, testPrompt)
+	if errors.Is(err, ErrLLMTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the caller's context error", err)
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"likemind-backend/internal/jsonschema"
+	"likemind-backend/internal/models"
+)
+
+// Analysis methods
+const (
+	AnalysisMethodLLM     = "llm"
+	AnalysisMethodLexicon = "lexicon"
+)
+
+const (
+	// maxAnalysisChars bounds the text sent to the model per analysis
+	maxAnalysisChars = 12000
+	// analysisConcurrency bounds parallel model calls in a batch
+	analysisConcurrency = 4
+)
+
+// ErrEmptyText is returned when there is nothing to analyze
+var ErrEmptyText = errors.New("text must not be empty")
+
+// Entity is a named entity found in text
+type Entity struct {
+	Text string `json:"text"`
+	Type string `json:"type"` // person, organization, location, product, date or other
+}
+
+// TextAnalysis is the result of AnalyzeText
+type TextAnalysis struct {
+	Sentiment      string   `json:"sentiment"`       // positive, negative, neutral or mixed
+	SentimentScore float64  `json:"sentiment_score"` // -1 (negative) to 1 (positive)
+	Topics         []string `json:"topics"`
+	Entities       []Entity `json:"entities"`
+	Language       string   `json:"language"` // ISO 639-1 code, "und" if unknown
+	Summary        string   `json:"summary"`
+	Method         string   `json:"method"`
+}
+
+// analysisSchema is what the model must return; responses that do not
+// validate fall back to the lexicon analyzer
+var analysisSchema = jsonschema.MustCompile(analysisSchemaText)
+
+const analysisSchemaText = `{
+	"type": "object",
+	"required": ["sentiment", "sentiment_score", "topics", "entities", "language", "summary"],
+	"properties": {
+		"sentiment": {"enum": ["positive", "negative", "neutral", "mixed"]},
+		"sentiment_score": {"type": "number", "minimum": -1, "maximum": 1},
+		"topics": {"type": "array", "maxItems": 10, "items": {"type": "string", "minLength": 1}},
+		"entities": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"required": ["text", "type"],
+				"properties": {
+					"text": {"type": "string", "minLength": 1},
+					"type": {"enum": ["person", "organization", "location", "product", "date", "other"]}
+				}
+			}
+		},
+		"language": {"type": "string", "pattern": "^([a-z]{2}|und)$"},
+		"summary": {"type": "string"}
+	}
+}`
+
+const analysisPrompt = `You analyze text. Reply with a single JSON object with these keys:
+"sentiment": one of "positive", "negative", "neutral", "mixed";
+"sentiment_score": a number from -1 (very negative) to 1 (very positive);
+"topics": up to 5 short lowercase topic labels;
+"entities": an array of {"text", "type"} where type is one of person, organization, location, product, date, other;
+"language": the ISO 639-1 code of the text's language, or "und" if unknown;
+"summary": a summary of at most two sentences in the text's language.`
+
+// AnalyzeText extracts sentiment, topics, entities, language and a summary.
+// The model is asked for schema-validated JSON; without an API key, or when
+// the model's answer is unusable, a lexicon-based analysis is returned. Text
+// the guardrails block is not analyzed at all.
+func (s *AIService) AnalyzeText(ctx context.Context, text string) (*TextAnalysis, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, ErrEmptyText
+	}
+	if s.apiKey == "" {
+		if _, err := s.screenMessage(ctx, text); err != nil {
+			return nil, err
+		}
+		return analyzeLexicon(text), nil
+	}
+
+	analysis, err := s.analyzeWithModel(ctx, text)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// Blocked text must not get an answer from the fallback either
+		var guardErr *GuardrailError
+		if errors.As(err, &guardErr) {
+			return nil, err
+		}
+		log.Printf("ai: model analysis failed, using lexicon fallback: %v", err)
+		return analyzeLexicon(text), nil
+	}
+	return analysis, nil
+}
+
+// AnalyzeBatch analyzes texts concurrently, preserving order
+func (s *AIService) AnalyzeBatch(ctx context.Context, texts []string) ([]*TextAnalysis, error) {
+	for i, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			return nil, fmt.Errorf("text %d: %w", i, ErrEmptyText)
+		}
+	}
+
+	results := make([]*TextAnalysis, len(texts))
+	errs := make([]error, len(texts))
+	sem := make(chan struct{}, analysisConcurrency)
+	var wg sync.WaitGroup
+	for i, text := range texts {
+		wg.Add(1)
+		go func(i int, text string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = s.AnalyzeText(ctx, text)
+		}(i, text)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func (s *AIService) analyzeWithModel(ctx context.Context, text string) (*TextAnalysis, error) {
+	if len(text) > maxAnalysisChars {
+		text = text[:maxAnalysisChars]
+	}
+
+	result, err := s.GenerateStructured(ctx, []models.ChatMessage{
+		{Role: "system", Content: analysisPrompt},
+		{Role: "user", Content: text},
+	}, analysisSchema, analysisSchemaText, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Round-trip through JSON to decode the validated value into the struct
+	data, err := json.Marshal(result.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode analysis: %w", err)
+	}
+	var analysis TextAnalysis
+	if err := json.Unmarshal(data, &analysis); err != nil {
+		return nil, fmt.Errorf("failed to decode analysis: %w", err)
+	}
+	if analysis.Topics == nil {
+		analysis.Topics = []string{}
+	}
+	if analysis.Entities == nil {
+		analysis.Entities = []Entity{}
+	}
+	analysis.Method = AnalysisMethodLLM
+	return &analysis, nil
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"likemind-backend/internal/models"
+)
+
+// APIKeyPrefix starts every API key so AuthMiddleware can tell keys from JWTs
+const APIKeyPrefix = "lmk_"
+
+const (
+	// apiKeyDisplayChars is how much of a key is kept to recognize it
+	apiKeyDisplayChars = len(APIKeyPrefix) + 8
+	// apiKeyTouchInterval bounds how often last-used tracking writes
+	apiKeyTouchInterval = time.Minute
+)
+
+// APIScopeResources are the route groups an API key scope can cover. Each
+// has a ":read" scope for reads and a ":write" scope that also allows reads.
+var APIScopeResources = []string{
+	"agents", "ai", "chat", "guardrails", "jobs", "knowledge", "prompts", "search", "users", "workspaces",
+}
+
+var (
+	// ErrAPIKeyNotFound is returned for unknown, revoked and other users' keys
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrInvalidAPIKey is returned when authenticating with an unknown,
+	// revoked or expired key
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrInvalidScope is returned for scopes outside APIScopeResources
+	ErrInvalidScope = errors.New("invalid scope")
+	// ErrInvalidExpiry is returned when a key's lifetime exceeds the limit
+	ErrInvalidExpiry = errors.New("invalid expiry")
+)
+
+// APIKeyRequest describes a key to create. ExpiresInDays defaults to the
+// longest allowed lifetime; WorkspaceID is the active workspace of requests
+// that send no X-Workspace-ID header.
+type APIKeyRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"`
+	WorkspaceID   uint     `json:"workspace_id"`
+}
+
+// ScopeAllows reports whether scopes cover reading, or with write
+// changing, resource
+func ScopeAllows(scopes []string, resource string, write bool) bool {
+	for _, scope := range scopes {
+		if scope == resource+":write" || (!write && scope == resource+":read") {
+			return true
+		}
+	}
+	return false
+}
+
+func validScope(scope string) bool {
+	resource, access, ok := strings.Cut(scope, ":")
+	if !ok || (access != "read" && access != "write") {
+		return false
+	}
+	for _, r := range APIScopeResources {
+		if r == resource {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyService manages personal API keys and authenticates requests made
+// with them
+type APIKeyService struct {
+	db     *gorm.DB
+	maxTTL time.Duration
+}
+
+func NewAPIKeyService(db *gorm.DB, maxTTL time.Duration) *APIKeyService {
+	return &APIKeyService{db: db, maxTTL: maxTTL}
+}
+
+// CreateAPIKey issues a key for userID. The key itself is only returned
+// here; afterwards it cannot be recovered.
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, userID uint, req APIKeyRequest) (*models.APIKey, string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, "", ErrNameRequired
+	}
+	if len(req.Scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	seen := make(map[string]bool, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !validScope(scope) {
+			return nil, "", fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	if req.ExpiresInDays < 0 {
+		return nil, "", fmt.Errorf("%w: expires_in_days must not be negative", ErrInvalidExpiry)
+	}
+	if s.maxTTL > 0 && ttl > s.maxTTL {
+		return nil, "", fmt.Errorf("%w: expires_in_days must be at most %d", ErrInvalidExpiry, int(s.maxTTL.Hours()/24))
+	}
+	if ttl == 0 {
+		ttl = s.maxTTL
+	}
+
+	if req.WorkspaceID != 0 {
+		if _, err := workspaceRole(ctx, s.db, req.WorkspaceID, userID); err != nil {
+			return nil, "", err
+		}
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	secret := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	key := &models.APIKey{
+		UserID:      userID,
+		Name:        name,
+		Prefix:      secret[:apiKeyDisplayChars],
+		KeyHash:     hashAPIKey(secret),
+		Scopes:      strings.Join(scopes, " "),
+		WorkspaceID: req.WorkspaceID,
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := s.db.WithContext(ctx).Create(key).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to save api key: %w", err)
+	}
+	key.ScopeList = scopes
+	return key, secret, nil
+}
+
+// ListAPIKeys returns userID's keys, newest first, including expired ones
+func (s *APIKeyService) ListAPIKeys(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	for i := range keys {
+		keys[i].ScopeList = strings.Fields(keys[i].Scopes)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey deletes one of userID's keys; requests using it fail at once
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, userID, keyID uint) error {
+	result := s.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.APIKey{}, keyID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke api key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate resolves a key to its record and owner and records its use
+func (s *APIKeyService) Authenticate(ctx context.Context, secret, clientIP string) (*models.APIKey, *models.User, error) {
+	var key models.APIKey
+	if err := s.db.WithContext(ctx).Where("key_hash = ?", hashAPIKey(secret)).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, fmt.Errorf("failed to load api key: %w", err)
+	}
+	user, err := s.keyOwner(ctx, &key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval || key.LastUsedIP != clientIP {
+		if err := s.db.WithContext(ctx).Model(&key).UpdateColumns(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": clientIP,
+		}).Error; err != nil {
+			log.Printf("api keys: failed to record use of key %d: %v", key.ID, err)
+		}
+	}
+	key.ScopeList = strings.Fields(key.Scopes)
+	return &key, user, nil
+}
+
+// CheckKey returns ErrInvalidAPIKey once a key has been revoked or has
+// expired and ErrAccountDisabled once its owner is deactivated. Connections
+// that outlive the request they authenticated with call it periodically.
+func (s *APIKeyService) CheckKey(ctx context.Context, keyID uint) error {
+	var key models.APIKey
+	if err := s.db.WithContext(ctx).First(&key, keyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidAPIKey
+		}
+		return fmt.Errorf("failed to load api key: %w", err)
+	}
+	_, err := s.keyOwner(ctx, &key)
+	return err
+}
+
+// keyOwner loads the owner of an unexpired key
+func (s *APIKeyService) keyOwner(ctx context.Context, key *models.APIKey) (*models.User, error) {
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		return nil, ErrInvalidAPIKey
+	}
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, key.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if !user.IsActive {
+		return nil, ErrAccountDisabled
+	}
+	return &user, nil
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
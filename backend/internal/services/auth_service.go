@@ -19,12 +19,18 @@ func NewAuthService(db *gorm.DB, jwtSecret string) *AuthService {
 	return &AuthService{db: db, jwtSecret: jwtSecret}
 }
 
-func (s *AuthService) GenerateToken(user *models.User) (string, error) {
+// GenerateToken signs a token for user. A non-zero workspaceID becomes the
+// token's active workspace.
+func (s *AuthService) GenerateToken(user *models.User, workspaceID uint) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": user.ID,
 		"email":   user.Email,
 		"role":    user.Role,
 		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+		"tv":      user.TokenVersion,
+	}
+	if workspaceID != 0 {
+		claims["workspace_id"] = workspaceID
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(s.jwtSecret))
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"likemind-backend/internal/models"
+)
+
+// Participant roles, from most to least privileged
+const (
+	ParticipantOwner  = "owner"
+	ParticipantEditor = "editor"
+	ParticipantViewer = "viewer"
+)
+
+var (
+	// ErrPermissionDenied is returned when a participant's role does not allow an action
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrInvalidRole is returned for unknown participant roles
+	ErrInvalidRole = errors.New("invalid participant role")
+	// ErrParticipantNotFound is returned when a user or participant does not exist
+	ErrParticipantNotFound = errors.New("participant not found")
+)
+
+// CanPrompt reports whether a participant role may send messages to the assistant
+func CanPrompt(role string) bool {
+	return role == ParticipantOwner || role == ParticipantEditor
+}
+
+// SessionRole resolves the role of userID in an active session. The session's
+// UserID is always the owner; everyone else needs a participant row. Users
+// who lost access to the session's workspace lose access to the session.
+func (s *ChatService) SessionRole(ctx context.Context, sessionID, userID uint) (string, error) {
+	var session models.ChatSession
+	if err := s.db.WithContext(ctx).
+		Where("id = ? AND is_active = ?", sessionID, true).
+		First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrSessionNotFound
+		}
+		return "", fmt.Errorf("failed to load session: %w", err)
+	}
+	if _, err := workspaceRole(ctx, s.db, session.WorkspaceID, userID); err != nil {
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			return "", ErrSessionNotFound
+		}
+		return "", err
+	}
+
+	if session.UserID == userID {
+		return ParticipantOwner, nil
+	}
+
+	var participant models.ChatParticipant
+	if err := s.db.WithContext(ctx).
+		Where("session_id = ? AND user_id = ?", sessionID, userID).
+		First(&participant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrSessionNotFound
+		}
+		return "", fmt.Errorf("failed to load participant: %w", err)
+	}
+
+	return participant.Role, nil
+}
+
+// GetParticipants lists the participants of a session visible to userID
+func (s *ChatService) GetParticipants(ctx context.Context, sessionID, userID uint) ([]models.ChatParticipant, error) {
+	if _, err := s.SessionRole(ctx, sessionID, userID); err != nil {
+		return nil, err
+	}
+
+	var participants []models.ChatParticipant
+	if err := s.db.WithContext(ctx).
+		Preload("User").
+		Where("session_id = ?", sessionID).
+		Order("created_at ASC").
+		Find(&participants).Error; err != nil {
+		return nil, fmt.Errorf("failed to get participants: %w", err)
+	}
+
+	return participants, nil
+}
+
+// SetParticipant adds a user to a session or changes their role. Only the owner
+// may manage participants, and ownership itself cannot be granted.
+func (s *ChatService) SetParticipant(ctx context.Context, sessionID, actorID, targetUserID uint, role string) (*models.ChatParticipant, error) {
+	if role != ParticipantEditor && role != ParticipantViewer {
+		return nil, ErrInvalidRole
+	}
+
+	if err := s.requireOwner(ctx, sessionID, actorID); err != nil {
+		return nil, err
+	}
+	if targetUserID == actorID {
+		return nil, ErrPermissionDenied
+	}
+	session, err := s.GetUserSession(ctx, sessionID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := workspaceRole(ctx, s.db, session.WorkspaceID, targetUserID); err != nil {
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			return nil, fmt.Errorf("%w: user has no access to the session's workspace", ErrParticipantNotFound)
+		}
+		return nil, err
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, targetUserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrParticipantNotFound
+		}
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	participant := models.ChatParticipant{SessionID: sessionID, UserID: targetUserID}
+	if err := s.db.WithContext(ctx).
+		Where(&participant).
+		Assign(models.ChatParticipant{Role: role}).
+		FirstOrCreate(&participant).Error; err != nil {
+		return nil, fmt.Errorf("failed to save participant: %w", err)
+	}
+	participant.User = user
+
+	s.publish(ctx, Event{Type: EventParticipantUpdated, UserID: targetUserID, SessionID: sessionID, Data: participant})
+
+	return &participant, nil
+}
+
+// RemoveParticipant revokes a user's access to a session. Owners may remove
+// anyone; other participants may only remove themselves.
+func (s *ChatService) RemoveParticipant(ctx context.Context, sessionID, actorID, targetUserID uint) error {
+	if actorID != targetUserID {
+		if err := s.requireOwner(ctx, sessionID, actorID); err != nil {
+			return err
+		}
+	}
+
+	result := s.db.WithContext(ctx).Unscoped().
+		Where("session_id = ? AND user_id = ?", sessionID, targetUserID).
+		Delete(&models.ChatParticipant{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove participant: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrParticipantNotFound
+	}
+
+	s.publish(ctx, Event{Type: EventParticipantRemoved, UserID: targetUserID, SessionID: sessionID, Data: map[string]uint{"user_id": targetUserID}})
+
+	return nil
+}
+
+func (s *ChatService) requireOwner(ctx context.Context, sessionID, userID uint) error {
+	role, err := s.SessionRole(ctx, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if role != ParticipantOwner {
+		return ErrPermissionDenied
+	}
+	return nil
+}
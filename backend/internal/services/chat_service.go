@@ -2,7 +2,12 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -12,36 +17,86 @@ import (
 	"likemind-backend/internal/models"
 )
 
+var (
+	// ErrSessionNotFound is returned when a session does not exist or belongs to another user
+	ErrSessionNotFound = errors.New("session not found or access denied")
+	// ErrShareLinkNotFound is returned for unknown, revoked or expired share tokens
+	ErrShareLinkNotFound = errors.New("share link not found")
+)
+
 type ChatService struct {
 	aiService   *AIService
 	redisClient *redis.Client
 	db          *gorm.DB
+	events      EventPublisher
+	prompts     *PromptService
 }
 
-func NewChatService(aiService *AIService, redisClient *redis.Client) *ChatService {
+func NewChatService(db *gorm.DB, aiService *AIService, redisClient *redis.Client, events EventPublisher, prompts *PromptService) *ChatService {
 	return &ChatService{
 		aiService:   aiService,
 		redisClient: redisClient,
+		db:          db,
+		events:      events,
+		prompts:     prompts,
 	}
 }
 
-func (s *ChatService) CreateSession(ctx context.Context, userID uint, title string) (*models.ChatSession, error) {
+// CreateSession starts a session in a workspace, optionally with a system
+// prompt rendered from a template on every reply
+func (s *ChatService) CreateSession(ctx context.Context, workspaceID, userID uint, title string, prompt *PromptRef) (*models.ChatSession, error) {
 	session := &models.ChatSession{
-		UserID:   userID,
-		Title:    title,
-		IsActive: true,
+		UserID:      userID,
+		WorkspaceID: workspaceID,
+		Title:       title,
+		IsActive:    true,
+	}
+	if prompt != nil && prompt.Name != "" {
+		// Fail now rather than on the first message
+		if _, err := s.prompts.Render(ctx, *prompt); err != nil {
+			return nil, err
+		}
+		session.PromptName = prompt.Name
+		session.PromptVersion = prompt.Version
+		if len(prompt.Variables) > 0 {
+			data, err := json.Marshal(prompt.Variables)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal prompt variables: %w", err)
+			}
+			session.PromptVariables = string(data)
+		}
 	}
 
 	if err := s.db.Create(session).Error; err != nil {
 		return nil, fmt.Errorf("failed to create chat session: %w", err)
 	}
 
+	s.publish(ctx, Event{Type: EventSessionUpdated, UserID: userID, SessionID: session.ID, Data: session})
+
 	return session, nil
 }
 
-func (s *ChatService) GetUserSessions(ctx context.Context, userID uint) ([]models.ChatSession, error) {
+// GetUserSession returns an active session if it belongs to userID
+func (s *ChatService) GetUserSession(ctx context.Context, sessionID, userID uint) (*models.ChatSession, error) {
+	var session models.ChatSession
+	if err := s.db.WithContext(ctx).
+		Where("id = ? AND user_id = ? AND is_active = ?", sessionID, userID, true).
+		First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// GetUserSessions returns the workspace's sessions userID owns or takes part in
+func (s *ChatService) GetUserSessions(ctx context.Context, workspaceID, userID uint) ([]models.ChatSession, error) {
 	var sessions []models.ChatSession
-	if err := s.db.Where("user_id = ? AND is_active = ?", userID, true).
+	if err := s.db.Where("is_active = ? AND workspace_id = ?", true, workspaceID).
+		Where("user_id = ? OR id IN (?)", userID,
+			s.db.Model(&models.ChatParticipant{}).Select("session_id").Where("user_id = ?", userID)).
 		Order("updated_at DESC").
 		Find(&sessions).Error; err != nil {
 		return nil, fmt.Errorf("failed to get user sessions: %w", err)
@@ -61,17 +116,52 @@ func (s *ChatService) GetSessionMessages(ctx context.Context, sessionID uint) ([
 	return messages, nil
 }
 
-func (s *ChatService) SendMessage(ctx context.Context, sessionID uint, userMessage string) (*models.ChatMessage, error) {
+// SendMessage stores a message from userID and generates the assistant reply.
+// Viewers can read a session but may not prompt the assistant.
+func (s *ChatService) SendMessage(ctx context.Context, sessionID, userID uint, userMessage string) (*models.ChatMessage, error) {
+	role, err := s.SessionRole(ctx, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !CanPrompt(role) {
+		return nil, ErrPermissionDenied
+	}
+
+	// Render the session prompt first so a broken template rejects the message
+	system, err := s.sessionSystemMessage(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replies depend on the session history, so cached ones are only
+	// reused for the same user in the session's workspace
+	var session models.ChatSession
+	if err := s.db.WithContext(ctx).Select("workspace_id").First(&session, sessionID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	cacheScope := CacheScope{WorkspaceID: session.WorkspaceID, UserID: userID}
+
+	// Screen before storing so that blocked text is never saved or shown
+	// to participants, and redacted text is saved redacted
+	genCtx := WithGuardrailSubject(WithCacheRoute(ctx, CacheRouteChat, cacheScope), userID, sessionID)
+	input, err := s.aiService.screenMessage(genCtx, userMessage)
+	if err != nil {
+		return nil, err
+	}
+	genCtx = withScreenedInput(genCtx, input)
+
 	// Create user message
 	userMsg := &models.ChatMessage{
 		SessionID: sessionID,
+		UserID:    &userID,
 		Role:      "user",
-		Content:   userMessage,
+		Content:   input.Text,
 	}
 
 	if err := s.db.Create(userMsg).Error; err != nil {
 		return nil, fmt.Errorf("failed to save user message: %w", err)
 	}
+	s.publish(ctx, Event{Type: EventMessageCreated, SessionID: sessionID, Data: userMsg})
 
 	// Get conversation history
 	messages, err := s.GetSessionMessages(ctx, sessionID)
@@ -79,8 +169,20 @@ func (s *ChatService) SendMessage(ctx context.Context, sessionID uint, userMessa
 		return nil, fmt.Errorf("failed to get conversation history: %w", err)
 	}
 
-	// Generate AI response
-	aiResponse, err := s.aiService.GenerateResponse(ctx, messages)
+	prompt := messages
+	if system != nil {
+		prompt = append([]models.ChatMessage{*system}, messages...)
+	}
+
+	// Generate AI response, streaming deltas to subscribers when possible
+	var aiResponse *models.ChatMessage
+	if s.events != nil {
+		aiResponse, err = s.aiService.GenerateResponseStream(genCtx, prompt, func(delta string) {
+			s.publish(ctx, Event{Type: EventGenerationDelta, SessionID: sessionID, Data: map[string]string{"content": delta}})
+		})
+	} else {
+		aiResponse, err = s.aiService.GenerateResponse(genCtx, prompt)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate AI response: %w", err)
 	}
@@ -90,6 +192,7 @@ func (s *ChatService) SendMessage(ctx context.Context, sessionID uint, userMessa
 	if err := s.db.Create(aiResponse).Error; err != nil {
 		return nil, fmt.Errorf("failed to save AI response: %w", err)
 	}
+	s.publish(ctx, Event{Type: EventMessageCreated, SessionID: sessionID, Data: aiResponse})
 
 	// Cache recent conversation in Redis
 	s.cacheConversation(ctx, sessionID, messages)
@@ -97,6 +200,30 @@ func (s *ChatService) SendMessage(ctx context.Context, sessionID uint, userMessa
 	return aiResponse, nil
 }
 
+// sessionSystemMessage renders the session's prompt template, if it has one
+func (s *ChatService) sessionSystemMessage(ctx context.Context, sessionID uint) (*models.ChatMessage, error) {
+	var session models.ChatSession
+	if err := s.db.WithContext(ctx).Select("prompt_name", "prompt_version", "prompt_variables").
+		First(&session, sessionID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	if session.PromptName == "" {
+		return nil, nil
+	}
+
+	ref := &PromptRef{Name: session.PromptName, Version: session.PromptVersion}
+	if session.PromptVariables != "" {
+		if err := json.Unmarshal([]byte(session.PromptVariables), &ref.Variables); err != nil {
+			return nil, fmt.Errorf("failed to decode prompt variables: %w", err)
+		}
+	}
+	system, err := s.prompts.SystemMessage(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render session prompt: %w", err)
+	}
+	return system, nil
+}
+
 func (s *ChatService) cacheConversation(ctx context.Context, sessionID uint, messages []models.ChatMessage) {
 	cacheKey := fmt.Sprintf("chat:session:%d", sessionID)
 	
@@ -145,5 +272,142 @@ func (s *ChatService) DeleteSession(ctx context.Context, sessionID uint, userID
 	cacheKey := fmt.Sprintf("chat:session:%d", sessionID)
 	s.redisClient.Del(ctx, cacheKey)
 
+	s.publish(ctx, Event{Type: EventSessionUpdated, UserID: userID, SessionID: sessionID, Data: map[string]interface{}{"id": sessionID, "is_active": false}})
+
+	return nil
+}
+
+// publish delivers an event on a best-effort basis; chat operations never fail
+// because a subscriber could not be notified
+func (s *ChatService) publish(ctx context.Context, event Event) {
+	if s.events == nil {
+		return
+	}
+	_ = s.events.Publish(ctx, event)
+}
+
+// SharedMessage is a chat message stripped of any user identity
+type SharedMessage struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SharedSession is the public, read-only view of a shared chat session
+type SharedSession struct {
+	Title     string          `json:"title"`
+	SharedAt  time.Time       `json:"shared_at"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+	Messages  []SharedMessage `json:"messages"`
+}
+
+// CreateShareLink mints a new share token for a session owned by userID.
+// The raw token is only returned here; the database stores its hash.
+func (s *ChatService) CreateShareLink(ctx context.Context, sessionID, userID uint, ttl time.Duration) (*models.ChatShareLink, string, error) {
+	if _, err := s.GetUserSession(ctx, sessionID, userID); err != nil {
+		return nil, "", err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	link := &models.ChatShareLink{
+		SessionID: sessionID,
+		CreatedBy: userID,
+		TokenHash: hashShareToken(token),
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		link.ExpiresAt = &expiresAt
+	}
+
+	if err := s.db.WithContext(ctx).Create(link).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	return link, token, nil
+}
+
+// GetShareLinks lists the active share links of a session owned by userID
+func (s *ChatService) GetShareLinks(ctx context.Context, sessionID, userID uint) ([]models.ChatShareLink, error) {
+	var links []models.ChatShareLink
+	if err := s.db.WithContext(ctx).
+		Where("session_id = ? AND created_by = ? AND revoked_at IS NULL", sessionID, userID).
+		Order("created_at DESC").
+		Find(&links).Error; err != nil {
+		return nil, fmt.Errorf("failed to get share links: %w", err)
+	}
+
+	return links, nil
+}
+
+// RevokeShareLink disables a share link immediately
+func (s *ChatService) RevokeShareLink(ctx context.Context, sessionID, linkID, userID uint) error {
+	result := s.db.WithContext(ctx).Model(&models.ChatShareLink{}).
+		Where("id = ? AND session_id = ? AND created_by = ? AND revoked_at IS NULL", linkID, sessionID, userID).
+		Update("revoked_at", time.Now())
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke share link: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrShareLinkNotFound
+	}
+
 	return nil
 }
+
+// GetSharedSession resolves a share token to a snapshot of the session as it
+// was when the link was created. Revocation and expiry are checked on every call.
+func (s *ChatService) GetSharedSession(ctx context.Context, token string) (*SharedSession, error) {
+	var link models.ChatShareLink
+	if err := s.db.WithContext(ctx).
+		Preload("Session").
+		Where("token_hash = ? AND revoked_at IS NULL", hashShareToken(token)).
+		First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShareLinkNotFound
+		}
+		return nil, fmt.Errorf("failed to load share link: %w", err)
+	}
+
+	if link.ExpiresAt != nil && time.Now().After(*link.ExpiresAt) {
+		return nil, ErrShareLinkNotFound
+	}
+	if !link.Session.IsActive {
+		return nil, ErrShareLinkNotFound
+	}
+
+	var messages []models.ChatMessage
+	if err := s.db.WithContext(ctx).
+		Where("session_id = ? AND created_at <= ? AND role <> ?", link.SessionID, link.CreatedAt, "system").
+		Order("created_at ASC").
+		Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to get shared messages: %w", err)
+	}
+
+	shared := &SharedSession{
+		Title:     link.Session.Title,
+		SharedAt:  link.CreatedAt,
+		ExpiresAt: link.ExpiresAt,
+		Messages:  make([]SharedMessage, len(messages)),
+	}
+	for i, msg := range messages {
+		shared.Messages[i] = SharedMessage{
+			Role:      msg.Role,
+			Content:   msg.Content,
+			CreatedAt: msg.CreatedAt,
+		}
+	}
+
+	return shared, nil
+}
+
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,483 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"likemind-backend/internal/chunking"
+	"likemind-backend/internal/crawl"
+	"likemind-backend/internal/extract"
+	"likemind-backend/internal/jobs"
+	"likemind-backend/internal/models"
+)
+
+// JobTypeCrawlSource fetches a tracked web source and updates its document
+const JobTypeCrawlSource = "knowledge.crawl"
+
+// crawlLockTTL bounds how long a replica holds a source while scheduling it
+const crawlLockTTL = time.Minute
+
+var (
+	// ErrSourceNotFound is returned when a web source does not exist or
+	// belongs to another workspace or an unreadable collection
+	ErrSourceNotFound = errors.New("web source not found")
+	// ErrSourceInOtherCollection is returned when adding a URL the user
+	// already tracks in a different collection of the workspace
+	ErrSourceInOtherCollection = errors.New("url is already tracked in another collection")
+)
+
+// CrawlOptions configures URL ingestion
+type CrawlOptions struct {
+	RecrawlInterval time.Duration // default for new sources; 0 disables re-crawling
+	MaxSitemapURLs  int
+	Chunking        chunking.Config
+}
+
+// AddURLResult describes what AddURL did: a page is ingested immediately,
+// while every page of a sitemap is queued as a crawl job
+type AddURLResult struct {
+	Source   *models.WebSource         `json:"source,omitempty"`
+	Document *models.KnowledgeDocument `json:"document,omitempty"`
+	Sources  []models.WebSource        `json:"sources,omitempty"`
+	JobIDs   []string                  `json:"job_ids,omitempty"`
+}
+
+// CrawlService ingests web pages into the knowledge base and keeps them fresh
+type CrawlService struct {
+	db          *gorm.DB
+	redisClient *redis.Client
+	jobs        *jobs.Queue
+	fetcher     *crawl.Fetcher
+	opts        CrawlOptions
+}
+
+func NewCrawlService(db *gorm.DB, redisClient *redis.Client, queue *jobs.Queue, fetcher *crawl.Fetcher, opts CrawlOptions) *CrawlService {
+	if opts.MaxSitemapURLs <= 0 {
+		opts.MaxSitemapURLs = 200
+	}
+	s := &CrawlService{
+		db:          db,
+		redisClient: redisClient,
+		jobs:        queue,
+		fetcher:     fetcher,
+		opts:        opts,
+	}
+	queue.Register(JobTypeCrawlSource, jobs.Handle(s.crawlSource))
+	return s
+}
+
+// AddURL fetches rawURL into a workspace collection; collection 0 is the
+// workspace's default collection. An HTML, text or PDF page is stored as a
+// document right away; a sitemap registers each listed page and queues it
+// for crawling. recrawlInterval overrides the default when not nil.
+func (s *CrawlService) AddURL(ctx context.Context, workspaceID, userID, collectionID uint, rawURL string, recrawlInterval *time.Duration) (*AddURLResult, error) {
+	normalized, err := crawl.NormalizeURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	collection, err := writableCollection(ctx, s.db, workspaceID, collectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	target := sourceTarget{WorkspaceID: workspaceID, CollectionID: collection.ID, UserID: userID}
+	interval := s.opts.RecrawlInterval
+	if recrawlInterval != nil {
+		interval = *recrawlInterval
+	}
+
+	result, err := s.fetcher.Fetch(ctx, normalized, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if crawl.IsSitemap(result.Body) {
+		return s.addSitemap(ctx, target, normalized, result.Body, interval)
+	}
+
+	source, err := s.upsertSource(ctx, target, normalized, "", interval)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := s.applyFetch(ctx, source, result)
+	if err != nil {
+		return nil, err
+	}
+	return &AddURLResult{Source: source, Document: doc}, nil
+}
+
+// sourceTarget is where AddURL stores new web sources
+type sourceTarget struct {
+	WorkspaceID  uint
+	CollectionID uint
+	UserID       uint
+}
+
+func (s *CrawlService) addSitemap(ctx context.Context, target sourceTarget, sitemapURL string, body []byte, interval time.Duration) (*AddURLResult, error) {
+	urls, err := s.fetcher.PageURLs(ctx, body, s.opts.MaxSitemapURLs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AddURLResult{Sources: []models.WebSource{}, JobIDs: []string{}}
+	for _, pageURL := range urls {
+		source, err := s.upsertSource(ctx, target, pageURL, sitemapURL, interval)
+		// Pages already tracked in another collection stay there
+		if errors.Is(err, ErrSourceInOtherCollection) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		job, err := s.jobs.Enqueue(ctx, JobTypeCrawlSource, crawlPayload{SourceID: source.ID}, jobs.WithUserID(target.UserID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to enqueue crawl: %w", err)
+		}
+		result.Sources = append(result.Sources, *source)
+		result.JobIDs = append(result.JobIDs, job.ID)
+	}
+	return result, nil
+}
+
+// upsertSource returns the user's tracked source for pageURL in the
+// workspace, creating it in the target collection if needed. A user tracks a
+// URL in at most one collection per workspace; sources of other users are
+// never returned.
+func (s *CrawlService) upsertSource(ctx context.Context, target sourceTarget, pageURL, sitemapURL string, interval time.Duration) (*models.WebSource, error) {
+	source := models.WebSource{
+		URL:             pageURL,
+		WorkspaceID:     target.WorkspaceID,
+		CollectionID:    target.CollectionID,
+		CreatedBy:       target.UserID,
+		SitemapURL:      sitemapURL,
+		RecrawlInterval: int(interval / time.Second),
+	}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(models.WebSource{URL: pageURL, WorkspaceID: target.WorkspaceID, CreatedBy: target.UserID}).
+			FirstOrCreate(&source).Error; err != nil {
+			return fmt.Errorf("failed to save web source: %w", err)
+		}
+		if source.CollectionID != target.CollectionID {
+			return ErrSourceInOtherCollection
+		}
+		if err := tx.Model(&source).Update("recrawl_interval", int(interval/time.Second)).Error; err != nil {
+			return fmt.Errorf("failed to save web source: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+// ListSources returns the web sources of a workspace in collections userID
+// can read
+func (s *CrawlService) ListSources(ctx context.Context, workspaceID, userID uint) ([]models.WebSource, error) {
+	var sources []models.WebSource
+	if err := s.db.WithContext(ctx).
+		Where("workspace_id = ? AND collection_id IN (?)", workspaceID, readableCollections(s.db, userID)).
+		Order("created_at DESC").
+		Find(&sources).Error; err != nil {
+		return nil, fmt.Errorf("failed to list web sources: %w", err)
+	}
+	return sources, nil
+}
+
+// DeleteSource stops tracking a URL of a collection userID can write to.
+// The document it produced is kept.
+func (s *CrawlService) DeleteSource(ctx context.Context, workspaceID, userID, sourceID uint) error {
+	var source models.WebSource
+	if err := s.db.WithContext(ctx).
+		Where("id = ? AND workspace_id = ? AND collection_id IN (?)", sourceID, workspaceID, readableCollections(s.db, userID)).
+		First(&source).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSourceNotFound
+		}
+		return fmt.Errorf("failed to load web source: %w", err)
+	}
+	if _, err := writableCollection(ctx, s.db, workspaceID, source.CollectionID, userID); err != nil {
+		return err
+	}
+	if err := s.db.WithContext(ctx).Unscoped().Delete(&source).Error; err != nil {
+		return fmt.Errorf("failed to delete web source: %w", err)
+	}
+	return nil
+}
+
+// RunRecrawler queues due sources for re-fetching until ctx is cancelled.
+// Every replica runs it; a Redis lock per source prevents double queueing.
+func (s *CrawlService) RunRecrawler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.queueDueSources(ctx); err != nil {
+				log.Printf("crawl: recrawl tick failed: %v", err)
+			}
+		}
+	}
+}
+
+func (s *CrawlService) queueDueSources(ctx context.Context) error {
+	var due []models.WebSource
+	if err := s.db.WithContext(ctx).
+		Where("recrawl_interval > 0 AND next_fetch_at <= ?", time.Now()).
+		Find(&due).Error; err != nil {
+		return fmt.Errorf("failed to load due web sources: %w", err)
+	}
+
+	for _, source := range due {
+		if err := s.queueSource(ctx, source.ID); err != nil {
+			log.Printf("crawl: failed to queue source %d: %v", source.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *CrawlService) queueSource(ctx context.Context, sourceID uint) error {
+	release, ok := acquireLock(ctx, s.redisClient, fmt.Sprintf("crawl:source:%d:lock", sourceID), crawlLockTTL)
+	if !ok {
+		return nil
+	}
+	defer release()
+
+	// Reload under the lock; another replica may already have queued it
+	var source models.WebSource
+	if err := s.db.WithContext(ctx).First(&source, sourceID).Error; err != nil {
+		return fmt.Errorf("failed to reload web source: %w", err)
+	}
+	if source.NextFetchAt == nil || source.NextFetchAt.After(time.Now()) {
+		return nil
+	}
+
+	// Push the next check out before queueing so the source is not picked
+	// up again while the job waits; the job reschedules it when it finishes
+	next := time.Now().Add(time.Duration(source.RecrawlInterval) * time.Second)
+	if err := s.db.WithContext(ctx).Model(&source).Update("next_fetch_at", next).Error; err != nil {
+		return fmt.Errorf("failed to reschedule web source: %w", err)
+	}
+
+	_, err := s.jobs.Enqueue(ctx, JobTypeCrawlSource, crawlPayload{SourceID: source.ID}, jobs.WithUserID(source.CreatedBy))
+	return err
+}
+
+type crawlPayload struct {
+	SourceID uint `json:"source_id"`
+}
+
+// crawlSource is the job handler that re-fetches a source conditionally
+func (s *CrawlService) crawlSource(ctx context.Context, payload crawlPayload) error {
+	var source models.WebSource
+	if err := s.db.WithContext(ctx).First(&source, payload.SourceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(fmt.Errorf("web source %d not found", payload.SourceID))
+		}
+		return err
+	}
+
+	// Only send validators when the document still exists
+	etag, lastModified := source.ETag, source.LastModified
+	if source.DocumentID == nil {
+		etag, lastModified = "", ""
+	}
+
+	result, err := s.fetcher.Fetch(ctx, source.URL, etag, lastModified)
+	if err != nil {
+		s.recordFailure(ctx, &source, err)
+		if permanentCrawlError(err) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+
+	if _, err := s.applyFetch(ctx, &source, result); err != nil {
+		if errors.Is(err, extract.ErrUnsupportedType) || errors.Is(err, extract.ErrNoText) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// applyFetch stores a fetch result. The document is only rewritten, chunked
+// and queued for embedding when its extracted text changed.
+func (s *CrawlService) applyFetch(ctx context.Context, source *models.WebSource, result *crawl.Result) (*models.KnowledgeDocument, error) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"last_fetched_at": now,
+		"last_status":     result.StatusCode,
+		"last_error":      "",
+		"next_fetch_at":   nextFetch(source, now),
+	}
+
+	if result.NotModified {
+		if err := s.db.WithContext(ctx).Model(source).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to update web source: %w", err)
+		}
+		return s.sourceDocument(ctx, source)
+	}
+
+	extracted, err := extract.Extract(pageName(result.URL), result.Body, s.fetcher.MaxBytes())
+	if err != nil {
+		s.recordFailure(ctx, source, err)
+		return nil, err
+	}
+	hash := contentHash(extracted.Title, extracted.Text)
+	updates["etag"] = result.ETag
+	updates["last_modified"] = result.LastModified
+
+	existing, err := s.sourceDocument(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && hash == source.ContentHash {
+		if err := s.db.WithContext(ctx).Model(source).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to update web source: %w", err)
+		}
+		return existing, nil
+	}
+
+	metadata, err := json.Marshal(DocumentMetadata{
+		URL:        source.URL,
+		MIME:       extracted.MIME,
+		Size:       len(result.Body),
+		UploadedBy: source.CreatedBy,
+		Sections:   extracted.Sections,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal document metadata: %w", err)
+	}
+
+	var doc *models.KnowledgeDocument
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if existing == nil {
+			doc = &models.KnowledgeDocument{
+				Title:        extracted.Title,
+				Content:      extracted.Text,
+				Source:       source.URL,
+				DocumentType: extracted.Type,
+				Metadata:     string(metadata),
+				WorkspaceID:  source.WorkspaceID,
+				CreatedBy:    source.CreatedBy,
+				CollectionID: source.CollectionID,
+			}
+			if err := tx.Create(doc).Error; err != nil {
+				return fmt.Errorf("failed to save document: %w", err)
+			}
+		} else {
+			doc = existing
+			if err := tx.Model(doc).Updates(map[string]interface{}{
+				"title":         extracted.Title,
+				"content":       extracted.Text,
+				"document_type": extracted.Type,
+				"metadata":      string(metadata),
+				"embedding_id":  "",
+			}).Error; err != nil {
+				return fmt.Errorf("failed to update document: %w", err)
+			}
+			doc.Content = extracted.Text
+			doc.DocumentType = extracted.Type
+		}
+		if err := replaceChunks(tx, doc, s.opts.Chunking); err != nil {
+			return err
+		}
+
+		updates["document_id"] = doc.ID
+		updates["content_hash"] = hash
+		updates["last_changed_at"] = now
+		if err := tx.Model(source).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update web source: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Re-embed only now that the text actually changed
+	if _, err := s.jobs.Enqueue(ctx, JobTypeIndexDocuments, indexPayload{DocumentIDs: []uint{doc.ID}}, jobs.WithUserID(source.CreatedBy)); err != nil {
+		log.Printf("crawl: failed to queue indexing of document %d: %v", doc.ID, err)
+	}
+	return doc, nil
+}
+
+// sourceDocument returns the source's document, or nil if it was deleted
+func (s *CrawlService) sourceDocument(ctx context.Context, source *models.WebSource) (*models.KnowledgeDocument, error) {
+	if source.DocumentID == nil {
+		return nil, nil
+	}
+	var doc models.KnowledgeDocument
+	if err := s.db.WithContext(ctx).First(&doc, *source.DocumentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load document: %w", err)
+	}
+	return &doc, nil
+}
+
+func (s *CrawlService) recordFailure(ctx context.Context, source *models.WebSource, fetchErr error) {
+	updates := map[string]interface{}{
+		"last_fetched_at": time.Now(),
+		"last_error":      fetchErr.Error(),
+		"next_fetch_at":   nextFetch(source, time.Now()),
+	}
+	var httpErr *crawl.HTTPError
+	if errors.As(fetchErr, &httpErr) {
+		updates["last_status"] = httpErr.StatusCode
+	}
+	s.db.WithContext(ctx).Model(source).Updates(updates)
+}
+
+// permanentCrawlError reports whether retrying a fetch cannot help
+func permanentCrawlError(err error) bool {
+	var httpErr *crawl.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 400 && httpErr.StatusCode < 500 && httpErr.StatusCode != 429
+	}
+	return errors.Is(err, crawl.ErrDisallowed) ||
+		errors.Is(err, crawl.ErrTooLarge) ||
+		errors.Is(err, crawl.ErrInvalidURL) ||
+		errors.Is(err, crawl.ErrPrivateAddress)
+}
+
+func nextFetch(source *models.WebSource, now time.Time) interface{} {
+	if source.RecrawlInterval <= 0 {
+		return nil
+	}
+	return now.Add(time.Duration(source.RecrawlInterval) * time.Second)
+}
+
+// pageName derives a filename-like name from a URL for type detection and
+// as a title fallback
+func pageName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return u.Host
+	}
+	return name
+}
+
+func contentHash(title, text string) string {
+	sum := sha256.Sum256([]byte(title + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
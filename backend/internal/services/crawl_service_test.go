@@ -0,0 +1,55 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"likemind-backend/internal/crawl"
+	"likemind-backend/internal/models"
+)
+
+func TestPermanentCrawlError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&crawl.HTTPError{StatusCode: 404}, true},
+		{&crawl.HTTPError{StatusCode: 410}, true},
+		{&crawl.HTTPError{StatusCode: 429}, false},
+		{&crawl.HTTPError{StatusCode: 503}, false},
+		{crawl.ErrDisallowed, true},
+		{crawl.ErrTooLarge, true},
+		{crawl.ErrPrivateAddress, true},
+		{fmt.Errorf("%w: bad", crawl.ErrInvalidURL), true},
+		{fmt.Errorf("%w http://example.com/: %w", crawl.ErrFetchFailed, errors.New("connection refused")), false},
+	} {
+		if got := permanentCrawlError(tc.err); got != tc.want {
+			t.Errorf("permanentCrawlError(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestNextFetch(t *testing.T) {
+	now := time.Date(2024, 9, 9, 12, 0, 0, 0, time.UTC)
+	if got := nextFetch(&models.WebSource{RecrawlInterval: 0}, now); got != nil {
+		t.Errorf("nextFetch without an interval = %v, want nil", got)
+	}
+	want := now.Add(time.Hour)
+	if got, ok := nextFetch(&models.WebSource{RecrawlInterval: 3600}, now).(time.Time); !ok || !got.Equal(want) {
+		t.Errorf("nextFetch with an hourly interval = %v, want %v", got, want)
+	}
+}
+
+func TestPageName(t *testing.T) {
+	for raw, want := range map[string]string{
+		"https://example.com/":             "example.com",
+		"https://example.com/docs/a.pdf":   "a.pdf",
+		"https://example.com/docs/?page=2": "docs",
+	} {
+		if got := pageName(raw); got != want {
+			t.Errorf("pageName(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
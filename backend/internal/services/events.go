@@ -0,0 +1,29 @@
+package services
+
+import "context"
+
+// Event types delivered to WebSocket subscribers
+const (
+	EventMessageCreated  = "message.created"
+	EventGenerationDelta = "generation.delta"
+	EventSessionUpdated  = "session.updated"
+
+	EventParticipantUpdated = "participant.updated"
+	EventParticipantRemoved = "participant.removed"
+	EventPresence           = "presence.updated"
+	EventTyping             = "typing"
+)
+
+// Event is a real-time notification routed to the connections of a user,
+// the subscribers of a session, or both
+type Event struct {
+	Type      string      `json:"type"`
+	UserID    uint        `json:"user_id,omitempty"`
+	SessionID uint        `json:"session_id,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// EventPublisher fans events out to connected clients
+type EventPublisher interface {
+	Publish(ctx context.Context, event Event) error
+}
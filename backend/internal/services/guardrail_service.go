@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"likemind-backend/internal/guardrails"
+	"likemind-backend/internal/models"
+	"likemind-backend/internal/pii"
+)
+
+var (
+	// ErrInputBlocked is returned when a guardrail blocks the user's message
+	ErrInputBlocked = errors.New("message blocked by content guardrails")
+	// ErrOutputBlocked is returned when a guardrail blocks the model's reply
+	ErrOutputBlocked = errors.New("response withheld by content guardrails")
+	// ErrViolationNotFound is returned for unknown violation IDs
+	ErrViolationNotFound = errors.New("guardrail violation not found")
+	// ErrInvalidReviewStatus is returned for review statuses other than
+	// confirmed or dismissed
+	ErrInvalidReviewStatus = errors.New("status must be confirmed or dismissed")
+)
+
+// Review statuses of a stored violation
+const (
+	ViolationPending   = "pending"
+	ViolationConfirmed = "confirmed"
+	ViolationDismissed = "dismissed"
+)
+
+const violationExcerptSize = 500
+
+// GuardrailError is returned when a check with the block action fires
+type GuardrailError struct {
+	Stage      guardrails.Stage       `json:"stage"`
+	Violations []guardrails.Violation `json:"violations"`
+}
+
+func (e *GuardrailError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		if v.Action == guardrails.Block {
+			rules = append(rules, v.Check+": "+v.Message)
+		}
+	}
+	return fmt.Sprintf("%v (%s)", e.Unwrap(), strings.Join(rules, "; "))
+}
+
+func (e *GuardrailError) Unwrap() error {
+	if e.Stage == guardrails.Output {
+		return ErrOutputBlocked
+	}
+	return ErrInputBlocked
+}
+
+// ViolationFilter narrows a violation listing; zero values match everything
+type ViolationFilter struct {
+	Status string
+	Stage  string
+	Check  string
+	UserID uint
+	Limit  int
+	Offset int
+}
+
+// GuardrailService screens model input and output and keeps the
+// violations for review
+type GuardrailService struct {
+	db       *gorm.DB
+	pipeline *guardrails.Pipeline
+}
+
+func NewGuardrailService(db *gorm.DB, pipeline *guardrails.Pipeline) *GuardrailService {
+	return &GuardrailService{db: db, pipeline: pipeline}
+}
+
+// Enabled reports whether any checks are configured
+func (s *GuardrailService) Enabled() bool {
+	return s != nil && s.pipeline.Enabled()
+}
+
+type guardrailSubjectKey struct{}
+
+type guardrailSubject struct {
+	userID, sessionID uint
+}
+
+// WithGuardrailSubject attributes violations found in generation requests
+// made with ctx to a user and, if not zero, a chat session
+func WithGuardrailSubject(ctx context.Context, userID, sessionID uint) context.Context {
+	return context.WithValue(ctx, guardrailSubjectKey{}, guardrailSubject{userID: userID, sessionID: sessionID})
+}
+
+// Screen runs the pipeline over text and records any violations. The
+// result's text has redactions applied; a blocked text returns a
+// *GuardrailError.
+func (s *GuardrailService) Screen(ctx context.Context, stage guardrails.Stage, text string) (*guardrails.Result, error) {
+	if !s.Enabled() {
+		return &guardrails.Result{Text: text}, nil
+	}
+	result := s.pipeline.Run(ctx, stage, text)
+	if len(result.Violations) > 0 {
+		s.record(ctx, stage, text, result.Violations)
+	}
+	if result.Blocked {
+		return nil, &GuardrailError{Stage: stage, Violations: result.Violations}
+	}
+	return result, nil
+}
+
+func (s *GuardrailService) record(ctx context.Context, stage guardrails.Stage, text string, violations []guardrails.Violation) {
+	subject, _ := ctx.Value(guardrailSubjectKey{}).(guardrailSubject)
+	rows := make([]models.GuardrailViolation, len(violations))
+	for i, v := range violations {
+		rows[i] = models.GuardrailViolation{
+			Route:     requestRoute(ctx),
+			Stage:     string(stage),
+			CheckName: v.Check,
+			Rule:      v.Rule,
+			Message:   v.Message,
+			Action:    string(v.Action),
+			Excerpt:   violationExcerpt(text, v),
+			Status:    ViolationPending,
+		}
+		if subject.userID != 0 {
+			rows[i].UserID = &subject.userID
+		}
+		if subject.sessionID != 0 {
+			rows[i].SessionID = &subject.sessionID
+		}
+	}
+	// Recording must not depend on the caller's request surviving
+	if err := s.db.WithContext(context.WithoutCancel(ctx)).Create(&rows).Error; err != nil {
+		log.Printf("guardrails: failed to record violations: %v", err)
+	}
+}
+
+// violationExcerpt returns the flagged span with some context, or the start
+// of the text when the whole text was flagged. Personal data and secrets are
+// masked: chat input is screened before it is redacted for the model.
+func violationExcerpt(text string, v guardrails.Violation) string {
+	start, end := 0, len(text)
+	if v.End > 0 {
+		margin := (violationExcerptSize - (v.End - v.Start)) / 2
+		if margin < 0 {
+			margin = 0
+		}
+		start, end = v.Start-margin, v.End+margin
+		if start < 0 {
+			start = 0
+		}
+		if end > len(text) {
+			end = len(text)
+		}
+	}
+	if end-start > violationExcerptSize {
+		end = start + violationExcerptSize
+	}
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return pii.Mask(text, start, end, pii.AllTypes)
+}
+
+// ListViolations returns violations matching filter, newest first, with
+// the total count
+func (s *GuardrailService) ListViolations(ctx context.Context, filter ViolationFilter) ([]models.GuardrailViolation, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.GuardrailViolation{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Stage != "" {
+		query = query.Where("stage = ?", filter.Stage)
+	}
+	if filter.Check != "" {
+		query = query.Where("check_name = ?", filter.Check)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count violations: %w", err)
+	}
+	if filter.Limit <= 0 || filter.Limit > 100 {
+		filter.Limit = 50
+	}
+	var violations []models.GuardrailViolation
+	if err := query.Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&violations).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list violations: %w", err)
+	}
+	return violations, total, nil
+}
+
+// ReviewViolation marks a violation as confirmed or dismissed
+func (s *GuardrailService) ReviewViolation(ctx context.Context, id, reviewerID uint, status string) (*models.GuardrailViolation, error) {
+	if status != ViolationConfirmed && status != ViolationDismissed {
+		return nil, ErrInvalidReviewStatus
+	}
+	var violation models.GuardrailViolation
+	if err := s.db.WithContext(ctx).First(&violation, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrViolationNotFound
+		}
+		return nil, fmt.Errorf("failed to load violation: %w", err)
+	}
+
+	now := time.Now()
+	violation.Status = status
+	violation.ReviewedBy = &reviewerID
+	violation.ReviewedAt = &now
+	if err := s.db.WithContext(ctx).Model(&violation).
+		Select("status", "reviewed_by", "reviewed_at").Updates(&violation).Error; err != nil {
+		return nil, fmt.Errorf("failed to review violation: %w", err)
+	}
+	return &violation, nil
+}
+
+// withGuardrailMetadata adds the violations that were let through, warned
+// or redacted, under "guardrails" in a message's metadata
+func withGuardrailMetadata(metadata string, input, output *guardrails.Result) string {
+	notices := make(map[guardrails.Stage][]guardrails.Violation)
+	for stage, result := range map[guardrails.Stage]*guardrails.Result{guardrails.Input: input, guardrails.Output: output} {
+		if result != nil && len(result.Violations) > 0 {
+			notices[stage] = result.Violations
+		}
+	}
+	if len(notices) == 0 {
+		return metadata
+	}
+	return setMetadata(metadata, "guardrails", notices)
+}
@@ -0,0 +1,435 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"likemind-backend/internal/models"
+)
+
+// Collection visibilities, from most to least restrictive. The creator and
+// workspace admins can always read and manage a collection.
+const (
+	CollectionPrivate      = "private"      // creator and workspace admins only
+	CollectionShared       = "shared"       // plus the users and groups it is granted to
+	CollectionWorkspace    = "workspace"    // every member of its workspace
+	CollectionOrganization = "organization" // every member of the workspace's organization
+	CollectionPublic       = "public"       // every signed-in user
+)
+
+// Collection grant principals and permissions
+const (
+	PrincipalUser  = "user"
+	PrincipalGroup = "group"
+
+	PermissionRead  = "read"
+	PermissionWrite = "write"
+)
+
+var (
+	// ErrCollectionNotFound is returned for unknown collections and
+	// collections the user cannot read
+	ErrCollectionNotFound = errors.New("collection not found")
+	// ErrInvalidVisibility is returned for unknown collection visibilities
+	ErrInvalidVisibility = errors.New("visibility must be private, shared, workspace, organization or public")
+	// ErrInvalidGrant is returned for unknown grant principals and permissions
+	ErrInvalidGrant = errors.New("principal_type must be user or group and permission read or write")
+	// ErrGrantNotFound is returned when removing a grant that does not exist
+	ErrGrantNotFound = errors.New("grant not found")
+)
+
+// CollectionRequest creates or updates a collection; empty fields of an
+// update are left unchanged
+type CollectionRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Visibility  string `json:"visibility"`
+}
+
+func validVisibility(visibility string) bool {
+	switch visibility {
+	case CollectionPrivate, CollectionShared, CollectionWorkspace, CollectionOrganization, CollectionPublic:
+		return true
+	}
+	return false
+}
+
+// readableCollections selects the IDs of every collection userID may read.
+// Listing, retrieval, search and agent context all filter documents by it.
+func readableCollections(db *gorm.DB, userID uint) *gorm.DB {
+	orgs := db.Model(&models.OrganizationMember{}).Select("organization_id").Where("user_id = ?", userID)
+	adminOrgs := db.Model(&models.OrganizationMember{}).Select("organization_id").
+		Where("user_id = ? AND role IN ?", userID, []string{OrganizationOwner, OrganizationAdmin})
+	joined := db.Model(&models.WorkspaceMember{}).Select("workspace_id").Where("user_id = ?", userID)
+	administered := db.Model(&models.WorkspaceMember{}).Select("workspace_id").
+		Where("user_id = ? AND role = ?", userID, WorkspaceAdmin)
+	groups := db.Model(&models.UserGroupMember{}).Select("group_id").Where("user_id = ?", userID)
+	granted := db.Model(&models.CollectionGrant{}).Select("collection_id").
+		Where("(principal_type = ? AND principal_id = ?) OR (principal_type = ? AND principal_id IN (?))",
+			PrincipalUser, userID, PrincipalGroup, groups)
+
+	return db.Table("knowledge_collections AS c").
+		Select("c.id").
+		Joins("JOIN workspaces w ON w.id = c.workspace_id AND w.deleted_at IS NULL").
+		Joins("JOIN organizations o ON o.id = w.organization_id AND o.deleted_at IS NULL").
+		Where("c.deleted_at IS NULL").
+		Where(`c.visibility = ?
+			OR (c.visibility = ? AND w.organization_id IN (?))
+			OR (c.visibility = ? AND c.id IN (?) AND w.organization_id IN (?))
+			OR ((c.visibility = ? OR c.created_by = ?) AND w.id IN (?))
+			OR w.organization_id IN (?)
+			OR w.id IN (?)`,
+			CollectionPublic,
+			CollectionOrganization, orgs,
+			CollectionShared, granted, orgs,
+			CollectionWorkspace, userID, joined,
+			adminOrgs,
+			administered)
+}
+
+// readableCollectionIDs returns the collections userID may read, limited to
+// requested when given and to workspaceID otherwise. A requested collection
+// the user cannot read is reported as ErrCollectionNotFound.
+func readableCollectionIDs(ctx context.Context, db *gorm.DB, workspaceID, userID uint, requested []uint) ([]uint, error) {
+	query := db.WithContext(ctx).Model(&models.KnowledgeCollection{}).
+		Where("id IN (?)", readableCollections(db, userID))
+	if len(requested) > 0 {
+		query = query.Where("id IN ?", requested)
+	} else {
+		query = query.Where("workspace_id = ?", workspaceID)
+	}
+
+	var ids []uint
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve collections: %w", err)
+	}
+	if len(requested) > 0 {
+		readable := make(map[uint]bool, len(ids))
+		for _, id := range ids {
+			readable[id] = true
+		}
+		for _, id := range requested {
+			if !readable[id] {
+				return nil, fmt.Errorf("%w: %d", ErrCollectionNotFound, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// loadCollection returns a collection userID may read, with CanWrite set
+func loadCollection(ctx context.Context, db *gorm.DB, collectionID, userID uint) (*models.KnowledgeCollection, error) {
+	var collection models.KnowledgeCollection
+	if err := db.WithContext(ctx).
+		Where("id = ? AND id IN (?)", collectionID, readableCollections(db, userID)).
+		First(&collection).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCollectionNotFound
+		}
+		return nil, fmt.Errorf("failed to load collection: %w", err)
+	}
+	_, write, err := collectionPermissions(ctx, db, &collection, userID)
+	if err != nil {
+		return nil, err
+	}
+	collection.CanWrite = write
+	return &collection, nil
+}
+
+// collectionPermissions reports whether userID may manage a collection (its
+// settings and grants) and whether they may add and remove its documents.
+// Both require an admin or editor role in the collection's workspace.
+func collectionPermissions(ctx context.Context, db *gorm.DB, collection *models.KnowledgeCollection, userID uint) (manage, write bool, err error) {
+	role, err := workspaceRole(ctx, db, collection.WorkspaceID, userID)
+	if errors.Is(err, ErrWorkspaceNotFound) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	if !CanEditWorkspace(role) {
+		return false, false, nil
+	}
+	if role == WorkspaceAdmin || collection.CreatedBy == userID {
+		return true, true, nil
+	}
+	switch collection.Visibility {
+	case CollectionWorkspace, CollectionOrganization, CollectionPublic:
+		return false, true, nil
+	case CollectionShared:
+		var grants int64
+		if err := db.WithContext(ctx).Model(&models.CollectionGrant{}).
+			Where("collection_id = ? AND permission = ?", collection.ID, PermissionWrite).
+			Where("(principal_type = ? AND principal_id = ?) OR (principal_type = ? AND principal_id IN (?))",
+				PrincipalUser, userID, PrincipalGroup,
+				db.Model(&models.UserGroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+			Count(&grants).Error; err != nil {
+			return false, false, fmt.Errorf("failed to load collection grants: %w", err)
+		}
+		return false, grants > 0, nil
+	}
+	return false, false, nil
+}
+
+// writableCollection resolves the collection a new document of workspaceID
+// goes into. Collection 0 selects the workspace's default collection,
+// creating it on first use.
+func writableCollection(ctx context.Context, db *gorm.DB, workspaceID, collectionID, userID uint) (*models.KnowledgeCollection, error) {
+	if collectionID == 0 {
+		return defaultCollection(ctx, db, workspaceID, userID)
+	}
+	collection, err := loadCollection(ctx, db, collectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if collection.WorkspaceID != workspaceID {
+		return nil, ErrCollectionNotFound
+	}
+	if !collection.CanWrite {
+		return nil, ErrPermissionDenied
+	}
+	return collection, nil
+}
+
+func defaultCollection(ctx context.Context, db *gorm.DB, workspaceID, userID uint) (*models.KnowledgeCollection, error) {
+	collection := models.KnowledgeCollection{WorkspaceID: workspaceID, IsDefault: true}
+	if err := db.WithContext(ctx).
+		Where(&collection).
+		Attrs(models.KnowledgeCollection{Name: "General", Visibility: CollectionWorkspace, CreatedBy: userID}).
+		FirstOrCreate(&collection).Error; err != nil {
+		return nil, fmt.Errorf("failed to load default collection: %w", err)
+	}
+	collection.CanWrite = true
+	return &collection, nil
+}
+
+// ListCollections returns the collections of a workspace userID can read
+func (s *KnowledgeService) ListCollections(ctx context.Context, workspaceID, userID uint) ([]models.KnowledgeCollection, error) {
+	role, err := workspaceRole(ctx, s.db, workspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	collections := []models.KnowledgeCollection{}
+	if err := s.db.WithContext(ctx).
+		Where("workspace_id = ? AND id IN (?)", workspaceID, readableCollections(s.db, userID)).
+		Order("name").
+		Find(&collections).Error; err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	if CanEditWorkspace(role) {
+		for i := range collections {
+			if _, collections[i].CanWrite, err = collectionPermissions(ctx, s.db, &collections[i], userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return collections, nil
+}
+
+// CreateCollection adds a collection owned by userID to a workspace. The
+// default visibility is workspace.
+func (s *KnowledgeService) CreateCollection(ctx context.Context, workspaceID, userID uint, req CollectionRequest) (*models.KnowledgeCollection, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, ErrNameRequired
+	}
+	if req.Visibility == "" {
+		req.Visibility = CollectionWorkspace
+	}
+	if !validVisibility(req.Visibility) {
+		return nil, ErrInvalidVisibility
+	}
+
+	collection := &models.KnowledgeCollection{
+		WorkspaceID: workspaceID,
+		Name:        name,
+		Description: req.Description,
+		Visibility:  req.Visibility,
+		CreatedBy:   userID,
+	}
+	if err := s.db.WithContext(ctx).Create(collection).Error; err != nil {
+		return nil, fmt.Errorf("failed to create collection: %w", err)
+	}
+	collection.CanWrite = true
+	return collection, nil
+}
+
+// GetCollection returns a collection userID can read, from any workspace
+func (s *KnowledgeService) GetCollection(ctx context.Context, userID, collectionID uint) (*models.KnowledgeCollection, error) {
+	return loadCollection(ctx, s.db, collectionID, userID)
+}
+
+// manageableCollection returns a collection userID may manage
+func (s *KnowledgeService) manageableCollection(ctx context.Context, userID, collectionID uint) (*models.KnowledgeCollection, error) {
+	collection, err := loadCollection(ctx, s.db, collectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	manage, _, err := collectionPermissions(ctx, s.db, collection, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !manage {
+		return nil, ErrPermissionDenied
+	}
+	return collection, nil
+}
+
+// UpdateCollection renames a collection or changes its visibility; its
+// creator and workspace admins only. Documents keep their vectors, as
+// search filters points by collection rather than by visibility.
+func (s *KnowledgeService) UpdateCollection(ctx context.Context, userID, collectionID uint, req CollectionRequest) (*models.KnowledgeCollection, error) {
+	if req.Visibility != "" && !validVisibility(req.Visibility) {
+		return nil, ErrInvalidVisibility
+	}
+	collection, err := s.manageableCollection(ctx, userID, collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		updates["name"] = name
+	}
+	if req.Description != "" {
+		updates["description"] = req.Description
+	}
+	if req.Visibility != "" {
+		updates["visibility"] = req.Visibility
+	}
+	if len(updates) > 0 {
+		if err := s.db.WithContext(ctx).Model(collection).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to update collection: %w", err)
+		}
+	}
+	return collection, nil
+}
+
+// DeleteCollection removes a collection with its documents, chunks, web
+// sources and grants; its creator and workspace admins only
+func (s *KnowledgeService) DeleteCollection(ctx context.Context, userID, collectionID uint) error {
+	collection, err := s.manageableCollection(ctx, userID, collectionID)
+	if err != nil {
+		return err
+	}
+
+	var documentIDs []uint
+	var dimensions []int
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.KnowledgeDocument{}).
+			Where("collection_id = ?", collection.ID).
+			Pluck("id", &documentIDs).Error; err != nil {
+			return fmt.Errorf("failed to load documents: %w", err)
+		}
+		dims, err := indexedDimensions(tx, documentIDs)
+		if err != nil {
+			return err
+		}
+		dimensions = dims
+		if err := tx.Where("document_id IN ?", documentIDs).Delete(&models.DocumentChunk{}).Error; err != nil {
+			return fmt.Errorf("failed to delete chunks: %w", err)
+		}
+		if err := tx.Where("collection_id = ?", collection.ID).Delete(&models.KnowledgeDocument{}).Error; err != nil {
+			return fmt.Errorf("failed to delete documents: %w", err)
+		}
+		if err := tx.Where("collection_id = ?", collection.ID).Delete(&models.WebSource{}).Error; err != nil {
+			return fmt.Errorf("failed to delete web sources: %w", err)
+		}
+		if err := tx.Where("collection_id = ?", collection.ID).Delete(&models.CollectionGrant{}).Error; err != nil {
+			return fmt.Errorf("failed to delete grants: %w", err)
+		}
+		if err := tx.Delete(collection).Error; err != nil {
+			return fmt.Errorf("failed to delete collection: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.queueVectorRemoval(ctx, documentIDs, dimensions)
+	return nil
+}
+
+// ListGrants returns who a collection is shared with; managers only
+func (s *KnowledgeService) ListGrants(ctx context.Context, userID, collectionID uint) ([]models.CollectionGrant, error) {
+	if _, err := s.manageableCollection(ctx, userID, collectionID); err != nil {
+		return nil, err
+	}
+	grants := []models.CollectionGrant{}
+	if err := s.db.WithContext(ctx).
+		Where("collection_id = ?", collectionID).
+		Order("id").
+		Find(&grants).Error; err != nil {
+		return nil, fmt.Errorf("failed to list grants: %w", err)
+	}
+	return grants, nil
+}
+
+// SetGrant shares a collection with a member or group of its organization,
+// or changes their permission; managers only. Grants only take effect while
+// the collection's visibility is shared.
+func (s *KnowledgeService) SetGrant(ctx context.Context, userID, collectionID uint, principalType string, principalID uint, permission string) (*models.CollectionGrant, error) {
+	if (principalType != PrincipalUser && principalType != PrincipalGroup) ||
+		(permission != PermissionRead && permission != PermissionWrite) {
+		return nil, ErrInvalidGrant
+	}
+	collection, err := s.manageableCollection(ctx, userID, collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var workspace models.Workspace
+	if err := s.db.WithContext(ctx).First(&workspace, collection.WorkspaceID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load workspace: %w", err)
+	}
+	if principalType == PrincipalUser {
+		if _, err := organizationRole(ctx, s.db, workspace.OrganizationID, principalID); err != nil {
+			if errors.Is(err, ErrOrganizationNotFound) {
+				return nil, ErrNotOrganizationMember
+			}
+			return nil, err
+		}
+	} else {
+		var groups int64
+		if err := s.db.WithContext(ctx).Model(&models.UserGroup{}).
+			Where("id = ? AND organization_id = ?", principalID, workspace.OrganizationID).
+			Count(&groups).Error; err != nil {
+			return nil, fmt.Errorf("failed to load group: %w", err)
+		}
+		if groups == 0 {
+			return nil, ErrGroupNotFound
+		}
+	}
+
+	grant := models.CollectionGrant{CollectionID: collectionID, PrincipalType: principalType, PrincipalID: principalID}
+	if err := s.db.WithContext(ctx).
+		Where(&grant).
+		Attrs(models.CollectionGrant{CreatedBy: userID}).
+		Assign(models.CollectionGrant{Permission: permission}).
+		FirstOrCreate(&grant).Error; err != nil {
+		return nil, fmt.Errorf("failed to save grant: %w", err)
+	}
+	return &grant, nil
+}
+
+// RemoveGrant stops sharing a collection with a user or group; managers only
+func (s *KnowledgeService) RemoveGrant(ctx context.Context, userID, collectionID uint, principalType string, principalID uint) error {
+	if _, err := s.manageableCollection(ctx, userID, collectionID); err != nil {
+		return err
+	}
+	result := s.db.WithContext(ctx).
+		Where("collection_id = ? AND principal_type = ? AND principal_id = ?", collectionID, principalType, principalID).
+		Delete(&models.CollectionGrant{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove grant: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrGrantNotFound
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"likemind-backend/internal/chunking"
+	"likemind-backend/internal/extract"
+	"likemind-backend/internal/jobs"
+	"likemind-backend/internal/models"
+)
+
+var (
+	// ErrDocumentNotFound is returned for unknown knowledge documents and
+	// documents in collections the user cannot read
+	ErrDocumentNotFound = errors.New("document not found")
+	// ErrFileTooLarge is returned when an upload exceeds the configured limit
+	ErrFileTooLarge = errors.New("file too large")
+)
+
+// DocumentMetadata is stored as JSON in models.KnowledgeDocument.Metadata
+type DocumentMetadata struct {
+	Filename   string            `json:"filename,omitempty"`
+	URL        string            `json:"url,omitempty"`
+	MIME       string            `json:"mime,omitempty"`
+	Size       int               `json:"size,omitempty"`
+	UploadedBy uint              `json:"uploaded_by,omitempty"`
+	Sections   []extract.Section `json:"sections,omitempty"`
+}
+
+// ChunkPreview shows how a text would be split
+type ChunkPreview struct {
+	DocumentType string           `json:"document_type"`
+	Options      chunking.Options `json:"options"`
+	TotalTokens  int              `json:"total_tokens"`
+	Chunks       []chunking.Chunk `json:"chunks"`
+}
+
+// ChunkOverride replaces configured chunking options in a preview; unset
+// fields keep the value configured for the document type
+type ChunkOverride struct {
+	Strategy chunking.Strategy `json:"strategy"`
+	Size     *int              `json:"size"`
+	Overlap  *int              `json:"overlap"` // 0 turns overlap off
+}
+
+// KnowledgeService manages knowledge base documents
+type KnowledgeService struct {
+	db            *gorm.DB
+	jobs          *jobs.Queue
+	maxUploadSize int64
+	chunking      chunking.Config
+}
+
+func NewKnowledgeService(db *gorm.DB, queue *jobs.Queue, maxUploadSize int64, chunks chunking.Config) *KnowledgeService {
+	return &KnowledgeService{db: db, jobs: queue, maxUploadSize: maxUploadSize, chunking: chunks}
+}
+
+// MaxUploadSize is the largest accepted upload in bytes
+func (s *KnowledgeService) MaxUploadSize() int64 {
+	return s.maxUploadSize
+}
+
+// IngestFile extracts the text of an uploaded file and stores it as a
+// document of a workspace collection, keeping headings, pages and row ranges
+// as section metadata. Collection 0 is the workspace's default collection.
+func (s *KnowledgeService) IngestFile(ctx context.Context, workspaceID, userID, collectionID uint, filename string, data []byte) (*models.KnowledgeDocument, error) {
+	if int64(len(data)) > s.maxUploadSize {
+		return nil, ErrFileTooLarge
+	}
+	collection, err := writableCollection(ctx, s.db, workspaceID, collectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	extracted, err := extract.Extract(filename, data, s.maxUploadSize)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := json.Marshal(DocumentMetadata{
+		Filename:   filename,
+		MIME:       extracted.MIME,
+		Size:       len(data),
+		UploadedBy: userID,
+		Sections:   extracted.Sections,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal document metadata: %w", err)
+	}
+
+	doc := &models.KnowledgeDocument{
+		Title:        extracted.Title,
+		Content:      extracted.Text,
+		Source:       filename,
+		DocumentType: extracted.Type,
+		Metadata:     string(metadata),
+		WorkspaceID:  workspaceID,
+		CreatedBy:    userID,
+		CollectionID: collection.ID,
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(doc).Error; err != nil {
+			return fmt.Errorf("failed to save document: %w", err)
+		}
+		return replaceChunks(tx, doc, s.chunking)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Embedding happens in the background so vector search picks the
+	// document up without a manual reindex
+	if _, err := s.jobs.Enqueue(ctx, JobTypeIndexDocuments, indexPayload{DocumentIDs: []uint{doc.ID}}, jobs.WithUserID(userID)); err != nil {
+		log.Printf("knowledge: failed to queue indexing of document %d: %v", doc.ID, err)
+	}
+	return doc, nil
+}
+
+// GetChunks returns the stored chunks of a document in order
+func (s *KnowledgeService) GetChunks(ctx context.Context, userID, documentID uint) ([]models.DocumentChunk, error) {
+	if _, err := s.GetDocument(ctx, userID, documentID); err != nil {
+		return nil, err
+	}
+	var chunks []models.DocumentChunk
+	if err := s.db.WithContext(ctx).
+		Where("document_id = ?", documentID).
+		Order("chunk_index").
+		Find(&chunks).Error; err != nil {
+		return nil, fmt.Errorf("failed to load chunks: %w", err)
+	}
+	return chunks, nil
+}
+
+// PreviewFile extracts an upload and splits it without storing anything
+func (s *KnowledgeService) PreviewFile(filename string, data []byte, override ChunkOverride) (*ChunkPreview, error) {
+	if int64(len(data)) > s.maxUploadSize {
+		return nil, ErrFileTooLarge
+	}
+	extracted, err := extract.Extract(filename, data, s.maxUploadSize)
+	if err != nil {
+		return nil, err
+	}
+	return s.PreviewText(extracted.Text, extracted.Type, override)
+}
+
+// PreviewText splits text with the options configured for documentType;
+// fields set in override take precedence
+func (s *KnowledgeService) PreviewText(text, documentType string, override ChunkOverride) (*ChunkPreview, error) {
+	opts := s.chunking.For(documentType)
+	if override.Strategy != "" {
+		opts.Strategy = override.Strategy
+	}
+	if override.Size != nil {
+		opts.Size = *override.Size
+	}
+	if override.Overlap != nil {
+		opts.Overlap = *override.Overlap
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	chunks, err := chunking.Split(text, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ChunkPreview{
+		DocumentType: documentType,
+		Options:      opts,
+		TotalTokens:  chunking.CountTokens(text),
+		Chunks:       chunks,
+	}, nil
+}
+
+// replaceChunks splits a document with the options for its type and
+// replaces its stored chunks
+func replaceChunks(tx *gorm.DB, doc *models.KnowledgeDocument, cfg chunking.Config) error {
+	opts := cfg.For(doc.DocumentType)
+	chunks, err := chunking.Split(doc.Content, opts)
+	if err != nil {
+		return fmt.Errorf("failed to chunk document: %w", err)
+	}
+
+	if err := tx.Where("document_id = ?", doc.ID).Delete(&models.DocumentChunk{}).Error; err != nil {
+		return fmt.Errorf("failed to delete old chunks: %w", err)
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	rows := make([]models.DocumentChunk, len(chunks))
+	for i, c := range chunks {
+		rows[i] = models.DocumentChunk{
+			DocumentID:  doc.ID,
+			ChunkIndex:  c.Index,
+			Content:     c.Text,
+			StartOffset: c.Start,
+			EndOffset:   c.End,
+			Tokens:      c.Tokens,
+			HeadingPath: strings.Join(c.HeadingPath, " > "),
+			Strategy:    string(opts.Strategy),
+		}
+	}
+	if err := tx.CreateInBatches(rows, 200).Error; err != nil {
+		return fmt.Errorf("failed to save chunks: %w", err)
+	}
+	return nil
+}
+
+// ListDocuments returns a page of documents without their content: those of
+// one collection, or of every workspace collection userID can read when
+// collectionID is 0
+func (s *KnowledgeService) ListDocuments(ctx context.Context, workspaceID, userID, collectionID uint, limit, offset int) ([]models.KnowledgeDocument, int64, error) {
+	scope := func(db *gorm.DB) *gorm.DB {
+		if collectionID != 0 {
+			return db.Where("collection_id = ?", collectionID)
+		}
+		return db.Where("workspace_id = ? AND collection_id IN (?)", workspaceID, readableCollections(s.db, userID))
+	}
+	if collectionID != 0 {
+		if _, err := loadCollection(ctx, s.db, collectionID, userID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var total int64
+	if err := s.db.WithContext(ctx).Model(&models.KnowledgeDocument{}).Scopes(scope).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count documents: %w", err)
+	}
+
+	var docs []models.KnowledgeDocument
+	if err := s.db.WithContext(ctx).
+		Omit("content").
+		Scopes(scope).
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&docs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list documents: %w", err)
+	}
+
+	return docs, total, nil
+}
+
+// GetDocument returns a document from any collection userID can read
+func (s *KnowledgeService) GetDocument(ctx context.Context, userID, id uint) (*models.KnowledgeDocument, error) {
+	var doc models.KnowledgeDocument
+	if err := s.db.WithContext(ctx).Where("collection_id IN (?)", readableCollections(s.db, userID)).First(&doc, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, fmt.Errorf("failed to load document: %w", err)
+	}
+	return &doc, nil
+}
+
+// DeleteDocument removes a document of the workspace from a collection
+// userID can write to
+func (s *KnowledgeService) DeleteDocument(ctx context.Context, workspaceID, userID, id uint) error {
+	doc, err := s.GetDocument(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if doc.WorkspaceID != workspaceID {
+		return ErrDocumentNotFound
+	}
+	if _, err := writableCollection(ctx, s.db, workspaceID, doc.CollectionID, userID); err != nil {
+		return err
+	}
+
+	var dimensions []int
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("workspace_id = ?", workspaceID).Delete(&models.KnowledgeDocument{}, id)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete document: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrDocumentNotFound
+		}
+		dims, err := indexedDimensions(tx, []uint{id})
+		if err != nil {
+			return err
+		}
+		dimensions = dims
+		if err := tx.Where("document_id = ?", id).Delete(&models.DocumentChunk{}).Error; err != nil {
+			return fmt.Errorf("failed to delete chunks: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.queueVectorRemoval(ctx, []uint{id}, dimensions)
+	return nil
+}
+
+// indexedDimensions returns the embedding dimensions the documents' chunks
+// were indexed with, which name the vector collections holding them
+func indexedDimensions(tx *gorm.DB, documentIDs []uint) ([]int, error) {
+	var dimensions []int
+	if err := tx.Model(&models.DocumentChunk{}).
+		Where("document_id IN ? AND embedding_dimension > 0", documentIDs).
+		Distinct().
+		Pluck("embedding_dimension", &dimensions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load chunk dimensions: %w", err)
+	}
+	return dimensions, nil
+}
+
+// queueVectorRemoval removes deleted documents from the vector database in
+// the background, where failures are retried. The documents are already
+// gone, so a failure to queue is only logged.
+func (s *KnowledgeService) queueVectorRemoval(ctx context.Context, documentIDs []uint, dimensions []int) {
+	if len(documentIDs) == 0 {
+		return
+	}
+	payload := deleteVectorsPayload{DocumentIDs: documentIDs, Dimensions: dimensions}
+	if _, err := s.jobs.Enqueue(ctx, JobTypeDeleteVectors, payload); err != nil {
+		log.Printf("knowledge: failed to queue vector removal for documents %v: %v", documentIDs, err)
+	}
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The lexicon analyzer is the offline fallback for AnalyzeText. It is
+// English-centric apart from language detection and deliberately simple.
+
+var positiveWords = toSet(`good great excellent amazing awesome fantastic wonderful love loved loves like liked
+enjoy enjoyed happy glad pleased delighted best better nice helpful useful easy fast reliable recommend
+recommended perfect superb impressive brilliant beautiful success successful win wins improved improvement
+satisfied thanks thank grateful smooth stable clear friendly efficient effective positive outstanding`)
+
+var negativeWords = toSet(`bad terrible awful horrible poor worst worse hate hated hates dislike disappointed
+disappointing sad angry annoyed annoying broken bug bugs buggy crash crashes crashed slow difficult hard
+confusing useless fail failed fails failure error errors problem problems issue issues wrong unstable
+expensive frustrating frustrated ugly negative missing lost late delay delayed refund complaint`)
+
+var negations = toSet(`not no never none nobody nothing neither nor cannot can't don't doesn't didn't isn't
+wasn't aren't weren't won't wouldn't shouldn't couldn't hardly barely`)
+
+var intensifiers = map[string]float64{
+	"very": 1.5, "really": 1.4, "extremely": 1.8, "so": 1.3, "super": 1.5, "incredibly": 1.7,
+	"quite": 1.2, "totally": 1.4, "absolutely": 1.6, "slightly": 0.6, "somewhat": 0.7,
+}
+
+// stopwords per language; the language with the most hits wins
+var stopwords = map[string]map[string]bool{
+	"en": toSet(`the and is are was were be been of to in that it for on with as at by this from or an but not have has had you they we he she which will would there their what about`),
+	"es": toSet(`el la los las de que y en un una es por con para no se lo como más pero sus le ya o este sí porque esta entre cuando muy sin sobre también`),
+	"fr": toSet(`le la les de des et est un une du en que qui dans pour pas sur au avec ce il elle ne se plus par sont mais nous vous ou aux cette`),
+	"de": toSet(`der die das und ist nicht ein eine zu den von mit sich des auf für im dem auch es an als werden aus er hat dass sie nach wird bei`),
+	"pt": toSet(`o a os as de que e do da em um uma para com não por mais dos das se na no como mas foi ao ele ela isso seu sua ou quando muito`),
+	"it": toSet(`il lo la i gli le di che e è un una per con non in del della sono ma come anche più se questo quando molto alla nel sul`),
+	"nl": toSet(`de het een en van is dat op te in voor niet met zijn er aan ook als bij door maar om dan zo nog wel naar uit hij zij`),
+}
+
+var (
+	lexiconWord     = regexp.MustCompile(`[\p{L}\p{N}'’]+`)
+	lexiconSentence = regexp.MustCompile(`[^.!?\n]+[.!?]*`)
+	entityPattern   = regexp.MustCompile(`\b[A-Z][\p{L}&.-]*(?:\s+(?:of\s+|de\s+|van\s+)?[A-Z][\p{L}&.-]*)*`)
+	datePattern     = regexp.MustCompile(`\b(?:\d{4}-\d{2}-\d{2}|\d{1,2}/\d{1,2}/\d{2,4}|(?:Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|June?|July?|Aug(?:ust)?|Sep(?:tember)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)\.?\s+\d{1,2}(?:,\s*\d{4})?)\b`)
+	orgSuffixes     = []string{"Inc", "Inc.", "Ltd", "Ltd.", "LLC", "Corp", "Corp.", "Corporation", "Company", "GmbH", "University", "Foundation", "Institute", "Bank", "Group"}
+	monthNames      = toSet(`january february march april may june july august september october november december monday tuesday wednesday thursday friday saturday sunday`)
+)
+
+func analyzeLexicon(text string) *TextAnalysis {
+	words := lexiconWord.FindAllString(text, -1)
+	lower := make([]string, len(words))
+	for i, w := range words {
+		lower[i] = strings.ToLower(strings.ReplaceAll(w, "’", "'"))
+	}
+
+	language := detectLanguage(lower)
+	score, pos, neg := lexiconSentiment(lower)
+	topics := lexiconTopics(lower, language)
+
+	return &TextAnalysis{
+		Sentiment:      sentimentLabel(score, pos, neg),
+		SentimentScore: math.Round(score*1000) / 1000,
+		Topics:         topics,
+		Entities:       lexiconEntities(text),
+		Language:       language,
+		Summary:        lexiconSummary(text, lower, language),
+		Method:         AnalysisMethodLexicon,
+	}
+}
+
+// lexiconSentiment sums word polarities, flipping them after a negation
+// within three words and scaling them after an intensifier
+func lexiconSentiment(words []string) (score, pos, neg float64) {
+	for i, w := range words {
+		polarity := 0.0
+		if positiveWords[w] {
+			polarity = 1
+		} else if negativeWords[w] {
+			polarity = -1
+		}
+		if polarity == 0 {
+			continue
+		}
+		for j := i - 1; j >= 0 && j >= i-3; j-- {
+			if negations[words[j]] {
+				polarity = -polarity * 0.75
+				break
+			}
+		}
+		if i > 0 {
+			if m, ok := intensifiers[words[i-1]]; ok {
+				polarity *= m
+			}
+		}
+		if polarity > 0 {
+			pos += polarity
+		} else {
+			neg -= polarity
+		}
+	}
+
+	total := pos - neg
+	if total == 0 {
+		return 0, pos, neg
+	}
+	// Normalize into [-1, 1], saturating as evidence accumulates
+	return total / math.Sqrt(total*total+15), pos, neg
+}
+
+func sentimentLabel(score, pos, neg float64) string {
+	switch {
+	case pos > 0 && neg > 0 && math.Min(pos, neg)/math.Max(pos, neg) >= 0.5:
+		return "mixed"
+	case score >= 0.05:
+		return "positive"
+	case score <= -0.05:
+		return "negative"
+	default:
+		return "neutral"
+	}
+}
+
+func detectLanguage(words []string) string {
+	best, bestHits := "und", 0
+	for _, lang := range []string{"en", "es", "fr", "de", "pt", "it", "nl"} {
+		hits := 0
+		for _, w := range words {
+			if stopwords[lang][w] {
+				hits++
+			}
+		}
+		if hits > bestHits {
+			best, bestHits = lang, hits
+		}
+	}
+	// Require some evidence before claiming a language
+	if bestHits < 2 && len(words) > 3 {
+		return "und"
+	}
+	return best
+}
+
+// lexiconTopics returns the most frequent content words
+func lexiconTopics(words []string, language string) []string {
+	counts := make(map[string]int)
+	for _, w := range words {
+		if len([]rune(w)) < 4 || isStopword(w, language) || isNumeric(w) {
+			continue
+		}
+		if positiveWords[w] || negativeWords[w] {
+			continue
+		}
+		counts[w]++
+	}
+
+	topics := make([]string, 0, len(counts))
+	for w := range counts {
+		topics = append(topics, w)
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		if counts[topics[i]] != counts[topics[j]] {
+			return counts[topics[i]] > counts[topics[j]]
+		}
+		return topics[i] < topics[j]
+	})
+	if len(topics) > 5 {
+		topics = topics[:5]
+	}
+	return topics
+}
+
+// lexiconEntities finds dates and capitalized phrases; phrases at the start
+// of a sentence are only kept when they span several words
+func lexiconEntities(text string) []Entity {
+	entities := []Entity{}
+	seen := make(map[string]bool)
+	add := func(value, kind string) {
+		value = strings.TrimRight(strings.TrimSpace(value), ".-")
+		if value == "" || seen[strings.ToLower(value)] {
+			return
+		}
+		seen[strings.ToLower(value)] = true
+		entities = append(entities, Entity{Text: value, Type: kind})
+	}
+
+	for _, d := range datePattern.FindAllString(text, -1) {
+		add(d, "date")
+	}
+	for _, loc := range entityPattern.FindAllStringIndex(text, -1) {
+		phrase := strings.TrimRight(text[loc[0]:loc[1]], ".-")
+		fields := strings.Fields(phrase)
+		if len(fields) == 0 || (sentenceStart(text, loc[0]) && len(fields) == 1) {
+			continue
+		}
+		if len(fields) == 1 && (isStopword(strings.ToLower(phrase), "") || monthNames[strings.ToLower(phrase)]) {
+			continue
+		}
+		if seen[strings.ToLower(phrase)] {
+			continue
+		}
+		kind := "other"
+		for _, suffix := range orgSuffixes {
+			if fields[len(fields)-1] == suffix {
+				kind = "organization"
+				break
+			}
+		}
+		if kind == "other" && len(fields) >= 2 && len(fields) <= 3 && allLetters(fields) {
+			kind = "person"
+		}
+		add(phrase, kind)
+		if len(entities) >= 20 {
+			break
+		}
+	}
+	return entities
+}
+
+// lexiconSummary picks the two sentences with the highest average word
+// frequency, in their original order
+func lexiconSummary(text string, words []string, language string) string {
+	sentences := lexiconSentence.FindAllString(text, -1)
+	if len(sentences) <= 2 {
+		return truncateRunes(strings.Join(strings.Fields(text), " "), 300)
+	}
+
+	freq := make(map[string]int)
+	for _, w := range words {
+		if !isStopword(w, language) {
+			freq[w]++
+		}
+	}
+
+	type scored struct {
+		index int
+		score float64
+	}
+	var ranked []scored
+	for i, sentence := range sentences {
+		sw := lexiconWord.FindAllString(sentence, -1)
+		if len(sw) < 3 {
+			continue
+		}
+		total := 0
+		for _, w := range sw {
+			total += freq[strings.ToLower(w)]
+		}
+		ranked = append(ranked, scored{i, float64(total) / float64(len(sw))})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].score > ranked[j].score })
+	if len(ranked) > 2 {
+		ranked = ranked[:2]
+	}
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].index < ranked[j].index })
+
+	parts := make([]string, len(ranked))
+	for i, r := range ranked {
+		parts[i] = strings.Join(strings.Fields(sentences[r.index]), " ")
+	}
+	return truncateRunes(strings.Join(parts, " "), 300)
+}
+
+func sentenceStart(text string, offset int) bool {
+	before := strings.TrimRightFunc(text[:offset], unicode.IsSpace)
+	return before == "" || strings.ContainsAny(before[len(before)-1:], ".!?\n\"")
+}
+
+func isStopword(w, language string) bool {
+	if language != "" && language != "und" {
+		return stopwords[language][w]
+	}
+	for _, set := range stopwords {
+		if set[w] {
+			return true
+		}
+	}
+	return false
+}
+
+func isNumeric(w string) bool {
+	for _, r := range w {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func allLetters(fields []string) bool {
+	for _, f := range fields {
+		for _, r := range f {
+			if !unicode.IsLetter(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
+
+func toSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrLLMRateLimited   = errors.New("model rate limit exceeded")
+	ErrLLMOverloaded    = errors.New("model provider is overloaded")
+	ErrLLMContextLength = errors.New("prompt exceeds the model's context length")
+	ErrLLMAuth          = errors.New("model provider rejected the credentials")
+	ErrLLMTimeout       = errors.New("model did not respond in time")
+	ErrLLMUnavailable   = errors.New("model is temporarily unavailable")
+)
+
+// LLMError describes a failed chat completion call. Kind is one of the
+// ErrLLM errors, or nil when the failure fits none of them; both Kind and
+// the underlying error match with errors.Is.
+type LLMError struct {
+	Kind       error
+	Model      string
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+	Err        error
+
+	retryable bool // the same model may succeed if asked again
+	fallback  bool // another model may succeed
+}
+
+func (e *LLMError) Error() string {
+	var b strings.Builder
+	b.WriteString("model " + e.Model)
+	if e.Kind != nil {
+		b.WriteString(": " + e.Kind.Error())
+	}
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	} else if e.Err != nil {
+		b.WriteString(": " + e.Err.Error())
+	}
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, " (status %d)", e.StatusCode)
+	}
+	return b.String()
+}
+
+func (e *LLMError) Unwrap() []error {
+	var errs []error
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// classifyResponse turns a non-200 chat completion response into an LLMError
+func classifyResponse(model string, resp *http.Response) *LLMError {
+	var body struct {
+		Error struct {
+			Message string      `json:"message"`
+			Type    string      `json:"type"`
+			Code    interface{} `json:"code"`
+		} `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = json.Unmarshal(data, &body)
+	code := fmt.Sprint(body.Error.Code)
+	message := strings.ToLower(body.Error.Message)
+
+	e := &LLMError{
+		Model:      model,
+		StatusCode: resp.StatusCode,
+		Message:    body.Error.Message,
+		RetryAfter: parseRetryAfter(resp.Header),
+	}
+	switch {
+	case code == "context_length_exceeded" || strings.Contains(message, "context length") ||
+		strings.Contains(message, "context window") || resp.StatusCode == http.StatusRequestEntityTooLarge:
+		e.Kind = ErrLLMContextLength
+		// Later models in the chain may have a larger window
+		e.fallback = true
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.Kind = ErrLLMRateLimited
+		// An exhausted quota will not recover by waiting
+		e.retryable = code != "insufficient_quota" && body.Error.Type != "insufficient_quota"
+		e.fallback = true
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		e.Kind = ErrLLMAuth
+	case resp.StatusCode == http.StatusRequestTimeout:
+		e.Kind = ErrLLMTimeout
+		e.retryable, e.fallback = true, true
+	case resp.StatusCode >= 500:
+		e.Kind = ErrLLMOverloaded
+		e.retryable, e.fallback = true, true
+	case resp.StatusCode == http.StatusNotFound:
+		// Usually an unknown or retired model name
+		e.fallback = true
+	}
+	return e
+}
+
+// parseRetryAfter reads retry-after-ms or Retry-After (seconds or an HTTP
+// date), returning zero when neither is present
+func parseRetryAfter(h http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(h.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := strings.TrimSpace(h.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// transportError wraps a failure to get any response from the provider
+func transportError(ctx context.Context, model string, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return &LLMError{Model: model, Err: err, retryable: true, fallback: true}
+}
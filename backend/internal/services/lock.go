@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// releaseScript deletes a lock only if it is still held by the caller's token
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// acquireLock takes a cluster-wide lock in Redis. It returns a release
+// function and true when the lock was obtained; the lock expires after ttl
+// even if the holder crashes.
+func acquireLock(ctx context.Context, client *redis.Client, key string, ttl time.Duration) (func(), bool) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, false
+	}
+	token := hex.EncodeToString(buf)
+
+	ok, err := client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false
+	}
+
+	release := func() {
+		releaseScript.Run(context.Background(), client, []string{key}, token)
+	}
+	return release, true
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// loginMaxDelay caps the progressive delay between failed attempts
+const loginMaxDelay = time.Minute
+
+// loginRetryWait is how long attempts wait when others already in flight
+// use up a limit
+const loginRetryWait = time.Second
+
+// reserveScript returns the wait for an account and address in
+// milliseconds, or counts the attempt as a failure and returns 0. Counting
+// and checking in one step keeps concurrent attempts from all passing
+// before any of them fails. KEYS are the account lock, address lock,
+// account delay, account failures and address failures; ARGV the window,
+// both maximums, the longest delay and the retry wait.
+var reserveScript = redis.NewScript(`
+local wait = 0
+for i = 1, 3 do
+	local ttl = redis.call('PTTL', KEYS[i])
+	if ttl > wait then
+		wait = ttl
+	end
+end
+if wait > 0 then
+	return wait
+end
+local account = redis.call('INCR', KEYS[4])
+if account == 1 then
+	redis.call('PEXPIRE', KEYS[4], ARGV[1])
+end
+local ip = redis.call('INCR', KEYS[5])
+if ip == 1 then
+	redis.call('PEXPIRE', KEYS[5], ARGV[1])
+end
+local maxAccount, maxIP = tonumber(ARGV[2]), tonumber(ARGV[3])
+if (maxAccount > 0 and account > maxAccount) or (maxIP > 0 and ip > maxIP) then
+	redis.call('DECR', KEYS[4])
+	redis.call('DECR', KEYS[5])
+	return tonumber(ARGV[5])
+end
+if account >= 2 then
+	local delay = math.min(1000 * 2 ^ math.min(account - 2, 6), tonumber(ARGV[4]))
+	redis.call('SET', KEYS[3], 1, 'PX', delay)
+end
+return 0
+`)
+
+// countFailureScript increments a failure counter, starting its window on
+// the first failure
+var countFailureScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// refundScript takes back an attempt counted by reserveScript
+var refundScript = redis.NewScript(`
+for i = 1, #KEYS do
+	if tonumber(redis.call('GET', KEYS[i]) or '0') > 0 then
+		redis.call('DECR', KEYS[i])
+	end
+end
+return 0
+`)
+
+// LoginGuardOptions configures brute-force protection. A zero maximum
+// disables that counter.
+type LoginGuardOptions struct {
+	MaxAccountFailures int           // failures before an account is locked
+	MaxIPFailures      int           // failures before a client address is locked
+	Window             time.Duration // how long failures are remembered
+	Lockout            time.Duration
+}
+
+// LoginGuard counts failed password logins per account and per client
+// address in Redis, so limits hold across replicas. From the second
+// failure an account must wait a delay that doubles with each failure;
+// reaching a maximum locks the account or address for the lockout period.
+// Attempts are counted as failures when they start and taken back when
+// the password is right. Wrong second factors count as failures too, and
+// only a finished login clears them.
+type LoginGuard struct {
+	redisClient *redis.Client
+	opts        LoginGuardOptions
+}
+
+func NewLoginGuard(redisClient *redis.Client, opts LoginGuardOptions) *LoginGuard {
+	return &LoginGuard{redisClient: redisClient, opts: opts}
+}
+
+// Reserve returns how long the client must wait before trying email again.
+// Zero means the attempt may proceed, and it counts as failed until
+// Refund is called; a wrong password is then reported with Fail.
+func (g *LoginGuard) Reserve(ctx context.Context, email, clientIP string) (time.Duration, error) {
+	wait, err := reserveScript.Run(ctx, g.redisClient, []string{
+		loginKey("lock", "account", email),
+		loginKey("lock", "ip", clientIP),
+		loginKey("delay", "account", email),
+		loginKey("fail", "account", email),
+		loginKey("fail", "ip", clientIP),
+	}, g.opts.Window.Milliseconds(), g.opts.MaxAccountFailures, g.opts.MaxIPFailures,
+		loginMaxDelay.Milliseconds(), loginRetryWait.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check login limits: %w", err)
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+// Fail locks the account or address once a reserved attempt that failed
+// reaches a maximum, and returns how long the client must now wait before
+// the next one
+func (g *LoginGuard) Fail(ctx context.Context, email, clientIP string) (time.Duration, error) {
+	accountFailures, err := g.failures(ctx, "account", email)
+	if err != nil {
+		return 0, err
+	}
+	ipFailures, err := g.failures(ctx, "ip", clientIP)
+	if err != nil {
+		return 0, err
+	}
+	return g.apply(ctx, email, clientIP, accountFailures, ipFailures)
+}
+
+// RecordFailure counts a failure that was not reserved, like a wrong
+// second factor, and returns how long the client must now wait
+func (g *LoginGuard) RecordFailure(ctx context.Context, email, clientIP string) (time.Duration, error) {
+	accountFailures, err := g.count(ctx, loginKey("fail", "account", email))
+	if err != nil {
+		return 0, err
+	}
+	ipFailures, err := g.count(ctx, loginKey("fail", "ip", clientIP))
+	if err != nil {
+		return 0, err
+	}
+	if accountFailures >= 2 {
+		delay := time.Second << min(accountFailures-2, 6)
+		if delay > loginMaxDelay {
+			delay = loginMaxDelay
+		}
+		if err := g.redisClient.Set(ctx, loginKey("delay", "account", email), 1, delay).Err(); err != nil {
+			return 0, fmt.Errorf("failed to record login delay: %w", err)
+		}
+	}
+	return g.apply(ctx, email, clientIP, accountFailures, ipFailures)
+}
+
+// Refund takes back a reserved attempt whose password was right, keeping
+// earlier failures, e.g. while a second factor is still to come
+func (g *LoginGuard) Refund(ctx context.Context, email, clientIP string) error {
+	if err := refundScript.Run(ctx, g.redisClient, []string{
+		loginKey("fail", "account", email),
+		loginKey("fail", "ip", clientIP),
+	}).Err(); err != nil {
+		return fmt.Errorf("failed to refund login attempt: %w", err)
+	}
+	return nil
+}
+
+// Succeed forgets an account's failures once a login has finished; the
+// address keeps its count so one valid account cannot be used to reset
+// guessing against others
+func (g *LoginGuard) Succeed(ctx context.Context, email string) error {
+	if err := g.redisClient.Del(ctx,
+		loginKey("fail", "account", email),
+		loginKey("delay", "account", email),
+	).Err(); err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+	return nil
+}
+
+// Unlock clears an account's failures and lockout, e.g. by an admin
+func (g *LoginGuard) Unlock(ctx context.Context, email string) error {
+	if err := g.redisClient.Del(ctx,
+		loginKey("fail", "account", email),
+		loginKey("delay", "account", email),
+		loginKey("lock", "account", email),
+	).Err(); err != nil {
+		return fmt.Errorf("failed to unlock account: %w", err)
+	}
+	return nil
+}
+
+// apply locks whatever reached its maximum and returns the longest wait
+func (g *LoginGuard) apply(ctx context.Context, email, clientIP string, accountFailures, ipFailures int64) (time.Duration, error) {
+	if g.opts.MaxAccountFailures > 0 && accountFailures >= int64(g.opts.MaxAccountFailures) {
+		if err := g.lock(ctx, "account", email); err != nil {
+			return 0, err
+		}
+	}
+	if g.opts.MaxIPFailures > 0 && ipFailures >= int64(g.opts.MaxIPFailures) {
+		if err := g.lock(ctx, "ip", clientIP); err != nil {
+			return 0, err
+		}
+	}
+	var wait time.Duration
+	for _, key := range []string{
+		loginKey("lock", "account", email),
+		loginKey("lock", "ip", clientIP),
+		loginKey("delay", "account", email),
+	} {
+		ttl, err := g.redisClient.PTTL(ctx, key).Result()
+		if err != nil {
+			return 0, fmt.Errorf("failed to check login limits: %w", err)
+		}
+		if ttl > wait {
+			wait = ttl
+		}
+	}
+	return wait, nil
+}
+
+func (g *LoginGuard) failures(ctx context.Context, scope, value string) (int64, error) {
+	n, err := g.redisClient.Get(ctx, loginKey("fail", scope, value)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, fmt.Errorf("failed to count login failures: %w", err)
+	}
+	return n, nil
+}
+
+func (g *LoginGuard) count(ctx context.Context, key string) (int64, error) {
+	n, err := countFailureScript.Run(ctx, g.redisClient, []string{key}, g.opts.Window.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count login failure: %w", err)
+	}
+	return n, nil
+}
+
+func (g *LoginGuard) lock(ctx context.Context, kind, value string) error {
+	pipe := g.redisClient.TxPipeline()
+	pipe.Set(ctx, loginKey("lock", kind, value), 1, g.opts.Lockout)
+	// Failures start over once the lock expires
+	pipe.Del(ctx, loginKey("fail", kind, value))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", kind, err)
+	}
+	return nil
+}
+
+func loginKey(kind, scope, value string) string {
+	return "login:" + kind + ":" + scope + ":" + strings.ToLower(strings.TrimSpace(value))
+}
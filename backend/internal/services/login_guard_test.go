@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestLoginGuard(t *testing.T, opts LoginGuardOptions) (*LoginGuard, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewLoginGuard(client, opts), mr
+}
+
+var testGuardOptions = LoginGuardOptions{
+	MaxAccountFailures: 3,
+	MaxIPFailures:      10,
+	Window:             15 * time.Minute,
+	Lockout:            15 * time.Minute,
+}
+
+func TestLoginGuardReservesConcurrentAttempts(t *testing.T) {
+	ctx := context.Background()
+	guard, _ := newTestLoginGuard(t, testGuardOptions)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := guard.Reserve(ctx, "a@example.com", "10.0.0.1")
+			if err != nil {
+				t.Errorf("Reserve: %v", err)
+				return
+			}
+			if wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// The second attempt starts the delay for every later one
+	if allowed != 2 {
+		t.Fatalf("%d concurrent attempts proceeded, want 2", allowed)
+	}
+}
+
+func TestLoginGuardLocksAfterMaxFailures(t *testing.T) {
+	ctx := context.Background()
+	guard, mr := newTestLoginGuard(t, testGuardOptions)
+
+	for i := 1; i <= testGuardOptions.MaxAccountFailures; i++ {
+		wait, err := guard.Reserve(ctx, "a@example.com", "10.0.0.1")
+		if err != nil || wait != 0 {
+			t.Fatalf("attempt %d: Reserve = %v, %v; want to proceed", i, wait, err)
+		}
+		wait, err = guard.Fail(ctx, "a@example.com", "10.0.0.1")
+		if err != nil {
+			t.Fatalf("attempt %d: Fail: %v", i, err)
+		}
+		if i == testGuardOptions.MaxAccountFailures {
+			if wait != testGuardOptions.Lockout {
+				t.Fatalf("Fail at the maximum waits %v, want the lockout", wait)
+			}
+			break
+		}
+		mr.FastForward(wait)
+	}
+	if wait, err := guard.Reserve(ctx, "A@example.com ", "10.0.0.2"); err != nil || wait <= 0 {
+		t.Fatalf("Reserve on a locked account = %v, %v; want a wait", wait, err)
+	}
+	mr.FastForward(testGuardOptions.Lockout)
+	if wait, err := guard.Reserve(ctx, "a@example.com", "10.0.0.1"); err != nil || wait != 0 {
+		t.Fatalf("Reserve after the lockout = %v, %v; want to proceed", wait, err)
+	}
+}
+
+func TestLoginGuardSucceedKeepsOtherFailures(t *testing.T) {
+	ctx := context.Background()
+	opts := testGuardOptions
+	opts.MaxIPFailures = 3
+	guard, _ := newTestLoginGuard(t, opts)
+
+	// Two wrong guesses from the address against other accounts
+	for _, email := range []string{"b@example.com", "c@example.com"} {
+		if wait, err := guard.Reserve(ctx, email, "10.0.0.1"); err != nil || wait != 0 {
+			t.Fatalf("Reserve %s = %v, %v", email, wait, err)
+		}
+		if _, err := guard.Fail(ctx, email, "10.0.0.1"); err != nil {
+			t.Fatalf("Fail %s: %v", email, err)
+		}
+	}
+	// Successful logins only take back their own attempt
+	for i := 0; i < 5; i++ {
+		if wait, err := guard.Reserve(ctx, "a@example.com", "10.0.0.1"); err != nil || wait != 0 {
+			t.Fatalf("login %d: Reserve = %v, %v; want to proceed", i, wait, err)
+		}
+		if err := guard.Refund(ctx, "a@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("login %d: Refund: %v", i, err)
+		}
+		if err := guard.Succeed(ctx, "a@example.com"); err != nil {
+			t.Fatalf("login %d: Succeed: %v", i, err)
+		}
+	}
+	if wait, err := guard.Reserve(ctx, "d@example.com", "10.0.0.1"); err != nil || wait != 0 {
+		t.Fatalf("Reserve = %v, %v; want to proceed", wait, err)
+	}
+	if wait, err := guard.Fail(ctx, "d@example.com", "10.0.0.1"); err != nil || wait != opts.Lockout {
+		t.Fatalf("third failure from the address = %v, %v; want the lockout", wait, err)
+	}
+}
@@ -0,0 +1,354 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"likemind-backend/internal/models"
+	"likemind-backend/internal/oidc"
+)
+
+// OIDCStateTTL is how long a user has to finish signing in at the provider
+const OIDCStateTTL = 10 * time.Minute
+
+var (
+	// ErrUnknownProvider is returned for provider names that are not configured
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	// ErrInvalidOIDCState is returned for callbacks with an unknown, expired
+	// or already used state
+	ErrInvalidOIDCState = errors.New("invalid or expired sign-in state")
+	// ErrSSOEmailRequired is returned when the provider shares no email address
+	ErrSSOEmailRequired = errors.New("identity provider did not supply an email address")
+	// ErrSSOAccountExists is returned when an account with the email exists
+	// but the login cannot be linked to it
+	ErrSSOAccountExists = errors.New("an account with this email already exists")
+	// ErrSSOSignupDisabled is returned for unknown users when automatic
+	// provisioning is off
+	ErrSSOSignupDisabled = errors.New("no account exists for this login")
+)
+
+// OIDCOptions configures how single sign-on logins map to local accounts
+type OIDCOptions struct {
+	AutoProvision bool // create accounts for unknown users
+	LinkByEmail   bool // attach logins to existing accounts with the same verified email
+}
+
+// OIDCProviderInfo is what clients need to offer a provider's login button
+type OIDCProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LoginURL    string `json:"login_url"`
+}
+
+type oidcProvider struct {
+	*oidc.Provider
+	displayName string
+	roleClaim   string
+	roleMap     map[string]string
+}
+
+// oidcState is what a login remembers until the provider redirects back
+type oidcState struct {
+	Provider string `json:"provider"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+}
+
+// OIDCService signs users in through OpenID Connect providers, creating or
+// linking local accounts on their first login
+type OIDCService struct {
+	db          *gorm.DB
+	redisClient *redis.Client
+	opts        OIDCOptions
+	providers   map[string]*oidcProvider
+	names       []string
+}
+
+func NewOIDCService(db *gorm.DB, redisClient *redis.Client, opts OIDCOptions) *OIDCService {
+	return &OIDCService{
+		db:          db,
+		redisClient: redisClient,
+		opts:        opts,
+		providers:   make(map[string]*oidcProvider),
+	}
+}
+
+// AddProvider registers a provider. When roleClaim is set, the user's role
+// is derived from it on every login using roleMap, e.g.
+// "platform-admins=admin"; users matching no entry get the "user" role.
+func (s *OIDCService) AddProvider(provider *oidc.Provider, displayName, roleClaim, roleMap string) error {
+	mapping := make(map[string]string)
+	for _, pair := range strings.Split(roleMap, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		value, role, ok := strings.Cut(pair, "=")
+		role = strings.TrimSpace(role)
+		if !ok || (role != "admin" && role != "user") {
+			return fmt.Errorf("expected claim-value=admin|user, got %q", pair)
+		}
+		mapping[strings.TrimSpace(value)] = role
+	}
+	if _, exists := s.providers[provider.Name()]; exists {
+		return fmt.Errorf("provider %q is configured twice", provider.Name())
+	}
+	s.providers[provider.Name()] = &oidcProvider{
+		Provider:    provider,
+		displayName: displayName,
+		roleClaim:   roleClaim,
+		roleMap:     mapping,
+	}
+	s.names = append(s.names, provider.Name())
+	return nil
+}
+
+// Providers lists the configured providers in configuration order
+func (s *OIDCService) Providers() []OIDCProviderInfo {
+	infos := make([]OIDCProviderInfo, 0, len(s.names))
+	for _, name := range s.names {
+		infos = append(infos, OIDCProviderInfo{
+			Name:        name,
+			DisplayName: s.providers[name].displayName,
+			LoginURL:    "/api/v1/auth/oidc/" + name + "/login",
+		})
+	}
+	return infos
+}
+
+// Begin starts a login and returns the provider URL to send the user to
+// and the state, which the browser must present again at the callback. The
+// state, nonce and PKCE verifier are kept in Redis until the callback.
+func (s *OIDCService) Begin(ctx context.Context, providerName string) (string, string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+	var values [3]string
+	for i := range values {
+		value, err := randomToken(32)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to generate sign-in state: %w", err)
+		}
+		values[i] = value
+	}
+	stateKey, verifier, nonce := values[0], values[1], values[2]
+
+	payload, err := json.Marshal(oidcState{Provider: providerName, Verifier: verifier, Nonce: nonce})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode sign-in state: %w", err)
+	}
+	if err := s.redisClient.Set(ctx, oidcStateKey(stateKey), payload, OIDCStateTTL).Err(); err != nil {
+		return "", "", fmt.Errorf("failed to save sign-in state: %w", err)
+	}
+	authURL, err := provider.AuthCodeURL(ctx, stateKey, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, stateKey, nil
+}
+
+// Complete finishes a login: it consumes the state, exchanges the code,
+// verifies the ID token and returns the local user it belongs to
+func (s *OIDCService) Complete(ctx context.Context, providerName, stateKey, code string) (*models.User, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	claims, err := s.verify(ctx, provider, stateKey, code)
+	if err != nil {
+		return nil, err
+	}
+	return s.resolveUser(ctx, provider, claims)
+}
+
+// verify consumes the state and returns the claims of the ID token the
+// code is exchanged for
+func (s *OIDCService) verify(ctx context.Context, provider *oidcProvider, stateKey, code string) (oidc.Claims, error) {
+	if stateKey == "" || code == "" {
+		return nil, ErrInvalidOIDCState
+	}
+	// GETDEL makes every state single use, even across replicas
+	payload, err := s.redisClient.GetDel(ctx, oidcStateKey(stateKey)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, fmt.Errorf("failed to load sign-in state: %w", err)
+	}
+	var state oidcState
+	if err := json.Unmarshal(payload, &state); err != nil || state.Provider != provider.Name() {
+		return nil, ErrInvalidOIDCState
+	}
+
+	tokens, err := provider.Exchange(ctx, code, state.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	return provider.VerifyIDToken(ctx, tokens.IDToken, state.Nonce)
+}
+
+// resolveUser finds the user an identity belongs to, linking it to an
+// account with the same verified email or creating one if allowed
+func (s *OIDCService) resolveUser(ctx context.Context, provider *oidcProvider, claims oidc.Claims) (*models.User, error) {
+	now := time.Now()
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider.Name(), claims.Subject()).First(&identity).Error
+		switch {
+		case err == nil:
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrSSOSignupDisabled
+				}
+				return fmt.Errorf("failed to load user: %w", err)
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := s.linkOrCreate(tx, provider, claims, &user); err != nil {
+				return err
+			}
+			identity = models.UserIdentity{UserID: user.ID, Provider: provider.Name(), Subject: claims.Subject()}
+		default:
+			return fmt.Errorf("failed to load identity: %w", err)
+		}
+
+		identity.Email = claims.Email()
+		identity.LastLoginAt = &now
+		if err := tx.Save(&identity).Error; err != nil {
+			return fmt.Errorf("failed to save identity: %w", err)
+		}
+
+		if role, ok := provider.role(claims); ok && role != user.Role {
+			if err := tx.Model(&user).Update("role", role).Error; err != nil {
+				return fmt.Errorf("failed to update role: %w", err)
+			}
+			user.Role = role
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrAccountDisabled
+	}
+	return &user, nil
+}
+
+func (s *OIDCService) linkOrCreate(tx *gorm.DB, provider *oidcProvider, claims oidc.Claims, user *models.User) error {
+	email := claims.Email()
+	if email == "" {
+		return ErrSSOEmailRequired
+	}
+
+	err := tx.Where("LOWER(email) = ?", email).First(user).Error
+	if err == nil {
+		if !s.linkable(claims) {
+			return ErrSSOAccountExists
+		}
+		// Whoever registered an unverified account may not own the
+		// address, so its password and sessions stop working
+		if user.EmailVerifiedAt == nil {
+			now := time.Now()
+			if err := tx.Model(user).Updates(map[string]interface{}{
+				"email_verified_at": now,
+				"password":          "",
+				"token_version":     gorm.Expr("token_version + 1"),
+			}).Error; err != nil {
+				return fmt.Errorf("failed to mark email verified: %w", err)
+			}
+			if err := tx.Where("user_id = ?", user.ID).Delete(&models.APIKey{}).Error; err != nil {
+				return fmt.Errorf("failed to revoke api keys: %w", err)
+			}
+			user.EmailVerifiedAt = &now
+			user.Password = ""
+			user.TokenVersion++
+		}
+		log.Printf("oidc: linked %s login to user %d", provider.Name(), user.ID)
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+	if !s.opts.AutoProvision {
+		return ErrSSOSignupDisabled
+	}
+
+	username, err := uniqueUsername(tx, claims)
+	if err != nil {
+		return err
+	}
+	// An empty password hash never matches, so SSO-only accounts cannot
+	// sign in with a password
+	*user = models.User{Email: email, Username: username, Role: "user", IsActive: true}
+	if claims.EmailVerified() {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	log.Printf("oidc: provisioned user %d from %s", user.ID, provider.Name())
+	return nil
+}
+
+// linkable reports whether a login may take over the existing account
+// with its email. An unverified address could belong to anyone at the
+// provider, so it never does.
+func (s *OIDCService) linkable(claims oidc.Claims) bool {
+	return s.opts.LinkByEmail && claims.EmailVerified()
+}
+
+// role maps the configured claim to a local role; ok is false when the
+// provider does not manage roles
+func (p *oidcProvider) role(claims oidc.Claims) (string, bool) {
+	if p.roleClaim == "" {
+		return "", false
+	}
+	for _, value := range claims.Strings(p.roleClaim) {
+		if p.roleMap[value] == "admin" {
+			return "admin", true
+		}
+	}
+	return "user", true
+}
+
+var usernameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// uniqueUsername derives a free username from the preferred username or
+// the email's local part, adding a numeric suffix when it is taken
+func uniqueUsername(tx *gorm.DB, claims oidc.Claims) (string, error) {
+	base := claims.String("preferred_username")
+	if base == "" || strings.Contains(base, "@") {
+		base, _, _ = strings.Cut(claims.Email(), "@")
+	}
+	base = strings.Trim(usernameChars.ReplaceAllString(base, ""), ".-_")
+	if base == "" {
+		base = "user"
+	}
+	candidate := base
+	for i := 2; ; i++ {
+		var count int64
+		if err := tx.Unscoped().Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", fmt.Errorf("failed to check username: %w", err)
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+func oidcStateKey(state string) string {
+	return "oidc:state:" + state
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+
+	"likemind-backend/internal/oidc"
+	"likemind-backend/internal/oidc/oidctest"
+)
+
+// newTestOIDCService configures the providers "dev" and "other" against
+// one fake IdP. Logins that reach the database are out of reach here, so
+// tests stop at verify.
+func newTestOIDCService(t *testing.T, opts OIDCOptions) (*OIDCService, *oidctest.Server, *miniredis.Miniredis) {
+	t.Helper()
+	idp, err := oidctest.New("", "likemind", "secret")
+	if err != nil {
+		t.Fatalf("oidctest.New: %v", err)
+	}
+	ts := httptest.NewServer(idp)
+	t.Cleanup(ts.Close)
+	idp.Issuer = ts.URL
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	s := NewOIDCService(nil, client, opts)
+	for _, name := range []string{"dev", "other"} {
+		provider := oidc.NewProvider(oidc.Config{
+			Name:         name,
+			Issuer:       ts.URL,
+			ClientID:     "likemind",
+			ClientSecret: "secret",
+			RedirectURL:  "http://app.test/api/v1/auth/oidc/" + name + "/callback",
+			Scopes:       []string{"email", "profile"},
+		}, ts.Client())
+		if err := s.AddProvider(provider, "Dev", "groups", "admins=admin, staff=user"); err != nil {
+			t.Fatalf("AddProvider: %v", err)
+		}
+	}
+	return s, idp, mr
+}
+
+// beginLogin starts a login and signs user in at the IdP, returning the
+// state and code the callback receives
+func beginLogin(t *testing.T, s *OIDCService, idp *oidctest.Server, user oidctest.User) (string, string) {
+	t.Helper()
+	authURL, state, err := s.Begin(context.Background(), "dev")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	callback, err := idp.Login(authURL, user)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if callback.Query().Get("state") != state {
+		t.Fatalf("callback state = %q, want %q", callback.Query().Get("state"), state)
+	}
+	return state, callback.Query().Get("code")
+}
+
+func TestOIDCServiceAddProvider(t *testing.T) {
+	s, _, _ := newTestOIDCService(t, OIDCOptions{})
+	if infos := s.Providers(); len(infos) != 2 || infos[0].Name != "dev" || infos[1].LoginURL != "/api/v1/auth/oidc/other/login" {
+		t.Fatalf("Providers = %+v", infos)
+	}
+	provider := oidc.NewProvider(oidc.Config{Name: "dev"}, nil)
+	if err := s.AddProvider(provider, "Dev", "", ""); err == nil {
+		t.Error("AddProvider accepted a duplicate name")
+	}
+	for _, roleMap := range []string{"admins=owner", "admins", "admins=admin,staff"} {
+		provider := oidc.NewProvider(oidc.Config{Name: "new"}, nil)
+		if err := s.AddProvider(provider, "New", "groups", roleMap); err == nil {
+			t.Errorf("AddProvider accepted role map %q", roleMap)
+		}
+	}
+}
+
+func TestOIDCServiceStateIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	s, idp, mr := newTestOIDCService(t, OIDCOptions{})
+	user := oidctest.User{Email: "jane@example.com"}
+
+	state, code := beginLogin(t, s, idp, user)
+	if !mr.Exists(oidcStateKey(state)) || mr.TTL(oidcStateKey(state)) != OIDCStateTTL {
+		t.Fatalf("Begin stored no state with a %v TTL", OIDCStateTTL)
+	}
+	if _, err := s.verify(ctx, s.providers["dev"], state, code); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if _, err := s.verify(ctx, s.providers["dev"], state, code); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("verify of a used state = %v, want ErrInvalidOIDCState", err)
+	}
+
+	// A state is only good for the provider it was started with
+	state, code = beginLogin(t, s, idp, user)
+	if _, err := s.Complete(ctx, "other", state, code); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("Complete with another provider = %v, want ErrInvalidOIDCState", err)
+	}
+
+	state, code = beginLogin(t, s, idp, user)
+	mr.FastForward(OIDCStateTTL)
+	if _, err := s.Complete(ctx, "dev", state, code); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("Complete after the state expired = %v, want ErrInvalidOIDCState", err)
+	}
+
+	for _, tc := range []struct{ provider, state, code string }{
+		{"dev", "", code},
+		{"dev", state, ""},
+		{"dev", "forged", code},
+	} {
+		if _, err := s.Complete(ctx, tc.provider, tc.state, tc.code); !errors.Is(err, ErrInvalidOIDCState) {
+			t.Errorf("Complete(%q, %q, %q) = %v, want ErrInvalidOIDCState", tc.provider, tc.state, tc.code, err)
+		}
+	}
+	if _, _, err := s.Begin(ctx, "missing"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Begin(missing) = %v, want ErrUnknownProvider", err)
+	}
+	if _, err := s.Complete(ctx, "missing", state, code); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Complete(missing) = %v, want ErrUnknownProvider", err)
+	}
+}
+
+func TestOIDCServiceBindsCodeToState(t *testing.T) {
+	ctx := context.Background()
+	s, idp, _ := newTestOIDCService(t, OIDCOptions{})
+	user := oidctest.User{Email: "jane@example.com"}
+
+	// A code redeemed under another login's state carries the wrong PKCE
+	// verifier
+	_, code := beginLogin(t, s, idp, user)
+	otherState, _ := beginLogin(t, s, idp, user)
+	if _, err := s.Complete(ctx, "dev", otherState, code); !errors.Is(err, oidc.ErrExchange) {
+		t.Fatalf("Complete with another login's state = %v, want ErrExchange", err)
+	}
+
+	// and an ID token must carry the nonce of the login it answers
+	idp.EditClaims = func(c jwt.MapClaims) { c["nonce"] = "from-another-login" }
+	state, code := beginLogin(t, s, idp, user)
+	if _, err := s.Complete(ctx, "dev", state, code); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("Complete with another nonce = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestOIDCProviderRole(t *testing.T) {
+	s, idp, _ := newTestOIDCService(t, OIDCOptions{})
+	for _, tc := range []struct {
+		groups []string
+		want   string
+	}{
+		{[]string{"staff", "admins"}, "admin"},
+		{[]string{"staff"}, "user"},
+		{[]string{"Admins"}, "user"},
+		{nil, "user"},
+	} {
+		state, code := beginLogin(t, s, idp, oidctest.User{Email: "jane@example.com", Groups: tc.groups})
+		claims, err := s.verify(context.Background(), s.providers["dev"], state, code)
+		if err != nil {
+			t.Fatalf("verify: %v", err)
+		}
+		if role, ok := s.providers["dev"].role(claims); !ok || role != tc.want {
+			t.Errorf("role(groups %v) = %q, %v; want %q", tc.groups, role, ok, tc.want)
+		}
+	}
+
+	nested := &oidcProvider{roleClaim: "realm_access.roles", roleMap: map[string]string{"platform-admin": "admin"}}
+	claims := oidc.Claims{"realm_access": map[string]interface{}{"roles": []interface{}{"platform-admin"}}}
+	if role, ok := nested.role(claims); !ok || role != "admin" {
+		t.Errorf("role(realm_access.roles) = %q, %v; want admin", role, ok)
+	}
+	if _, ok := (&oidcProvider{}).role(claims); ok {
+		t.Error("a provider without a role claim manages roles")
+	}
+}
+
+func TestOIDCServiceLinksOnlyVerifiedEmails(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		linkByEmail bool
+		verified    bool
+		edit        func(jwt.MapClaims)
+		want        bool
+	}{
+		{"verified", true, true, nil, true},
+		{"unverified", true, false, nil, false},
+		{"verified as a string", true, false, func(c jwt.MapClaims) { c["email_verified"] = "true" }, true},
+		{"linking disabled", false, true, nil, false},
+	} {
+		s, idp, _ := newTestOIDCService(t, OIDCOptions{LinkByEmail: tc.linkByEmail})
+		idp.EditClaims = tc.edit
+		state, code := beginLogin(t, s, idp, oidctest.User{Email: "jane@example.com", EmailVerified: tc.verified})
+		claims, err := s.verify(context.Background(), s.providers["dev"], state, code)
+		if err != nil {
+			t.Fatalf("%s: verify: %v", tc.name, err)
+		}
+		if got := s.linkable(claims); got != tc.want {
+			t.Errorf("%s: linkable = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestOIDCLoginURLCarriesPKCE(t *testing.T) {
+	s, _, mr := newTestOIDCService(t, OIDCOptions{})
+	authURL, state, err := s.Begin(context.Background(), "dev")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	stored, _ := mr.Get(oidcStateKey(state))
+	var saved oidcState
+	if err := json.Unmarshal([]byte(stored), &saved); err != nil {
+		t.Fatalf("stored state %q: %v", stored, err)
+	}
+	if u.Query().Get("code_challenge") != oidc.Challenge(saved.Verifier) || u.Query().Get("nonce") != saved.Nonce {
+		t.Fatalf("login URL %s does not match stored state %+v", authURL, saved)
+	}
+}
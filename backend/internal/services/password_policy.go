@@ -0,0 +1,99 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcryptMaxBytes is the longest password bcrypt hashes without truncating
+const bcryptMaxBytes = 72
+
+// ErrWeakPassword is returned for passwords the policy rejects; the wrapped
+// message says which rule failed
+var ErrWeakPassword = errors.New("password does not meet the password policy")
+
+// PasswordPolicy decides which new passwords are acceptable. It applies
+// when a password is set, never to existing passwords at login.
+type PasswordPolicy struct {
+	MinLength  int // characters
+	MinClasses int // of lower case, upper case, digits and symbols
+	breached   map[[sha1.Size]byte]struct{}
+}
+
+// NewPasswordPolicy creates a policy, loading breachedFile when set. The
+// file has one entry per line: a known-breached password, or its SHA-1 in
+// hex as in the Have I Been Pwned downloads ("HASH" or "HASH:COUNT").
+func NewPasswordPolicy(minLength, minClasses int, breachedFile string) (*PasswordPolicy, error) {
+	p := &PasswordPolicy{MinLength: minLength, MinClasses: minClasses}
+	if breachedFile == "" {
+		return p, nil
+	}
+	f, err := os.Open(breachedFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p.breached = make(map[[sha1.Size]byte]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); len(hash) == 2*sha1.Size {
+			var sum [sha1.Size]byte
+			if _, err := hex.Decode(sum[:], []byte(hash)); err == nil {
+				p.breached[sum] = struct{}{}
+				continue
+			}
+		}
+		p.breached[sha1.Sum([]byte(line))] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password file: %w", err)
+	}
+	return p, nil
+}
+
+// Validate checks a new password against the policy
+func (p *PasswordPolicy) Validate(password string) error {
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, p.MinLength)
+	}
+	if len(password) > bcryptMaxBytes {
+		return fmt.Errorf("%w: must be at most %d bytes", ErrWeakPassword, bcryptMaxBytes)
+	}
+	if p.MinClasses > 1 && characterClasses(password) < p.MinClasses {
+		return fmt.Errorf("%w: must mix at least %d of lower case letters, upper case letters, digits and symbols",
+			ErrWeakPassword, p.MinClasses)
+	}
+	if _, found := p.breached[sha1.Sum([]byte(password))]; found {
+		return fmt.Errorf("%w: appears in a list of breached passwords", ErrWeakPassword)
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
@@ -0,0 +1,453 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"text/template"
+	"text/template/parse"
+
+	"gorm.io/gorm"
+
+	"likemind-backend/internal/models"
+)
+
+var (
+	// ErrPromptNotFound is returned for unknown template names or versions
+	ErrPromptNotFound = errors.New("prompt template not found")
+	// ErrPromptExists is returned when creating a name that is already in use
+	ErrPromptExists = errors.New("prompt template already exists")
+	// ErrInvalidPrompt is returned for bad names, unparsable templates and
+	// templates that fail to render
+	ErrInvalidPrompt = errors.New("invalid prompt template")
+)
+
+const (
+	maxRenderedPromptSize = 64 << 10
+	// maxPromptSteps bounds the range iterations and template calls of one
+	// render, which cost time even when they produce no output
+	maxPromptSteps = 10000
+	// maxPromptVariableValues and maxPromptVariableDepth bound the data a
+	// template is rendered with
+	maxPromptVariableValues = 2000
+	maxPromptVariableDepth  = 8
+)
+
+// promptStepFunc is called at the start of every range iteration and
+// template call; see countSteps
+const promptStepFunc = "_step"
+
+var promptNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,99}$`)
+
+// PromptRef selects a template version and the variables to render it
+// with. Version 0 means the latest version.
+type PromptRef struct {
+	Name      string                 `json:"name"`
+	Version   int                    `json:"version,omitempty"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// PromptRequest is the content of a new template version
+type PromptRequest struct {
+	Description string                 `json:"description"`
+	Template    string                 `json:"template" binding:"required"`
+	Defaults    map[string]interface{} `json:"defaults"`
+}
+
+// RenderedPrompt is the output of rendering a template
+type RenderedPrompt struct {
+	Name      string   `json:"name,omitempty"`
+	Version   int      `json:"version,omitempty"`
+	Text      string   `json:"text"`
+	Variables []string `json:"variables"` // variables the template references
+}
+
+// PromptService stores versioned prompt templates and renders them
+type PromptService struct {
+	db *gorm.DB
+}
+
+func NewPromptService(db *gorm.DB) *PromptService {
+	return &PromptService{db: db}
+}
+
+// Create stores version 1 of a new template. A name whose versions were all
+// deleted continues its numbering.
+func (s *PromptService) Create(ctx context.Context, userID uint, name string, req PromptRequest) (*models.PromptTemplate, error) {
+	if !promptNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w: name must be lowercase letters, digits, '.', '_' or '-'", ErrInvalidPrompt)
+	}
+	return s.addVersion(ctx, userID, name, req, true)
+}
+
+// AddVersion stores a new version of an existing template. Only the user
+// who created the template, or an admin, may change it.
+func (s *PromptService) AddVersion(ctx context.Context, userID uint, admin bool, name string, req PromptRequest) (*models.PromptTemplate, error) {
+	if err := s.checkOwner(ctx, userID, admin, name); err != nil {
+		return nil, err
+	}
+	return s.addVersion(ctx, userID, name, req, false)
+}
+
+// addVersion stores the next version of name; with create set the name
+// must not have any live versions
+func (s *PromptService) addVersion(ctx context.Context, userID uint, name string, req PromptRequest, create bool) (*models.PromptTemplate, error) {
+	if _, err := parsePrompt(name, req.Template); err != nil {
+		return nil, err
+	}
+	defaults := ""
+	if len(req.Defaults) > 0 {
+		data, err := json.Marshal(req.Defaults)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPrompt, err)
+		}
+		defaults = string(data)
+	}
+
+	prompt := &models.PromptTemplate{
+		Name:        name,
+		Description: req.Description,
+		Template:    req.Template,
+		Defaults:    defaults,
+		CreatedBy:   userID,
+	}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Saves of one name queue behind each other until commit, so the
+		// version read below cannot be taken by a concurrent save. A lock
+		// on the name also covers names that have no rows yet.
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "prompt_templates:"+name).Error; err != nil {
+			return err
+		}
+		if create {
+			var count int64
+			if err := tx.Model(&models.PromptTemplate{}).Where("name = ?", name).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrPromptExists
+			}
+		}
+
+		// Deleted versions keep their numbers so references never change meaning
+		var latest int
+		if err := tx.Unscoped().Model(&models.PromptTemplate{}).Where("name = ?", name).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		prompt.Version = latest + 1
+		return tx.Create(prompt).Error
+	})
+	if errors.Is(err, ErrPromptExists) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save prompt template: %w", err)
+	}
+	return prompt, nil
+}
+
+// List returns the latest version of every template
+func (s *PromptService) List(ctx context.Context) ([]models.PromptTemplate, error) {
+	var prompts []models.PromptTemplate
+	if err := s.db.WithContext(ctx).
+		Where("version = (SELECT MAX(p.version) FROM prompt_templates p WHERE p.name = prompt_templates.name AND p.deleted_at IS NULL)").
+		Order("name").Find(&prompts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list prompt templates: %w", err)
+	}
+	return prompts, nil
+}
+
+// Versions returns every version of a template, newest first
+func (s *PromptService) Versions(ctx context.Context, name string) ([]models.PromptTemplate, error) {
+	var prompts []models.PromptTemplate
+	if err := s.db.WithContext(ctx).Where("name = ?", name).Order("version DESC").Find(&prompts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list prompt versions: %w", err)
+	}
+	if len(prompts) == 0 {
+		return nil, ErrPromptNotFound
+	}
+	return prompts, nil
+}
+
+// Get returns one version of a template, or the latest when version is 0
+func (s *PromptService) Get(ctx context.Context, name string, version int) (*models.PromptTemplate, error) {
+	query := s.db.WithContext(ctx).Where("name = ?", name)
+	if version > 0 {
+		query = query.Where("version = ?", version)
+	}
+	var prompt models.PromptTemplate
+	if err := query.Order("version DESC").First(&prompt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPromptNotFound
+		}
+		return nil, fmt.Errorf("failed to load prompt template: %w", err)
+	}
+	return &prompt, nil
+}
+
+// Delete removes one version of a template, or all of them when version is 0
+func (s *PromptService) Delete(ctx context.Context, userID uint, admin bool, name string, version int) error {
+	if err := s.checkOwner(ctx, userID, admin, name); err != nil {
+		return err
+	}
+	query := s.db.WithContext(ctx).Where("name = ?", name)
+	if version > 0 {
+		query = query.Where("version = ?", version)
+	}
+	result := query.Delete(&models.PromptTemplate{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete prompt template: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrPromptNotFound
+	}
+	return nil
+}
+
+// checkOwner allows admins and the creator of a template's first
+// remaining version
+func (s *PromptService) checkOwner(ctx context.Context, userID uint, admin bool, name string) error {
+	var first models.PromptTemplate
+	if err := s.db.WithContext(ctx).Where("name = ?", name).Order("version").First(&first).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPromptNotFound
+		}
+		return fmt.Errorf("failed to load prompt template: %w", err)
+	}
+	if !admin && first.CreatedBy != userID {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// Render renders the referenced template version. Variables override the
+// template's defaults.
+func (s *PromptService) Render(ctx context.Context, ref PromptRef) (*RenderedPrompt, error) {
+	prompt, err := s.Get(ctx, ref.Name, ref.Version)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]interface{})
+	if prompt.Defaults != "" {
+		if err := json.Unmarshal([]byte(prompt.Defaults), &vars); err != nil {
+			return nil, fmt.Errorf("failed to decode prompt defaults: %w", err)
+		}
+	}
+	for k, v := range ref.Variables {
+		vars[k] = v
+	}
+
+	rendered, err := renderPrompt(prompt.Name, prompt.Template, vars)
+	if err != nil {
+		return nil, err
+	}
+	rendered.Name, rendered.Version = prompt.Name, prompt.Version
+	return rendered, nil
+}
+
+// Preview renders an unsaved template
+func (s *PromptService) Preview(text string, vars map[string]interface{}) (*RenderedPrompt, error) {
+	return renderPrompt("preview", text, vars)
+}
+
+// SystemMessage renders ref as a system message, or returns nil when ref
+// names no template
+func (s *PromptService) SystemMessage(ctx context.Context, ref *PromptRef) (*models.ChatMessage, error) {
+	if ref == nil || ref.Name == "" {
+		return nil, nil
+	}
+	rendered, err := s.Render(ctx, *ref)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ChatMessage{Role: "system", Content: rendered.Text}, nil
+}
+
+func parsePrompt(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").
+		Funcs(template.FuncMap{promptStepFunc: func() string { return "" }}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPrompt, err)
+	}
+	countSteps(tmpl)
+	return tmpl, nil
+}
+
+func renderPrompt(name, text string, vars map[string]interface{}) (*RenderedPrompt, error) {
+	if err := checkPromptVariables(vars); err != nil {
+		return nil, err
+	}
+	tmpl, err := parsePrompt(name, text)
+	if err != nil {
+		return nil, err
+	}
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+
+	steps := 0
+	tmpl.Funcs(template.FuncMap{promptStepFunc: func() (string, error) {
+		steps++
+		if steps > maxPromptSteps {
+			return "", fmt.Errorf("template exceeds %d loop iterations", maxPromptSteps)
+		}
+		return "", nil
+	}})
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&limitedBuffer{buf: &out, limit: maxRenderedPromptSize}, vars); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPrompt, err)
+	}
+	return &RenderedPrompt{Text: out.String(), Variables: templateVariables(tmpl)}, nil
+}
+
+// countSteps inserts a call of promptStepFunc at the start of every range
+// body and every template, so loops and recursion that print nothing still
+// reach the step limit
+func countSteps(tmpl *template.Template) {
+	step := template.Must(template.New("").
+		Funcs(template.FuncMap{promptStepFunc: func() string { return "" }}).
+		Parse("{{" + promptStepFunc + "}}")).Tree.Root.Nodes[0]
+	prepend := func(list *parse.ListNode) {
+		list.Nodes = append([]parse.Node{step}, list.Nodes...)
+	}
+
+	var walk func(list *parse.ListNode)
+	walk = func(list *parse.ListNode) {
+		if list == nil {
+			return
+		}
+		for _, node := range list.Nodes {
+			switch node := node.(type) {
+			case *parse.IfNode:
+				walk(node.List)
+				walk(node.ElseList)
+			case *parse.WithNode:
+				walk(node.List)
+				walk(node.ElseList)
+			case *parse.RangeNode:
+				walk(node.List)
+				walk(node.ElseList)
+				if node.List != nil {
+					prepend(node.List)
+				}
+			}
+		}
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil && t.Tree.Root != nil {
+			walk(t.Tree.Root)
+			prepend(t.Tree.Root)
+		}
+	}
+}
+
+// checkPromptVariables bounds the number and nesting of variable values,
+// which decide how often a template's loops run
+func checkPromptVariables(vars map[string]interface{}) error {
+	count := 0
+	var check func(v interface{}, depth int) error
+	check = func(v interface{}, depth int) error {
+		if count++; count > maxPromptVariableValues {
+			return fmt.Errorf("%w: variables hold more than %d values", ErrInvalidPrompt, maxPromptVariableValues)
+		}
+		if depth > maxPromptVariableDepth {
+			return fmt.Errorf("%w: variables are nested more than %d levels deep", ErrInvalidPrompt, maxPromptVariableDepth)
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for _, e := range v {
+				if err := check(e, depth+1); err != nil {
+					return err
+				}
+			}
+		case []interface{}:
+			for _, e := range v {
+				if err := check(e, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return check(vars, 0)
+}
+
+// limitedBuffer stops templates that loop into huge outputs
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.buf.Len()+len(p) > b.limit {
+		return 0, fmt.Errorf("rendered prompt exceeds %d bytes", b.limit)
+	}
+	return b.buf.Write(p)
+}
+
+// templateVariables lists the top-level fields a template reads from its
+// data, such as "topic" in {{.topic}}. Fields inside range and with blocks
+// refer to a different dot and are skipped.
+func templateVariables(tmpl *template.Template) []string {
+	seen := make(map[string]bool)
+	var walk func(node parse.Node)
+	walkPipe := func(pipe *parse.PipeNode) {
+		if pipe == nil {
+			return
+		}
+		for _, cmd := range pipe.Cmds {
+			for _, arg := range cmd.Args {
+				switch arg := arg.(type) {
+				case *parse.FieldNode:
+					seen[arg.Ident[0]] = true
+				case *parse.PipeNode:
+					walk(arg)
+				}
+			}
+		}
+	}
+	walk = func(node parse.Node) {
+		switch node := node.(type) {
+		case *parse.ListNode:
+			if node == nil {
+				return
+			}
+			for _, n := range node.Nodes {
+				walk(n)
+			}
+		case *parse.ActionNode:
+			walkPipe(node.Pipe)
+		case *parse.PipeNode:
+			walkPipe(node)
+		case *parse.IfNode:
+			walkPipe(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.RangeNode:
+			walkPipe(node.Pipe)
+			walk(node.ElseList)
+		case *parse.WithNode:
+			walkPipe(node.Pipe)
+			walk(node.ElseList)
+		case *parse.TemplateNode:
+			walkPipe(node.Pipe)
+		}
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walk(t.Tree.Root)
+		}
+	}
+
+	vars := make([]string, 0, len(seen))
+	for name := range seen {
+		vars = append(vars, name)
+	}
+	sort.Strings(vars)
+	return vars
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderPrompt(t *testing.T) {
+	rendered, err := renderPrompt("t", `Topic: {{.topic}}{{range .items}} {{.}}{{end}}`, map[string]interface{}{
+		"topic": "go",
+		"items": []interface{}{"a", "b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered.Text != "Topic: go a b" {
+		t.Fatalf("got %q", rendered.Text)
+	}
+	if want := []string{"items", "topic"}; !reflect.DeepEqual(rendered.Variables, want) {
+		t.Fatalf("got variables %v, want %v", rendered.Variables, want)
+	}
+}
+
+func TestRenderPromptStopsSilentLoops(t *testing.T) {
+	items := make([]interface{}, 500)
+	for i := range items {
+		items[i] = i
+	}
+	vars := map[string]interface{}{"items": items}
+
+	for name, text := range map[string]string{
+		"nested ranges": `{{range .items}}{{range $.items}}{{range $.items}}{{end}}{{end}}{{end}}`,
+		"recursion":     `{{define "r"}}{{template "r" .}}{{template "r" .}}{{end}}{{template "r" .}}`,
+	} {
+		start := time.Now()
+		_, err := renderPrompt("t", text, vars)
+		if !errors.Is(err, ErrInvalidPrompt) || !strings.Contains(err.Error(), "loop iterations") {
+			t.Errorf("%s: got %v, want the step limit", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: took %s", name, elapsed)
+		}
+	}
+}
+
+func TestRenderPromptBoundsVariables(t *testing.T) {
+	var deep interface{} = "leaf"
+	for i := 0; i < maxPromptVariableDepth+1; i++ {
+		deep = []interface{}{deep}
+	}
+	wide := make([]interface{}, maxPromptVariableValues)
+
+	for name, vars := range map[string]map[string]interface{}{
+		"deep": {"v": deep},
+		"wide": {"v": wide},
+	} {
+		if _, err := renderPrompt("t", `{{.v}}`, vars); !errors.Is(err, ErrInvalidPrompt) {
+			t.Errorf("%s: got %v, want ErrInvalidPrompt", name, err)
+		}
+	}
+}
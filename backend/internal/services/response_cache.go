@@ -0,0 +1,358 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"likemind-backend/internal/embedding"
+	"likemind-backend/internal/models"
+)
+
+// CacheMode selects how a route reuses earlier model responses
+type CacheMode string
+
+const (
+	// CacheExact reuses a response only for an identical prompt
+	CacheExact CacheMode = "exact"
+	// CacheSemantic also reuses a response when the last user message is
+	// close enough in embedding space and the rest of the prompt is identical
+	CacheSemantic CacheMode = "semantic"
+)
+
+// Routes that can opt in to the response cache
+const (
+	CacheRouteGenerate = "generate"
+	CacheRouteChat     = "chat"
+)
+
+// CachePolicy is a route's opt-in to the response cache
+type CachePolicy struct {
+	Mode CacheMode
+	TTL  time.Duration
+}
+
+// ResponseCacheOptions configures the response cache
+type ResponseCacheOptions struct {
+	Policies   map[string]CachePolicy // by route; routes without a policy are not cached
+	Threshold  float64                // minimum cosine similarity for a semantic hit
+	MaxEntries int                    // semantic candidates kept per prompt context
+}
+
+// ResponseCache stores model responses in Redis so repeated prompts skip
+// the model. Entries are scoped to the workspace of the request and, on
+// routes whose prompts carry per-user context such as chat, to the user, so
+// a similar prompt never returns another tenant's or user's answer.
+type ResponseCache struct {
+	client   *redis.Client
+	embedder embedding.Embedder
+	opts     ResponseCacheOptions
+}
+
+const responseCachePrefix = "llmcache:"
+
+func NewResponseCache(client *redis.Client, embedder embedding.Embedder, opts ResponseCacheOptions) *ResponseCache {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 500
+	}
+	return &ResponseCache{client: client, embedder: embedder, opts: opts}
+}
+
+// ParseCachePolicies reads route policies such as
+// "generate=semantic,chat=exact:600", where the optional number overrides
+// defaultTTL in seconds
+func ParseCachePolicies(value string, defaultTTL time.Duration) (map[string]CachePolicy, error) {
+	policies := make(map[string]CachePolicy)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		route, spec, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected route=mode[:ttl], got %q", pair)
+		}
+		route = strings.TrimSpace(route)
+		if route != CacheRouteGenerate && route != CacheRouteChat {
+			return nil, fmt.Errorf("unknown cache route %q", route)
+		}
+		mode, ttlValue, hasTTL := strings.Cut(strings.TrimSpace(spec), ":")
+		policy := CachePolicy{Mode: CacheMode(mode), TTL: defaultTTL}
+		if policy.Mode != CacheExact && policy.Mode != CacheSemantic {
+			return nil, fmt.Errorf("unknown cache mode %q for route %s", mode, route)
+		}
+		if hasTTL {
+			seconds, err := strconv.Atoi(ttlValue)
+			if err != nil || seconds <= 0 {
+				return nil, fmt.Errorf("invalid cache TTL %q for route %s", ttlValue, route)
+			}
+			policy.TTL = time.Duration(seconds) * time.Second
+		}
+		policies[route] = policy
+	}
+	return policies, nil
+}
+
+// CacheScope limits which requests share cached responses. UserID is zero
+// on routes whose answers may be shared within the workspace.
+type CacheScope struct {
+	WorkspaceID uint
+	UserID      uint
+}
+
+type cacheRouteKey struct{}
+
+type cacheRoute struct {
+	name  string
+	scope CacheScope
+}
+
+// WithCacheRoute marks generation requests made with ctx as coming from
+// route, applying that route's cache policy within scope
+func WithCacheRoute(ctx context.Context, route string, scope CacheScope) context.Context {
+	return context.WithValue(ctx, cacheRouteKey{}, cacheRoute{name: route, scope: scope})
+}
+
+func requestRoute(ctx context.Context) string {
+	route, _ := ctx.Value(cacheRouteKey{}).(cacheRoute)
+	return route.name
+}
+
+func requestCacheScope(ctx context.Context) CacheScope {
+	route, _ := ctx.Value(cacheRouteKey{}).(cacheRoute)
+	return route.scope
+}
+
+// cachedResponse is a stored model response
+type cachedResponse struct {
+	Content  string    `json:"content"`
+	Model    string    `json:"model,omitempty"`
+	CachedAt time.Time `json:"cached_at"`
+	Vector   []float32 `json:"vector,omitempty"`
+}
+
+// CacheMetadata is reported under "cache" in a generated message's metadata
+type CacheMetadata struct {
+	Hit        bool       `json:"hit"`
+	Mode       CacheMode  `json:"mode"`
+	Similarity float64    `json:"similarity,omitempty"`
+	CachedAt   *time.Time `json:"cached_at,omitempty"`
+}
+
+// cacheLookup is the outcome of one lookup. On a miss it remembers the keys
+// and prompt vector so the generated response can be stored.
+type cacheLookup struct {
+	cache     *ResponseCache
+	policy    CachePolicy
+	exactKey  string
+	bucketKey string
+	vector    []float32
+
+	hit        *cachedResponse
+	hitMode    CacheMode
+	similarity float64
+}
+
+// lookup finds a cached response for messages under the route attached to
+// ctx. A nil cache, a route without a policy or a Redis failure all behave
+// as an uncacheable miss.
+func (c *ResponseCache) lookup(ctx context.Context, request OpenAIRequest, chain []string) *cacheLookup {
+	route := requestRoute(ctx)
+	if c == nil || route == "" {
+		return &cacheLookup{}
+	}
+	policy, ok := c.opts.Policies[route]
+	if !ok {
+		return &cacheLookup{}
+	}
+
+	// The prompt is identified by everything that shapes the answer: the
+	// messages, sampling settings and the model chain
+	request.Model = strings.Join(chain, ",")
+	scope := requestCacheScope(ctx)
+	prefix := fmt.Sprintf("%s%s:%d:%d:", responseCachePrefix, route, scope.WorkspaceID, scope.UserID)
+	l := &cacheLookup{
+		cache:    c,
+		policy:   policy,
+		exactKey: prefix + "exact:" + hashJSON(request),
+	}
+
+	if value, err := c.client.Get(ctx, l.exactKey).Result(); err == nil {
+		var entry cachedResponse
+		if json.Unmarshal([]byte(value), &entry) == nil {
+			l.hit, l.hitMode, l.similarity = &entry, CacheExact, 1
+			return l
+		}
+	} else if err != redis.Nil {
+		log.Printf("ai: response cache lookup failed: %v", err)
+		return &cacheLookup{}
+	}
+
+	last := len(request.Messages) - 1
+	if policy.Mode != CacheSemantic || c.embedder == nil || last < 0 || request.Messages[last].Role != "user" {
+		return l
+	}
+
+	// Semantic candidates share the prompt up to the last user message
+	history := request
+	history.Messages = request.Messages[:last]
+	l.bucketKey = prefix + "semantic:" + c.embedder.Model() + ":" + hashJSON(history)
+
+	vector, err := embedding.EmbedOne(ctx, c.embedder, request.Messages[last].Content)
+	if err != nil {
+		log.Printf("ai: response cache embedding failed: %v", err)
+		l.bucketKey = ""
+		return l
+	}
+	l.vector = vector
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	c.client.ZRemRangeByScore(ctx, l.bucketKey, "-inf", now)
+	members, err := c.client.ZRange(ctx, l.bucketKey, 0, -1).Result()
+	if err != nil {
+		log.Printf("ai: response cache lookup failed: %v", err)
+		return l
+	}
+	for _, member := range members {
+		var entry cachedResponse
+		if json.Unmarshal([]byte(member), &entry) != nil {
+			continue
+		}
+		if sim := cosineSimilarity(vector, entry.Vector); sim >= c.opts.Threshold && sim > l.similarity {
+			entry := entry
+			l.hit, l.hitMode, l.similarity = &entry, CacheSemantic, sim
+		}
+	}
+	return l
+}
+
+// message returns the cached response as an assistant message
+func (l *cacheLookup) message() *models.ChatMessage {
+	return &models.ChatMessage{
+		Role:      "assistant",
+		Content:   l.hit.Content,
+		Model:     l.hit.Model,
+		Metadata:  l.metadata(),
+		CreatedAt: time.Now(),
+	}
+}
+
+// metadata describes the lookup as message metadata, or "" when the route
+// is not cached
+func (l *cacheLookup) metadata() string {
+	if l.cache == nil {
+		return ""
+	}
+	meta := CacheMetadata{Hit: l.hit != nil, Mode: l.policy.Mode}
+	if l.hit != nil {
+		meta.Mode = l.hitMode
+		meta.Similarity = math.Round(l.similarity*10000) / 10000
+		meta.CachedAt = &l.hit.CachedAt
+	}
+	data, _ := json.Marshal(map[string]CacheMetadata{"cache": meta})
+	return string(data)
+}
+
+// store saves a freshly generated response under the keys of a miss
+func (l *cacheLookup) store(ctx context.Context, response *models.ChatMessage) {
+	if l.cache == nil || l.hit != nil || response.Content == "" {
+		return
+	}
+	client := l.cache.client
+	entry := cachedResponse{Content: response.Content, Model: response.Model, CachedAt: time.Now().UTC()}
+
+	if data, err := json.Marshal(entry); err == nil {
+		if err := client.Set(ctx, l.exactKey, data, l.policy.TTL).Err(); err != nil {
+			log.Printf("ai: response cache store failed: %v", err)
+		}
+	}
+
+	if l.bucketKey == "" || l.vector == nil {
+		return
+	}
+	entry.Vector = l.vector
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	expires := float64(time.Now().Add(l.policy.TTL).Unix())
+	pipe := client.Pipeline()
+	pipe.ZAdd(ctx, l.bucketKey, redis.Z{Score: expires, Member: data})
+	// Keep the entries that expire last
+	pipe.ZRemRangeByRank(ctx, l.bucketKey, 0, int64(-l.cache.opts.MaxEntries-1))
+	pipe.Expire(ctx, l.bucketKey, l.policy.TTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("ai: response cache store failed: %v", err)
+	}
+}
+
+// Invalidate deletes cached responses for route, or for every route when
+// route is empty, and returns how many keys were removed
+func (c *ResponseCache) Invalidate(ctx context.Context, route string) (int, error) {
+	if c == nil {
+		return 0, nil
+	}
+	pattern := responseCachePrefix + "*"
+	if route != "" {
+		pattern = responseCachePrefix + route + ":*"
+	}
+
+	deleted := 0
+	iter := c.client.Scan(ctx, 0, pattern, 500).Iterator()
+	var batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := c.client.Del(ctx, batch...).Result()
+		deleted += int(n)
+		batch = batch[:0]
+		return err
+	}
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == 500 {
+			if err := flush(); err != nil {
+				return deleted, fmt.Errorf("failed to invalidate response cache: %w", err)
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, fmt.Errorf("failed to scan response cache: %w", err)
+	}
+	if err := flush(); err != nil {
+		return deleted, fmt.Errorf("failed to invalidate response cache: %w", err)
+	}
+	return deleted, nil
+}
+
+func hashJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
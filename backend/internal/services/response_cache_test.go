@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"likemind-backend/internal/embedding"
+	"likemind-backend/internal/models"
+)
+
+func newTestResponseCache(t *testing.T) *ResponseCache {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewResponseCache(client, embedding.NewLocalEmbedder(64), ResponseCacheOptions{
+		Policies: map[string]CachePolicy{
+			CacheRouteGenerate: {Mode: CacheSemantic, TTL: time.Hour},
+			CacheRouteChat:     {Mode: CacheSemantic, TTL: time.Hour},
+		},
+		Threshold: 0.5,
+	})
+}
+
+func TestResponseCacheIsScoped(t *testing.T) {
+	c := newTestResponseCache(t)
+	chain := []string{"test-model"}
+	request := OpenAIRequest{Messages: []Message{{Role: "user", Content: "What is our refund policy?"}}}
+	similar := OpenAIRequest{Messages: []Message{{Role: "user", Content: "what is our refund policy"}}}
+
+	owner := WithCacheRoute(context.Background(), CacheRouteChat, CacheScope{WorkspaceID: 1, UserID: 1})
+	miss := c.lookup(owner, request, chain)
+	if miss.hit != nil {
+		t.Fatal("empty cache returned a hit")
+	}
+	miss.store(owner, &models.ChatMessage{Content: "Refunds within 30 days", Model: "test-model"})
+
+	for _, tc := range []struct {
+		name  string
+		route string
+		scope CacheScope
+		want  CacheMode
+	}{
+		{"same user, exact", CacheRouteChat, CacheScope{WorkspaceID: 1, UserID: 1}, CacheExact},
+		{"other user", CacheRouteChat, CacheScope{WorkspaceID: 1, UserID: 2}, ""},
+		{"other workspace", CacheRouteChat, CacheScope{WorkspaceID: 2, UserID: 1}, ""},
+		{"other route", CacheRouteGenerate, CacheScope{WorkspaceID: 1}, ""},
+	} {
+		l := c.lookup(WithCacheRoute(context.Background(), tc.route, tc.scope), request, chain)
+		if got := lookupMode(l); got != tc.want {
+			t.Errorf("%s: lookup = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	// A similar prompt is only a semantic hit within the same scope
+	if got := lookupMode(c.lookup(owner, similar, chain)); got != CacheSemantic {
+		t.Errorf("similar prompt, same scope: lookup = %q, want %q", got, CacheSemantic)
+	}
+	other := WithCacheRoute(context.Background(), CacheRouteChat, CacheScope{WorkspaceID: 2, UserID: 1})
+	if got := lookupMode(c.lookup(other, similar, chain)); got != "" {
+		t.Errorf("similar prompt, other workspace: lookup = %q, want a miss", got)
+	}
+}
+
+func TestResponseCacheInvalidate(t *testing.T) {
+	c := newTestResponseCache(t)
+	chain := []string{"test-model"}
+	request := OpenAIRequest{Messages: []Message{{Role: "user", Content: "hello"}}}
+	for _, route := range []string{CacheRouteChat, CacheRouteGenerate} {
+		ctx := WithCacheRoute(context.Background(), route, CacheScope{WorkspaceID: 1})
+		c.lookup(ctx, request, chain).store(ctx, &models.ChatMessage{Content: "hi"})
+	}
+
+	// An exact key and a semantic bucket per route
+	if n, err := c.Invalidate(context.Background(), CacheRouteChat); err != nil || n != 2 {
+		t.Fatalf("Invalidate(chat) = %d, %v; want 2 keys", n, err)
+	}
+	ctx := WithCacheRoute(context.Background(), CacheRouteGenerate, CacheScope{WorkspaceID: 1})
+	if lookupMode(c.lookup(ctx, request, chain)) != CacheExact {
+		t.Fatal("Invalidate(chat) removed generate entries")
+	}
+	if n, err := c.Invalidate(context.Background(), ""); err != nil || n != 2 {
+		t.Fatalf("Invalidate() = %d, %v; want 2 keys", n, err)
+	}
+}
+
+func lookupMode(l *cacheLookup) CacheMode {
+	if l.hit == nil {
+		return ""
+	}
+	return l.hitMode
+}
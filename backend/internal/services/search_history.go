@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"likemind-backend/internal/models"
+)
+
+const (
+	// suggestWindow limits suggestions to recent searches
+	suggestWindow = 90 * 24 * time.Hour
+	// minPopularUsers is how many distinct users must have run a query
+	// before it is suggested to others, so one user's searches never leak
+	minPopularUsers = 2
+)
+
+// Suggestion sources
+const (
+	SuggestionHistory = "history"
+	SuggestionPopular = "popular"
+)
+
+// ErrSearchQueryNotFound is returned when a history entry does not exist or belongs to another user
+var ErrSearchQueryNotFound = errors.New("search query not found")
+
+// Suggestion is an autocomplete candidate
+type Suggestion struct {
+	Query  string `json:"query"`
+	Source string `json:"source"`
+	Count  int64  `json:"count"`
+}
+
+// logSearch records a completed search; failures are logged, not returned,
+// so history never breaks search itself
+func (s *SearchService) logSearch(ctx context.Context, workspaceID, userID uint, query string, results []SearchResult, latency time.Duration) {
+	ids := make([]uint, len(results))
+	for i, r := range results {
+		ids[i] = r.DocumentID
+	}
+	data, err := json.Marshal(ids)
+	if err != nil {
+		log.Printf("search: failed to marshal result IDs: %v", err)
+		return
+	}
+
+	entry := &models.SearchQuery{
+		UserID:      userID,
+		WorkspaceID: workspaceID,
+		Query:       query,
+		Normalized:  normalizeQuery(query),
+		Results:     string(data),
+		ResultCount: len(results),
+		LatencyMs:   latency.Milliseconds(),
+	}
+	if err := s.db.WithContext(ctx).Create(entry).Error; err != nil {
+		log.Printf("search: failed to log query: %v", err)
+	}
+}
+
+// GetHistory returns a page of the user's searches in the workspace, newest
+// first
+func (s *SearchService) GetHistory(ctx context.Context, workspaceID, userID uint, limit, offset int) ([]models.SearchQuery, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.SearchQuery{}).Where("user_id = ? AND workspace_id = ?", userID, workspaceID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count search history: %w", err)
+	}
+
+	var entries []models.SearchQuery
+	if err := query.
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&entries).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load search history: %w", err)
+	}
+	return entries, total, nil
+}
+
+func (s *SearchService) DeleteHistoryEntry(ctx context.Context, userID, id uint) error {
+	result := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&models.SearchQuery{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete search query: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSearchQueryNotFound
+	}
+	return nil
+}
+
+// ClearHistory deletes all of the user's searches in the workspace and
+// returns how many were removed
+func (s *SearchService) ClearHistory(ctx context.Context, workspaceID, userID uint) (int64, error) {
+	result := s.db.WithContext(ctx).Where("user_id = ? AND workspace_id = ?", userID, workspaceID).Delete(&models.SearchQuery{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to clear search history: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Suggest completes prefix from the user's own frequent queries first, then
+// from queries popular across users, both within the workspace
+func (s *SearchService) Suggest(ctx context.Context, workspaceID, userID uint, prefix string, limit int) ([]Suggestion, error) {
+	pattern := escapeLike(normalizeQuery(prefix)) + "%"
+	since := time.Now().Add(-suggestWindow)
+
+	var own []Suggestion
+	if err := s.db.WithContext(ctx).
+		Model(&models.SearchQuery{}).
+		Select("normalized AS query, COUNT(*) AS count").
+		Where("user_id = ? AND workspace_id = ? AND normalized LIKE ? AND created_at >= ?", userID, workspaceID, pattern, since).
+		Group("normalized").
+		Order("count DESC, MAX(created_at) DESC").
+		Limit(limit).
+		Scan(&own).Error; err != nil {
+		return nil, fmt.Errorf("failed to load query suggestions: %w", err)
+	}
+
+	var popular []Suggestion
+	if len(own) < limit {
+		if err := s.db.WithContext(ctx).
+			Model(&models.SearchQuery{}).
+			Select("normalized AS query, COUNT(*) AS count").
+			Where("workspace_id = ? AND normalized LIKE ? AND created_at >= ?", workspaceID, pattern, since).
+			Group("normalized").
+			Having("COUNT(DISTINCT user_id) >= ?", minPopularUsers).
+			Order("count DESC").
+			Limit(limit).
+			Scan(&popular).Error; err != nil {
+			return nil, fmt.Errorf("failed to load popular queries: %w", err)
+		}
+	}
+
+	suggestions := make([]Suggestion, 0, limit)
+	seen := make(map[string]bool)
+	for _, group := range []struct {
+		source string
+		items  []Suggestion
+	}{{SuggestionHistory, own}, {SuggestionPopular, popular}} {
+		for _, item := range group.items {
+			if len(suggestions) >= limit || seen[item.Query] || item.Query == "" {
+				continue
+			}
+			seen[item.Query] = true
+			item.Source = group.source
+			suggestions = append(suggestions, item)
+		}
+	}
+	return suggestions, nil
+}
+
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// escapeLike escapes LIKE wildcards using Postgres' default backslash escape
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -1,8 +1,524 @@
 package services
 
-// SearchService is a placeholder for future search features
-type SearchService struct{}
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
-func NewSearchService(_ string) *SearchService {
-	return &SearchService{}
+	"gorm.io/gorm"
+
+	"likemind-backend/internal/chunking"
+	"likemind-backend/internal/jobs"
+	"likemind-backend/internal/models"
+	"likemind-backend/internal/vectordb"
+)
+
+// KnowledgeCollection prefixes the Qdrant collections holding chunk vectors
+const KnowledgeCollection = "likemind_knowledge"
+
+// JobTypeIndexDocuments embeds documents and stores them in the vector database
+const JobTypeIndexDocuments = "search.index"
+
+// JobTypeDeleteVectors removes the vectors of deleted documents
+const JobTypeDeleteVectors = "search.delete_vectors"
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+	// defaultRRFK dampens the influence of top ranks in reciprocal rank fusion
+	defaultRRFK = 60
+	// maxEmbedChars bounds the text sent to the embedding model per document
+	maxEmbedChars   = 8000
+	snippetChars    = 240
+	upsertBatchSize = 100
+)
+
+// ErrEmptyQuery is returned for blank search queries
+var ErrEmptyQuery = errors.New("query must not be empty")
+
+// SearchRequest is a hybrid search. Weights scale each source's
+// contribution to the fused score; a zero weight disables that source.
+type SearchRequest struct {
+	Query         string   `json:"query" binding:"required"`
+	Limit         int      `json:"limit"`
+	KeywordWeight *float64 `json:"keyword_weight"`
+	VectorWeight  *float64 `json:"vector_weight"`
+	RRFK          int      `json:"rrf_k"`
+	DocumentType  string   `json:"document_type"`
+	// CollectionIDs narrows the search to these readable collections, which
+	// may belong to other workspaces. By default every collection of the
+	// active workspace the user can read is searched.
+	CollectionIDs []uint `json:"collection_ids"`
+}
+
+// SourceScores exposes how each retriever ranked a result, for debugging relevance
+type SourceScores struct {
+	KeywordRank  int     `json:"keyword_rank,omitempty"`
+	KeywordScore float64 `json:"keyword_score,omitempty"`
+	VectorRank   int     `json:"vector_rank,omitempty"`
+	VectorScore  float64 `json:"vector_score,omitempty"`
+}
+
+// SearchResult is a document in the fused ranking
+type SearchResult struct {
+	DocumentID   uint         `json:"document_id"`
+	Title        string       `json:"title"`
+	Source       string       `json:"source"`
+	DocumentType string       `json:"document_type"`
+	Snippet      string       `json:"snippet"`
+	Score        float64      `json:"score"`
+	Scores       SourceScores `json:"scores"`
+}
+
+// SearchResponse holds the fused results. Errors lists retrievers that
+// failed; results from the others are still returned.
+type SearchResponse struct {
+	Query   string            `json:"query"`
+	Results []SearchResult    `json:"results"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// SearchService runs keyword and vector retrieval over the knowledge base
+type SearchService struct {
+	db        *gorm.DB
+	aiService *AIService
+	vectors   *vectordb.Client
+	jobs      *jobs.Queue
+	chunking  chunking.Config
+}
+
+func NewSearchService(db *gorm.DB, aiService *AIService, vectors *vectordb.Client, queue *jobs.Queue, chunks chunking.Config) *SearchService {
+	s := &SearchService{
+		db:        db,
+		aiService: aiService,
+		vectors:   vectors,
+		jobs:      queue,
+		chunking:  chunks,
+	}
+	queue.Register(JobTypeIndexDocuments, jobs.Handle(s.indexDocuments))
+	queue.Register(JobTypeDeleteVectors, jobs.Handle(s.deleteVectors))
+	return s
+}
+
+// searchHit is one retriever's view of a document
+type searchHit struct {
+	DocumentID   uint
+	Title        string
+	Source       string
+	DocumentType string
+	Snippet      string
+	Score        float64
+}
+
+// Search runs Postgres full-text and vector similarity search in parallel
+// and merges them with weighted reciprocal rank fusion. Successful searches
+// are logged to the user's history. Only documents in collections the user
+// can read are searched.
+func (s *SearchService) Search(ctx context.Context, workspaceID, userID uint, req SearchRequest) (*SearchResponse, error) {
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, ErrEmptyQuery
+	}
+	start := time.Now()
+	collections, err := readableCollectionIDs(ctx, s.db, workspaceID, userID, req.CollectionIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(collections) == 0 {
+		return &SearchResponse{Query: req.Query, Results: []SearchResult{}}, nil
+	}
+	if req.Limit <= 0 || req.Limit > maxSearchLimit {
+		req.Limit = defaultSearchLimit
+	}
+	if req.RRFK <= 0 {
+		req.RRFK = defaultRRFK
+	}
+	keywordWeight, vectorWeight := 1.0, 1.0
+	if req.KeywordWeight != nil {
+		keywordWeight = *req.KeywordWeight
+	}
+	if req.VectorWeight != nil {
+		vectorWeight = *req.VectorWeight
+	}
+
+	// Fetch deeper than the page so fusion can promote documents that
+	// only one retriever ranks highly
+	depth := req.Limit * 4
+
+	var (
+		wg                      sync.WaitGroup
+		keywordHits, vectorHits []searchHit
+		keywordErr, vectorErr   error
+	)
+	if keywordWeight > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keywordHits, keywordErr = s.keywordSearch(ctx, collections, req.Query, req.DocumentType, depth)
+		}()
+	}
+	if vectorWeight > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vectorHits, vectorErr = s.vectorSearch(ctx, collections, req.Query, req.DocumentType, depth)
+		}()
+	}
+	wg.Wait()
+
+	resp := &SearchResponse{Query: req.Query}
+	if keywordErr != nil || vectorErr != nil {
+		resp.Errors = make(map[string]string)
+	}
+	if keywordErr != nil {
+		log.Printf("search: keyword search failed: %v", keywordErr)
+		resp.Errors["keyword"] = keywordErr.Error()
+	}
+	if vectorErr != nil {
+		log.Printf("search: vector search failed: %v", vectorErr)
+		resp.Errors["vector"] = vectorErr.Error()
+	}
+	// Only fail when no enabled retriever succeeded
+	keywordOK := keywordWeight > 0 && keywordErr == nil
+	vectorOK := vectorWeight > 0 && vectorErr == nil
+	if !keywordOK && !vectorOK {
+		if err := errors.Join(keywordErr, vectorErr); err != nil {
+			return nil, fmt.Errorf("search failed: %w", err)
+		}
+	}
+
+	resp.Results = fuseResults(keywordHits, vectorHits, keywordWeight, vectorWeight, req.RRFK, req.Limit)
+	s.logSearch(ctx, workspaceID, userID, req.Query, resp.Results, time.Since(start))
+	return resp, nil
+}
+
+// fuseResults scores each document as the sum of weight/(k+rank) over the
+// retrievers that returned it
+func fuseResults(keywordHits, vectorHits []searchHit, keywordWeight, vectorWeight float64, k, limit int) []SearchResult {
+	byID := make(map[uint]*SearchResult)
+	get := func(hit searchHit) *SearchResult {
+		r, ok := byID[hit.DocumentID]
+		if !ok {
+			r = &SearchResult{
+				DocumentID:   hit.DocumentID,
+				Title:        hit.Title,
+				Source:       hit.Source,
+				DocumentType: hit.DocumentType,
+				Snippet:      hit.Snippet,
+			}
+			byID[hit.DocumentID] = r
+		}
+		return r
+	}
+
+	for i, hit := range keywordHits {
+		r := get(hit)
+		r.Scores.KeywordRank = i + 1
+		r.Scores.KeywordScore = hit.Score
+		r.Score += keywordWeight / float64(k+i+1)
+		// Keyword snippets highlight the matched terms, so prefer them
+		r.Snippet = hit.Snippet
+	}
+	for i, hit := range vectorHits {
+		r := get(hit)
+		r.Scores.VectorRank = i + 1
+		r.Scores.VectorScore = hit.Score
+		r.Score += vectorWeight / float64(k+i+1)
+	}
+
+	results := make([]SearchResult, 0, len(byID))
+	for _, r := range byID {
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].DocumentID < results[j].DocumentID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// keywordSearch uses the same expression as idx_knowledge_documents_fts so
+// Postgres can serve it from the GIN index
+func (s *SearchService) keywordSearch(ctx context.Context, collections []uint, query, documentType string, limit int) ([]searchHit, error) {
+	sql := `
+SELECT id AS document_id, title, source, document_type,
+	ts_rank_cd(to_tsvector('english', title || ' ' || content), q) AS score,
+	ts_headline('english', content, q, 'MaxFragments=2, MaxWords=30, MinWords=10') AS snippet
+FROM knowledge_documents, websearch_to_tsquery('english', ?) AS q
+WHERE deleted_at IS NULL
+	AND collection_id IN ?
+	AND to_tsvector('english', title || ' ' || content) @@ q`
+	args := []interface{}{query, collections}
+	if documentType != "" {
+		sql += " AND document_type = ?"
+		args = append(args, documentType)
+	}
+	sql += " ORDER BY score DESC, id LIMIT ?"
+	args = append(args, limit)
+
+	var hits []searchHit
+	if err := s.db.WithContext(ctx).Raw(sql, args...).Scan(&hits).Error; err != nil {
+		return nil, fmt.Errorf("failed to run keyword search: %w", err)
+	}
+	return hits, nil
+}
+
+func (s *SearchService) vectorSearch(ctx context.Context, collections []uint, query, documentType string, limit int) ([]searchHit, error) {
+	vector, err := s.aiService.GenerateEmbedding(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	// Vectors from different models are not comparable even at equal dimension
+	model, dimension := s.aiService.EmbeddingModel()
+	filter := &vectordb.Filter{Must: []map[string]interface{}{
+		{"key": "embedding_model", "match": map[string]interface{}{"value": model}},
+		{"key": "collection_id", "match": map[string]interface{}{"any": collections}},
+	}}
+	if documentType != "" {
+		filter.Must = append(filter.Must, map[string]interface{}{
+			"key": "document_type", "match": map[string]interface{}{"value": documentType},
+		})
+	}
+	points, err := s.vectors.Search(ctx, vectorCollection(dimension), vector, limit, filter)
+	if err != nil {
+		if errors.Is(err, vectordb.ErrCollectionNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to run vector search: %w", err)
+	}
+	if len(points) == 0 {
+		return nil, nil
+	}
+
+	// Points are chunks; load them with their documents. The collection is
+	// checked again in case a document moved since it was indexed.
+	ids := make([]uint64, len(points))
+	for i, p := range points {
+		ids[i] = p.ID
+	}
+	var rows []struct {
+		ChunkID uint
+		searchHit
+	}
+	if err := s.db.WithContext(ctx).
+		Table("document_chunks").
+		Select("document_chunks.id AS chunk_id, d.id AS document_id, d.title, d.source, d.document_type, left(document_chunks.content, ?) AS snippet", snippetChars).
+		Joins("JOIN knowledge_documents d ON d.id = document_chunks.document_id AND d.deleted_at IS NULL AND d.collection_id IN ?", collections).
+		Where("document_chunks.id IN ?", ids).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load chunks: %w", err)
+	}
+	byChunk := make(map[uint]searchHit, len(rows))
+	for _, r := range rows {
+		byChunk[r.ChunkID] = r.searchHit
+	}
+
+	// Keep vector order, rank each document by its best chunk and drop
+	// points whose chunk or document no longer exists
+	hits := make([]searchHit, 0, len(points))
+	seen := make(map[uint]bool)
+	for _, p := range points {
+		hit, ok := byChunk[uint(p.ID)]
+		if !ok || seen[hit.DocumentID] {
+			continue
+		}
+		seen[hit.DocumentID] = true
+		hit.Score = p.Score
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// vectorCollection names the Qdrant collection for a vector dimension, so
+// switching to a model of another size never collides with stored vectors
+func vectorCollection(dimension int) string {
+	return fmt.Sprintf("%s_%d", KnowledgeCollection, dimension)
+}
+
+// embeddingID records which model produced a document's vectors
+func embeddingID(model string, dimension int) string {
+	return fmt.Sprintf("%s:%d", model, dimension)
+}
+
+type indexPayload struct {
+	DocumentIDs []uint `json:"document_ids"`
+}
+
+// deleteVectorsPayload names deleted documents and the dimensions of the
+// vector collections they were indexed into
+type deleteVectorsPayload struct {
+	DocumentIDs []uint `json:"document_ids"`
+	Dimensions  []int  `json:"dimensions"`
+}
+
+// QueueIndex schedules documents of the workspace for embedding. Without
+// IDs every document not yet embedded with the current model is queued, up
+// to limit; IDs of other workspaces' documents are dropped.
+func (s *SearchService) QueueIndex(ctx context.Context, workspaceID, userID uint, documentIDs []uint, limit int) (*jobs.Job, []uint, error) {
+	query := s.db.WithContext(ctx).Model(&models.KnowledgeDocument{}).Where("workspace_id = ?", workspaceID)
+	if len(documentIDs) == 0 {
+		current := embeddingID(s.aiService.EmbeddingModel())
+		if err := query.
+			Where("embedding_id IS NULL OR embedding_id <> ?", current).
+			Order("id").
+			Limit(limit).
+			Pluck("id", &documentIDs).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to find unindexed documents: %w", err)
+		}
+	} else {
+		requested := documentIDs
+		documentIDs = nil
+		if err := query.Where("id IN ?", requested).Order("id").Pluck("id", &documentIDs).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to find documents: %w", err)
+		}
+	}
+	if len(documentIDs) == 0 {
+		return nil, documentIDs, nil
+	}
+
+	job, err := s.jobs.Enqueue(ctx, JobTypeIndexDocuments, indexPayload{DocumentIDs: documentIDs}, jobs.WithUserID(userID))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to enqueue indexing: %w", err)
+	}
+	return job, documentIDs, nil
+}
+
+// indexDocuments is the job handler that embeds each document's chunks and
+// replaces the document's points in the vector database. Point IDs are
+// chunk IDs; the payload records the embedding model and dimension.
+func (s *SearchService) indexDocuments(ctx context.Context, payload indexPayload) error {
+	var docs []models.KnowledgeDocument
+	if err := s.db.WithContext(ctx).Where("id IN ?", payload.DocumentIDs).Find(&docs).Error; err != nil {
+		return fmt.Errorf("failed to load documents: %w", err)
+	}
+
+	model, dimension := s.aiService.EmbeddingModel()
+	collection := vectorCollection(dimension)
+	if err := s.vectors.EnsureCollection(ctx, collection, dimension); err != nil {
+		return fmt.Errorf("failed to prepare vector collection: %w", err)
+	}
+
+	for i := range docs {
+		if err := s.indexDocument(ctx, &docs[i], collection, model, dimension); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteVectors is the job handler that removes deleted documents' points,
+// including the current model's collection in case indexing was under way
+func (s *SearchService) deleteVectors(ctx context.Context, payload deleteVectorsPayload) error {
+	_, current := s.aiService.EmbeddingModel()
+	dimensions := map[int]struct{}{current: {}}
+	for _, dimension := range payload.Dimensions {
+		dimensions[dimension] = struct{}{}
+	}
+	filter := vectordb.Filter{Must: []map[string]interface{}{
+		{"key": "document_id", "match": map[string]interface{}{"any": payload.DocumentIDs}},
+	}}
+	for dimension := range dimensions {
+		if err := s.vectors.DeleteByFilter(ctx, vectorCollection(dimension), filter); err != nil {
+			return fmt.Errorf("failed to remove vectors of deleted documents: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SearchService) indexDocument(ctx context.Context, doc *models.KnowledgeDocument, collection, model string, dimension int) error {
+	var chunks []models.DocumentChunk
+	if err := s.db.WithContext(ctx).Where("document_id = ?", doc.ID).Order("chunk_index").Find(&chunks).Error; err != nil {
+		return fmt.Errorf("failed to load chunks: %w", err)
+	}
+	// Documents stored before chunking existed are chunked on first index
+	if len(chunks) == 0 {
+		if err := replaceChunks(s.db.WithContext(ctx), doc, s.chunking); err != nil {
+			return err
+		}
+		if err := s.db.WithContext(ctx).Where("document_id = ?", doc.ID).Order("chunk_index").Find(&chunks).Error; err != nil {
+			return fmt.Errorf("failed to load chunks: %w", err)
+		}
+	}
+
+	// Prefix the title and heading path so chunks keep their context
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		text := doc.Title + "\n"
+		if c.HeadingPath != "" {
+			text += c.HeadingPath + "\n"
+		}
+		text += "\n" + c.Content
+		if len(text) > maxEmbedChars {
+			// Cut on a rune boundary so the text stays valid UTF-8
+			cut := maxEmbedChars
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+			text = text[:cut]
+		}
+		texts[i] = text
+	}
+	vectors, err := s.aiService.GenerateEmbeddings(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("failed to embed document %d: %w", doc.ID, err)
+	}
+
+	filter := vectordb.Filter{Must: []map[string]interface{}{
+		{"key": "document_id", "match": map[string]interface{}{"value": doc.ID}},
+	}}
+	if err := s.vectors.DeleteByFilter(ctx, collection, filter); err != nil {
+		return fmt.Errorf("failed to remove old vectors for document %d: %w", doc.ID, err)
+	}
+
+	points := make([]vectordb.Point, len(chunks))
+	for i, c := range chunks {
+		points[i] = vectordb.Point{
+			ID:     uint64(c.ID),
+			Vector: vectors[i],
+			Payload: map[string]interface{}{
+				"document_id":         doc.ID,
+				"workspace_id":        doc.WorkspaceID,
+				"collection_id":       doc.CollectionID,
+				"chunk_index":         c.ChunkIndex,
+				"heading_path":        c.HeadingPath,
+				"title":               doc.Title,
+				"source":              doc.Source,
+				"document_type":       doc.DocumentType,
+				"embedding_model":     model,
+				"embedding_dimension": dimension,
+			},
+		}
+	}
+	for start := 0; start < len(points); start += upsertBatchSize {
+		end := start + upsertBatchSize
+		if end > len(points) {
+			end = len(points)
+		}
+		if err := s.vectors.Upsert(ctx, collection, points[start:end]); err != nil {
+			return fmt.Errorf("failed to store vectors for document %d: %w", doc.ID, err)
+		}
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.DocumentChunk{}).
+			Where("document_id = ?", doc.ID).
+			Updates(map[string]interface{}{"embedding_model": model, "embedding_dimension": dimension}).Error; err != nil {
+			return fmt.Errorf("failed to record chunk embeddings: %w", err)
+		}
+		if err := tx.Model(doc).Update("embedding_id", embeddingID(model, dimension)).Error; err != nil {
+			return fmt.Errorf("failed to record embedding: %w", err)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"likemind-backend/internal/guardrails"
+	"likemind-backend/internal/jsonschema"
+	"likemind-backend/internal/models"
+)
+
+// StructuredResult is a model response that validated against a schema
+type StructuredResult struct {
+	Object   interface{} `json:"object"`
+	Attempts int         `json:"attempts"`
+	Model    string      `json:"model,omitempty"`
+}
+
+// StructuredOutputError is returned when the model did not produce valid
+// JSON within the retry limit
+type StructuredOutputError struct {
+	Attempts int               `json:"attempts"`
+	Errors   jsonschema.Errors `json:"errors"`
+	Content  string            `json:"content"`
+}
+
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("model output failed schema validation after %d attempts: %v", e.Attempts, e.Errors)
+}
+
+// GenerateStructured asks the model for a JSON object matching schema in
+// JSON mode. Invalid output is sent back with the validation errors and the
+// model is asked to correct it, up to maxRetries more times. schemaText is
+// the schema as shown to the model. The last user message and every answer
+// pass through the guardrails like in GenerateResponse.
+func (s *AIService) GenerateStructured(ctx context.Context, messages []models.ChatMessage, schema *jsonschema.Schema, schemaText string, maxRetries int) (*StructuredResult, error) {
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("no messages provided")
+	}
+
+	vault, messages := s.redactPII(messages)
+	messages, _, err := s.screenInput(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	if s.apiKey == "" {
+		return &StructuredResult{Object: schema.Example(), Attempts: 1}, nil
+	}
+
+	instructions := "Respond only with a JSON object that conforms to this JSON Schema:\n" + schemaText
+	request := s.newOpenAIRequest(append([]models.ChatMessage{{Role: "system", Content: instructions}}, messages...))
+	request.Temperature = 0
+	request.ResponseFormat = &ResponseFormat{Type: "json_object"}
+
+	var lastErr *StructuredOutputError
+	for attempt := 1; attempt <= maxRetries+1; attempt++ {
+		resp, model, err := s.complete(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		raw := resp.Choices[0].Message.Content
+		output, err := s.guardrails.Screen(ctx, guardrails.Output, raw)
+		if err != nil {
+			return nil, err
+		}
+		content := vault.Restore(output.Text)
+
+		value, err := schema.ValidateJSON([]byte(content))
+		if err == nil {
+			return &StructuredResult{Object: value, Attempts: attempt, Model: model}, nil
+		}
+		errs, _ := err.(jsonschema.Errors)
+		lastErr = &StructuredOutputError{Attempts: attempt, Errors: errs, Content: content}
+
+		// Show the model its answer and what was wrong with it
+		feedback, _ := json.Marshal(errs)
+		request.Messages = append(request.Messages,
+			Message{Role: "assistant", Content: raw},
+			Message{Role: "user", Content: "That response does not match the schema. Validation errors: " + string(feedback) + "\nReply with a corrected JSON object only."},
+		)
+	}
+	return nil, lastErr
+}
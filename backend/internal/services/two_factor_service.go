@@ -0,0 +1,500 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"likemind-backend/internal/models"
+	"likemind-backend/internal/totp"
+)
+
+const (
+	// totpSkew accepts codes from one step before or after the current one
+	totpSkew = 1
+	// recoveryCodeCount is how many recovery codes a user gets at a time
+	recoveryCodeCount = 10
+	// maxChallengeAttempts is how many wrong codes end a login challenge
+	maxChallengeAttempts = 5
+)
+
+var (
+	// ErrTwoFactorNotEnrolled is returned when confirming or using 2FA
+	// before enrolling
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication is not set up")
+	// ErrTwoFactorEnabled is returned when enrolling a second time
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrInvalidTwoFactorCode is returned for wrong, expired and reused codes
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	// ErrTwoFactorRequired is returned when disabling 2FA the user's role
+	// must have
+	ErrTwoFactorRequired = errors.New("two-factor authentication is required for your role")
+	// ErrInvalidChallenge is returned for unknown, expired or used login
+	// challenges
+	ErrInvalidChallenge = errors.New("invalid or expired login challenge")
+)
+
+// TwoFactorOptions configures TOTP two-factor authentication
+type TwoFactorOptions struct {
+	Issuer        string   // shown in authenticator apps
+	RequiredRoles []string // roles that must use 2FA, e.g. "admin"
+	ChallengeTTL  time.Duration
+}
+
+// TwoFactorStatus describes a user's 2FA setup
+type TwoFactorStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	Required               bool       `json:"required"`
+	RecoveryCodesRemaining int64      `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorEnrollment is the secret to add to an authenticator app
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// LoginChallenge is returned by a password login instead of a token when
+// a code is needed. SetupRequired means the user's role requires 2FA and
+// they must enroll before finishing the login.
+type LoginChallenge struct {
+	Token         string    `json:"challenge_token"`
+	SetupRequired bool      `json:"setup_required"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+type challengeState struct {
+	UserID uint `json:"user_id"`
+}
+
+// TwoFactorService manages TOTP enrollment, recovery codes and the second
+// step of password logins. Secrets are stored encrypted.
+type TwoFactorService struct {
+	db          *gorm.DB
+	redisClient *redis.Client
+	guard       *LoginGuard
+	aead        cipher.AEAD
+	opts        TwoFactorOptions
+}
+
+func NewTwoFactorService(db *gorm.DB, redisClient *redis.Client, guard *LoginGuard, secret string, opts TwoFactorOptions) (*TwoFactorService, error) {
+	// A key of its own, derived like the account token key
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("likemind totp secrets"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorService{db: db, redisClient: redisClient, guard: guard, aead: aead, opts: opts}, nil
+}
+
+// Required reports whether user's role must use 2FA
+func (s *TwoFactorService) Required(user *models.User) bool {
+	for _, role := range s.opts.RequiredRoles {
+		if role == user.Role {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns user's 2FA setup
+func (s *TwoFactorService) Status(ctx context.Context, user *models.User) (*TwoFactorStatus, error) {
+	status := &TwoFactorStatus{Required: s.Required(user)}
+	factor, err := s.load(ctx, s.db, user.ID)
+	if err != nil && !errors.Is(err, ErrTwoFactorNotEnrolled) {
+		return nil, err
+	}
+	if factor != nil && factor.EnabledAt != nil {
+		status.Enabled = true
+		status.EnabledAt = factor.EnabledAt
+		if err := s.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Count(&status.RecoveryCodesRemaining).Error; err != nil {
+			return nil, fmt.Errorf("failed to count recovery codes: %w", err)
+		}
+	}
+	return status, nil
+}
+
+// Enroll starts setting up 2FA with a new secret, replacing any earlier
+// unconfirmed one. It takes effect once confirmed with a code.
+func (s *TwoFactorService) Enroll(ctx context.Context, user *models.User) (*TwoFactorEnrollment, error) {
+	factor, err := s.load(ctx, s.db, user.ID)
+	if err != nil && !errors.Is(err, ErrTwoFactorNotEnrolled) {
+		return nil, err
+	}
+	if factor != nil && factor.EnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	encrypted, err := s.encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+	if factor == nil {
+		factor = &models.TwoFactor{UserID: user.ID}
+	}
+	factor.Secret = encrypted
+	factor.LastStep = 0
+	if err := s.db.WithContext(ctx).Save(factor).Error; err != nil {
+		return nil, fmt.Errorf("failed to save two-factor secret: %w", err)
+	}
+	return &TwoFactorEnrollment{Secret: secret, URI: totp.URI(s.opts.Issuer, user.Email, secret)}, nil
+}
+
+// Confirm enables 2FA once the user proves their authenticator works, and
+// returns their recovery codes. They are only shown this once.
+func (s *TwoFactorService) Confirm(ctx context.Context, user *models.User, code string) ([]string, error) {
+	var codes []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		factor, err := s.load(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if factor.EnabledAt != nil {
+			return ErrTwoFactorEnabled
+		}
+		if err := s.checkTOTP(tx, factor, code); err != nil {
+			return err
+		}
+		if err := tx.Model(factor).Update("enabled_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to enable two-factor authentication: %w", err)
+		}
+		codes, err = s.replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns 2FA off after checking a current code or recovery code
+func (s *TwoFactorService) Disable(ctx context.Context, user *models.User, code string) error {
+	if s.Required(user) {
+		return ErrTwoFactorRequired
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		factor, err := s.loadEnabled(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkCode(tx, factor, code); err != nil {
+			return err
+		}
+		return s.remove(tx, user.ID)
+	})
+}
+
+// RegenerateRecoveryCodes replaces user's recovery codes after checking a
+// current code
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, user *models.User, code string) ([]string, error) {
+	var codes []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		factor, err := s.loadEnabled(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkTOTP(tx, factor, code); err != nil {
+			return err
+		}
+		codes, err = s.replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Reset removes a user's 2FA, e.g. by an admin after a lost device. Users
+// whose role requires 2FA enroll again at their next login.
+func (s *TwoFactorService) Reset(ctx context.Context, userID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.remove(tx, userID)
+	})
+}
+
+// BeginLogin returns a challenge when user needs a second step after their
+// password, or nil when the login can finish
+func (s *TwoFactorService) BeginLogin(ctx context.Context, user *models.User) (*LoginChallenge, error) {
+	factor, err := s.load(ctx, s.db, user.ID)
+	if err != nil && !errors.Is(err, ErrTwoFactorNotEnrolled) {
+		return nil, err
+	}
+	enabled := factor != nil && factor.EnabledAt != nil
+	if !enabled && !s.Required(user) {
+		return nil, nil
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	payload, err := json.Marshal(challengeState{UserID: user.ID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode challenge: %w", err)
+	}
+	if err := s.redisClient.Set(ctx, challengeKey(token), payload, s.opts.ChallengeTTL).Err(); err != nil {
+		return nil, fmt.Errorf("failed to save challenge: %w", err)
+	}
+	return &LoginChallenge{Token: token, SetupRequired: !enabled, ExpiresAt: time.Now().Add(s.opts.ChallengeTTL)}, nil
+}
+
+// SetupChallenge enrolls the user of a challenge whose role requires 2FA
+// but who has not set it up; CompleteLogin then confirms it
+func (s *TwoFactorService) SetupChallenge(ctx context.Context, token string) (*TwoFactorEnrollment, error) {
+	user, err := s.challengeUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.Enroll(ctx, user)
+}
+
+// CompleteLogin checks the code for a challenge and returns the user. For
+// users enrolling during login it confirms 2FA and also returns their new
+// recovery codes. Wrong codes count as failed logins.
+func (s *TwoFactorService) CompleteLogin(ctx context.Context, token, code, clientIP string) (*models.User, []string, error) {
+	user, err := s.challengeUser(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var codes []string
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		factor, err := s.load(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if factor.EnabledAt != nil {
+			return s.checkCode(tx, factor, code)
+		}
+		// Finishing setup required by the user's role
+		if err := s.checkTOTP(tx, factor, code); err != nil {
+			return err
+		}
+		if err := tx.Model(factor).Update("enabled_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to enable two-factor authentication: %w", err)
+		}
+		codes, err = s.replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		s.failChallenge(ctx, token, user, clientIP)
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Only one request can delete the challenge, so it is used once
+	deleted, err := s.redisClient.Del(ctx, challengeKey(token), challengeAttemptsKey(token)).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to consume challenge: %w", err)
+	}
+	if deleted == 0 {
+		return nil, nil, ErrInvalidChallenge
+	}
+	return user, codes, nil
+}
+
+func (s *TwoFactorService) challengeUser(ctx context.Context, token string) (*models.User, error) {
+	payload, err := s.redisClient.Get(ctx, challengeKey(token)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, fmt.Errorf("failed to load challenge: %w", err)
+	}
+	var state challengeState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, state.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if !user.IsActive {
+		return nil, ErrAccountDisabled
+	}
+	return &user, nil
+}
+
+// failChallenge counts a wrong code against the challenge and the account
+func (s *TwoFactorService) failChallenge(ctx context.Context, token string, user *models.User, clientIP string) {
+	attempts, err := s.redisClient.Incr(ctx, challengeAttemptsKey(token)).Result()
+	if err == nil && attempts == 1 {
+		err = s.redisClient.Expire(ctx, challengeAttemptsKey(token), s.opts.ChallengeTTL).Err()
+	}
+	if err == nil && attempts >= maxChallengeAttempts {
+		err = s.redisClient.Del(ctx, challengeKey(token), challengeAttemptsKey(token)).Err()
+	}
+	if err != nil {
+		log.Printf("two-factor: failed to count attempt for user %d: %v", user.ID, err)
+	}
+	if _, err := s.guard.RecordFailure(ctx, user.Email, clientIP); err != nil {
+		log.Printf("two-factor: %v", err)
+	}
+}
+
+func (s *TwoFactorService) load(ctx context.Context, db *gorm.DB, userID uint) (*models.TwoFactor, error) {
+	var factor models.TwoFactor
+	if err := db.WithContext(ctx).Where("user_id = ?", userID).First(&factor).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTwoFactorNotEnrolled
+		}
+		return nil, fmt.Errorf("failed to load two-factor settings: %w", err)
+	}
+	return &factor, nil
+}
+
+func (s *TwoFactorService) loadEnabled(ctx context.Context, db *gorm.DB, userID uint) (*models.TwoFactor, error) {
+	factor, err := s.load(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if factor.EnabledAt == nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	return factor, nil
+}
+
+// checkCode accepts a current TOTP code or an unused recovery code
+func (s *TwoFactorService) checkCode(tx *gorm.DB, factor *models.TwoFactor, code string) error {
+	err := s.checkTOTP(tx, factor, code)
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		return err
+	}
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", factor.UserID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to use recovery code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// checkTOTP accepts a current code that is newer than the last one used,
+// so an observed code cannot be replayed
+func (s *TwoFactorService) checkTOTP(tx *gorm.DB, factor *models.TwoFactor, code string) error {
+	secret, err := s.decrypt(factor.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok || step <= factor.LastStep {
+		return ErrInvalidTwoFactorCode
+	}
+	result := tx.Model(&models.TwoFactor{}).
+		Where("id = ? AND last_step < ?", factor.ID, step).
+		Update("last_step", step)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record code use: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	factor.LastStep = step
+	return nil
+}
+
+func (s *TwoFactorService) replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		codes[i] = code[:4] + "-" + code[4:]
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+func (s *TwoFactorService) remove(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.TwoFactor{}).Error; err != nil {
+		return fmt.Errorf("failed to delete two-factor settings: %w", err)
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	return nil
+}
+
+func (s *TwoFactorService) encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *TwoFactorService) decrypt(ciphertext string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", errors.New("failed to decrypt two-factor secret")
+	}
+	nonce, body := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, body, nil)
+	if err != nil {
+		// Usually JWT_SECRET changed since the secret was stored
+		return "", errors.New("failed to decrypt two-factor secret")
+	}
+	return string(plaintext), nil
+}
+
+// hashRecoveryCode normalizes a code as users may type it and hashes it;
+// the codes are random enough that a fast hash is safe
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func challengeKey(token string) string {
+	return "2fa:challenge:" + token
+}
+
+func challengeAttemptsKey(token string) string {
+	return "2fa:challenge:" + token + ":attempts"
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"likemind-backend/internal/models"
+)
+
+func newTestTwoFactorService(t *testing.T) (*TwoFactorService, *LoginGuard, *miniredis.Miniredis) {
+	t.Helper()
+	guard, mr := newTestLoginGuard(t, LoginGuardOptions{
+		MaxAccountFailures: 3,
+		Window:             15 * time.Minute,
+		Lockout:            15 * time.Minute,
+	})
+	s, err := NewTwoFactorService(nil, guard.redisClient, guard, "secret", TwoFactorOptions{ChallengeTTL: 5 * time.Minute})
+	if err != nil {
+		t.Fatalf("NewTwoFactorService: %v", err)
+	}
+	return s, guard, mr
+}
+
+func TestFailChallengeEndsChallenge(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newTestTwoFactorService(t)
+	user := &models.User{ID: 1, Email: "a@example.com"}
+	if err := s.redisClient.Set(ctx, challengeKey("token"), `{"user_id":1}`, time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i < maxChallengeAttempts; i++ {
+		s.failChallenge(ctx, "token", user, "10.0.0.1")
+		if n, _ := s.redisClient.Exists(ctx, challengeKey("token")).Result(); n != 1 {
+			t.Fatalf("challenge ended after %d wrong codes, want %d", i, maxChallengeAttempts)
+		}
+	}
+	s.failChallenge(ctx, "token", user, "10.0.0.1")
+	if n, _ := s.redisClient.Exists(ctx, challengeKey("token"), challengeAttemptsKey("token")).Result(); n != 0 {
+		t.Fatal("challenge still usable after the last wrong code")
+	}
+}
+
+func TestPasswordLoginKeepsChallengeFailures(t *testing.T) {
+	ctx := context.Background()
+	s, guard, mr := newTestTwoFactorService(t)
+	user := &models.User{ID: 1, Email: "a@example.com"}
+
+	// Someone who knows the password keeps getting new challenges
+	for i := 0; i < 3; i++ {
+		mr.FastForward(loginMaxDelay)
+		if wait, err := guard.Reserve(ctx, user.Email, "10.0.0.1"); err != nil || wait != 0 {
+			t.Fatalf("login %d: Reserve = %v, %v; want to proceed", i, wait, err)
+		}
+		// The password was right, but the login waits for a code
+		if err := guard.Refund(ctx, user.Email, "10.0.0.1"); err != nil {
+			t.Fatalf("Refund: %v", err)
+		}
+		s.failChallenge(ctx, "token", user, "10.0.0.1")
+	}
+	mr.FastForward(loginMaxDelay)
+	if wait, err := guard.Reserve(ctx, user.Email, "10.0.0.1"); err != nil || wait <= loginMaxDelay {
+		t.Fatalf("Reserve after repeated wrong codes = %v, %v; want the lockout", wait, err)
+	}
+}
@@ -1,24 +1,59 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
+
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
 	"likemind-backend/internal/models"
 )
 
+// activeCacheTTL is how long AuthMiddleware trusts a user's active flag and
+// token version; deactivation takes effect on other replicas, and password
+// resets on all of them, within this time
+const activeCacheTTL = 30 * time.Second
+
+var (
+	// ErrInvalidCredentials is returned for unknown emails and wrong passwords
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrAccountDisabled is returned for users whose IsActive flag is off
+	ErrAccountDisabled = errors.New("account disabled")
+	// ErrUserNotFound is returned for unknown user IDs
+	ErrUserNotFound = errors.New("user not found")
+	// ErrTokenRevoked is returned for JWTs issued before the user's last
+	// password reset
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
 // UserService handles user related database operations
 type UserService struct {
-	db *gorm.DB
+	db        *gorm.DB
+	passwords *PasswordPolicy
+
+	mu     sync.Mutex
+	active map[uint]activeEntry
+}
+
+type activeEntry struct {
+	active       bool
+	tokenVersion int
+	checked      time.Time
 }
 
-func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+func NewUserService(db *gorm.DB, passwords *PasswordPolicy) *UserService {
+	return &UserService{db: db, passwords: passwords, active: make(map[uint]activeEntry)}
 }
 
 // CreateUser registers a new user and hashes the password
 func (s *UserService) CreateUser(email, username, password string) (*models.User, error) {
+	if err := s.passwords.Validate(password); err != nil {
+		return nil, err
+	}
 	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
@@ -53,10 +88,89 @@ func (s *UserService) GetByID(id uint) (*models.User, error) {
 func (s *UserService) ValidateCredentials(email, password string) (*models.User, error) {
 	user, err := s.GetByEmail(email)
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
 		return nil, err
 	}
+	// Accounts created through single sign-on have no password
+	if user.Password == "" {
+		return nil, ErrInvalidCredentials
+	}
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, fmt.Errorf("invalid credentials")
+		return nil, ErrInvalidCredentials
+	}
+	// Only reported for the right password, so it reveals nothing to guessers
+	if !user.IsActive {
+		return nil, ErrAccountDisabled
 	}
 	return user, nil
 }
+
+// CheckActive returns ErrAccountDisabled for deactivated or deleted users.
+// Results are cached briefly because it runs on every request.
+func (s *UserService) CheckActive(ctx context.Context, userID uint) error {
+	_, err := s.activeEntry(ctx, userID)
+	return err
+}
+
+// CheckToken is CheckActive for a JWT, which is also rejected with
+// ErrTokenRevoked once the user's token version has moved past the one it
+// was issued with
+func (s *UserService) CheckToken(ctx context.Context, userID uint, tokenVersion int) error {
+	entry, err := s.activeEntry(ctx, userID)
+	if err == nil && tokenVersion > entry.tokenVersion {
+		// Issued after the cached version was read
+		s.Forget(userID)
+		entry, err = s.activeEntry(ctx, userID)
+	}
+	if err != nil {
+		return err
+	}
+	if tokenVersion != entry.tokenVersion {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+func (s *UserService) activeEntry(ctx context.Context, userID uint) (activeEntry, error) {
+	s.mu.Lock()
+	entry, ok := s.active[userID]
+	s.mu.Unlock()
+	if !ok || time.Since(entry.checked) > activeCacheTTL {
+		var user models.User
+		err := s.db.WithContext(ctx).Select("id", "is_active", "token_version").First(&user, userID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return entry, fmt.Errorf("failed to load user: %w", err)
+		}
+		entry = activeEntry{active: err == nil && user.IsActive, tokenVersion: user.TokenVersion, checked: time.Now()}
+		s.mu.Lock()
+		s.active[userID] = entry
+		s.mu.Unlock()
+	}
+	if !entry.active {
+		return entry, ErrAccountDisabled
+	}
+	return entry, nil
+}
+
+// Forget drops the cached active flag and token version of a user whose
+// account was changed elsewhere
+func (s *UserService) Forget(userID uint) {
+	s.mu.Lock()
+	delete(s.active, userID)
+	s.mu.Unlock()
+}
+
+// SetActive enables or disables a user's account
+func (s *UserService) SetActive(ctx context.Context, userID uint, active bool) (*models.User, error) {
+	result := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("is_active", active)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update user: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrUserNotFound
+	}
+	s.Forget(userID)
+	return s.GetByID(userID)
+}
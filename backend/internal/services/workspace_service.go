@@ -0,0 +1,697 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"likemind-backend/internal/models"
+)
+
+// Organization roles, from most to least privileged
+const (
+	OrganizationOwner  = "owner"
+	OrganizationAdmin  = "admin"
+	OrganizationMember = "member"
+)
+
+// Workspace roles, from most to least privileged. Organization owners and
+// admins are admins of every workspace in the organization.
+const (
+	WorkspaceAdmin  = "admin"
+	WorkspaceEditor = "editor"
+	WorkspaceViewer = "viewer"
+)
+
+var (
+	// ErrOrganizationNotFound is returned when an organization does not exist
+	// or the user is not a member
+	ErrOrganizationNotFound = errors.New("organization not found")
+	// ErrWorkspaceNotFound is returned when a workspace does not exist or the
+	// user has no access to it
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	// ErrMemberNotFound is returned for unknown users and memberships
+	ErrMemberNotFound = errors.New("member not found")
+	// ErrNotOrganizationMember is returned when adding a user to a workspace
+	// of an organization they do not belong to
+	ErrNotOrganizationMember = errors.New("user is not a member of the organization")
+	// ErrLastOwner is returned when a change would leave an organization
+	// without an owner
+	ErrLastOwner = errors.New("an organization must keep at least one owner")
+	// ErrNameRequired is returned for blank organization and workspace names
+	ErrNameRequired = errors.New("name must not be empty")
+	// ErrInvitationNotFound is returned for unknown invitations and ones
+	// addressed to another user
+	ErrInvitationNotFound = errors.New("invitation not found")
+	// ErrAlreadyMember is returned when inviting a user who already belongs
+	// to the organization
+	ErrAlreadyMember = errors.New("user is already a member of the organization")
+)
+
+// CanEditWorkspace reports whether a workspace role may change the
+// workspace's documents, agents and web sources
+func CanEditWorkspace(role string) bool {
+	return role == WorkspaceAdmin || role == WorkspaceEditor
+}
+
+// WorkspaceService manages organizations, workspaces and their members
+type WorkspaceService struct {
+	db *gorm.DB
+}
+
+func NewWorkspaceService(db *gorm.DB) *WorkspaceService {
+	return &WorkspaceService{db: db}
+}
+
+// ResolveWorkspace returns the workspace a request acts in and the user's
+// role there. Workspace 0 selects the user's first workspace, creating a
+// personal one for users who have none.
+func (s *WorkspaceService) ResolveWorkspace(ctx context.Context, userID, workspaceID uint) (uint, string, error) {
+	if workspaceID != 0 {
+		role, err := workspaceRole(ctx, s.db, workspaceID, userID)
+		if err != nil {
+			return 0, "", err
+		}
+		return workspaceID, role, nil
+	}
+
+	workspaces, err := s.ListWorkspaces(ctx, userID)
+	if err != nil {
+		return 0, "", err
+	}
+	if len(workspaces) > 0 {
+		return workspaces[0].ID, workspaces[0].Role, nil
+	}
+	workspace, err := s.createPersonalWorkspace(ctx, userID)
+	if err != nil {
+		return 0, "", err
+	}
+	return workspace.ID, WorkspaceAdmin, nil
+}
+
+func (s *WorkspaceService) createPersonalWorkspace(ctx context.Context, userID uint) (*models.Workspace, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMemberNotFound
+		}
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	_, workspace, err := s.CreateOrganization(ctx, userID, user.Username, "Personal")
+	return workspace, err
+}
+
+// workspaceRole resolves the role of userID in an active workspace. It is
+// shared by the services that scope records to workspaces.
+func workspaceRole(ctx context.Context, db *gorm.DB, workspaceID, userID uint) (string, error) {
+	// Workspaces of a deleted organization are gone for admins and
+	// workspace members alike
+	var workspace models.Workspace
+	if err := db.WithContext(ctx).
+		Joins("JOIN organizations ON organizations.id = workspaces.organization_id AND organizations.deleted_at IS NULL").
+		First(&workspace, workspaceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrWorkspaceNotFound
+		}
+		return "", fmt.Errorf("failed to load workspace: %w", err)
+	}
+
+	orgRole, err := organizationRole(ctx, db, workspace.OrganizationID, userID)
+	if err != nil && !errors.Is(err, ErrOrganizationNotFound) {
+		return "", err
+	}
+	if orgRole == OrganizationOwner || orgRole == OrganizationAdmin {
+		return WorkspaceAdmin, nil
+	}
+
+	var member models.WorkspaceMember
+	if err := db.WithContext(ctx).
+		Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
+		First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrWorkspaceNotFound
+		}
+		return "", fmt.Errorf("failed to load workspace member: %w", err)
+	}
+	return member.Role, nil
+}
+
+func organizationRole(ctx context.Context, db *gorm.DB, organizationID, userID uint) (string, error) {
+	var member models.OrganizationMember
+	err := db.WithContext(ctx).
+		Joins("JOIN organizations ON organizations.id = organization_members.organization_id AND organizations.deleted_at IS NULL").
+		Where("organization_members.organization_id = ? AND organization_members.user_id = ?", organizationID, userID).
+		First(&member).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrOrganizationNotFound
+		}
+		return "", fmt.Errorf("failed to load organization member: %w", err)
+	}
+	return member.Role, nil
+}
+
+func (s *WorkspaceService) requireOrganizationAdmin(ctx context.Context, organizationID, userID uint) (string, error) {
+	role, err := organizationRole(ctx, s.db, organizationID, userID)
+	if err != nil {
+		return "", err
+	}
+	if role != OrganizationOwner && role != OrganizationAdmin {
+		return "", ErrPermissionDenied
+	}
+	return role, nil
+}
+
+// CreateOrganization creates an organization owned by userID together with
+// its first workspace
+func (s *WorkspaceService) CreateOrganization(ctx context.Context, userID uint, name, workspaceName string) (*models.Organization, *models.Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, nil, ErrNameRequired
+	}
+	if workspaceName = strings.TrimSpace(workspaceName); workspaceName == "" {
+		workspaceName = "General"
+	}
+
+	org := &models.Organization{Name: name, CreatedBy: userID}
+	workspace := &models.Workspace{Name: workspaceName, CreatedBy: userID}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return fmt.Errorf("failed to create organization: %w", err)
+		}
+		member := models.OrganizationMember{OrganizationID: org.ID, UserID: userID, Role: OrganizationOwner}
+		if err := tx.Create(&member).Error; err != nil {
+			return fmt.Errorf("failed to add organization owner: %w", err)
+		}
+		workspace.OrganizationID = org.ID
+		if err := tx.Create(workspace).Error; err != nil {
+			return fmt.Errorf("failed to create workspace: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	org.Role = OrganizationOwner
+	workspace.Role = WorkspaceAdmin
+	return org, workspace, nil
+}
+
+// ListOrganizations returns the organizations userID belongs to
+func (s *WorkspaceService) ListOrganizations(ctx context.Context, userID uint) ([]models.Organization, error) {
+	var rows []struct {
+		models.Organization
+		MemberRole string
+	}
+	if err := s.db.WithContext(ctx).
+		Model(&models.Organization{}).
+		Select("organizations.*, organization_members.role AS member_role").
+		Joins("JOIN organization_members ON organization_members.organization_id = organizations.id").
+		Where("organization_members.user_id = ?", userID).
+		Order("organizations.id").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	orgs := make([]models.Organization, len(rows))
+	for i, row := range rows {
+		orgs[i] = row.Organization
+		orgs[i].Role = row.MemberRole
+	}
+	return orgs, nil
+}
+
+// ListOrganizationMembers returns the members of an organization userID belongs to
+func (s *WorkspaceService) ListOrganizationMembers(ctx context.Context, organizationID, userID uint) ([]models.OrganizationMember, error) {
+	if _, err := organizationRole(ctx, s.db, organizationID, userID); err != nil {
+		return nil, err
+	}
+	var members []models.OrganizationMember
+	if err := s.db.WithContext(ctx).
+		Preload("User").
+		Where("organization_id = ?", organizationID).
+		Order("id").
+		Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to list organization members: %w", err)
+	}
+	return members, nil
+}
+
+// SetOrganizationMember changes the role of an organization member. Owners
+// and admins manage members; only owners grant or change the owner role.
+// New members join through InviteOrganizationMember.
+func (s *WorkspaceService) SetOrganizationMember(ctx context.Context, organizationID, actorID, targetUserID uint, role string) (*models.OrganizationMember, error) {
+	if role != OrganizationOwner && role != OrganizationAdmin && role != OrganizationMember {
+		return nil, ErrInvalidRole
+	}
+	actorRole, err := s.requireOrganizationAdmin(ctx, organizationID, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	var member models.OrganizationMember
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Preload("User").
+			Where("organization_id = ? AND user_id = ?", organizationID, targetUserID).
+			First(&member).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrMemberNotFound
+			}
+			return fmt.Errorf("failed to load organization member: %w", err)
+		}
+		if actorRole != OrganizationOwner && (role == OrganizationOwner || member.Role == OrganizationOwner) {
+			return ErrPermissionDenied
+		}
+		if member.Role == OrganizationOwner && role != OrganizationOwner {
+			if err := requireAnotherOwner(tx, organizationID, targetUserID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&member).Update("role", role).Error; err != nil {
+			return fmt.Errorf("failed to save organization member: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// InviteOrganizationMember invites a user to join an organization with a
+// role, replacing any pending invitation of theirs. The same owners and
+// admins who manage members may invite; only owners invite owners.
+func (s *WorkspaceService) InviteOrganizationMember(ctx context.Context, organizationID, actorID, targetUserID uint, role string) (*models.OrganizationInvitation, error) {
+	if role != OrganizationOwner && role != OrganizationAdmin && role != OrganizationMember {
+		return nil, ErrInvalidRole
+	}
+	actorRole, err := s.requireOrganizationAdmin(ctx, organizationID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if role == OrganizationOwner && actorRole != OrganizationOwner {
+		return nil, ErrPermissionDenied
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, targetUserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMemberNotFound
+		}
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if _, err := organizationRole(ctx, s.db, organizationID, targetUserID); err == nil {
+		return nil, ErrAlreadyMember
+	} else if !errors.Is(err, ErrOrganizationNotFound) {
+		return nil, err
+	}
+
+	invitation := models.OrganizationInvitation{OrganizationID: organizationID, UserID: targetUserID}
+	if err := s.db.WithContext(ctx).
+		Where(&invitation).
+		Assign(models.OrganizationInvitation{Role: role, InvitedBy: actorID}).
+		FirstOrCreate(&invitation).Error; err != nil {
+		return nil, fmt.Errorf("failed to save invitation: %w", err)
+	}
+	invitation.User = user
+	return &invitation, nil
+}
+
+// ListOrganizationInvitations returns the pending invitations of an
+// organization to its owners and admins
+func (s *WorkspaceService) ListOrganizationInvitations(ctx context.Context, organizationID, actorID uint) ([]models.OrganizationInvitation, error) {
+	if _, err := s.requireOrganizationAdmin(ctx, organizationID, actorID); err != nil {
+		return nil, err
+	}
+	var invitations []models.OrganizationInvitation
+	if err := s.db.WithContext(ctx).
+		Preload("User").
+		Where("organization_id = ?", organizationID).
+		Order("id").
+		Find(&invitations).Error; err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// RevokeOrganizationInvitation withdraws a pending invitation
+func (s *WorkspaceService) RevokeOrganizationInvitation(ctx context.Context, organizationID, actorID, invitationID uint) error {
+	if _, err := s.requireOrganizationAdmin(ctx, organizationID, actorID); err != nil {
+		return err
+	}
+	result := s.db.WithContext(ctx).
+		Where("id = ? AND organization_id = ?", invitationID, organizationID).
+		Delete(&models.OrganizationInvitation{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// ListInvitations returns the invitations addressed to userID
+func (s *WorkspaceService) ListInvitations(ctx context.Context, userID uint) ([]models.OrganizationInvitation, error) {
+	var invitations []models.OrganizationInvitation
+	if err := s.db.WithContext(ctx).
+		Preload("Organization").
+		Joins("JOIN organizations ON organizations.id = organization_invitations.organization_id AND organizations.deleted_at IS NULL").
+		Where("organization_invitations.user_id = ?", userID).
+		Order("organization_invitations.id").
+		Find(&invitations).Error; err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// AcceptInvitation makes userID a member with the invited role. An
+// invitation whose sender has since lost the right to send it is void.
+func (s *WorkspaceService) AcceptInvitation(ctx context.Context, userID, invitationID uint) (*models.OrganizationMember, error) {
+	var member models.OrganizationMember
+	void := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var invitation models.OrganizationInvitation
+		if err := tx.Where("id = ? AND user_id = ?", invitationID, userID).First(&invitation).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvitationNotFound
+			}
+			return fmt.Errorf("failed to load invitation: %w", err)
+		}
+		if err := tx.Delete(&invitation).Error; err != nil {
+			return fmt.Errorf("failed to delete invitation: %w", err)
+		}
+
+		inviterRole, err := organizationRole(ctx, tx, invitation.OrganizationID, invitation.InvitedBy)
+		if err != nil && !errors.Is(err, ErrOrganizationNotFound) {
+			return err
+		}
+		void = inviterRole != OrganizationOwner &&
+			(inviterRole != OrganizationAdmin || invitation.Role == OrganizationOwner)
+		if void {
+			// Commit the deletion only
+			return nil
+		}
+
+		member = models.OrganizationMember{OrganizationID: invitation.OrganizationID, UserID: userID}
+		// An existing membership keeps its role
+		if err := tx.Where(&member).Attrs(models.OrganizationMember{Role: invitation.Role}).FirstOrCreate(&member).Error; err != nil {
+			return fmt.Errorf("failed to save organization member: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if void {
+		return nil, ErrInvitationNotFound
+	}
+	return &member, nil
+}
+
+// DeclineInvitation deletes an invitation addressed to userID
+func (s *WorkspaceService) DeclineInvitation(ctx context.Context, userID, invitationID uint) error {
+	result := s.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", invitationID, userID).
+		Delete(&models.OrganizationInvitation{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to decline invitation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// RemoveOrganizationMember removes a user from an organization and all of
+// its workspaces. Owners and admins may remove others; anyone may leave.
+func (s *WorkspaceService) RemoveOrganizationMember(ctx context.Context, organizationID, actorID, targetUserID uint) error {
+	actorRole, err := organizationRole(ctx, s.db, organizationID, actorID)
+	if err != nil {
+		return err
+	}
+	if actorID != targetUserID && actorRole != OrganizationOwner && actorRole != OrganizationAdmin {
+		return ErrPermissionDenied
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var member models.OrganizationMember
+		if err := tx.Where("organization_id = ? AND user_id = ?", organizationID, targetUserID).First(&member).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrMemberNotFound
+			}
+			return fmt.Errorf("failed to load organization member: %w", err)
+		}
+		if member.Role == OrganizationOwner {
+			if actorID != targetUserID && actorRole != OrganizationOwner {
+				return ErrPermissionDenied
+			}
+			if err := requireAnotherOwner(tx, organizationID, targetUserID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&member).Error; err != nil {
+			return fmt.Errorf("failed to remove organization member: %w", err)
+		}
+		var workspaceIDs []uint
+		if err := tx.Unscoped().Model(&models.Workspace{}).
+			Where("organization_id = ?", organizationID).
+			Pluck("id", &workspaceIDs).Error; err != nil {
+			return fmt.Errorf("failed to load workspaces: %w", err)
+		}
+		if err := tx.Where("user_id = ? AND workspace_id IN ?", targetUserID, workspaceIDs).
+			Delete(&models.WorkspaceMember{}).Error; err != nil {
+			return fmt.Errorf("failed to remove workspace memberships: %w", err)
+		}
+		var groupIDs []uint
+		if err := tx.Unscoped().Model(&models.UserGroup{}).
+			Where("organization_id = ?", organizationID).
+			Pluck("id", &groupIDs).Error; err != nil {
+			return fmt.Errorf("failed to load groups: %w", err)
+		}
+		if err := tx.Where("user_id = ? AND group_id IN ?", targetUserID, groupIDs).
+			Delete(&models.UserGroupMember{}).Error; err != nil {
+			return fmt.Errorf("failed to remove group memberships: %w", err)
+		}
+		return nil
+	})
+}
+
+func requireAnotherOwner(tx *gorm.DB, organizationID, userID uint) error {
+	var owners int64
+	if err := tx.Model(&models.OrganizationMember{}).
+		Where("organization_id = ? AND role = ? AND user_id <> ?", organizationID, OrganizationOwner, userID).
+		Count(&owners).Error; err != nil {
+		return fmt.Errorf("failed to count organization owners: %w", err)
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// CreateWorkspace adds a workspace to an organization; only organization
+// owners and admins may
+func (s *WorkspaceService) CreateWorkspace(ctx context.Context, organizationID, actorID uint, name string) (*models.Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrNameRequired
+	}
+	if _, err := s.requireOrganizationAdmin(ctx, organizationID, actorID); err != nil {
+		return nil, err
+	}
+	workspace := &models.Workspace{OrganizationID: organizationID, Name: name, CreatedBy: actorID}
+	if err := s.db.WithContext(ctx).Create(workspace).Error; err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	workspace.Role = WorkspaceAdmin
+	return workspace, nil
+}
+
+// ListWorkspaces returns the workspaces userID can act in, oldest first,
+// with the user's role in each
+func (s *WorkspaceService) ListWorkspaces(ctx context.Context, userID uint) ([]models.Workspace, error) {
+	var orgMembers []models.OrganizationMember
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ? AND role IN ?", userID, []string{OrganizationOwner, OrganizationAdmin}).
+		Find(&orgMembers).Error; err != nil {
+		return nil, fmt.Errorf("failed to load organization memberships: %w", err)
+	}
+	var wsMembers []models.WorkspaceMember
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Find(&wsMembers).Error; err != nil {
+		return nil, fmt.Errorf("failed to load workspace memberships: %w", err)
+	}
+
+	administered := make([]uint, 0, len(orgMembers))
+	for _, m := range orgMembers {
+		administered = append(administered, m.OrganizationID)
+	}
+	roles := make(map[uint]string, len(wsMembers))
+	joined := make([]uint, 0, len(wsMembers))
+	for _, m := range wsMembers {
+		roles[m.WorkspaceID] = m.Role
+		joined = append(joined, m.WorkspaceID)
+	}
+	if len(administered) == 0 && len(joined) == 0 {
+		return nil, nil
+	}
+
+	var workspaces []models.Workspace
+	if err := s.db.WithContext(ctx).
+		Where("id IN ? OR organization_id IN ?", joined, administered).
+		Where("organization_id IN (?)", s.db.Model(&models.Organization{}).Select("id")).
+		Order("id").
+		Find(&workspaces).Error; err != nil {
+		return nil, fmt.Errorf("failed to list workspaces: %w", err)
+	}
+
+	admin := make(map[uint]bool, len(administered))
+	for _, id := range administered {
+		admin[id] = true
+	}
+	for i := range workspaces {
+		if admin[workspaces[i].OrganizationID] {
+			workspaces[i].Role = WorkspaceAdmin
+		} else {
+			workspaces[i].Role = roles[workspaces[i].ID]
+		}
+	}
+	return workspaces, nil
+}
+
+// GetWorkspace returns a workspace userID can access, with their role
+func (s *WorkspaceService) GetWorkspace(ctx context.Context, workspaceID, userID uint) (*models.Workspace, error) {
+	role, err := workspaceRole(ctx, s.db, workspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	var workspace models.Workspace
+	if err := s.db.WithContext(ctx).First(&workspace, workspaceID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load workspace: %w", err)
+	}
+	workspace.Role = role
+	return &workspace, nil
+}
+
+// RenameWorkspace changes a workspace's name; workspace admins only
+func (s *WorkspaceService) RenameWorkspace(ctx context.Context, workspaceID, actorID uint, name string) (*models.Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrNameRequired
+	}
+	workspace, err := s.GetWorkspace(ctx, workspaceID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if workspace.Role != WorkspaceAdmin {
+		return nil, ErrPermissionDenied
+	}
+	if err := s.db.WithContext(ctx).Model(workspace).Update("name", name).Error; err != nil {
+		return nil, fmt.Errorf("failed to rename workspace: %w", err)
+	}
+	return workspace, nil
+}
+
+// DeleteWorkspace removes a workspace and its memberships; only owners and
+// admins of its organization may. Its records stay in the database but are
+// no longer reachable.
+func (s *WorkspaceService) DeleteWorkspace(ctx context.Context, workspaceID, actorID uint) error {
+	var workspace models.Workspace
+	if err := s.db.WithContext(ctx).First(&workspace, workspaceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrWorkspaceNotFound
+		}
+		return fmt.Errorf("failed to load workspace: %w", err)
+	}
+	if _, err := s.requireOrganizationAdmin(ctx, workspace.OrganizationID, actorID); err != nil {
+		if errors.Is(err, ErrOrganizationNotFound) {
+			return ErrWorkspaceNotFound
+		}
+		return err
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&workspace).Error; err != nil {
+			return fmt.Errorf("failed to delete workspace: %w", err)
+		}
+		if err := tx.Where("workspace_id = ?", workspaceID).Delete(&models.WorkspaceMember{}).Error; err != nil {
+			return fmt.Errorf("failed to delete workspace members: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListWorkspaceMembers returns the explicit members of a workspace
+func (s *WorkspaceService) ListWorkspaceMembers(ctx context.Context, workspaceID, userID uint) ([]models.WorkspaceMember, error) {
+	if _, err := workspaceRole(ctx, s.db, workspaceID, userID); err != nil {
+		return nil, err
+	}
+	var members []models.WorkspaceMember
+	if err := s.db.WithContext(ctx).
+		Preload("User").
+		Where("workspace_id = ?", workspaceID).
+		Order("id").
+		Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to list workspace members: %w", err)
+	}
+	return members, nil
+}
+
+// SetWorkspaceMember adds a member of the workspace's organization to the
+// workspace or changes their role; workspace admins only
+func (s *WorkspaceService) SetWorkspaceMember(ctx context.Context, workspaceID, actorID, targetUserID uint, role string) (*models.WorkspaceMember, error) {
+	if role != WorkspaceAdmin && role != WorkspaceEditor && role != WorkspaceViewer {
+		return nil, ErrInvalidRole
+	}
+	workspace, err := s.GetWorkspace(ctx, workspaceID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if workspace.Role != WorkspaceAdmin {
+		return nil, ErrPermissionDenied
+	}
+	if _, err := organizationRole(ctx, s.db, workspace.OrganizationID, targetUserID); err != nil {
+		if errors.Is(err, ErrOrganizationNotFound) {
+			return nil, ErrNotOrganizationMember
+		}
+		return nil, err
+	}
+
+	member := models.WorkspaceMember{WorkspaceID: workspaceID, UserID: targetUserID}
+	if err := s.db.WithContext(ctx).
+		Where(&member).
+		Assign(models.WorkspaceMember{Role: role}).
+		FirstOrCreate(&member).Error; err != nil {
+		return nil, fmt.Errorf("failed to save workspace member: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Preload("User").First(&member, member.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load workspace member: %w", err)
+	}
+	return &member, nil
+}
+
+// RemoveWorkspaceMember revokes a user's membership. Admins may remove
+// anyone; other members may only remove themselves.
+func (s *WorkspaceService) RemoveWorkspaceMember(ctx context.Context, workspaceID, actorID, targetUserID uint) error {
+	role, err := workspaceRole(ctx, s.db, workspaceID, actorID)
+	if err != nil {
+		return err
+	}
+	if actorID != targetUserID && role != WorkspaceAdmin {
+		return ErrPermissionDenied
+	}
+
+	result := s.db.WithContext(ctx).
+		Where("workspace_id = ? AND user_id = ?", workspaceID, targetUserID).
+		Delete(&models.WorkspaceMember{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove workspace member: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of RFC 6238 appendix B, "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfcVectors are the SHA-1 test values of RFC 6238 appendix B, cut to the
+// last six of their eight digits
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		code, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", v.unix, err)
+		}
+		if code != v.code {
+			t.Errorf("Code at %d = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidateRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		at := time.Unix(v.unix, 0)
+		step, ok := Validate(rfcSecret, v.code, at, 1)
+		if !ok || step != Step(at) {
+			t.Errorf("Validate(%s) at %d = %d, %v; want step %d", v.code, v.unix, step, ok, Step(at))
+		}
+		// One step of drift either way is accepted, two are not
+		if _, ok := Validate(rfcSecret, v.code, at.Add(Period), 1); !ok {
+			t.Errorf("Validate(%s) one step late was refused", v.code)
+		}
+		if _, ok := Validate(rfcSecret, v.code, at.Add(-Period), 1); !ok {
+			t.Errorf("Validate(%s) one step early was refused", v.code)
+		}
+		if _, ok := Validate(rfcSecret, v.code, at.Add(2*Period), 1); ok {
+			t.Errorf("Validate(%s) two steps late was accepted", v.code)
+		}
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	at := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, at, 1); ok {
+			t.Errorf("Validate(%q) was accepted", code)
+		}
+	}
+	// Spaces, as some apps show them, are ignored
+	if _, ok := Validate(rfcSecret, " 287 082 ", at, 1); !ok {
+		t.Error("Validate with spaces was refused")
+	}
+	if _, ok := Validate("not base32!", "287082", at, 1); ok {
+		t.Error("Validate with an invalid secret was accepted")
+	}
+}
@@ -0,0 +1,149 @@
+// Package vectordb is a small client for the Qdrant REST API
+package vectordb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrCollectionNotFound is returned when a collection does not exist
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// Point is a vector with its payload
+type Point struct {
+	ID      uint64                 `json:"id"`
+	Vector  []float32              `json:"vector"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+// ScoredPoint is a search hit
+type ScoredPoint struct {
+	ID      uint64                 `json:"id"`
+	Score   float64                `json:"score"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// Filter is a Qdrant filter; conditions use the REST API's JSON shape,
+// e.g. {"key": "document_type", "match": {"value": "pdf"}}
+type Filter struct {
+	Must    []map[string]interface{} `json:"must,omitempty"`
+	Should  []map[string]interface{} `json:"should,omitempty"`
+	MustNot []map[string]interface{} `json:"must_not,omitempty"`
+}
+
+// Client talks to a Qdrant server
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// EnsureCollection creates a cosine-distance collection of the given
+// dimension unless it already exists
+func (c *Client) EnsureCollection(ctx context.Context, name string, dimension int) error {
+	err := c.do(ctx, http.MethodGet, "/collections/"+name, nil, nil)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrCollectionNotFound) {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"vectors": map[string]interface{}{"size": dimension, "distance": "Cosine"},
+	}
+	return c.do(ctx, http.MethodPut, "/collections/"+name, body, nil)
+}
+
+// Upsert inserts or replaces points and waits until they are searchable
+func (c *Client) Upsert(ctx context.Context, collection string, points []Point) error {
+	return c.do(ctx, http.MethodPut, "/collections/"+collection+"/points?wait=true", map[string]interface{}{"points": points}, nil)
+}
+
+// Delete removes points by ID
+func (c *Client) Delete(ctx context.Context, collection string, ids []uint64) error {
+	return c.do(ctx, http.MethodPost, "/collections/"+collection+"/points/delete?wait=true", map[string]interface{}{"points": ids}, nil)
+}
+
+// DeleteByFilter removes every point matching filter
+func (c *Client) DeleteByFilter(ctx context.Context, collection string, filter Filter) error {
+	err := c.do(ctx, http.MethodPost, "/collections/"+collection+"/points/delete?wait=true", map[string]interface{}{"filter": filter}, nil)
+	if errors.Is(err, ErrCollectionNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Search returns the limit points closest to vector that match filter
+func (c *Client) Search(ctx context.Context, collection string, vector []float32, limit int, filter *Filter) ([]ScoredPoint, error) {
+	body := map[string]interface{}{
+		"vector":       vector,
+		"limit":        limit,
+		"with_payload": true,
+	}
+	if filter != nil {
+		body["filter"] = filter
+	}
+
+	var resp struct {
+		Result []ScoredPoint `json:"result"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/collections/"+collection+"/points/search", body, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Result, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach vector database: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrCollectionNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("vector database returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode vector database response: %w", err)
+	}
+	return nil
+}